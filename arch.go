@@ -0,0 +1,212 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// leadArchNums are the architecture numbers of the lead, from the arch_canon
+// entries of rpmrc.
+// https://github.com/rpm-software-management/rpm/blob/master/rpmrc.in
+var leadArchNums = map[string]uint16{
+	"i386":        1,
+	"i486":        1,
+	"i586":        1,
+	"i686":        1,
+	"athlon":      1,
+	"geode":       1,
+	"pentium3":    1,
+	"pentium4":    1,
+	"x86_64":      1,
+	"amd64":       1,
+	"ia32e":       1,
+	"em64t":       1,
+	"alpha":       2,
+	"sparc64":     2,
+	"sparc":       3,
+	"sparcv9":     3,
+	"mips":        4,
+	"mipsel":      4,
+	"ppc":         5,
+	"m68k":        6,
+	"ia64":        9,
+	"mips64":      11,
+	"mips64el":    11,
+	"armv5tel":    12,
+	"armv6l":      12,
+	"armv6hl":     12,
+	"armv7l":      12,
+	"armv7hl":     12,
+	"s390":        14,
+	"s390x":       15,
+	"ppc64":       16,
+	"ppc64le":     16,
+	"sh4":         17,
+	"xtensa":      18,
+	"aarch64":     19,
+	"riscv64":     22,
+	"loongarch64": 23,
+}
+
+// leadArchNum returns the lead architecture number of arch.
+// noarch has none, rpm writes the number of the build host. Like for unknown
+// architectures, the number of i386 is used. rpm ignores it when reading.
+func leadArchNum(arch string) uint16 {
+	if n, ok := leadArchNums[arch]; ok {
+		return n
+	}
+	return 1
+}
+
+// isaNames are the instruction set architectures of the arches, the
+// %{_isa} of rpm without the parentheses, from its platform macros.
+var isaNames = map[string]string{
+	"i386":        "x86-32",
+	"i486":        "x86-32",
+	"i586":        "x86-32",
+	"i686":        "x86-32",
+	"athlon":      "x86-32",
+	"geode":       "x86-32",
+	"pentium3":    "x86-32",
+	"pentium4":    "x86-32",
+	"x86_64":      "x86-64",
+	"amd64":       "x86-64",
+	"ia32e":       "x86-64",
+	"em64t":       "x86-64",
+	"alpha":       "alpha-64",
+	"sparc64":     "sparc-64",
+	"sparc":       "sparc-32",
+	"sparcv9":     "sparc-32",
+	"mips":        "mips-32",
+	"mipsel":      "mips-32",
+	"ppc":         "ppc-32",
+	"ia64":        "ia-64",
+	"mips64":      "mips-64",
+	"mips64el":    "mips-64",
+	"armv5tel":    "arm-32",
+	"armv6l":      "arm-32",
+	"armv6hl":     "arm-32",
+	"armv7l":      "arm-32",
+	"armv7hl":     "arm-32",
+	"s390":        "s390-32",
+	"s390x":       "s390-64",
+	"ppc64":       "ppc-64",
+	"ppc64le":     "ppc-64",
+	"aarch64":     "aarch-64",
+	"riscv64":     "riscv-64",
+	"loongarch64": "loongarch-64",
+}
+
+// isaName returns the ISA of arch, like "x86-64" for x86_64, or "" for noarch
+// and the arches rpm has no ISA for.
+func isaName(arch string) string {
+	return isaNames[arch]
+}
+
+// goArchs are the rpm architectures of GOARCH values, other than arm.
+var goArchs = map[string]string{
+	"386":      "i386",
+	"amd64":    "x86_64",
+	"arm64":    "aarch64",
+	"loong64":  "loongarch64",
+	"mips":     "mips",
+	"mipsle":   "mipsel",
+	"mips64":   "mips64",
+	"mips64le": "mips64el",
+	"ppc64":    "ppc64",
+	"ppc64le":  "ppc64le",
+	"riscv64":  "riscv64",
+	"s390x":    "s390x",
+}
+
+// goArms are the rpm architectures of GOARM values.
+var goArms = map[string]string{
+	"5": "armv5tel",
+	"6": "armv6hl",
+	"7": "armv7hl",
+}
+
+// GoArch returns the rpm architecture for a GOARCH value, for example x86_64
+// for amd64, to be used as the Arch of RPMMetaData.
+// goarm is the GOARM value and is only used for arm. An empty goarm is 7,
+// the default of the go tool when cross compiling.
+func GoArch(goarch, goarm string) (string, error) {
+	if goarch != "arm" {
+		if a, ok := goArchs[goarch]; ok {
+			return a, nil
+		}
+		return "", errors.Errorf("unsupported GOARCH %q", goarch)
+	}
+	// GOARM may have a floating point suffix, like 7,softfloat.
+	v := strings.SplitN(goarm, ",", 2)[0]
+	if v == "" {
+		v = "7"
+	}
+	if a, ok := goArms[v]; ok {
+		return a, nil
+	}
+	return "", errors.Errorf("unsupported GOARM %q", goarm)
+}
+
+// leadOSNums are the operating system numbers of the lead, from the os_canon
+// entries of rpmrc, by the lower case name used in the OS tag.
+var leadOSNums = map[string]uint16{
+	"linux":    1,
+	"irix":     2,
+	"solaris":  3,
+	"sunos":    4,
+	"aix":      5,
+	"hpux":     6,
+	"osf1":     7,
+	"freebsd":  8,
+	"irix64":   10,
+	"cygwin32": 14,
+	"darwin":   21,
+	"macosx":   21,
+}
+
+// leadOSNum returns the lead operating system number of the OS os.
+// Like for unknown architectures, the number of linux is used for unknown
+// operating systems.
+func leadOSNum(os string) uint16 {
+	if n, ok := leadOSNums[strings.ToLower(os)]; ok {
+		return n
+	}
+	return 1
+}
+
+// goOSs are the rpm operating systems of GOOS values.
+var goOSs = map[string]string{
+	"aix":     "aix",
+	"darwin":  "darwin",
+	"freebsd": "freebsd",
+	"illumos": "solaris",
+	"linux":   "linux",
+	"netbsd":  "netbsd",
+	"openbsd": "openbsd",
+	"solaris": "solaris",
+}
+
+// GoOS returns the rpm operating system for a GOOS value, for example
+// solaris for illumos, to be used as the OS of RPMMetaData.
+func GoOS(goos string) (string, error) {
+	if o, ok := goOSs[goos]; ok {
+		return o, nil
+	}
+	return "", errors.Errorf("unsupported GOOS %q", goos)
+}
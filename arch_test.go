@@ -0,0 +1,71 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import "testing"
+
+func TestGoArch(t *testing.T) {
+	testCases := []struct {
+		goarch, goarm string
+		want          string
+		wantErr       bool
+	}{
+		{goarch: "amd64", want: "x86_64"},
+		{goarch: "386", want: "i386"},
+		{goarch: "arm64", want: "aarch64"},
+		{goarch: "ppc64le", want: "ppc64le"},
+		{goarch: "s390x", want: "s390x"},
+		{goarch: "riscv64", want: "riscv64"},
+		{goarch: "mips64le", want: "mips64el"},
+		{goarch: "arm", want: "armv7hl"},
+		{goarch: "arm", goarm: "6", want: "armv6hl"},
+		{goarch: "arm", goarm: "7,softfloat", want: "armv7hl"},
+		{goarch: "arm", goarm: "4", wantErr: true},
+		{goarch: "wasm", wantErr: true},
+	}
+	for _, tc := range testCases {
+		got, err := GoArch(tc.goarch, tc.goarm)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("GoArch(%q, %q) returned error %v, want error: %v", tc.goarch, tc.goarm, err, tc.wantErr)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("GoArch(%q, %q) = %q, want %q", tc.goarch, tc.goarm, got, tc.want)
+		}
+	}
+}
+
+func TestGoOS(t *testing.T) {
+	testCases := []struct {
+		goos    string
+		want    string
+		wantErr bool
+	}{
+		{goos: "linux", want: "linux"},
+		{goos: "aix", want: "aix"},
+		{goos: "illumos", want: "solaris"},
+		{goos: "windows", wantErr: true},
+	}
+	for _, tc := range testCases {
+		got, err := GoOS(tc.goos)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("GoOS(%q) returned error %v, want error: %v", tc.goos, err, tc.wantErr)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("GoOS(%q) = %q, want %q", tc.goos, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// readerAt returns the content of the entry for random access.
+func (e archiveEntry) readerAt() (io.ReaderAt, error) {
+	if e.file.Reader == nil {
+		return bytes.NewReader(e.file.Body), nil
+	}
+	if ra, ok := e.file.Reader.(io.ReaderAt); ok {
+		return io.NewSectionReader(ra, e.offset, e.size()), nil
+	}
+	c, err := e.content()
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(c, e.size()))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the file content")
+	}
+	return bytes.NewReader(b), nil
+}
+
+// scriptInterpreter returns the interpreter of the shebang line of a script,
+// like "/bin/bash" for "#!/bin/bash -e", or "" if there is none. As with
+// rpmbuild, "#!/usr/bin/env python3" requires "/usr/bin/env".
+func scriptInterpreter(ra io.ReaderAt, size int64) (string, error) {
+	// Longer lines are not shebangs the kernel would run.
+	const maxLine = 4096
+	if size > maxLine {
+		size = maxLine
+	}
+	line, err := bufio.NewReader(io.NewSectionReader(ra, 0, size)).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", errors.Wrap(err, "failed to read the first line")
+	}
+	if !strings.HasPrefix(line, "#!") {
+		return "", nil
+	}
+	fields := strings.Fields(line[2:])
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return "", nil
+	}
+	return fields[0], nil
+}
+
+// addAutoDeps scans the executable regular files of the payload, like
+// rpmbuild, and adds the dependencies they have to the relations.
+func (r *RPM) addAutoDeps() error {
+	var excludes []*regexp.Regexp
+	for _, p := range r.AutoRequiresExclude {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return errors.Wrapf(err, "invalid AutoRequiresExclude pattern %q", p)
+		}
+		excludes = append(excludes, re)
+	}
+	require := func(name string) {
+		for _, re := range excludes {
+			if re.MatchString(name) {
+				return
+			}
+		}
+		r.Requires.addGenerated(name, "", SenseFindRequires)
+	}
+	for _, e := range r.archive {
+		f := e.file
+		if f.Mode&0170000 != 0100000 || f.Mode&0111 == 0 || f.Type&GhostFile != 0 {
+			continue
+		}
+		ra, err := e.readerAt()
+		if err != nil {
+			return errors.Wrapf(err, "failed to read file %q", f.Name)
+		}
+		d, err := readELFDeps(f.Name, ra)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read the ELF dependencies of %q", f.Name)
+		}
+		if r.AutoProvides {
+			for _, p := range d.provides {
+				r.Provides.addGenerated(p, "", SenseFindProvides)
+			}
+		}
+		if !r.AutoRequires {
+			continue
+		}
+		for _, req := range d.requires {
+			require(req)
+		}
+		interp, err := scriptInterpreter(ra, e.size())
+		if err != nil {
+			return errors.Wrapf(err, "failed to read the interpreter of %q", f.Name)
+		}
+		if interp != "" {
+			require(interp)
+		}
+	}
+	return nil
+}
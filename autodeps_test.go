@@ -0,0 +1,126 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"debug/elf"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestScriptInterpreter(t *testing.T) {
+	testCases := []struct {
+		body string
+		want string
+	}{
+		{body: "#!/bin/sh\necho hi\n", want: "/bin/sh"},
+		{body: "#! /bin/bash -e\n", want: "/bin/bash"},
+		{body: "#!/usr/bin/env python3", want: "/usr/bin/env"},
+		{body: "#!\n"},
+		{body: "#!bash\n"},
+		{body: "echo hi\n"},
+		{body: ""},
+	}
+	for _, tc := range testCases {
+		got, err := scriptInterpreter(strings.NewReader(tc.body), int64(len(tc.body)))
+		if err != nil {
+			t.Errorf("scriptInterpreter(%q) returned error %v", tc.body, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("scriptInterpreter(%q) = %q, want %q", tc.body, got, tc.want)
+		}
+	}
+}
+
+func TestAutoRequires(t *testing.T) {
+	bin := testELF{
+		typ:      elf.ET_DYN,
+		pie:      true,
+		needed:   []string{"libfoo.so.1", "libc.so.6"},
+		verneeds: []testVerneed{{file: "libc.so.6", versions: []string{"GLIBC_2.2.5", "GLIBC_2.34"}}},
+	}.bytes(t)
+	testCases := []struct {
+		name     string
+		files    []RPMFile
+		excludes []string
+		want     []string
+	}{{
+		name:  "elf",
+		files: []RPMFile{{Name: "/usr/bin/foo", Mode: 0755, Body: bin}},
+		want:  []string{"libc.so.6(GLIBC_2.2.5)(64bit)", "libc.so.6(GLIBC_2.34)(64bit)", "libfoo.so.1()(64bit)", "libc.so.6()(64bit)"},
+	}, {
+		name:     "excludes",
+		files:    []RPMFile{{Name: "/usr/bin/foo", Mode: 0755, Body: bin}},
+		excludes: []string{`^libfoo\.so`, `GLIBC_2\.2\.5`},
+		want:     []string{"libc.so.6(GLIBC_2.34)(64bit)", "libc.so.6()(64bit)"},
+	}, {
+		name:  "gnu hash",
+		files: []RPMFile{{Name: "/usr/lib64/libfoo.so.1", Mode: 0755, Body: testELF{typ: elf.ET_DYN, soname: "libfoo.so.1", gnuHash: true}.bytes(t)}},
+		want:  []string{"rtld(GNU_HASH)"},
+	}, {
+		name: "scripts",
+		files: []RPMFile{
+			{Name: "/usr/bin/a", Mode: 0755, Body: []byte("#!/bin/bash\n")},
+			{Name: "/usr/bin/b", Mode: 0755, Reader: bytes.NewBufferString("#!/bin/bash\n"), Size: 12},
+			{Name: "/usr/bin/c", Mode: 0755, Body: []byte("#!/usr/bin/perl -w\n")},
+			{Name: "/usr/share/d", Mode: 0644, Body: []byte("#!/usr/bin/python3\n")},
+		},
+		want: []string{"/bin/bash", "/usr/bin/perl"},
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewRPM(RPMMetaData{Name: "test", Version: "1.0", Summary: "summary", AutoRequires: true, AutoRequiresExclude: tc.excludes})
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			for _, f := range tc.files {
+				r.AddFile(f)
+			}
+			if err := r.Write(ioutil.Discard); err != nil {
+				t.Fatalf("Write returned error %v", err)
+			}
+			var got []string
+			for _, p := range r.Requires {
+				if p.Sense&SenseFindRequires != 0 {
+					got = append(got, p.Name)
+				}
+			}
+			if d := cmp.Diff(tc.want, got); d != "" {
+				t.Errorf("unexpected requires (-want, +got): %s", d)
+			}
+			for _, p := range r.Provides {
+				if p.Sense&SenseFindProvides != 0 {
+					t.Errorf("unexpected provide %s without AutoProvides", p.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestAutoRequiresInvalidExclude(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "test", Version: "1.0", Summary: "summary", AutoRequires: true, AutoRequiresExclude: []string{"("}})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	if err := r.Write(ioutil.Discard); err == nil {
+		t.Error("Write accepted an invalid exclude pattern")
+	}
+}
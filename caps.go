@@ -0,0 +1,68 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// checkCaps checks that caps is in the text form of cap_from_text(3): clauses
+// separated by spaces, each a comma separated list of capabilities, or none
+// for all of them, followed by actions like "+ep" or "=i".
+func checkCaps(caps string) error {
+	for _, clause := range strings.Fields(caps) {
+		i := strings.IndexAny(clause, "=+-")
+		if i < 0 {
+			return errors.Errorf("invalid capabilities %q: %q has no action", caps, clause)
+		}
+		if names := clause[:i]; names != "" {
+			for _, n := range strings.Split(names, ",") {
+				if n != "all" && (!strings.HasPrefix(n, "cap_") || len(n) == len("cap_")) {
+					return errors.Errorf("invalid capabilities %q: unknown capability %q", caps, n)
+				}
+			}
+		}
+		for _, c := range clause[i:] {
+			if !strings.ContainsRune("=+-eip", c) {
+				return errors.Errorf("invalid capabilities %q: unknown flag %q in %q", caps, c, clause)
+			}
+		}
+	}
+	return nil
+}
+
+// writeFileCaps records the capabilities of a file, FILECAPS is only written
+// when a file has some.
+func (r *RPM) writeFileCaps(f RPMFile) error {
+	if f.Caps != "" {
+		if t := f.Mode & 0170000; (t != 0 && t != 0100000) || f.Type&GhostFile != 0 {
+			return errors.Errorf("file %s has capabilities, but only regular files can have them", f.Name)
+		}
+		if err := checkCaps(f.Caps); err != nil {
+			return err
+		}
+		r.hasFileCaps = true
+	}
+	r.filecaps = append(r.filecaps, strings.TrimSpace(f.Caps))
+	return nil
+}
+
+func (r *RPM) writeFileCapsIndexes(h *index) {
+	if r.hasFileCaps {
+		h.Add(tagFileCaps, EntryStringSlice(r.filecaps))
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCheckCaps(t *testing.T) {
+	for _, tc := range []struct {
+		caps    string
+		wantErr bool
+	}{
+		{caps: "cap_net_bind_service+ep"},
+		{caps: "cap_net_raw,cap_net_admin=eip"},
+		{caps: "=ep cap_sys_admin-p"},
+		{caps: "all+i"},
+		{caps: "cap_net_raw", wantErr: true},
+		{caps: "net_raw+ep", wantErr: true},
+		{caps: "cap_+ep", wantErr: true},
+		{caps: "cap_net_raw+x", wantErr: true},
+	} {
+		if err := checkCaps(tc.caps); (err != nil) != tc.wantErr {
+			t.Errorf("checkCaps(%q) returned error %v, want error: %v", tc.caps, err, tc.wantErr)
+		}
+	}
+}
+
+func TestFileCaps(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "caps", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/bin/ping", Body: []byte("ping"), Mode: 0755, Caps: "cap_net_raw+ep"})
+	r.AddFile(RPMFile{Name: "/usr/bin/true", Body: []byte("true"), Mode: 0755})
+	b := buildRPM(t, r)
+	h := readHeader(t, b)
+	if got, want := h.getStrings(tagFileCaps), []string{"cap_net_raw+ep", ""}; !cmp.Equal(got, want) {
+		t.Errorf("FILECAPS = %q, want %q", got, want)
+	}
+	if got := h.getStrings(tagRequires); !contains(got, "rpmlib(FileCaps)") {
+		t.Errorf("REQUIRENAME = %q, want rpmlib(FileCaps)", got)
+	}
+	info, err := ReadRPMInfo(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("ReadRPMInfo returned error %v", err)
+	}
+	if got := info.Files[0].Caps; got != "cap_net_raw+ep" {
+		t.Errorf("ReadRPMInfo: Caps = %q, want cap_net_raw+ep", got)
+	}
+
+	r, err = NewRPM(RPMMetaData{Name: "caps", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/bin/true", Body: []byte("true"), Mode: 0755})
+	if _, ok := readHeader(t, buildRPM(t, r)).entries[tagFileCaps]; ok {
+		t.Error("FILECAPS is written without capabilities")
+	}
+
+	r, err = NewRPM(RPMMetaData{Name: "caps", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	d := NewDir("/usr/lib/caps", 0755)
+	d.Caps = "cap_net_raw+ep"
+	r.AddFile(d)
+	if err := r.Write(ioutil.Discard); err == nil {
+		t.Error("Write of a directory with capabilities returned nil error")
+	}
+}
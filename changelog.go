@@ -0,0 +1,67 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"sort"
+	"time"
+)
+
+// ChangelogEntry is a single entry of the package changelog, the equivalent
+// of an entry in the %changelog section of a spec file.
+type ChangelogEntry struct {
+	// Time is the time of the change. rpm only keeps the seconds.
+	Time time.Time
+	// Name is the author of the change, usually "Full Name <email> - version-release".
+	Name string
+	// Text is the description of the change.
+	Text string
+}
+
+// AddChangelog adds an entry to the changelog.
+// Entries are written newest first. Entries with the same timestamp (rpmbuild
+// only keeps the day) are kept in the order they were added, so the output is
+// reproducible.
+func (r *RPM) AddChangelog(e ChangelogEntry) {
+	r.changelog = append(r.changelog, e)
+}
+
+// sortedChangelog returns the changelog entries, newest first.
+func (r *RPM) sortedChangelog() []ChangelogEntry {
+	entries := make([]ChangelogEntry, len(r.changelog))
+	copy(entries, r.changelog)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Unix() > entries[j].Time.Unix()
+	})
+	return entries
+}
+
+func (r *RPM) writeChangelogIndexes(h *index) {
+	if len(r.changelog) == 0 {
+		return
+	}
+	entries := r.sortedChangelog()
+	times := make([]uint32, len(entries))
+	names := make([]string, len(entries))
+	texts := make([]string, len(entries))
+	for i, e := range entries {
+		times[i] = uint32(e.Time.Unix())
+		names[i] = e.Name
+		texts[i] = e.Text
+	}
+	h.Add(tagChangelogTime, EntryUint32(times))
+	h.Add(tagChangelogName, EntryStringSlice(names))
+	h.Add(tagChangelogText, EntryStringSlice(texts))
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestChangelogOrder(t *testing.T) {
+	day := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	build := func() []byte {
+		r, err := NewRPM(RPMMetaData{Name: "changelog", Version: "1.1", Summary: "summary"})
+		if err != nil {
+			t.Fatalf("NewRPM returned error %v", err)
+		}
+		r.AddChangelog(ChangelogEntry{Time: day.AddDate(0, 0, -1), Name: "Old", Text: "- earlier"})
+		r.AddChangelog(ChangelogEntry{Time: day, Name: "First", Text: "- first"})
+		r.AddChangelog(ChangelogEntry{Time: day, Name: "Second", Text: "- second"})
+		return buildRPM(t, r)
+	}
+	b := build()
+	if !bytes.Equal(b, build()) {
+		t.Error("building the same changelog twice resulted in different rpms")
+	}
+	h := readHeader(t, b)
+	if d := cmp.Diff([]string{"First", "Second", "Old"}, h.getStrings(tagChangelogName)); d != "" {
+		t.Errorf("changelog names mismatch (-want +got):\n%s", d)
+	}
+	if d := cmp.Diff([]string{"- first", "- second", "- earlier"}, h.getStrings(tagChangelogText)); d != "" {
+		t.Errorf("changelog texts mismatch (-want +got):\n%s", d)
+	}
+	wantTimes := []uint32{uint32(day.Unix()), uint32(day.Unix()), uint32(day.AddDate(0, 0, -1).Unix())}
+	if d := cmp.Diff(wantTimes, h.getUint32s(tagChangelogTime)); d != "" {
+		t.Errorf("changelog times mismatch (-want +got):\n%s", d)
+	}
+}
+
+func TestNoChangelog(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "changelog", Version: "1.1", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	h := readHeader(t, buildRPM(t, r))
+	if _, ok := h.entries[tagChangelogTime]; ok {
+		t.Error("changelog time written without changelog entries")
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// rpmpack builds an rpm from a YAML manifest, see package manifest, for
+// example:
+//
+//	name: hello
+//	version: 1.0.0
+//	summary: says hello
+//	requires: ["bash"]
+//	files:
+//	  - src: build/hello
+//	    dst: /usr/bin/hello
+//	    mode: 0755
+//	  - src: etc/hello.conf
+//	    dst: /etc/hello.conf
+//	    type: noreplace
+//	scripts:
+//	  postin: echo installed
+//	changelog:
+//	  - time: 2020-06-01
+//	    author: Jane Doe <jane@example.com> - 1.0.0-1
+//	    text: "- Initial release"
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/google/rpmpack/manifest"
+)
+
+var outputfile = flag.String("file", "", "write rpm to `FILE` instead of stdout")
+
+func usage() {
+	fmt.Fprintf(os.Stderr,
+		`Usage:
+  %s [OPTION] MANIFEST
+Options:
+`, os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "expecting the manifest as the only positional argument")
+		flag.Usage()
+		os.Exit(2)
+	}
+	m, err := manifest.Read(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rpmpack error: %v\n", err)
+		os.Exit(1)
+	}
+	r, err := m.Build(filepath.Dir(flag.Arg(0)))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rpmpack error: %v\n", err)
+		os.Exit(1)
+	}
+	r.SetWarningHandler(func(m string) { fmt.Fprintf(os.Stderr, "rpmpack warning: %s\n", m) })
+
+	w := os.Stdout
+	if *outputfile != "" {
+		f, err := os.Create(*outputfile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to open file %s for writing: %v\n", *outputfile, err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := r.Write(w); err != nil {
+		fmt.Fprintf(os.Stderr, "rpm write error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -28,6 +28,7 @@ func main() {
 
 	r, err := rpmpack.NewRPM(rpmpack.RPMMetaData{
 		Name:    "rpmsample",
+		Summary: "rpmpack sample package",
 		Version: "0.1",
 		Release: "A",
 		Arch:    "noarch",
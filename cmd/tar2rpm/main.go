@@ -31,6 +31,8 @@ var (
 	obsoletes,
 	suggests,
 	recommends,
+	supplements,
+	enhances,
 	requires,
 	conflicts rpmpack.Relations
 	name        = flag.String("name", "", "the package name")
@@ -39,9 +41,10 @@ var (
 	epoch       = flag.Uint64("epoch", 0, "the rpm epoch")
 	arch        = flag.String("arch", "noarch", "the rpm architecture")
 	buildTime   = flag.Int64("build_time", 0, "the build_time unix timestamp")
-	compressor  = flag.String("compressor", "gzip", "the rpm compressor")
+	buildHost   = flag.String("build_host", "", "the rpm build host")
+	compressor  = flag.String("compressor", "gzip", "the rpm compressor: gzip, lzma, xz, zstd or none, optionally with a level like xz:6")
 	osName      = flag.String("os", "linux", "the rpm os")
-	summary     = flag.String("summary", "", "the rpm summary")
+	summary     = flag.String("summary", "", "the rpm summary, the package name if empty")
 	description = flag.String("description", "", "the rpm description")
 	vendor      = flag.String("vendor", "", "the rpm vendor")
 	packager    = flag.String("packager", "", "the rpm packager")
@@ -49,10 +52,12 @@ var (
 	url         = flag.String("url", "", "the rpm url")
 	licence     = flag.String("licence", "", "the rpm licence name")
 
-	prein  = flag.String("prein", "", "prein scriptlet contents (not filename)")
-	postin = flag.String("postin", "", "postin scriptlet contents (not filename)")
-	preun  = flag.String("preun", "", "preun scriptlet contents (not filename)")
-	postun = flag.String("postun", "", "postun scriptlet contents (not filename)")
+	prein     = flag.String("prein", "", "prein scriptlet contents (not filename)")
+	postin    = flag.String("postin", "", "postin scriptlet contents (not filename)")
+	preun     = flag.String("preun", "", "preun scriptlet contents (not filename)")
+	postun    = flag.String("postun", "", "postun scriptlet contents (not filename)")
+	pretrans  = flag.String("pretrans", "", "pretrans scriptlet contents (not filename)")
+	posttrans = flag.String("posttrans", "", "posttrans scriptlet contents (not filename)")
 
 	outputfile = flag.String("file", "", "write rpm to `FILE` instead of stdout")
 )
@@ -71,6 +76,8 @@ func main() {
 	flag.Var(&obsoletes, "obsoletes", "rpm obsoletes values, can be just name or in the form of name=version (eg. bla=1.2.3)")
 	flag.Var(&suggests, "suggests", "rpm suggests values, can be just name or in the form of name=version (eg. bla=1.2.3)")
 	flag.Var(&recommends, "recommends", "rpm recommends values, can be just name or in the form of name=version (eg. bla=1.2.3)")
+	flag.Var(&supplements, "supplements", "rpm supplements values, can be just name or in the form of name=version (eg. bla=1.2.3)")
+	flag.Var(&enhances, "enhances", "rpm enhances values, can be just name or in the form of name=version (eg. bla=1.2.3)")
 	flag.Var(&requires, "requires", "rpm requires values, can be just name or in the form of name=version (eg. bla=1.2.3)")
 	flag.Var(&conflicts, "conflicts", "rpm provides values, can be just name or in the form of name=version (eg. bla=1.2.3)")
 	flag.Usage = usage
@@ -85,6 +92,9 @@ func main() {
 		flag.Usage()
 		os.Exit(2)
 	}
+	if *summary == "" {
+		*summary = *name
+	}
 	var buildTimeStamp time.Time
 	if *buildTime != 0 {
 		buildTimeStamp = time.Unix(*buildTime, 0)
@@ -125,6 +135,7 @@ func main() {
 			Release:     *release,
 			Epoch:       uint32(*epoch),
 			BuildTime:   buildTimeStamp,
+			BuildHost:   *buildHost,
 			Arch:        *arch,
 			OS:          *osName,
 			Vendor:      *vendor,
@@ -139,6 +150,8 @@ func main() {
 			Obsoletes:   obsoletes,
 			Suggests:    suggests,
 			Recommends:  recommends,
+			Supplements: supplements,
+			Enhances:    enhances,
 			Requires:    requires,
 			Conflicts:   conflicts,
 		})
@@ -146,11 +159,14 @@ func main() {
 	r.AddPostin(*postin)
 	r.AddPreun(*preun)
 	r.AddPostun(*postun)
+	r.AddPretrans(*pretrans)
+	r.AddPosttrans(*posttrans)
 
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "tar2rpm error: %v\n", err)
 		os.Exit(1)
 	}
+	r.SetWarningHandler(func(m string) { fmt.Fprintf(os.Stderr, "tar2rpm warning: %s\n", m) })
 	if err := r.Write(w); err != nil {
 		fmt.Fprintf(os.Stderr, "rpm write error: %v\n", err)
 		os.Exit(1)
@@ -0,0 +1,258 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// Compressor compresses the payload with an implementation provided by the
+// caller, for example a parallel or cgo based one. Set it as
+// RPMMetaData.CustomCompressor.
+type Compressor interface {
+	// NewWriter returns a writer compressing to w. Closing it must flush the
+	// compressed stream, but not close w.
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	// Name is the PAYLOADCOMPRESSOR value rpm uses to pick the decompressor
+	// when installing, like "xz" or "zstd".
+	Name() string
+}
+
+// xzDictCaps are the dictionary sizes of the xz presets 0 to 9, which
+// dominate the tradeoff between size and speed of xz and lzma.
+var xzDictCaps = []int{
+	256 << 10, 1 << 20, 2 << 20, 4 << 20, 4 << 20,
+	8 << 20, 8 << 20, 16 << 20, 32 << 20, 64 << 20,
+}
+
+// newCompressor returns a writer compressing the payload to w, together with
+// the PAYLOADCOMPRESSOR and PAYLOADFLAGS values describing it.
+// setting is a compressor type, optionally followed by a colon and a level,
+// like "xz:6". "none" writes the payload uncompressed, without
+// PAYLOADCOMPRESSOR nor PAYLOADFLAGS. Levels are supported for gzip, 0 to 9
+// with 9 as the default, and for xz and lzma, where the default is preset 6,
+// the dictionary size of the xz library.
+func newCompressor(setting string, w io.Writer) (z io.WriteCloser, name, flags string, err error) {
+	name = setting
+	level := -1
+	if i := strings.Index(setting, ":"); i >= 0 {
+		name = setting[:i]
+		if level, err = strconv.Atoi(setting[i+1:]); err != nil || level < 0 {
+			return nil, "", "", fmt.Errorf("invalid compression level in %s", setting)
+		}
+	}
+	if name == "" {
+		name = "gzip"
+	}
+	// flags is the compression level, as rpm records it.
+	flags = "9"
+	switch name {
+	case "gzip":
+		if level > gzip.BestCompression {
+			return nil, "", "", fmt.Errorf("invalid gzip level %d, want 0 to 9", level)
+		}
+		if level < 0 {
+			level = gzip.BestCompression
+		}
+		flags = strconv.Itoa(level)
+		var gz *gzip.Writer
+		if gz, err = gzip.NewWriterLevel(w, level); err == nil {
+			// No name, modification time nor OS in the gzip header, so that
+			// the payload only depends on its content.
+			gz.Header = gzip.Header{OS: 255}
+			z = gz
+		}
+	case "lzma", "xz":
+		if level >= len(xzDictCaps) {
+			return nil, "", "", fmt.Errorf("invalid %s preset %d, want 0 to 9", name, level)
+		}
+		if level < 0 {
+			level = 6
+		}
+		dictCap := xzDictCaps[level]
+		flags = strconv.Itoa(level)
+		if name == "lzma" {
+			z, err = lzma.WriterConfig{DictCap: dictCap}.NewWriter(w)
+		} else {
+			z, err = xz.WriterConfig{DictCap: dictCap}.NewWriter(w)
+		}
+	case "zstd":
+		if level >= 0 {
+			return nil, "", "", fmt.Errorf("compressor %s has no configurable level", name)
+		}
+		// The level rpm uses by default for zstd payloads, mapped to the closest
+		// level the pure go encoder implements.
+		flags = "19"
+		z, err = zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(19)))
+	case "none":
+		if level >= 0 {
+			return nil, "", "", fmt.Errorf("compressor %s has no configurable level", name)
+		}
+		// rpm reads a payload without PAYLOADCOMPRESSOR through its gzip reader,
+		// which passes uncompressed data through as is.
+		return nopWriteCloser{w}, "", "", nil
+	default:
+		return nil, "", "", fmt.Errorf("unknown compressor type %s", name)
+	}
+	if err != nil {
+		return nil, "", "", errors.Wrap(err, "failed to create compression writer")
+	}
+	return z, name, flags, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// parallelChunkSize is the size of the uncompressed chunks of a parallel
+// compressor. It is fixed, so that the payload is reproducible.
+const parallelChunkSize = 4 << 20
+
+// newParallelCompressor is newCompressor compressing on threads goroutines.
+// Each chunk is a complete gzip member or zstd frame, and their
+// concatenation is a valid stream for the decompressors of rpm. The other
+// formats are not split, as the decompressors of some rpm versions stop after
+// the first xz or lzma stream.
+func newParallelCompressor(setting string, threads int, w io.Writer) (io.WriteCloser, string, string, error) {
+	z, name, flags, err := newCompressor(setting, ioutil.Discard)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if err := z.Close(); err != nil {
+		return nil, "", "", errors.Wrap(err, "failed to close compression writer")
+	}
+	if name != "gzip" && name != "zstd" {
+		return nil, "", "", errors.Errorf("compressor %s cannot use several threads", setting)
+	}
+	p := &parallelWriter{
+		newWriter: func(w io.Writer) (io.WriteCloser, error) {
+			z, _, _, err := newCompressor(setting, w)
+			return z, err
+		},
+		queue: make(chan chan compressedChunk, threads),
+		done:  make(chan error, 1),
+	}
+	go p.writeChunks(w)
+	return p, name, flags, nil
+}
+
+type compressedChunk struct {
+	b   []byte
+	err error
+}
+
+// parallelWriter compresses the chunks as they are filled, and writes them
+// in order. At most threads chunks are compressed at once.
+type parallelWriter struct {
+	newWriter func(io.Writer) (io.WriteCloser, error)
+	buf       []byte
+	chunks    int
+	queue     chan chan compressedChunk
+	done      chan error
+	// closed is set once the queue is closed, err is then the first error
+	// of the chunks.
+	closed bool
+	err    error
+}
+
+func (p *parallelWriter) Write(b []byte) (int, error) {
+	n := len(b)
+	for len(p.buf)+len(b) >= parallelChunkSize {
+		m := parallelChunkSize - len(p.buf)
+		p.compress(append(p.buf, b[:m]...))
+		p.buf, b = nil, b[m:]
+	}
+	p.buf = append(p.buf, b...)
+	return n, nil
+}
+
+// compress compresses chunk on a new goroutine, and queues the result.
+func (p *parallelWriter) compress(chunk []byte) {
+	c := make(chan compressedChunk, 1)
+	p.queue <- c
+	p.chunks++
+	go func() {
+		out := &bytes.Buffer{}
+		z, err := p.newWriter(out)
+		if err == nil {
+			_, err = z.Write(chunk)
+		}
+		if err == nil {
+			err = z.Close()
+		}
+		c <- compressedChunk{out.Bytes(), err}
+	}()
+}
+
+// writeChunks writes the compressed chunks to w in order, and reports the
+// first error once the queue is closed.
+func (p *parallelWriter) writeChunks(w io.Writer) {
+	var err error
+	for c := range p.queue {
+		chunk := <-c
+		if err == nil {
+			err = chunk.err
+		}
+		if err == nil {
+			_, err = w.Write(chunk.b)
+		}
+	}
+	p.done <- err
+}
+
+// abortCompressor stops z without compressing the rest of the payload, when
+// the payload failed, so that a parallel compressor does not leak goroutines.
+// It can be called more than once.
+func abortCompressor(z io.WriteCloser) {
+	if p, ok := z.(*parallelWriter); ok {
+		p.closeQueue()
+	}
+}
+
+// closeQueue closes the queue once, and waits for the compressed chunks to
+// be written.
+func (p *parallelWriter) closeQueue() error {
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+		p.err = <-p.done
+	}
+	return p.err
+}
+
+func (p *parallelWriter) Close() error {
+	if p.closed {
+		return errors.Wrap(p.err, "failed to compress payload")
+	}
+	// An empty payload is still one compressed, empty chunk.
+	if len(p.buf) > 0 || p.chunks == 0 {
+		p.compress(p.buf)
+		p.buf = nil
+	}
+	return errors.Wrap(p.closeQueue(), "failed to compress payload")
+}
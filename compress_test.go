@@ -0,0 +1,191 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestNewCompressor(t *testing.T) {
+	for _, tc := range []struct {
+		setting, name, flags string
+		wantErr              bool
+	}{
+		{setting: "", name: "gzip", flags: "9"},
+		{setting: "gzip", name: "gzip", flags: "9"},
+		{setting: "gzip:0", name: "gzip", flags: "0"},
+		{setting: "gzip:6", name: "gzip", flags: "6"},
+		{setting: "xz", name: "xz", flags: "6"},
+		{setting: "xz:0", name: "xz", flags: "0"},
+		{setting: "xz:6", name: "xz", flags: "6"},
+		{setting: "lzma", name: "lzma", flags: "6"},
+		{setting: "lzma:9", name: "lzma", flags: "9"},
+		{setting: "zstd", name: "zstd", flags: "19"},
+		{setting: "none", name: "", flags: ""},
+		{setting: "none:1", wantErr: true},
+		{setting: "xz:10", wantErr: true},
+		{setting: "xz:-1", wantErr: true},
+		{setting: "xz:fast", wantErr: true},
+		{setting: "gzip:10", wantErr: true},
+		{setting: "bzip2", wantErr: true},
+	} {
+		t.Run(tc.setting, func(t *testing.T) {
+			b := &bytes.Buffer{}
+			z, name, flags, err := newCompressor(tc.setting, b)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("newCompressor(%q) returned no error", tc.setting)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newCompressor(%q) returned error %v", tc.setting, err)
+			}
+			if name != tc.name || flags != tc.flags {
+				t.Errorf("newCompressor(%q) = %q, %q, want %q, %q", tc.setting, name, flags, tc.name, tc.flags)
+			}
+			if _, err := z.Write([]byte("payload")); err != nil {
+				t.Errorf("Write returned error %v", err)
+			}
+			if err := z.Close(); err != nil {
+				t.Errorf("Close returned error %v", err)
+			}
+			if b.Len() == 0 {
+				t.Error("no compressed output")
+			}
+		})
+	}
+}
+
+func TestGzipReproducible(t *testing.T) {
+	build := func() []byte {
+		r, err := NewRPM(RPMMetaData{Name: "gzip", Version: "1.0", Summary: "summary", Compressor: "gzip:6"})
+		if err != nil {
+			t.Fatalf("NewRPM returned error %v", err)
+		}
+		r.AddFile(RPMFile{Name: "/usr/share/gzip/file", Body: []byte("content")})
+		return readPayload(t, buildRPM(t, r))
+	}
+	p := build()
+	if !bytes.Equal(p, build()) {
+		t.Error("two builds of the same rpm have different payloads")
+	}
+	// MTIME is bytes 4 to 8 of the gzip header, OS is byte 9.
+	if !bytes.Equal(p[4:8], make([]byte, 4)) || p[9] != 255 {
+		t.Errorf("gzip header %x has a modification time or an OS", p[:10])
+	}
+}
+
+type zlibCompressor struct{}
+
+func (zlibCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) { return zlib.NewWriter(w), nil }
+func (zlibCompressor) Name() string                                  { return "zlib" }
+
+func TestCustomCompressor(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "custom", Version: "1.0", Summary: "summary", CustomCompressor: zlibCompressor{}})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	b := buildRPM(t, r)
+	h := readHeader(t, b)
+	if got := h.getString(tagPayloadCompressor); got != "zlib" {
+		t.Errorf("payload compressor = %q, want zlib", got)
+	}
+	if _, ok := h.entries[tagPayloadFlags]; ok {
+		t.Error("payload flags written for a custom compressor")
+	}
+	z, err := zlib.NewReader(bytes.NewReader(readPayload(t, b)))
+	if err != nil {
+		t.Fatalf("payload is not zlib compressed: %v", err)
+	}
+	archive := &bytes.Buffer{}
+	if _, err := io.Copy(archive, z); err != nil {
+		t.Fatalf("failed to decompress the payload: %v", err)
+	}
+	if !bytes.Contains(archive.Bytes(), []byte("TRAILER!!!")) {
+		t.Errorf("payload %q has no cpio trailer", archive)
+	}
+}
+
+// changingCompressor writes a different stream each time it is used.
+type changingCompressor struct{ n *int }
+
+func (c changingCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	*c.n++
+	w.Write([]byte{byte(*c.n)})
+	return nopWriteCloser{w}, nil
+}
+func (changingCompressor) Name() string { return "changing" }
+
+func TestNondeterministicCompressor(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "changing", Version: "1.0", Summary: "summary", CustomCompressor: changingCompressor{new(int)}})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	if err := r.Write(&bytes.Buffer{}); err == nil {
+		t.Error("Write with a payload differing between passes returned no error")
+	}
+}
+
+func TestCompressorThreads(t *testing.T) {
+	// Three chunks, the last one short.
+	content := &bytes.Buffer{}
+	for i := 0; content.Len() < 2*parallelChunkSize+1000; i++ {
+		fmt.Fprintf(content, "line %d of %d\n", i, i*i)
+	}
+	build := func(compressor string, threads int) []byte {
+		r, err := NewRPM(RPMMetaData{Name: "threads", Summary: "summary", Compressor: compressor, CompressorThreads: threads})
+		if err != nil {
+			t.Fatalf("NewRPM returned error %v", err)
+		}
+		r.AddFile(RPMFile{Name: "/usr/share/threads/big", Body: content.Bytes()})
+		r.AddFile(RPMFile{Name: "/usr/share/threads/small", Body: []byte("small")})
+		return buildRPM(t, r)
+	}
+	for _, compressor := range []string{"gzip:1", "zstd"} {
+		compressor := compressor
+		t.Run(compressor, func(t *testing.T) {
+			b := build(compressor, 4)
+			files := extractRPM(t, b)
+			if files["/usr/share/threads/big"] != content.String() || files["/usr/share/threads/small"] != "small" {
+				t.Errorf("the extracted files differ from the packaged files")
+			}
+			if err := Verify(bytes.NewReader(b), nil); err != nil {
+				t.Errorf("Verify returned error %v", err)
+			}
+			if !bytes.Equal(b, build(compressor, 2)) {
+				t.Errorf("the payload depends on the number of threads")
+			}
+		})
+	}
+
+	for _, compressor := range []string{"gzip", "zstd"} {
+		r, err := NewRPM(RPMMetaData{Name: "empty", Summary: "summary", Compressor: compressor, CompressorThreads: 4})
+		if err != nil {
+			t.Fatalf("NewRPM returned error %v", err)
+		}
+		if files := extractRPM(t, buildRPM(t, r)); len(files) != 0 {
+			t.Errorf("%s: extracted %d files from an empty package", compressor, len(files))
+		}
+	}
+
+	if _, err := NewRPM(RPMMetaData{Name: "threads", Summary: "summary", Compressor: "xz", CompressorThreads: 4}); err == nil {
+		t.Errorf("NewRPM with xz and CompressorThreads should return an error")
+	}
+}
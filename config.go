@@ -0,0 +1,65 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+// AddConfigFile adds a regular file marked as %config, owned by root with mode 0644.
+//
+// On upgrade, a config file modified by the admin is kept, and:
+//   - with noreplace (%config(noreplace)), the file of the new package is
+//     installed next to it as <destPath>.rpmnew.
+//   - without noreplace (%config), the modified file is moved to
+//     <destPath>.rpmsave and replaced by the file of the new package.
+//
+// Like rpmbuild, all attributes are verified, so that local changes are
+// reported by `rpm -V`. Use AddFile with ConfigFile and NoVerify for anything
+// finer grained.
+func (r *RPM) AddConfigFile(destPath string, body []byte, noreplace bool) error {
+	t := ConfigFile
+	if noreplace {
+		t |= NoReplaceFile
+	}
+	return r.AddFile(RPMFile{
+		Name:  destPath,
+		Body:  body,
+		Mode:  0100644,
+		Owner: "root",
+		Group: "root",
+		Type:  t,
+	})
+}
+
+// AddConfigDir adds a directory marked as %config, owned by root with mode 0755.
+// rpm does not remove a config directory that still holds files on erase.
+func (r *RPM) AddConfigDir(destPath string) error {
+	return r.AddFile(RPMFile{
+		Name:  destPath,
+		Mode:  040755,
+		Owner: "root",
+		Group: "root",
+		Type:  ConfigFile,
+	})
+}
+
+// addConfigProvide provides and requires "config(name)" when the package has
+// config files, see ConfigProvides.
+func (r *RPM) addConfigProvide() {
+	for _, f := range r.files {
+		if f.Type&ConfigFile != 0 {
+			r.Provides.addGenerated("config("+r.Name+")", r.evr(), SenseConfig|SenseEqual)
+			r.Requires.addGenerated("config("+r.Name+")", r.evr(), SenseConfig|SenseEqual)
+			return
+		}
+	}
+}
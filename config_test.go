@@ -0,0 +1,124 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestConfigFiles(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "config", Version: "1.0", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddConfigDir("/etc/config")
+	r.AddConfigFile("/etc/config/keep.conf", []byte("a=b\n"), true)
+	r.AddConfigFile("/etc/config/replace.conf", []byte("a=b\n"), false)
+	info, err := ReadRPMInfo(bytes.NewReader(buildRPM(t, r)))
+	if err != nil {
+		t.Fatalf("ReadRPMInfo returned error %v", err)
+	}
+	type file struct {
+		Name  string
+		Mode  uint
+		Type  FileType
+		Owner string
+	}
+	var got []file
+	for _, f := range info.Files {
+		got = append(got, file{f.Name, f.Mode, f.Type, f.Owner})
+	}
+	want := []file{
+		{"/etc/config", 040755, ConfigFile, "root"},
+		{"/etc/config/keep.conf", 0100644, ConfigFile | NoReplaceFile, "root"},
+		{"/etc/config/replace.conf", 0100644, ConfigFile, "root"},
+	}
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("config files mismatch (-want +got):\n%s", d)
+	}
+	if d := cmp.Diff([]uint32{0xffffffff, 0xffffffff, 0xffffffff}, r.fileverifyflags); d != "" {
+		t.Errorf("fileverifyflags mismatch (-want +got):\n%s", d)
+	}
+}
+
+func TestConfigProvides(t *testing.T) {
+	testCases := []struct {
+		name   string
+		md     RPMMetaData
+		config bool
+		want   string
+	}{{
+		name:   "config file",
+		md:     RPMMetaData{Name: "config", Version: "1.0", Release: "2", Epoch: 1, ConfigProvides: true},
+		config: true,
+		want:   "config=1:1.0-2,config(config)=1:1.0-2",
+	}, {
+		name: "no config file",
+		md:   RPMMetaData{Name: "config", Version: "1.0", Release: "2", ConfigProvides: true},
+		want: "config=1.0-2",
+	}, {
+		name:   "disabled",
+		md:     RPMMetaData{Name: "config", Version: "1.0", Release: "2"},
+		config: true,
+		want:   "config=1.0-2",
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tc.md.Summary = "summary"
+			r, err := NewRPM(tc.md)
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			r.AddFile(RPMFile{Name: "/usr/bin/config", Body: []byte("bin"), Mode: 0100755})
+			if tc.config {
+				r.AddConfigFile("/etc/config.conf", []byte("a=b\n"), true)
+			}
+			buildRPM(t, r)
+			if got := r.Provides.String(); got != tc.want {
+				t.Errorf("provides = %s, want %s", got, tc.want)
+			}
+			for _, rel := range r.Provides {
+				if rel.Name == "config(config)" && rel.Sense != SenseConfig|SenseEqual {
+					t.Errorf("config provide flags = %d, want %d", rel.Sense, SenseConfig|SenseEqual)
+				}
+			}
+			required := false
+			for _, rel := range r.Requires {
+				if rel.Name == "config(config)" {
+					required = true
+					if rel.String() != "config(config)="+r.evr() || rel.Sense != SenseConfig|SenseEqual {
+						t.Errorf("config requirement = %s with flags %d, want %s with flags %d", rel, rel.Sense, "config(config)="+r.evr(), SenseConfig|SenseEqual)
+					}
+				}
+			}
+			if want := strings.Contains(tc.want, "config(config)"); required != want {
+				t.Errorf("config requirement present: %v, want %v", required, want)
+			}
+			// The generated relations are not part of the spec file.
+			b := &bytes.Buffer{}
+			if err := r.WriteSpec(b); err != nil {
+				t.Fatalf("WriteSpec returned error %v", err)
+			}
+			if strings.Contains(b.String(), "config(config)") {
+				t.Errorf("WriteSpec wrote the generated config relations:\n%s", b)
+			}
+		})
+	}
+}
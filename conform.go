@@ -0,0 +1,246 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNonConformingHeader is returned by Write with StrictHeaders when a
+// header breaks the rules of rpm.
+var ErrNonConformingHeader = errors.New("header does not conform to rpm")
+
+// requiredTags are the tags rpm needs to install a package.
+var requiredTags = []int{
+	tagName, tagVersion, tagRelease, tagSummary, tagDescription, tagOS, tagArch,
+	tagPayloadFormat,
+}
+
+// requiredSigTags are the signature tags rpm needs to check a package.
+var requiredSigTags = []int{sigSHA256}
+
+// tagTypes are the rpm types of the tags, as rpmtag.h defines them. Tags not
+// listed here, like custom tags and the scriptlet interpreters which can be a
+// STRING or a STRING_ARRAY, are not checked.
+var tagTypes = map[int]int{
+	tagHeaderI18NTable: typeStringArray,
+
+	tagName:              typeString,
+	tagVersion:           typeString,
+	tagRelease:           typeString,
+	tagEpoch:             typeInt32,
+	tagSummary:           typeI18NString,
+	tagDescription:       typeI18NString,
+	tagBuildTime:         typeInt32,
+	tagBuildHost:         typeString,
+	tagSize:              typeInt32,
+	tagVendor:            typeString,
+	tagLicence:           typeString,
+	tagPackager:          typeString,
+	tagGroup:             typeI18NString,
+	tagSource:            typeStringArray,
+	tagPatch:             typeStringArray,
+	tagURL:               typeString,
+	tagOS:                typeString,
+	tagArch:              typeString,
+	tagPrein:             typeString,
+	tagPostin:            typeString,
+	tagPreun:             typeString,
+	tagPostun:            typeString,
+	tagOldFileNames:      typeStringArray,
+	tagFileSizes:         typeInt32,
+	tagFileModes:         typeInt16,
+	tagFileRDevs:         typeInt16,
+	tagFileMTimes:        typeInt32,
+	tagFileDigests:       typeStringArray,
+	tagFileLinkTos:       typeStringArray,
+	tagFileFlags:         typeInt32,
+	tagFileUserName:      typeStringArray,
+	tagFileGroupName:     typeStringArray,
+	tagSourceRPM:         typeString,
+	tagFileVerifyFlags:   typeInt32,
+	tagProvides:          typeStringArray,
+	tagRequireFlags:      typeInt32,
+	tagRequires:          typeStringArray,
+	tagRequireVersion:    typeStringArray,
+	tagConflictFlags:     typeInt32,
+	tagConflicts:         typeStringArray,
+	tagConflictVersion:   typeStringArray,
+	tagChangelogTime:     typeInt32,
+	tagChangelogName:     typeStringArray,
+	tagChangelogText:     typeStringArray,
+	tagObsoletes:         typeStringArray,
+	tagCookie:            typeString,
+	tagFileINodes:        typeInt32,
+	tagFileLangs:         typeStringArray,
+	tagPrefixes:          typeStringArray,
+	tagSourcePackage:     typeInt32,
+	tagProvideFlags:      typeInt32,
+	tagProvideVersion:    typeStringArray,
+	tagObsoleteFlags:     typeInt32,
+	tagObsoleteVersion:   typeStringArray,
+	tagDirindexes:        typeInt32,
+	tagBasenames:         typeStringArray,
+	tagDirnames:          typeStringArray,
+	tagOptFlags:          typeString,
+	tagDistURL:           typeString,
+	tagPayloadFormat:     typeString,
+	tagPayloadCompressor: typeString,
+	tagPayloadFlags:      typeString,
+	tagPlatform:          typeString,
+	tagFileColors:        typeInt32,
+	tagFileClass:         typeInt32,
+	tagClassDict:         typeStringArray,
+	tagFileContexts:      typeStringArray,
+	tagPretrans:          typeString,
+	tagPosttrans:         typeString,
+	tagDistTag:           typeString,
+	tagLongFileSizes:     typeInt64,
+	tagLongSize:          typeInt64,
+	tagFileCaps:          typeStringArray,
+	tagFileDigestAlgo:    typeInt32,
+	tagRecommends:        typeStringArray,
+	tagRecommendVersion:  typeStringArray,
+	tagRecommendFlags:    typeInt32,
+	tagSuggests:          typeStringArray,
+	tagSuggestVersion:    typeStringArray,
+	tagSuggestFlags:      typeInt32,
+	tagSupplements:       typeStringArray,
+	tagSupplementVersion: typeStringArray,
+	tagSupplementFlags:   typeInt32,
+	tagEnhances:          typeStringArray,
+	tagEnhanceVersion:    typeStringArray,
+	tagEnhanceFlags:      typeInt32,
+	tagOrderName:         typeStringArray,
+	tagOrderVersion:      typeStringArray,
+	tagOrderFlags:        typeInt32,
+	tagFileSignatures:    typeStringArray,
+	tagFileSignatureLen:  typeInt32,
+	tagPayloadDigest:     typeStringArray,
+	tagPayloadDigestAlgo: typeInt32,
+	tagModularityLabel:   typeString,
+	tagPayloadDigestAlt:  typeStringArray,
+}
+
+// sigTagTypes are the rpm types of the signature tags.
+var sigTagTypes = map[int]int{
+	sigDSA:             typeBinary,
+	sigRSA:             typeBinary,
+	sigSHA1:            typeString,
+	sigSHA256:          typeString,
+	sigLongSize:        typeInt64,
+	sigLongArchiveSize: typeInt64,
+	sigSize:            typeInt32,
+	sigPGP:             typeBinary,
+	sigGPG:             typeBinary,
+	sigPayloadSize:     typeInt32,
+	sigReservedSpace:   typeBinary,
+}
+
+// checkHeaders checks the signature header and the main header of a package,
+// as they are written, and reports every violation it finds.
+func checkHeaders(signature, header []byte) error {
+	var violations []string
+	violations = append(violations, checkHeader(signature, signatures, requiredSigTags, sigTagTypes, "signature header")...)
+	violations = append(violations, checkHeader(header, immutable, requiredTags, tagTypes, "header")...)
+	if len(violations) > 0 {
+		return errors.Wrap(ErrNonConformingHeader, strings.Join(violations, "; "))
+	}
+	return nil
+}
+
+// checkHeader checks the layout of a header, whose region tag is region,
+// the types of its tags, and that it has the required tags.
+func checkHeader(b []byte, region int, required []int, types map[int]int, name string) []string {
+	var v []string
+	fail := func(format string, args ...interface{}) {
+		v = append(v, name+": "+fmt.Sprintf(format, args...))
+	}
+	if len(b) < 16 || !bytes.Equal(b[:4], []byte{0x8e, 0xad, 0xe8, 0x01}) {
+		fail("bad magic")
+		return v
+	}
+	count := int(int32(binary.BigEndian.Uint32(b[8:])))
+	size := int(int32(binary.BigEndian.Uint32(b[12:])))
+	if count < 1 || size < 0 || len(b) != 16+16*count+size {
+		fail("%d entries and %d bytes of data do not match the %d bytes of the header", count, size, len(b))
+		return v
+	}
+	data := b[16+16*count:]
+	rec := func(i, field int) int {
+		return int(int32(binary.BigEndian.Uint32(b[16+16*i+4*field:])))
+	}
+
+	// The region tag comes first, and points at its trailer, the last 16
+	// bytes of the data.
+	if rec(0, 0) != region || rec(0, 1) != typeBinary || rec(0, 2) != size-16 || rec(0, 3) != 16 {
+		fail("the first entry is not the region tag %d of the trailer", region)
+	} else {
+		t := data[size-16:]
+		trailer := func(field int) int { return int(int32(binary.BigEndian.Uint32(t[4*field:]))) }
+		if trailer(0) != region || trailer(1) != typeBinary || trailer(2) != -16*count || trailer(3) != 16 {
+			fail("the region trailer does not cover the %d entries", count)
+		}
+	}
+
+	seen := make(map[int]bool)
+	prevTag, end := region, 0
+	for i := 1; i < count; i++ {
+		tag, rpmtype, offset, n := rec(i, 0), rec(i, 1), rec(i, 2), rec(i, 3)
+		seen[tag] = true
+		if tag <= prevTag {
+			fail("tag %d is not sorted after tag %d", tag, prevTag)
+		}
+		prevTag = tag
+		if want, ok := types[tag]; ok && want != rpmtype {
+			fail("tag %d has type %s, want %s", tag, typeName(rpmtype), typeName(want))
+		}
+		if n < 1 {
+			fail("tag %d has no values", tag)
+			continue
+		}
+		if offset < end || offset > size-16 {
+			fail("tag %d at offset %d overlaps the previous entry or the trailer", tag, offset)
+			continue
+		}
+		if padding(rpmtype, offset) != 0 {
+			fail("tag %d of type %s at offset %d is not aligned", tag, typeName(rpmtype), offset)
+		}
+		l, err := entryLen(rpmtype, n, data[offset:size-16])
+		if err != nil || offset+l > size-16 {
+			fail("tag %d does not fit in the data", tag)
+			continue
+		}
+		end = offset + l
+	}
+	for _, tag := range required {
+		if !seen[tag] {
+			fail("required tag %d is missing", tag)
+		}
+	}
+	return v
+}
+
+func typeName(rpmtype int) string {
+	if n, ok := typeNames[rpmtype]; ok {
+		return n
+	}
+	return fmt.Sprintf("%d", rpmtype)
+}
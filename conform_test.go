@@ -0,0 +1,116 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestStrictHeaders(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{
+		Name:          "strict",
+		Version:       "1.0",
+		Release:       "1",
+		Summary:       "summary",
+		BuildTime:     time.Unix(1600000000, 0),
+		Prefixes:      []string{"/opt"},
+		Requires:      Relations{{Name: "bash"}},
+		StrictHeaders: true,
+		Translations:  map[string]Translation{"de": {Summary: "Zusammenfassung"}},
+	})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/opt/strict/file", Body: []byte("content")})
+	r.AddFile(RPMFile{Name: "/opt/strict/link", Body: []byte("file"), Mode: 0120777})
+	r.AddPrein("echo prein")
+	r.AddChangelog(ChangelogEntry{Time: time.Unix(1600000000, 0), Name: "Packager <p@example.com>", Text: "- change"})
+	if err := r.SetPGPKey(newTestEntity(t, "signer")); err != nil {
+		t.Fatalf("SetPGPKey returned error %v", err)
+	}
+	if err := r.Write(ioutil.Discard); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+
+	r, err = NewRPM(RPMMetaData{Name: "strict", Version: "1.0", Summary: "summary", StrictHeaders: true})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddCustomTag(tagOS, EntryInt32([]int32{1}))
+	err = r.Write(ioutil.Discard)
+	if errors.Cause(err) != ErrNonConformingHeader {
+		t.Fatalf("Write returned error %v, want %v", err, ErrNonConformingHeader)
+	}
+	if want := "header: tag 1021 has type INT32, want STRING"; !strings.Contains(err.Error(), want) {
+		t.Errorf("Write returned error %v, want it to contain %q", err, want)
+	}
+}
+
+func TestCheckHeader(t *testing.T) {
+	valid := func() []byte {
+		i := newIndex(immutable)
+		i.Add(tagName, EntryString("name"))
+		i.Add(tagFileModes, EntryUint16([]uint16{0100644}))
+		i.Add(tagFileSizes, EntryUint32([]uint32{1}))
+		b, err := i.Bytes()
+		if err != nil {
+			t.Fatalf("i.Bytes() returned error %v", err)
+		}
+		return b
+	}
+	// The entries are at 16 + 16*i, their fields are tag, type, offset and count.
+	field := func(b []byte, entry, f int) []byte {
+		return b[16+16*entry+4*f:]
+	}
+	for _, tc := range []struct {
+		name   string
+		change func(b []byte)
+		want   string
+	}{
+		{"valid", func([]byte) {}, ""},
+		{"bad magic", func(b []byte) { b[0] = 0 }, "bad magic"},
+		{"region", func(b []byte) { binary.BigEndian.PutUint32(field(b, 0, 0), 0x3e) }, "region tag 63"},
+		{"trailer", func(b []byte) { binary.BigEndian.PutUint32(b[len(b)-8:], 0) }, "region trailer"},
+		{"unsorted", func(b []byte) { binary.BigEndian.PutUint32(field(b, 2, 0), 900) }, "not sorted"},
+		{"type", func(b []byte) { binary.BigEndian.PutUint32(field(b, 1, 1), typeStringArray) }, "type STRING_ARRAY, want STRING"},
+		{"no values", func(b []byte) { binary.BigEndian.PutUint32(field(b, 3, 3), 0) }, "no values"},
+		{"overlap", func(b []byte) { binary.BigEndian.PutUint32(field(b, 3, 2), 2) }, "overlaps"},
+		{"alignment", func(b []byte) { binary.BigEndian.PutUint32(field(b, 2, 2), 5) }, "not aligned"},
+		{"too long", func(b []byte) { binary.BigEndian.PutUint32(field(b, 3, 3), 100) }, "does not fit"},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			b := valid()
+			tc.change(b)
+			v := checkHeader(b, immutable, []int{tagName}, tagTypes, "header")
+			got := strings.Join(v, "; ")
+			if tc.want == "" && got != "" {
+				t.Errorf("checkHeader() = %q, want no violations", got)
+			}
+			if !strings.Contains(got, tc.want) {
+				t.Errorf("checkHeader() = %q, want it to contain %q", got, tc.want)
+			}
+		})
+	}
+	if v := checkHeader(valid(), immutable, []int{tagName, tagVersion}, tagTypes, "header"); len(v) != 1 || !strings.Contains(v[0], "required tag 1001 is missing") {
+		t.Errorf("checkHeader() = %q, want only the missing VERSION", v)
+	}
+}
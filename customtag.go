@@ -0,0 +1,83 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+
+	"github.com/pkg/errors"
+)
+
+// SetTag adds tag to the main header, for vendor-specific extensions. Unlike
+// AddCustomTag, it checks e, and it fails rather than overwriting a tag it
+// already set or a tag written by rpmpack or reserved by rpm, the tags below
+// 1000. Build the entry with one of the Entry functions.
+func (r *RPM) SetTag(tag int, e IndexEntry) error {
+	if _, ok := tagNames[tag]; ok || tag < 1000 {
+		return errors.Errorf("tag %d is reserved", tag)
+	}
+	return setTag(r.customTags, tag, e)
+}
+
+// SetSignatureTag is SetTag for the signature header, where the tags below
+// 256 are reserved.
+func (r *RPM) SetSignatureTag(tag int, e IndexEntry) error {
+	if _, ok := sigTagNames[tag]; ok || tag < 256 {
+		return errors.Errorf("signature tag %d is reserved", tag)
+	}
+	return setTag(r.customSigs, tag, e)
+}
+
+func setTag(tags map[int]IndexEntry, tag int, e IndexEntry) error {
+	if _, ok := tags[tag]; ok {
+		return errors.Errorf("tag %d is already set", tag)
+	}
+	if err := e.validate(); err != nil {
+		return errors.Wrapf(err, "invalid entry for tag %d", tag)
+	}
+	tags[tag] = e
+	return nil
+}
+
+// validate checks that the count of e matches its data, as rpm reads it.
+func (e IndexEntry) validate() error {
+	if _, ok := typeNames[e.rpmtype]; !ok {
+		return errors.Errorf("unknown type %d", e.rpmtype)
+	}
+	if e.count < 1 {
+		return errors.New("an entry needs at least one value")
+	}
+	switch e.rpmtype {
+	case typeString, typeStringArray, typeI18NString:
+		if len(e.data) == 0 || e.data[len(e.data)-1] != 0 {
+			return errors.New("strings must be null terminated")
+		}
+		if n := bytes.Count(e.data, []byte{0}); n != e.count {
+			return errors.Errorf("%d strings, but a count of %d", n, e.count)
+		}
+		if e.rpmtype == typeString && e.count != 1 {
+			return errors.New("a STRING entry holds a single string")
+		}
+	default:
+		size := 1
+		if b, ok := boundaries[e.rpmtype]; ok {
+			size = b
+		}
+		if len(e.data) != e.count*size {
+			return errors.Errorf("%d bytes, but %d values of %d bytes", len(e.data), e.count, size)
+		}
+	}
+	return nil
+}
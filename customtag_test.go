@@ -0,0 +1,85 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"testing"
+)
+
+func TestSetTag(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		tag     int
+		e       IndexEntry
+		wantErr bool
+	}{
+		{"string", 0x4242, EntryString("custom"), false},
+		{"strings", 0x4242, EntryStringSlice([]string{"a", "b"}), false},
+		{"i18n", 0x4242, EntryI18NString("custom"), false},
+		{"int16", 0x4242, EntryInt16([]int16{1, 2}), false},
+		{"int64", 0x4242, EntryUint64([]uint64{1}), false},
+		{"binary", 0x4242, EntryBytes([]byte{1, 2, 3}), false},
+		{"char", 0x4242, EntryChar([]byte("x")), false},
+		{"int8", 0x4242, EntryInt8([]int8{-1}), false},
+		{"written by rpmpack", tagName, EntryString("name"), true},
+		{"reserved", 0x3f, EntryBytes([]byte{1}), true},
+		{"empty", 0x4242, EntryInt32(nil), true},
+		{"unknown type", 0x4242, IndexEntry{rpmtype: 42, count: 1, data: []byte{1}}, true},
+		{"wrong count", 0x4242, IndexEntry{rpmtype: typeInt32, count: 2, data: []byte{0, 0, 0, 1}}, true},
+		{"unterminated string", 0x4242, IndexEntry{rpmtype: typeString, count: 1, data: []byte("custom")}, true},
+		{"several strings", 0x4242, IndexEntry{rpmtype: typeString, count: 2, data: []byte("a\x00b\x00")}, true},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewRPM(RPMMetaData{Name: "custom", Version: "1.0", Summary: "summary"})
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			err = r.SetTag(tc.tag, tc.e)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("SetTag returned error %v, want error %t", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if err := r.SetTag(tc.tag, tc.e); err == nil {
+				t.Errorf("SetTag of a tag already set should return an error")
+			}
+			e, ok := readHeader(t, buildRPM(t, r)).entries[tc.tag]
+			if !ok {
+				t.Fatalf("tag %d missing from the header", tc.tag)
+			}
+			if e.rpmtype != tc.e.rpmtype || e.count != tc.e.count {
+				t.Errorf("tag %d has type %d and count %d, want %d and %d", tc.tag, e.rpmtype, e.count, tc.e.rpmtype, tc.e.count)
+			}
+		})
+	}
+}
+
+func TestSetSignatureTag(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "custom", Version: "1.0", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	if err := r.SetSignatureTag(sigSHA256, EntryString("digest")); err == nil {
+		t.Errorf("SetSignatureTag(SHA256) should return an error")
+	}
+	if err := r.SetSignatureTag(0x4242, EntryBytes([]byte{1})); err != nil {
+		t.Fatalf("SetSignatureTag returned error %v", err)
+	}
+	if _, ok := r.customSigs[0x4242]; !ok {
+		t.Errorf("signature tag 0x4242 was not set")
+	}
+}
@@ -0,0 +1,527 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DebugOptions configure SplitDebugInfo.
+type DebugOptions struct {
+	// SourceDir is the directory the ELF files were built in, as recorded in
+	// their debug information, like "/build/foo-1.0". The source files under
+	// it go to the -debugsource package, which is not built if it is empty.
+	SourceDir string
+	// ReadSource reads a source file by its path in the debug information,
+	// ioutil.ReadFile if not set.
+	ReadSource func(name string) ([]byte, error)
+}
+
+// SplitDebugInfo moves the debug information of the ELF executables and
+// libraries of r to a -debuginfo package, the way rpmbuild does with
+// find-debuginfo, and returns it together with a -debugsource package of
+// their source files. Either is nil if there is nothing to put in it.
+//
+// The debug sections of each ELF file are removed from it, and written to
+// /usr/lib/debug/<path>.debug in the -debuginfo package. Files with a GNU
+// build id get the /usr/lib/.build-id and /usr/lib/debug/.build-id links
+// gdb and systemd-coredump look them up with, and the -debuginfo package
+// provides debuginfo(build-id) for each of them.
+// Unlike rpmbuild, the paths of the sources in the debug information are not
+// rewritten to /usr/src/debug, where the -debugsource package has them, so
+// debuggers need a substitution, like "set substitute-path" of gdb.
+//
+// Only the regular files with an executable bit are considered, and files
+// with a Reader only if it is an io.ReadSeeker.
+func (r *RPM) SplitDebugInfo(o DebugOptions) (debuginfo, debugsource *RPM, err error) {
+	md := RPMMetaData{
+		Version:   r.Version,
+		Release:   r.Release,
+		Epoch:     r.Epoch,
+		Arch:      r.Arch,
+		OS:        r.OS,
+		Licence:   r.Licence,
+		URL:       r.URL,
+		Vendor:    r.Vendor,
+		Packager:  r.Packager,
+		BuildHost: r.BuildHost,
+		BuildTime: r.BuildTime,
+		FileMTime: r.FileMTime,
+		SourceRPM: r.sourceRPMName(),
+		Group:     "Development/Debug",
+	}
+	md.Name = r.Name + "-debuginfo"
+	md.Summary = "Debug information for package " + r.Name
+	md.Description = "This package provides debug information for package " + r.Name + ".\n" +
+		"Debug information is useful when developing applications that use this\n" +
+		"package or when debugging this package."
+	debuginfo, err = NewRPM(md)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	names := []string{}
+	for n := range r.files {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	sources := map[string]bool{}
+	split := 0
+	for _, n := range names {
+		f := r.files[n]
+		if f.Mode&0170000 != 0100000 || f.Mode&0111 == 0 || f.Type&GhostFile != 0 {
+			continue
+		}
+		b, err := debugFileContent(f)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to read file %q", f.Name)
+		}
+		if b == nil {
+			continue
+		}
+		d, err := splitDebugInfo(b)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to split the debug information of %q", f.Name)
+		}
+		if d == nil {
+			continue
+		}
+		split++
+		if o.SourceDir != "" {
+			for _, s := range d.sources {
+				if strings.HasPrefix(s, path.Clean(o.SourceDir)+"/") {
+					sources[s] = true
+				}
+			}
+		}
+		f.Body, f.Reader, f.Size = d.stripped, nil, 0
+		r.files[n] = f
+		debugName := path.Join("/usr/lib/debug", n) + ".debug"
+		if err := debuginfo.AddFile(RPMFile{Name: debugName, Body: d.debug, Mode: 0100644, MTime: f.MTime}); err != nil {
+			return nil, nil, err
+		}
+		if d.buildID == "" {
+			continue
+		}
+		debuginfo.Provides.addIfMissing(&Relation{Name: "debuginfo(build-id)", Version: d.buildID, Sense: SenseEqual})
+		if err := addBuildIDLink(debuginfo, "/usr/lib/debug/.build-id", d.buildID+".debug", debugName); err != nil {
+			return nil, nil, err
+		}
+		if err := addBuildIDLink(r, "/usr/lib/.build-id", d.buildID, n); err != nil {
+			return nil, nil, err
+		}
+	}
+	if split == 0 {
+		return nil, nil, nil
+	}
+	if len(sources) == 0 {
+		return debuginfo, nil, nil
+	}
+
+	md.Name = r.Name + "-debugsource"
+	md.Summary = "Debug sources for package " + r.Name
+	md.Description = "This package provides debug sources for package " + r.Name + ".\n" +
+		"Debug sources are useful when developing applications that use this\n" +
+		"package or when debugging this package."
+	debugsource, err = NewRPM(md)
+	if err != nil {
+		return nil, nil, err
+	}
+	read := o.ReadSource
+	if read == nil {
+		read = ioutil.ReadFile
+	}
+	dir := path.Join("/usr/src/debug", strings.TrimSuffix(r.NEVRA().FileName(), ".rpm"))
+	names = names[:0]
+	for s := range sources {
+		names = append(names, s)
+	}
+	sort.Strings(names)
+	for _, s := range names {
+		b, err := read(s)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to read source file %q", s)
+		}
+		rel := strings.TrimPrefix(s, path.Clean(o.SourceDir)+"/")
+		if err := debugsource.AddFile(RPMFile{Name: path.Join(dir, rel), Body: b, Mode: 0100644}); err != nil {
+			return nil, nil, err
+		}
+	}
+	debuginfo.Recommends.addIfMissing(&Relation{Name: debugsource.Name, Version: r.evr(), Sense: SenseEqual})
+	return debuginfo, debugsource, nil
+}
+
+// debugFileContent returns the content of f, or nil if it cannot be read
+// without consuming its Reader or if it is not an ELF file.
+func debugFileContent(f RPMFile) ([]byte, error) {
+	if f.Reader == nil {
+		if !bytes.HasPrefix(f.Body, []byte(elf.ELFMAG)) {
+			return nil, nil
+		}
+		return f.Body, nil
+	}
+	rs, ok := f.Reader.(io.ReadSeeker)
+	if !ok {
+		return nil, nil
+	}
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(rs, f.Size))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := rs.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(b, []byte(elf.ELFMAG)) {
+		return nil, nil
+	}
+	return b, nil
+}
+
+// addBuildIDLink adds the symlink dir/xx/yyyy to target for the build id
+// xxyyyy, and the directories of dir it is in.
+func addBuildIDLink(r *RPM, dir, name, target string) error {
+	sub := path.Join(dir, name[:2])
+	for _, d := range []string{dir, sub} {
+		if err := r.AddFile(RPMFile{Name: d, Mode: 040755, Type: ArtifactFile}); err != nil {
+			return err
+		}
+	}
+	rel := strings.Repeat("../", strings.Count(sub, "/")) + strings.TrimPrefix(target, "/")
+	link := NewSymlink(path.Join(sub, name[2:]), rel)
+	link.Type = ArtifactFile
+	return r.AddFile(link)
+}
+
+// splitDebug is an ELF file split by splitDebugInfo.
+type splitDebug struct {
+	stripped, debug []byte
+	buildID         string
+	// sources are the source files of the debug information.
+	sources []string
+}
+
+func isDebugSection(s *elf.Section) bool {
+	return s.Flags&elf.SHF_ALLOC == 0 && (strings.HasPrefix(s.Name, ".debug_") || strings.HasPrefix(s.Name, ".zdebug_"))
+}
+
+// splitDebugInfo splits the ELF file b into the file without its debug
+// sections and a separate debug file, like eu-strip -f. It returns nil if
+// b is not an ELF executable or library with debug sections.
+// All of the section headers are kept in both files, so that the section
+// indices do not change, the sections removed from a file are empty
+// SHT_NOBITS sections. The separate debug file keeps the symbols and the
+// notes too, and the size and address of the other sections.
+func splitDebugInfo(b []byte) (*splitDebug, error) {
+	f, err := elf.NewFile(bytes.NewReader(b))
+	if err != nil {
+		return nil, nil
+	}
+	defer f.Close()
+	if f.Type != elf.ET_EXEC && f.Type != elf.ET_DYN {
+		return nil, nil
+	}
+	hasDebug := false
+	for _, s := range f.Sections {
+		hasDebug = hasDebug || isDebugSection(s)
+	}
+	if !hasDebug {
+		return nil, nil
+	}
+	l, err := readELFLayout(f, b)
+	if err != nil {
+		return nil, err
+	}
+	d := &splitDebug{buildID: elfBuildID(f)}
+	d.sources = elfSources(f)
+
+	// The stripped file keeps the loaded part of the file as is.
+	fixed := uint64(l.ehsize)
+	if end := l.phoff + uint64(l.phnum)*uint64(l.phentsize); end > fixed {
+		fixed = end
+	}
+	for _, p := range f.Progs {
+		if end := p.Off + p.Filesz; end > fixed {
+			fixed = end
+		}
+	}
+	for _, s := range f.Sections {
+		if s.Flags&elf.SHF_ALLOC != 0 && s.Type != elf.SHT_NOBITS {
+			if end := s.Offset + s.FileSize; end > fixed {
+				fixed = end
+			}
+		}
+	}
+	if d.stripped, err = l.write(b, fixed, true, func(i int, s *elf.Section) sectionAction {
+		if isDebugSection(s) {
+			return emptySection
+		}
+		return keepSection
+	}); err != nil {
+		return nil, err
+	}
+
+	// The string table of the symbols.
+	strtab := -1
+	for _, s := range f.Sections {
+		if s.Type == elf.SHT_SYMTAB {
+			strtab = int(s.Link)
+		}
+	}
+	if d.debug, err = l.write(b, uint64(l.ehsize), false, func(i int, s *elf.Section) sectionAction {
+		switch {
+		case isDebugSection(s), s.Type == elf.SHT_SYMTAB, s.Type == elf.SHT_NOTE, i == strtab, i == l.shstrndx:
+			return keepSection
+		case s.Type == elf.SHT_NOBITS || s.Type == elf.SHT_NULL:
+			return keepSection
+		}
+		return noDataSection
+	}); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// elfBuildID returns the GNU build id of f in hex, or "" if it has none.
+func elfBuildID(f *elf.File) string {
+	for _, s := range f.Sections {
+		if s.Type != elf.SHT_NOTE {
+			continue
+		}
+		b, err := s.Data()
+		if err != nil {
+			continue
+		}
+		for len(b) >= 12 {
+			namesz, descsz, typ := f.ByteOrder.Uint32(b), f.ByteOrder.Uint32(b[4:]), f.ByteOrder.Uint32(b[8:])
+			name := 12 + (namesz+3)&^3
+			end := name + (descsz+3)&^3
+			if uint64(end) > uint64(len(b)) {
+				break
+			}
+			// NT_GNU_BUILD_ID
+			if typ == 3 && namesz == 4 && string(b[12:16]) == "GNU\x00" {
+				return hex.EncodeToString(b[name : name+descsz])
+			}
+			b = b[end:]
+		}
+	}
+	return ""
+}
+
+// elfSources returns the source files of the line tables of the debug
+// information of f, sorted.
+func elfSources(f *elf.File) []string {
+	dw, err := f.DWARF()
+	if err != nil {
+		return nil
+	}
+	files := map[string]bool{}
+	rd := dw.Reader()
+	for {
+		e, err := rd.Next()
+		if err != nil || e == nil {
+			break
+		}
+		rd.SkipChildren()
+		if e.Tag != dwarf.TagCompileUnit {
+			continue
+		}
+		lr, err := dw.LineReader(e)
+		if err != nil || lr == nil {
+			continue
+		}
+		var le dwarf.LineEntry
+		for lr.Next(&le) == nil {
+			if le.File != nil && path.IsAbs(le.File.Name) {
+				files[path.Clean(le.File.Name)] = true
+			}
+		}
+	}
+	var sources []string
+	for s := range files {
+		sources = append(sources, s)
+	}
+	sort.Strings(sources)
+	return sources
+}
+
+type sectionAction int
+
+const (
+	keepSection sectionAction = iota
+	// emptySection makes the section an empty SHT_NOBITS section.
+	emptySection
+	// noDataSection makes the section a SHT_NOBITS section of the same size.
+	noDataSection
+)
+
+// elfLayout is the raw layout of an ELF file, to rewrite it.
+type elfLayout struct {
+	order            binary.ByteOrder
+	class            elf.Class
+	header64         elf.Header64
+	header32         elf.Header32
+	ehsize           uint16
+	phoff            uint64
+	phnum, phentsize uint16
+	shstrndx         int
+	sections         []elf.Section64
+}
+
+func readELFLayout(f *elf.File, b []byte) (*elfLayout, error) {
+	l := &elfLayout{order: f.ByteOrder, class: f.Class}
+	rd := bytes.NewReader(b)
+	var shoff uint64
+	var shnum, shentsize uint16
+	switch f.Class {
+	case elf.ELFCLASS64:
+		if err := binary.Read(rd, l.order, &l.header64); err != nil {
+			return nil, errors.Wrap(err, "failed to read the ELF header")
+		}
+		h := l.header64
+		l.ehsize, l.phoff, l.phnum, l.phentsize = h.Ehsize, h.Phoff, h.Phnum, h.Phentsize
+		shoff, shnum, shentsize, l.shstrndx = h.Shoff, h.Shnum, h.Shentsize, int(h.Shstrndx)
+	case elf.ELFCLASS32:
+		if err := binary.Read(rd, l.order, &l.header32); err != nil {
+			return nil, errors.Wrap(err, "failed to read the ELF header")
+		}
+		h := l.header32
+		l.ehsize, l.phoff, l.phnum, l.phentsize = h.Ehsize, uint64(h.Phoff), h.Phnum, h.Phentsize
+		shoff, shnum, shentsize, l.shstrndx = uint64(h.Shoff), h.Shnum, h.Shentsize, int(h.Shstrndx)
+	default:
+		return nil, errors.Errorf("unknown ELF class %v", f.Class)
+	}
+	if int(shnum) != len(f.Sections) {
+		return nil, errors.New("extended ELF section numbering is not supported")
+	}
+	for i := 0; i < int(shnum); i++ {
+		sr := io.NewSectionReader(rd, int64(shoff)+int64(i)*int64(shentsize), int64(shentsize))
+		var s elf.Section64
+		if l.class == elf.ELFCLASS64 {
+			if err := binary.Read(sr, l.order, &s); err != nil {
+				return nil, errors.Wrap(err, "failed to read the ELF section headers")
+			}
+		} else {
+			var s32 elf.Section32
+			if err := binary.Read(sr, l.order, &s32); err != nil {
+				return nil, errors.Wrap(err, "failed to read the ELF section headers")
+			}
+			s = elf.Section64{
+				Name: s32.Name, Type: s32.Type, Flags: uint64(s32.Flags), Addr: uint64(s32.Addr),
+				Off: uint64(s32.Off), Size: uint64(s32.Size), Link: s32.Link, Info: s32.Info,
+				Addralign: uint64(s32.Addralign), Entsize: uint64(s32.Entsize),
+			}
+		}
+		l.sections = append(l.sections, s)
+	}
+	return l, nil
+}
+
+// write returns the ELF file b with the first fixed bytes unchanged, followed
+// by the sections after them, changed by action. The program headers are
+// only kept with keepProgs.
+func (l *elfLayout) write(b []byte, fixed uint64, keepProgs bool, action func(int, *elf.Section) sectionAction) ([]byte, error) {
+	f, err := elf.NewFile(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	out := append([]byte(nil), b[:fixed]...)
+	align := func(a uint64) {
+		if a > 1 {
+			for uint64(len(out))%a != 0 {
+				out = append(out, 0)
+			}
+		}
+	}
+	sections := make([]elf.Section64, len(l.sections))
+	copy(sections, l.sections)
+	for i := 1; i < len(sections); i++ {
+		s := &sections[i]
+		switch action(i, f.Sections[i]) {
+		case keepSection:
+			if s.Type == uint32(elf.SHT_NOBITS) || s.Off+s.Size <= fixed {
+				continue
+			}
+			if s.Off+s.Size > uint64(len(b)) {
+				return nil, errors.Errorf("ELF section %d is out of the file", i)
+			}
+			align(s.Addralign)
+			data := b[s.Off : s.Off+s.Size]
+			s.Off = uint64(len(out))
+			out = append(out, data...)
+		case emptySection:
+			s.Type, s.Off, s.Size = uint32(elf.SHT_NOBITS), uint64(len(out)), 0
+		case noDataSection:
+			s.Type, s.Off = uint32(elf.SHT_NOBITS), uint64(len(out))
+		}
+	}
+	align(8)
+	shoff := uint64(len(out))
+	w := &bytes.Buffer{}
+	for _, s := range sections {
+		var err error
+		if l.class == elf.ELFCLASS64 {
+			err = binary.Write(w, l.order, s)
+		} else {
+			err = binary.Write(w, l.order, elf.Section32{
+				Name: s.Name, Type: s.Type, Flags: uint32(s.Flags), Addr: uint32(s.Addr),
+				Off: uint32(s.Off), Size: uint32(s.Size), Link: s.Link, Info: s.Info,
+				Addralign: uint32(s.Addralign), Entsize: uint32(s.Entsize),
+			})
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to write the ELF section headers")
+		}
+	}
+	out = append(out, w.Bytes()...)
+
+	w.Reset()
+	if l.class == elf.ELFCLASS64 {
+		h := l.header64
+		h.Shoff = shoff
+		if !keepProgs {
+			h.Phoff, h.Phnum = 0, 0
+		}
+		err = binary.Write(w, l.order, h)
+	} else {
+		h := l.header32
+		h.Shoff = uint32(shoff)
+		if !keepProgs {
+			h.Phoff, h.Phnum = 0, 0
+		}
+		err = binary.Write(w, l.order, h)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to write the ELF header")
+	}
+	copy(out, w.Bytes())
+	return out, nil
+}
@@ -0,0 +1,139 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"debug/elf"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// testdata/debuginfo/hello is built from hello.c with
+//
+//	gcc -g -O0 -nostdlib -static -Wl,--build-id -Wl,-z,max-page-size=0x10 \
+//	  -Wl,-z,noseparate-code -fdebug-prefix-map=$PWD=/build/hello -o hello hello.c
+const helloBuildID = "89590b278ff08606eada960872be842808348dbf"
+
+func TestSplitDebugInfo(t *testing.T) {
+	hello, err := ioutil.ReadFile("testdata/debuginfo/hello")
+	if err != nil {
+		t.Fatalf("failed to read the test ELF file: %v", err)
+	}
+	r, err := NewRPM(RPMMetaData{Name: "hello", Version: "1.0", Release: "1", Arch: "x86_64", Summary: "hello"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	for _, f := range []RPMFile{
+		{Name: "/usr/bin/hello", Body: hello, Mode: 0100755},
+		{Name: "/usr/bin/script", Body: []byte("#!/bin/sh\n"), Mode: 0100755},
+		{Name: "/usr/share/hello/hello", Body: hello, Mode: 0100644},
+	} {
+		if err := r.AddFile(f); err != nil {
+			t.Fatalf("AddFile returned error %v", err)
+		}
+	}
+	debuginfo, debugsource, err := r.SplitDebugInfo(DebugOptions{
+		SourceDir: "/build/hello",
+		ReadSource: func(name string) ([]byte, error) {
+			return ioutil.ReadFile(filepath.Join("testdata/debuginfo", strings.TrimPrefix(name, "/build/hello/")))
+		},
+	})
+	if err != nil {
+		t.Fatalf("SplitDebugInfo returned error %v", err)
+	}
+	if debuginfo == nil || debugsource == nil {
+		t.Fatalf("SplitDebugInfo returned %v and %v, want both packages", debuginfo, debugsource)
+	}
+
+	stripped := r.files["/usr/bin/hello"].Body
+	if len(stripped) >= len(hello) {
+		t.Errorf("stripped file has %d bytes, the original %d", len(stripped), len(hello))
+	}
+	sf, err := elf.NewFile(bytes.NewReader(stripped))
+	if err != nil {
+		t.Fatalf("stripped file is not an ELF file: %v", err)
+	}
+	if s := sf.Section(".debug_info"); s == nil || s.Type != elf.SHT_NOBITS || s.Size != 0 {
+		t.Errorf("stripped file has .debug_info %+v, want an empty SHT_NOBITS section", s)
+	}
+	if got, want := sf.Section(".text").Offset, uint64(0x10c); got != want {
+		t.Errorf("stripped file has .text at %#x, want %#x", got, want)
+	}
+	if !bytes.Equal(r.files["/usr/share/hello/hello"].Body, hello) {
+		t.Error("the not executable ELF file was stripped")
+	}
+	link := r.files["/usr/lib/.build-id/89/"+helloBuildID[2:]]
+	if got := string(link.Body); got != "../../../../usr/bin/hello" || link.Type != ArtifactFile {
+		t.Errorf("build id link points to %q with type %v, want ../../../../usr/bin/hello and %v", got, link.Type, ArtifactFile)
+	}
+
+	df, err := elf.NewFile(bytes.NewReader(debuginfo.files["/usr/lib/debug/usr/bin/hello.debug"].Body))
+	if err != nil {
+		t.Fatalf("debug file is not an ELF file: %v", err)
+	}
+	if got := elfBuildID(df); got != helloBuildID {
+		t.Errorf("debug file has build id %s, want %s", got, helloBuildID)
+	}
+	if got := elfSources(df); !cmp.Equal(got, []string{"/build/hello/hello.c"}) {
+		t.Errorf("debug file has sources %v, want [/build/hello/hello.c]", got)
+	}
+	if s := df.Section(".text"); s == nil || s.Type != elf.SHT_NOBITS || s.Addr != 0x40010c {
+		t.Errorf("debug file has .text %+v, want a SHT_NOBITS section at 0x40010c", s)
+	}
+	link = debuginfo.files["/usr/lib/debug/.build-id/89/"+helloBuildID[2:]+".debug"]
+	if got := string(link.Body); got != "../../../../../usr/lib/debug/usr/bin/hello.debug" {
+		t.Errorf("debug build id link points to %q", got)
+	}
+	if got := debuginfo.Provides.String(); !strings.Contains(got, "debuginfo(build-id)="+helloBuildID) {
+		t.Errorf("debuginfo provides %s, want debuginfo(build-id)", got)
+	}
+	if got := debuginfo.Recommends.String(); got != "hello-debugsource=1.0-1" {
+		t.Errorf("debuginfo recommends %s, want hello-debugsource=1.0-1", got)
+	}
+
+	src, err := ioutil.ReadFile("testdata/debuginfo/hello.c")
+	if err != nil {
+		t.Fatalf("failed to read the test source: %v", err)
+	}
+	if got := debugsource.files["/usr/src/debug/hello-1.0-1.x86_64/hello.c"].Body; !bytes.Equal(got, src) {
+		t.Errorf("debugsource has hello.c %q, want %q", got, src)
+	}
+	for _, p := range []*RPM{r, debuginfo, debugsource} {
+		buildRPM(t, p)
+	}
+}
+
+func TestSplitDebugInfoWithoutDebug(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "nodebug", Version: "1.0", Summary: "nodebug"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	b := testELF{typ: elf.ET_DYN, soname: "libfoo.so.1"}.bytes(t)
+	if err := r.AddFile(RPMFile{Name: "/usr/lib64/libfoo.so.1", Body: b, Mode: 0100755}); err != nil {
+		t.Fatalf("AddFile returned error %v", err)
+	}
+	debuginfo, debugsource, err := r.SplitDebugInfo(DebugOptions{SourceDir: "/build"})
+	if err != nil || debuginfo != nil || debugsource != nil {
+		t.Errorf("SplitDebugInfo = %v, %v, %v, want no packages", debuginfo, debugsource, err)
+	}
+	if !bytes.Equal(r.files["/usr/lib64/libfoo.so.1"].Body, b) {
+		t.Error("a file without debug information was changed")
+	}
+}
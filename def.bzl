@@ -5,6 +5,8 @@ def _pkg_tar2rpm_impl(ctx):
     args.add("--version", ctx.attr.version)
     args.add("--release", ctx.attr.release)
     args.add("--epoch", ctx.attr.epoch)
+    if ctx.attr.summary != "":
+        args.add("--summary", ctx.attr.summary)
     args.add("--prein", ctx.attr.prein)
     args.add("--postin", ctx.attr.postin)
     args.add("--preun", ctx.attr.preun)
@@ -31,6 +33,7 @@ pkg_tar2rpm = rule(
         "version": attr.string(mandatory = True),
         "release": attr.string(),
         "epoch": attr.int(),
+        "summary": attr.string(),
         "prein": attr.string(),
         "postin": attr.string(),
         "preun": attr.string(),
@@ -0,0 +1,397 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// TagInfo describes a tag of an rpm header.
+type TagInfo struct {
+	// Header is "signature" for the signature header, and "main" for the regular header.
+	Header string
+	Tag    int
+	// Name is the rpm name of the tag, without the RPMTAG_/RPMSIGTAG_ prefix.
+	// It is empty for custom tags unknown to rpmpack.
+	Name string
+	// Type is the rpm type of the tag, like "STRING" or "INT32".
+	Type  string
+	Count int
+}
+
+var typeNames = map[int]string{
+	typeChar:        "CHAR",
+	typeInt8:        "INT8",
+	typeInt16:       "INT16",
+	typeInt32:       "INT32",
+	typeInt64:       "INT64",
+	typeString:      "STRING",
+	typeBinary:      "BIN",
+	typeStringArray: "STRING_ARRAY",
+	typeI18NString:  "I18NSTRING",
+}
+
+var sigTagNames = map[int]string{
+	signatures:             "HEADERSIGNATURES",
+	sigDSA:                 "DSAHEADER",
+	sigRSA:                 "RSAHEADER",
+	sigLongSize:            "LONGSIZE",
+	sigLongArchiveSize:     "LONGARCHIVESIZE",
+	sigSHA1:                "SHA1",
+	sigSHA256:              "SHA256",
+	sigVeritySignatures:    "VERITYSIGNATURES",
+	sigVeritySignatureAlgo: "VERITYSIGNATUREALGO",
+	sigSize:                "SIZE",
+	sigPGP:                 "PGP",
+	sigGPG:                 "GPG",
+	sigPayloadSize:         "PAYLOADSIZE",
+	sigReservedSpace:       "RESERVEDSPACE",
+}
+
+var tagNames = map[int]string{
+	immutable:            "HEADERIMMUTABLE",
+	tagHeaderI18NTable:   "HEADERI18NTABLE",
+	tagName:              "NAME",
+	tagVersion:           "VERSION",
+	tagRelease:           "RELEASE",
+	tagEpoch:             "EPOCH",
+	tagSummary:           "SUMMARY",
+	tagDescription:       "DESCRIPTION",
+	tagBuildTime:         "BUILDTIME",
+	tagBuildHost:         "BUILDHOST",
+	tagSize:              "SIZE",
+	tagVendor:            "VENDOR",
+	tagLicence:           "LICENSE",
+	tagPackager:          "PACKAGER",
+	tagGroup:             "GROUP",
+	tagSource:            "SOURCE",
+	tagPatch:             "PATCH",
+	tagURL:               "URL",
+	tagOS:                "OS",
+	tagArch:              "ARCH",
+	tagPrein:             "PREIN",
+	tagPostin:            "POSTIN",
+	tagPreun:             "PREUN",
+	tagPostun:            "POSTUN",
+	tagOldFileNames:      "OLDFILENAMES",
+	tagFileSizes:         "FILESIZES",
+	tagFileModes:         "FILEMODES",
+	tagFileRDevs:         "FILERDEVS",
+	tagFileMTimes:        "FILEMTIMES",
+	tagFileDigests:       "FILEDIGESTS",
+	tagFileLinkTos:       "FILELINKTOS",
+	tagFileFlags:         "FILEFLAGS",
+	tagFileUserName:      "FILEUSERNAME",
+	tagFileGroupName:     "FILEGROUPNAME",
+	tagSourceRPM:         "SOURCERPM",
+	tagFileVerifyFlags:   "FILEVERIFYFLAGS",
+	tagProvides:          "PROVIDENAME",
+	tagRequireFlags:      "REQUIREFLAGS",
+	tagRequires:          "REQUIRENAME",
+	tagRequireVersion:    "REQUIREVERSION",
+	tagConflictFlags:     "CONFLICTFLAGS",
+	tagConflicts:         "CONFLICTNAME",
+	tagConflictVersion:   "CONFLICTVERSION",
+	tagChangelogTime:     "CHANGELOGTIME",
+	tagChangelogName:     "CHANGELOGNAME",
+	tagChangelogText:     "CHANGELOGTEXT",
+	tagPreinProg:         "PREINPROG",
+	tagPostinProg:        "POSTINPROG",
+	tagPreunProg:         "PREUNPROG",
+	tagPostunProg:        "POSTUNPROG",
+	tagPretrans:          "PRETRANS",
+	tagPosttrans:         "POSTTRANS",
+	tagPretransProg:      "PRETRANSPROG",
+	tagPosttransProg:     "POSTTRANSPROG",
+	tagDistTag:           "DISTTAG",
+	tagObsoletes:         "OBSOLETENAME",
+	tagCookie:            "COOKIE",
+	tagFileINodes:        "FILEINODES",
+	tagFileLangs:         "FILELANGS",
+	tagPrefixes:          "PREFIXES",
+	tagSourcePackage:     "SOURCEPACKAGE",
+	tagProvideFlags:      "PROVIDEFLAGS",
+	tagProvideVersion:    "PROVIDEVERSION",
+	tagObsoleteFlags:     "OBSOLETEFLAGS",
+	tagObsoleteVersion:   "OBSOLETEVERSION",
+	tagDirindexes:        "DIRINDEXES",
+	tagBasenames:         "BASENAMES",
+	tagDirnames:          "DIRNAMES",
+	tagOptFlags:          "OPTFLAGS",
+	tagDistURL:           "DISTURL",
+	tagPayloadFormat:     "PAYLOADFORMAT",
+	tagPayloadCompressor: "PAYLOADCOMPRESSOR",
+	tagPayloadFlags:      "PAYLOADFLAGS",
+	tagPlatform:          "PLATFORM",
+	tagFileColors:        "FILECOLORS",
+	tagFileClass:         "FILECLASS",
+	tagClassDict:         "CLASSDICT",
+	tagLongFileSizes:     "LONGFILESIZES",
+	tagLongSize:          "LONGSIZE",
+	tagFileCaps:          "FILECAPS",
+	tagFileContexts:      "FILECONTEXTS",
+	tagFileDigestAlgo:    "FILEDIGESTALGO",
+	tagPreinFlags:        "PREINFLAGS",
+	tagPostinFlags:       "POSTINFLAGS",
+	tagPreunFlags:        "PREUNFLAGS",
+	tagPostunFlags:       "POSTUNFLAGS",
+	tagPretransFlags:     "PRETRANSFLAGS",
+	tagPosttransFlags:    "POSTTRANSFLAGS",
+	tagRecommends:        "RECOMMENDNAME",
+	tagRecommendVersion:  "RECOMMENDVERSION",
+	tagRecommendFlags:    "RECOMMENDFLAGS",
+	tagSuggests:          "SUGGESTNAME",
+	tagSuggestVersion:    "SUGGESTVERSION",
+	tagSuggestFlags:      "SUGGESTFLAGS",
+	tagSupplements:       "SUPPLEMENTNAME",
+	tagSupplementVersion: "SUPPLEMENTVERSION",
+	tagSupplementFlags:   "SUPPLEMENTFLAGS",
+	tagEnhances:          "ENHANCENAME",
+	tagEnhanceVersion:    "ENHANCEVERSION",
+	tagEnhanceFlags:      "ENHANCEFLAGS",
+	tagOrderName:         "ORDERNAME",
+	tagOrderVersion:      "ORDERVERSION",
+	tagOrderFlags:        "ORDERFLAGS",
+	tagFileSignatures:    "FILESIGNATURES",
+	tagFileSignatureLen:  "FILESIGNATURELENGTH",
+	tagPayloadDigest:     "PAYLOADDIGEST",
+	tagPayloadDigestAlgo: "PAYLOADDIGESTALGO",
+	tagModularityLabel:   "MODULARITYLABEL",
+	tagPayloadDigestAlt:  "PAYLOADDIGESTALT",
+
+	tagTriggerScripts:     "TRIGGERSCRIPTS",
+	tagTriggerName:        "TRIGGERNAME",
+	tagTriggerVersion:     "TRIGGERVERSION",
+	tagTriggerFlags:       "TRIGGERFLAGS",
+	tagTriggerIndex:       "TRIGGERINDEX",
+	tagTriggerScriptProg:  "TRIGGERSCRIPTPROG",
+	tagTriggerScriptFlags: "TRIGGERSCRIPTFLAGS",
+
+	tagFileTriggerScripts:          "FILETRIGGERSCRIPTS",
+	tagFileTriggerScriptProg:       "FILETRIGGERSCRIPTPROG",
+	tagFileTriggerScriptFlags:      "FILETRIGGERSCRIPTFLAGS",
+	tagFileTriggerName:             "FILETRIGGERNAME",
+	tagFileTriggerIndex:            "FILETRIGGERINDEX",
+	tagFileTriggerVersion:          "FILETRIGGERVERSION",
+	tagFileTriggerFlags:            "FILETRIGGERFLAGS",
+	tagTransFileTriggerScripts:     "TRANSFILETRIGGERSCRIPTS",
+	tagTransFileTriggerScriptProg:  "TRANSFILETRIGGERSCRIPTPROG",
+	tagTransFileTriggerScriptFlags: "TRANSFILETRIGGERSCRIPTFLAGS",
+	tagTransFileTriggerName:        "TRANSFILETRIGGERNAME",
+	tagTransFileTriggerIndex:       "TRANSFILETRIGGERINDEX",
+	tagTransFileTriggerVersion:     "TRANSFILETRIGGERVERSION",
+	tagTransFileTriggerFlags:       "TRANSFILETRIGGERFLAGS",
+	tagFileTriggerPriorities:       "FILETRIGGERPRIORITIES",
+	tagTransFileTriggerPriorities:  "TRANSFILETRIGGERPRIORITIES",
+}
+
+// DescribeTags returns every tag Write would emit in the signature and the
+// regular header, in the order they are written. r is left untouched, and can
+// still be written afterwards.
+// The signers are not called, so the signature tags are reported with a
+// count of 0 when signers are set.
+func (r *RPM) DescribeTags() ([]TagInfo, error) {
+	s, h, err := r.describeHeaders()
+	if err != nil {
+		return nil, err
+	}
+	tags := describeIndex("signature", s, sigTagNames)
+	return append(tags, describeIndex("main", h, tagNames)...), nil
+}
+
+// Headers returns the signature and the regular header Write would emit, to
+// inspect their values. Like DescribeTags, r is left untouched and the
+// signers are not called, the signature tags are empty when signers are set.
+func (r *RPM) Headers() (signature, main *Header, err error) {
+	s, h, err := r.describeHeaders()
+	if err != nil {
+		return nil, nil, err
+	}
+	return &Header{s}, &Header{h}, nil
+}
+
+// describeHeaders builds the headers of a copy of r.
+func (r *RPM) describeHeaders() (*index, *index, error) {
+	c, err := r.describeClone()
+	if err != nil {
+		return nil, nil, err
+	}
+	hb, s, err := c.buildHeaders()
+	if err != nil {
+		return nil, nil, err
+	}
+	if r.headerSigner != nil {
+		s.Add(sigRSA, EntryBytes(nil))
+	}
+	if r.pgpSigner != nil {
+		s.Add(sigPGP, EntryBytes(nil))
+	}
+	h, _, err := readIndex(bytes.NewReader(hb))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to read back the header")
+	}
+	return s, h, nil
+}
+
+// describeClone returns a copy of r that can be written without changing r,
+// without its signers. Unless the header is finalized already, the copy has
+// the payload writers of a new rpm for its first pass.
+func (r *RPM) describeClone() (*RPM, error) {
+	c := *r
+	c.pgpSigner, c.headerSigner = nil, nil
+	c.files = make(map[string]RPMFile, len(r.files))
+	for n, f := range r.files {
+		if f.Reader != nil {
+			// Only the size of the content matters, and the reader can only be
+			// read once, by Write.
+			f.Reader = io.NewSectionReader(zeroReader{}, 0, f.Size)
+		}
+		c.files[n] = f
+	}
+	c.parentDirs = make(map[string]string, len(r.parentDirs))
+	for n, d := range r.parentDirs {
+		c.parentDirs[n] = d
+	}
+	c.hardlinks = make(map[string]string, len(r.hardlinks))
+	for n, t := range r.hardlinks {
+		c.hardlinks[n] = t
+	}
+	c.scriptlets = make(map[ScriptletType]scriptlet, len(r.scriptlets))
+	for t, s := range r.scriptlets {
+		c.scriptlets[t] = s
+	}
+	c.customTags = make(map[int]IndexEntry, len(r.customTags))
+	for t, e := range r.customTags {
+		c.customTags[t] = e
+	}
+	c.customSigs = make(map[int]IndexEntry, len(r.customSigs))
+	for t, e := range r.customSigs {
+		c.customSigs[t] = e
+	}
+	if r.header != nil {
+		// The header of a written rpm is described too.
+		c.closed = false
+		return &c, nil
+	}
+	fresh, err := NewRPM(r.RPMMetaData)
+	if err != nil {
+		return nil, err
+	}
+	c.di, c.payload, c.payloadHead = fresh.di, fresh.payload, fresh.payloadHead
+	c.compressedPayload, c.archiveDigest = fresh.compressedPayload, fresh.archiveDigest
+	c.progress, c.cpio = fresh.progress, fresh.cpio
+	return &c, nil
+}
+
+func describeIndex(header string, i *index, names map[int]string) []TagInfo {
+	tags := []TagInfo{{
+		Header: header,
+		Tag:    i.h,
+		Name:   names[i.h],
+		Type:   typeNames[typeBinary],
+		Count:  0x10,
+	}}
+	for _, tag := range i.sortedTags() {
+		e := i.entries[tag]
+		tags = append(tags, TagInfo{
+			Header: header,
+			Tag:    tag,
+			Name:   names[tag],
+			Type:   typeNames[e.rpmtype],
+			Count:  e.count,
+		})
+	}
+	return tags
+}
+
+type zeroReader struct{}
+
+func (zeroReader) ReadAt(p []byte, off int64) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// Value returns the value of tag with the Go type matching its rpm type:
+// []uint8, []uint16, []uint32 or []uint64 for integers, string for STRING,
+// []string for STRING_ARRAY and I18NSTRING, and []byte for BIN and CHAR. It
+// returns nil if the header does not have tag.
+func (h *Header) Value(tag int) interface{} {
+	e, ok := h.i.entries[tag]
+	if !ok {
+		return nil
+	}
+	switch e.rpmtype {
+	case typeInt16:
+		return h.i.getUint16s(tag)
+	case typeInt32:
+		return h.i.getUint32s(tag)
+	case typeInt64:
+		return h.i.getUint64s(tag)
+	case typeString:
+		return h.i.getString(tag)
+	case typeStringArray, typeI18NString:
+		return h.i.getStrings(tag)
+	}
+	return e.data
+}
+
+// Values returns the values of all the tags of the header, as Value does.
+func (h *Header) Values() map[int]interface{} {
+	v := make(map[int]interface{}, len(h.i.entries))
+	for tag := range h.i.entries {
+		v[tag] = h.Value(tag)
+	}
+	return v
+}
+
+// Dump writes the tags of the header to w, one per line and sorted, with
+// their name, type and value, like:
+//
+//	1000 NAME STRING "rpmpack"
+//	1028 FILESIZES INT32 [12 4096]
+//
+// The output only depends on the content of the header, so it can be
+// compared to a golden file.
+func (h *Header) Dump(w io.Writer) error {
+	names := tagNames
+	if h.i.h == signatures {
+		names = sigTagNames
+	}
+	for _, tag := range h.i.sortedTags() {
+		name := names[tag]
+		if name == "" {
+			name = "-"
+		}
+		var v string
+		switch val := h.Value(tag).(type) {
+		case string, []string:
+			v = fmt.Sprintf("%q", val)
+		case []byte:
+			v = fmt.Sprintf("%x", val)
+		default:
+			v = fmt.Sprintf("%v", val)
+		}
+		if _, err := fmt.Fprintf(w, "%d %s %s %s\n", tag, name, h.Type(tag), v); err != nil {
+			return errors.Wrap(err, "failed to write header dump")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func describeRPM(t *testing.T) *RPM {
+	t.Helper()
+	r, err := NewRPM(RPMMetaData{Name: "describe", Version: "1.0", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/bin/describe", Body: []byte("bin"), Mode: 0755})
+	r.AddFile(RPMFile{Name: "/etc/describe.conf", Body: []byte("a=b\n")})
+	r.AddPostin("echo")
+	r.AddCustomTag(0x4242, EntryString("custom"))
+	return r
+}
+
+func TestDescribeTags(t *testing.T) {
+	r := describeRPM(t)
+	tags, err := r.DescribeTags()
+	if err != nil {
+		t.Fatalf("DescribeTags returned error %v", err)
+	}
+	got := map[string]TagInfo{}
+	for _, ti := range tags {
+		got[ti.Header+"/"+ti.Name] = ti
+	}
+	for _, want := range []TagInfo{
+		{Header: "signature", Tag: signatures, Name: "HEADERSIGNATURES", Type: "BIN", Count: 16},
+		{Header: "signature", Tag: sigSHA256, Name: "SHA256", Type: "STRING", Count: 1},
+		{Header: "signature", Tag: sigSize, Name: "SIZE", Type: "INT32", Count: 1},
+		{Header: "main", Tag: immutable, Name: "HEADERIMMUTABLE", Type: "BIN", Count: 16},
+		{Header: "main", Tag: tagName, Name: "NAME", Type: "STRING", Count: 1},
+		{Header: "main", Tag: tagSummary, Name: "SUMMARY", Type: "I18NSTRING", Count: 1},
+		{Header: "main", Tag: tagBasenames, Name: "BASENAMES", Type: "STRING_ARRAY", Count: 2},
+		{Header: "main", Tag: tagFileModes, Name: "FILEMODES", Type: "INT16", Count: 2},
+		{Header: "main", Tag: tagPostin, Name: "POSTIN", Type: "STRING", Count: 1},
+		{Header: "main", Tag: 0x4242, Type: "STRING", Count: 1},
+	} {
+		if d := cmp.Diff(want, got[want.Header+"/"+want.Name]); d != "" {
+			t.Errorf("tag %s/%s mismatch (-want +got):\n%s", want.Header, want.Name, d)
+		}
+	}
+	if _, ok := got["signature/PGP"]; ok {
+		t.Error("PGP signature described without a signer")
+	}
+	// Describing must not consume the rpm.
+	if !bytes.Equal(buildRPM(t, describeRPM(t)), buildRPM(t, r)) {
+		t.Error("writing after DescribeTags resulted in a different rpm")
+	}
+}
+
+func TestDescribeTagsProfile(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "describe", Version: "1.0", Summary: "summary"}, WithProfile(ProfileEL7))
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/bin/describe", Body: []byte("bin"), Mode: 0755})
+	tags, err := r.DescribeTags()
+	if err != nil {
+		t.Fatalf("DescribeTags returned error %v", err)
+	}
+	found := false
+	for _, ti := range tags {
+		if ti.Header == "signature" && ti.Tag == sigSHA1 {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("DescribeTags under ProfileEL7 does not describe the SHA1 signature")
+	}
+}
+
+// failingSigner fails the test when it signs.
+type failingSigner struct{ t *testing.T }
+
+func (s failingSigner) Sign(io.Reader) ([]byte, error) {
+	s.t.Error("the signer was called")
+	return nil, nil
+}
+
+func TestDescribeTagsSigner(t *testing.T) {
+	r := describeRPM(t)
+	r.SetSigner(failingSigner{t})
+	tags, err := r.DescribeTags()
+	if err != nil {
+		t.Fatalf("DescribeTags returned error %v", err)
+	}
+	got := map[int]int{}
+	for _, ti := range tags {
+		if ti.Header == "signature" {
+			got[ti.Tag] = ti.Count
+		}
+	}
+	for _, tag := range []int{sigRSA, sigPGP} {
+		if count, ok := got[tag]; !ok || count != 0 {
+			t.Errorf("signature tag %d is described with count %d (present: %v), want 0", tag, count, ok)
+		}
+	}
+}
+
+func TestDescribeTagsFinalized(t *testing.T) {
+	r := describeRPM(t)
+	h, err := r.FinalizeHeader()
+	if err != nil {
+		t.Fatalf("FinalizeHeader returned error %v", err)
+	}
+	// Changes after FinalizeHeader are not part of the rpm.
+	r.AddFile(RPMFile{Name: "/usr/bin/late", Body: []byte("late")})
+	_, main, err := r.Headers()
+	if err != nil {
+		t.Fatalf("Headers returned error %v", err)
+	}
+	want, _, err := readIndex(bytes.NewReader(h.Bytes))
+	if err != nil {
+		t.Fatalf("readIndex returned error %v", err)
+	}
+	if d := cmp.Diff(want.getStrings(tagBasenames), main.i.getStrings(tagBasenames)); d != "" {
+		t.Errorf("basenames mismatch (-want +got):\n%s", d)
+	}
+	if err := r.Write(ioutil.Discard); err != nil {
+		t.Errorf("Write after Headers returned error %v", err)
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	r := describeRPM(t)
+	s, h, err := r.Headers()
+	if err != nil {
+		t.Fatalf("Headers returned error %v", err)
+	}
+	values := h.Values()
+	for tag, want := range map[int]interface{}{
+		tagName:      "describe",
+		tagSummary:   []string{"summary"},
+		tagBasenames: []string{"describe.conf", "describe"},
+		tagFileModes: []uint16{0100000, 0100755},
+		0x4242:       "custom",
+	} {
+		if d := cmp.Diff(want, values[tag]); d != "" {
+			t.Errorf("tag %d mismatch (-want +got):\n%s", tag, d)
+		}
+	}
+	if got := s.Value(sigSize); got == nil {
+		t.Error("signature has no SIZE")
+	}
+
+	// The dumps match the headers of the written rpm.
+	p, err := ReadPackage(bytes.NewReader(buildRPM(t, r)))
+	if err != nil {
+		t.Fatalf("ReadPackage returned error %v", err)
+	}
+	for _, hh := range []struct{ got, want *Header }{{s, p.Signature}, {h, p.Header}} {
+		got, want := &bytes.Buffer{}, &bytes.Buffer{}
+		if err := hh.got.Dump(got); err != nil {
+			t.Fatalf("Dump returned error %v", err)
+		}
+		if err := hh.want.Dump(want); err != nil {
+			t.Fatalf("Dump returned error %v", err)
+		}
+		if d := cmp.Diff(want.String(), got.String()); d != "" {
+			t.Errorf("Dump mismatch (-want +got):\n%s", d)
+		}
+	}
+}
+
+func TestHeaderDump(t *testing.T) {
+	i := newIndex(immutable)
+	i.Add(tagName, EntryString("dump"))
+	i.Add(tagFileSizes, EntryInt32([]int32{12, 4096}))
+	i.Add(tagBasenames, EntryStringSlice([]string{"a", "b"}))
+	i.Add(0x4242, EntryBytes([]byte{0xca, 0xfe}))
+	b := &bytes.Buffer{}
+	if err := (&Header{i}).Dump(b); err != nil {
+		t.Fatalf("Dump returned error %v", err)
+	}
+	want := `1000 NAME STRING "dump"
+1028 FILESIZES INT32 [12 4096]
+1117 BASENAMES STRING_ARRAY ["a" "b"]
+16962 - BIN cafe
+`
+	if d := cmp.Diff(want, b.String()); d != "" {
+		t.Errorf("Dump mismatch (-want +got):\n%s", d)
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"crypto"
+	"io"
+	"runtime"
+	"sync"
+
+	// Register the hashes of fileDigests.
+	_ "crypto/md5"
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// fileDigest is a file digest algorithm, with its PGPHASHALGO value and its
+// value in IMA signatures (enum hash_algo of the kernel).
+type fileDigest struct {
+	algo int32
+	hash crypto.Hash
+	ima  byte
+}
+
+// fileDigests maps the values of RPMMetaData.FileDigest to the algorithms.
+// md5 and sha1 are only there for old rpm versions and tools, FIPS enabled
+// hosts refuse to install packages with md5 file digests.
+var fileDigests = map[string]fileDigest{
+	"md5":    {hashAlgoMD5, crypto.MD5, 1},
+	"sha1":   {hashAlgoSHA1, crypto.SHA1, 2},
+	"sha256": {hashAlgoSHA256, crypto.SHA256, 4},
+	"sha512": {hashAlgoSHA512, crypto.SHA512, 6},
+}
+
+// digestFiles computes the digests of the regular files of fnames
+// concurrently, on GOMAXPROCS workers, before the payload is written
+// serially. Only the files with their content in Body, or in a Reader which
+// is also an io.ReaderAt, like an *os.File, are digested. The other files,
+// and files whose content does not match their size, are left to
+// writeRegularFile.
+func (r *RPM) digestFiles(fnames []string) map[string][]byte {
+	workers := runtime.GOMAXPROCS(0)
+	if workers < 2 || len(fnames) < 2 {
+		return nil
+	}
+	type job struct {
+		name    string
+		content io.Reader
+		size    int64
+	}
+	var jobs []job
+	for _, fn := range fnames {
+		f := r.files[fn]
+		if t := f.Mode & 0170000; t != 0 && t != 0100000 || f.Type&GhostFile != 0 {
+			continue
+		}
+		switch rd := f.Reader.(type) {
+		case nil:
+			jobs = append(jobs, job{fn, bytes.NewReader(f.Body), int64(len(f.Body))})
+		case readSeekerAt:
+			off, err := rd.Seek(0, io.SeekCurrent)
+			if err != nil {
+				continue
+			}
+			jobs = append(jobs, job{fn, io.NewSectionReader(rd, off, f.Size), f.Size})
+		}
+	}
+
+	sums := make(map[string][]byte, len(jobs))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	next := make(chan job)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range next {
+				h := r.fileDigest.hash.New()
+				n, err := io.Copy(h, io.LimitReader(j.content, j.size+1))
+				if err != nil || n != j.size {
+					continue
+				}
+				mu.Lock()
+				sums[j.name] = h.Sum(nil)
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, j := range jobs {
+		if r.progress.canceled() != nil {
+			break
+		}
+		next <- j
+	}
+	close(next)
+	wg.Wait()
+	return sums
+}
+
+type readSeekerAt interface {
+	io.ReaderAt
+	io.Seeker
+}
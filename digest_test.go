@@ -0,0 +1,125 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFileDigest(t *testing.T) {
+	testCases := []struct {
+		digest     string
+		wantAlgo   uint32
+		wantDigest string
+	}{{
+		digest:     "",
+		wantAlgo:   8,
+		wantDigest: "77e7ce77c707a8147bb65a710ac1af3fca02c8dd2be36762ec9611d90fb5c041",
+	}, {
+		digest:     "sha256",
+		wantAlgo:   8,
+		wantDigest: "77e7ce77c707a8147bb65a710ac1af3fca02c8dd2be36762ec9611d90fb5c041",
+	}, {
+		digest:     "md5",
+		wantAlgo:   1,
+		wantDigest: "6aea67367311873a8a1383e4373a0e3c",
+	}, {
+		digest:     "sha1",
+		wantAlgo:   2,
+		wantDigest: "488068fe1e9468cd95a5f4812ed98b24d25fa997",
+	}, {
+		digest:     "sha512",
+		wantAlgo:   10,
+		wantDigest: "ba29bb9890bd061caf5f80eb03f3189169138471717abea42c95ec127d7ee401a380b714ac87e6eea69b7ef5d4e33533fbf6a40c0d61c1ea20068afbd0835734",
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.digest, func(t *testing.T) {
+			r, err := NewRPM(RPMMetaData{Name: "digest", Version: "1.0", FileDigest: tc.digest, Summary: "summary"})
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			r.AddFile(RPMFile{Name: "/etc/digest.conf", Body: []byte("a=b\n")})
+			h := readHeader(t, buildRPM(t, r))
+			if d := cmp.Diff([]string{tc.wantDigest}, h.getStrings(tagFileDigests)); d != "" {
+				t.Errorf("file digests mismatch (-want +got):\n%s", d)
+			}
+			if d := cmp.Diff([]uint32{tc.wantAlgo}, h.getUint32s(tagFileDigestAlgo)); d != "" {
+				t.Errorf("file digest algo mismatch (-want +got):\n%s", d)
+			}
+		})
+	}
+}
+
+func TestUnknownFileDigest(t *testing.T) {
+	if _, err := NewRPM(RPMMetaData{Name: "digest", Version: "1.0", FileDigest: "crc32", Summary: "summary"}); err == nil {
+		t.Error("NewRPM with an unknown file digest should return an error")
+	}
+}
+
+func TestParallelFileDigests(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rpmpack")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir returned error %v", err)
+	}
+	defer os.RemoveAll(dir)
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	r, err := NewRPM(RPMMetaData{Name: "digest", Version: "1.0", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	var want []string
+	for i := 0; i < 100; i++ {
+		content := []byte(strings.Repeat(fmt.Sprintf("file %d\n", i), i))
+		want = append(want, fmt.Sprintf("%x", sha256.Sum256(content)))
+		name := fmt.Sprintf("/usr/share/digest/%02d", i)
+		switch i % 3 {
+		case 0:
+			r.AddFile(RPMFile{Name: name, Body: content})
+		case 1:
+			fn := filepath.Join(dir, fmt.Sprintf("%02d", i))
+			if err := ioutil.WriteFile(fn, content, 0644); err != nil {
+				t.Fatalf("ioutil.WriteFile returned error %v", err)
+			}
+			f, err := os.Open(fn)
+			if err != nil {
+				t.Fatalf("os.Open returned error %v", err)
+			}
+			defer f.Close()
+			r.AddFile(RPMFile{Name: name, Reader: f, Size: int64(len(content))})
+		case 2:
+			// Not an io.ReaderAt, so digested serially.
+			r.AddFile(RPMFile{Name: name, Reader: bytes.NewBuffer(content), Size: int64(len(content))})
+		}
+	}
+	b := buildRPM(t, r)
+	if d := cmp.Diff(want, readHeader(t, b).getStrings(tagFileDigests)); d != "" {
+		t.Errorf("file digests mismatch (-want +got):\n%s", d)
+	}
+	if err := Verify(bytes.NewReader(b), nil); err != nil {
+		t.Errorf("Verify returned error %v", err)
+	}
+}
@@ -14,6 +14,10 @@
 
 package rpmpack
 
+import (
+	"path"
+)
+
 // dirIndex holds the index from files to directory names.
 type dirIndex struct {
 	m map[string]uint32
@@ -39,3 +43,48 @@ func (d *dirIndex) Get(value string) uint32 {
 func (d *dirIndex) AllDirs() []string {
 	return d.l
 }
+
+// NewDir returns an empty directory at destPath with the permission mode
+// perm, like %dir in a spec file. The package owns the directory: rpm creates
+// it on install and removes it on uninstall, unless it is not empty.
+// Without AddParentDirs, only the directories added explicitly are owned.
+func NewDir(destPath string, perm uint) RPMFile {
+	return RPMFile{
+		Name:  destPath,
+		Mode:  040000 | perm&07777,
+		Owner: "root",
+		Group: "root",
+	}
+}
+
+// addParentDirs adds the missing parent directories of all files. Like
+// rpmbuild, a relocatable package does not own the parents of its prefixes.
+func (r *RPM) addParentDirs() {
+	mode := r.DefaultDirMode
+	if mode == 0 {
+		mode = 0755
+	}
+	owner, group := r.DefaultDirOwner, r.DefaultDirGroup
+	if owner == "" {
+		owner = "root"
+	}
+	if group == "" {
+		group = "root"
+	}
+	missing := map[string]bool{}
+	for fn := range r.files {
+		for d := path.Dir(fn); d != "/" && d != "."; d = path.Dir(d) {
+			if _, ok := r.files[d]; !ok && r.underPrefixes(d) {
+				missing[d] = true
+			}
+		}
+	}
+	for d := range missing {
+		r.files[d] = RPMFile{
+			Name:  d,
+			Mode:  040000 | mode,
+			Owner: owner,
+			Group: group,
+		}
+	}
+}
@@ -15,6 +15,7 @@
 package rpmpack
 
 import (
+	"io/ioutil"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -61,3 +62,118 @@ func TestDirIndex(t *testing.T) {
 		})
 	}
 }
+
+func TestAddParentDirs(t *testing.T) {
+	testCases := []struct {
+		name          string
+		md            RPMMetaData
+		wantBasenames []string
+		wantFileModes []uint16
+		wantOwners    []string
+		wantGroups    []string
+	}{{
+		name:          "disabled",
+		md:            RPMMetaData{Summary: "summary"},
+		wantBasenames: []string{"config", "share", "file"},
+		wantFileModes: []uint16{0100644, 040700, 0100644},
+		wantOwners:    []string{"root", "root", "root"},
+		wantGroups:    []string{"root", "root", "root"},
+	}, {
+		name:          "default mode",
+		md:            RPMMetaData{AddParentDirs: true, Summary: "summary"},
+		wantBasenames: []string{"etc", "test", "config", "usr", "share", "test", "file"},
+		wantFileModes: []uint16{040755, 040755, 0100644, 040755, 040700, 040755, 0100644},
+		wantOwners:    []string{"root", "root", "root", "root", "root", "root", "root"},
+		wantGroups:    []string{"root", "root", "root", "root", "root", "root", "root"},
+	}, {
+		name:          "configured mode",
+		md:            RPMMetaData{AddParentDirs: true, DefaultDirMode: 0750, Summary: "summary"},
+		wantBasenames: []string{"etc", "test", "config", "usr", "share", "test", "file"},
+		wantFileModes: []uint16{040750, 040750, 0100644, 040750, 040700, 040750, 0100644},
+		wantOwners:    []string{"root", "root", "root", "root", "root", "root", "root"},
+		wantGroups:    []string{"root", "root", "root", "root", "root", "root", "root"},
+	}, {
+		name:          "configured owner",
+		md:            RPMMetaData{AddParentDirs: true, DefaultDirOwner: "app", DefaultDirGroup: "wheel", Summary: "summary"},
+		wantBasenames: []string{"etc", "test", "config", "usr", "share", "test", "file"},
+		wantFileModes: []uint16{040755, 040755, 0100644, 040755, 040700, 040755, 0100644},
+		wantOwners:    []string{"app", "app", "root", "app", "root", "app", "root"},
+		wantGroups:    []string{"wheel", "wheel", "root", "wheel", "root", "wheel", "root"},
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewRPM(tc.md)
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			r.AddFile(RPMFile{Name: "/etc/test/config", Mode: 0644})
+			r.AddFile(RPMFile{Name: "/usr/share/test/file", Mode: 0644})
+			r.AddFile(RPMFile{Name: "/usr/share", Mode: 040700})
+			if err := r.Write(ioutil.Discard); err != nil {
+				t.Fatalf("Write returned error %v", err)
+			}
+			if d := cmp.Diff(tc.wantBasenames, r.basenames); d != "" {
+				t.Errorf("basenames differ (want->got):\n%s", d)
+			}
+			if d := cmp.Diff(tc.wantFileModes, r.filemodes); d != "" {
+				t.Errorf("filemodes differ (want->got):\n%s", d)
+			}
+			if d := cmp.Diff(tc.wantOwners, r.fileowners); d != "" {
+				t.Errorf("fileowners differ (want->got):\n%s", d)
+			}
+			if d := cmp.Diff(tc.wantGroups, r.filegroups); d != "" {
+				t.Errorf("filegroups differ (want->got):\n%s", d)
+			}
+		})
+	}
+}
+
+func TestAddParentDirsPrefixes(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Summary: "summary", AddParentDirs: true, Prefixes: []string{"/opt/foo", "/etc/foo"}})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/opt/foo/bin/foo", Mode: 0755})
+	r.AddFile(RPMFile{Name: "/etc/foo/foo.conf", Mode: 0644})
+	if err := r.Write(ioutil.Discard); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	if d := cmp.Diff([]string{"foo", "foo.conf", "foo", "bin", "foo"}, r.basenames); d != "" {
+		t.Errorf("basenames differ (want->got):\n%s", d)
+	}
+	if d := cmp.Diff([]uint16{040755, 0100644, 040755, 040755, 0100755}, r.filemodes); d != "" {
+		t.Errorf("filemodes differ (want->got):\n%s", d)
+	}
+}
+
+func TestNewDir(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "dir", Summary: "summary", Compressor: "none"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(NewDir("/var/lib/dir", 0750))
+	b := buildRPM(t, r)
+	h := readHeader(t, b)
+	if got, want := h.getUint16s(tagFileModes), []uint16{040750}; !cmp.Equal(got, want) {
+		t.Errorf("FILEMODES = %o, want %o", got, want)
+	}
+	files := readArchive(t, b)
+	if len(files) != 1 {
+		t.Fatalf("payload has %d files, want 1", len(files))
+	}
+	if got := files[0]; got.Name != "/var/lib/dir" || got.Mode != 040750 || len(got.Body) != 0 || got.Links != 2 {
+		t.Errorf("payload entry %s has mode %o, %d links and content %q, want an empty directory", got.Name, got.Mode, got.Links, got.Body)
+	}
+
+	r, err = NewRPM(RPMMetaData{Name: "dir", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	d := NewDir("/var/lib/dir", 0755)
+	d.Body = []byte("content")
+	r.AddFile(d)
+	if err := r.Write(ioutil.Discard); err == nil {
+		t.Error("Write of a directory with content returned nil error")
+	}
+}
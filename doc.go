@@ -0,0 +1,83 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// docNoVerify are the attributes `rpm -V` does not check on doc files. Their
+// modification time changes whenever they are regenerated or copied, the
+// digest still catches changes to their content.
+const docNoVerify = VerifyMTime
+
+// DocDir returns the documentation directory of the package,
+// /usr/share/doc/<name>-<version>.
+func (r *RPM) DocDir() string {
+	return path.Join("/usr/share/doc", r.Name+"-"+r.Version)
+}
+
+// AddDoc adds a %doc file at name, relative to DocDir, owned by root with mode 0644,
+// whose modification time `rpm -V` does not check. DocDir and the directories
+// between it and the file are added too, so the package owns them. name must
+// stay under DocDir, "../x" is an error.
+func (r *RPM) AddDoc(name string, body []byte) error {
+	p := path.Join(r.DocDir(), name)
+	if !strings.HasPrefix(p, r.DocDir()+"/") {
+		return errors.Errorf("doc %q is not under %s", name, r.DocDir())
+	}
+	for d := path.Dir(p); d != path.Dir(r.DocDir()); d = path.Dir(d) {
+		if _, ok := r.files[d]; ok {
+			continue
+		}
+		if err := r.AddFile(RPMFile{
+			Name:  d,
+			Mode:  040755,
+			Owner: "root",
+			Group: "root",
+		}); err != nil {
+			return err
+		}
+	}
+	return r.AddFile(RPMFile{
+		Name:     p,
+		Body:     body,
+		Mode:     0100644,
+		Owner:    "root",
+		Group:    "root",
+		Type:     DocFile,
+		NoVerify: docNoVerify,
+	})
+}
+
+// AddDocTree adds all the docs, a map of paths relative to DocDir to contents,
+// with AddDoc, sorted by path. It stops at the first invalid path.
+func (r *RPM) AddDocTree(docs map[string][]byte) error {
+	names := make([]string, 0, len(docs))
+	for n := range docs {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		if err := r.AddDoc(n, docs[n]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAddDoc(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "docs", Version: "2.1", Release: "1", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddDoc("README", []byte("readme"))
+	r.AddDocTree(map[string][]byte{
+		"CHANGES":          []byte("changes"),
+		"examples/a.conf":  []byte("a"),
+		"examples/b/b.cfg": []byte("b"),
+	})
+	info, err := ReadRPMInfo(bytes.NewReader(buildRPM(t, r)))
+	if err != nil {
+		t.Fatalf("ReadRPMInfo returned error %v", err)
+	}
+	type file struct {
+		Name     string
+		Mode     uint
+		Type     FileType
+		NoVerify VerifyFlags
+	}
+	var got []file
+	for _, f := range info.Files {
+		got = append(got, file{f.Name, f.Mode, f.Type, f.NoVerify})
+	}
+	want := []file{
+		{"/usr/share/doc/docs-2.1", 040755, GenericFile, 0},
+		{"/usr/share/doc/docs-2.1/CHANGES", 0100644, DocFile, VerifyMTime},
+		{"/usr/share/doc/docs-2.1/README", 0100644, DocFile, VerifyMTime},
+		{"/usr/share/doc/docs-2.1/examples", 040755, GenericFile, 0},
+		{"/usr/share/doc/docs-2.1/examples/a.conf", 0100644, DocFile, VerifyMTime},
+		{"/usr/share/doc/docs-2.1/examples/b", 040755, GenericFile, 0},
+		{"/usr/share/doc/docs-2.1/examples/b/b.cfg", 0100644, DocFile, VerifyMTime},
+	}
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("doc files mismatch (-want +got):\n%s", d)
+	}
+}
+
+func TestAddDocOutsideDocDir(t *testing.T) {
+	for _, name := range []string{"../../x", "../docs-2.1x/README", "/../../etc/passwd", "", "."} {
+		r, err := NewRPM(RPMMetaData{Name: "docs", Version: "2.1", Release: "1", Summary: "summary"})
+		if err != nil {
+			t.Fatalf("NewRPM returned error %v", err)
+		}
+		if err := r.AddDoc(name, []byte("doc")); err == nil {
+			t.Errorf("AddDoc(%q) returned no error", name)
+		}
+		if len(r.files) != 0 {
+			t.Errorf("AddDoc(%q) added %d files", name, len(r.files))
+		}
+	}
+}
+
+func TestAddDocTreeOrder(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		r, err := NewRPM(RPMMetaData{Name: "docs", Version: "2.1", Release: "1", Summary: "summary"})
+		if err != nil {
+			t.Fatalf("NewRPM returned error %v", err)
+		}
+		err = r.AddDocTree(map[string][]byte{
+			"README":       []byte("readme"),
+			"../b/README":  []byte("b"),
+			"../c/README":  []byte("c"),
+			"examples/a.c": []byte("a"),
+		})
+		if err == nil || !strings.Contains(err.Error(), `"../b/README"`) {
+			t.Fatalf("AddDocTree returned error %v, want the error of ../b/README", err)
+		}
+		if len(r.files) != 0 {
+			t.Errorf("AddDocTree added %d files before ../b/README", len(r.files))
+		}
+	}
+}
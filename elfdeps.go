@@ -0,0 +1,246 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"debug/elf"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The ELF dependency generator mirrors elfdeps of rpmbuild.
+// https://github.com/rpm-software-management/rpm/blob/master/tools/elfdeps.c
+
+// elfDeps holds the dependencies of an ELF file.
+type elfDeps struct {
+	provides, requires []string
+}
+
+// elfDep returns the dependency name of a soname, like "libfoo.so.1()(64bit)"
+// or "libc.so.6(GLIBC_2.17)(64bit)" on 64 bit, and "libfoo.so.1" on 32 bit.
+func elfDep(soname, version, marker string) string {
+	if version == "" && marker == "" {
+		return soname
+	}
+	return soname + "(" + version + ")" + marker
+}
+
+// elfMarker returns the suffix of the dependencies of f.
+func elfMarker(f *elf.File) string {
+	// alpha doesn't traditionally have 64bit markers.
+	if f.Class == elf.ELFCLASS64 && f.Machine != elf.EM_ALPHA {
+		return "(64bit)"
+	}
+	return ""
+}
+
+// readELFDeps returns the dependencies of the ELF file name. Files which are
+// not ELF files have no dependencies.
+func readELFDeps(name string, ra io.ReaderAt) (*elfDeps, error) {
+	f, err := elf.NewFile(ra)
+	if err != nil {
+		// Not an ELF file, or not one that rpmbuild would understand either.
+		return &elfDeps{}, nil
+	}
+	defer f.Close()
+	d := &elfDeps{}
+	if f.Type != elf.ET_DYN && f.Type != elf.ET_EXEC {
+		return d, nil
+	}
+	marker := elfMarker(f)
+	verdefs, err := elfVerdefs(f)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range verdefs {
+		d.provides = append(d.provides, elfDep(v.soname, v.version, marker))
+	}
+	verneeds, err := elfVerneeds(f)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range verneeds {
+		d.requires = append(d.requires, elfDep(v.soname, v.version, marker))
+	}
+	needed, err := f.DynString(elf.DT_NEEDED)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the needed libraries")
+	}
+	for _, n := range needed {
+		if strings.TrimSpace(n) != "" {
+			d.requires = append(d.requires, elfDep(n, "", marker))
+		}
+	}
+	// Libraries with only the GNU hash table need a dynamic linker that
+	// understands it.
+	if f.Type == elf.ET_DYN && f.SectionByType(elf.SHT_GNU_HASH) != nil && f.SectionByType(elf.SHT_HASH) == nil {
+		d.requires = append(d.requires, "rtld(GNU_HASH)")
+	}
+	// Shared libraries provide their soname, or their file name if they have
+	// none. PIE executables are ET_DYN too, they are told apart by DT_DEBUG.
+	if f.Type == elf.ET_DYN && !elfHasDynTag(f, elf.DT_DEBUG) {
+		soname := path.Base(name)
+		if s, err := f.DynString(elf.DT_SONAME); err == nil && len(s) > 0 {
+			soname = s[0]
+		}
+		if strings.TrimSpace(soname) != "" {
+			d.provides = append(d.provides, elfDep(soname, "", marker))
+		}
+	}
+	return d, nil
+}
+
+// elfHasDynTag reports whether the dynamic section of f has an entry tag.
+func elfHasDynTag(f *elf.File, tag elf.DynTag) bool {
+	ds := f.SectionByType(elf.SHT_DYNAMIC)
+	if ds == nil {
+		return false
+	}
+	d, err := ds.Data()
+	if err != nil {
+		return false
+	}
+	size := 8
+	if f.Class == elf.ELFCLASS64 {
+		size = 16
+	}
+	for ; len(d) >= size; d = d[size:] {
+		var t uint64
+		if f.Class == elf.ELFCLASS64 {
+			t = f.ByteOrder.Uint64(d)
+		} else {
+			t = uint64(f.ByteOrder.Uint32(d))
+		}
+		if elf.DynTag(t) == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// elfVersion is a symbol version of a shared library.
+type elfVersion struct {
+	soname, version string
+}
+
+// elfStrings returns the string table linked from s.
+func elfStrings(f *elf.File, s *elf.Section) ([]byte, error) {
+	if int(s.Link) >= len(f.Sections) {
+		return nil, errors.Errorf("section %s links to a missing string table", s.Name)
+	}
+	return f.Sections[s.Link].Data()
+}
+
+// elfString returns the NUL terminated string at off of the string table.
+func elfString(table []byte, off uint32) string {
+	if int(off) >= len(table) {
+		return ""
+	}
+	s := table[off:]
+	if i := bytes.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	return string(s)
+}
+
+// elfVerdefs returns the versions defined by f, from the .gnu.version_d
+// section. The base definition names the library itself.
+func elfVerdefs(f *elf.File) ([]elfVersion, error) {
+	s := f.SectionByType(elf.SHT_GNU_VERDEF)
+	if s == nil {
+		return nil, nil
+	}
+	d, err := s.Data()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read version definitions")
+	}
+	strs, err := elfStrings(f, s)
+	if err != nil {
+		return nil, err
+	}
+	const verFlagBase = 0x1
+	var (
+		vs     []elfVersion
+		soname string
+	)
+	// Elf_Verdef is vd_version, vd_flags, vd_ndx and vd_cnt of 16 bits, then
+	// vd_hash, vd_aux and vd_next of 32 bits. Elf_Verdaux is vda_name and vda_next.
+	for off := 0; off+20 <= len(d); {
+		flags := f.ByteOrder.Uint16(d[off+2:])
+		aux := off + int(f.ByteOrder.Uint32(d[off+12:]))
+		next := int(f.ByteOrder.Uint32(d[off+16:]))
+		if aux+8 > len(d) || aux < off {
+			return nil, errors.New("invalid version definition")
+		}
+		name := elfString(strs, f.ByteOrder.Uint32(d[aux:]))
+		switch {
+		case flags&verFlagBase != 0:
+			soname = name
+		case soname != "":
+			vs = append(vs, elfVersion{soname, name})
+		}
+		if next == 0 {
+			break
+		}
+		off += next
+	}
+	return vs, nil
+}
+
+// elfVerneeds returns the versions f needs from other libraries, from the
+// .gnu.version_r section.
+func elfVerneeds(f *elf.File) ([]elfVersion, error) {
+	s := f.SectionByType(elf.SHT_GNU_VERNEED)
+	if s == nil {
+		return nil, nil
+	}
+	d, err := s.Data()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read version requirements")
+	}
+	strs, err := elfStrings(f, s)
+	if err != nil {
+		return nil, err
+	}
+	var vs []elfVersion
+	// Elf_Verneed is vn_version and vn_cnt of 16 bits, then vn_file, vn_aux and
+	// vn_next of 32 bits. Elf_Vernaux is vna_hash of 32 bits, vna_flags and
+	// vna_other of 16 bits, then vna_name and vna_next of 32 bits.
+	for off := 0; off+16 <= len(d); {
+		soname := elfString(strs, f.ByteOrder.Uint32(d[off+4:]))
+		aux := off + int(f.ByteOrder.Uint32(d[off+8:]))
+		next := int(f.ByteOrder.Uint32(d[off+12:]))
+		for {
+			if aux+16 > len(d) || aux < off {
+				return nil, errors.New("invalid version requirement")
+			}
+			vs = append(vs, elfVersion{soname, elfString(strs, f.ByteOrder.Uint32(d[aux+8:]))})
+			auxNext := int(f.ByteOrder.Uint32(d[aux+12:]))
+			if auxNext == 0 {
+				break
+			}
+			aux += auxNext
+		}
+		if next == 0 {
+			break
+		}
+		off += next
+	}
+	return vs, nil
+}
@@ -0,0 +1,243 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// testELF describes a minimal 64 bit little endian ELF file with only a
+// dynamic section and symbol versions.
+type testELF struct {
+	typ elf.Type
+	// soname is the DT_SONAME, if set.
+	soname string
+	// pie adds a DT_DEBUG entry, like executables have.
+	pie bool
+	// verdefs are the version definitions, the first one is the base.
+	verdefs []string
+	// needed are the DT_NEEDED libraries.
+	needed []string
+	// verneeds are the versions needed from other libraries.
+	verneeds []testVerneed
+	// gnuHash adds a .gnu.hash section without a .hash section.
+	gnuHash bool
+}
+
+type testVerneed struct {
+	file     string
+	versions []string
+}
+
+func (e testELF) bytes(t *testing.T) []byte {
+	t.Helper()
+	le := binary.LittleEndian
+	dynstr := []byte{0}
+	str := func(s string) uint32 {
+		off := uint32(len(dynstr))
+		dynstr = append(append(dynstr, s...), 0)
+		return off
+	}
+
+	dynamic := &bytes.Buffer{}
+	dyn := func(tag elf.DynTag, val uint64) {
+		binary.Write(dynamic, le, elf.Dyn64{Tag: int64(tag), Val: val})
+	}
+	if e.soname != "" {
+		dyn(elf.DT_SONAME, uint64(str(e.soname)))
+	}
+	for _, n := range e.needed {
+		dyn(elf.DT_NEEDED, uint64(str(n)))
+	}
+	if e.pie {
+		dyn(elf.DT_DEBUG, 0)
+	}
+	dyn(elf.DT_NULL, 0)
+
+	verdef := &bytes.Buffer{}
+	for i, v := range e.verdefs {
+		var flags uint16
+		if i == 0 {
+			flags = 1
+		}
+		next := uint32(28)
+		if i == len(e.verdefs)-1 {
+			next = 0
+		}
+		binary.Write(verdef, le, []uint16{1, flags, uint16(i + 1), 1})
+		binary.Write(verdef, le, []uint32{0, 20, next, str(v), 0})
+	}
+
+	verneed := &bytes.Buffer{}
+	for i, v := range e.verneeds {
+		next := uint32(16 + 16*len(v.versions))
+		if i == len(e.verneeds)-1 {
+			next = 0
+		}
+		binary.Write(verneed, le, []uint16{1, uint16(len(v.versions))})
+		binary.Write(verneed, le, []uint32{str(v.file), 16, next})
+		for j, n := range v.versions {
+			auxNext := uint32(16)
+			if j == len(v.versions)-1 {
+				auxNext = 0
+			}
+			binary.Write(verneed, le, uint32(0))
+			binary.Write(verneed, le, []uint16{0, uint16(j + 2)})
+			binary.Write(verneed, le, []uint32{str(n), auxNext})
+		}
+	}
+
+	shstrtab := []byte{0}
+	type section struct {
+		name       string
+		typ        elf.SectionType
+		data       []byte
+		link       uint32
+		entsize    uint64
+		nameOffset uint32
+	}
+	sections := []*section{
+		{},
+		{name: ".dynstr", typ: elf.SHT_STRTAB},
+		{name: ".dynamic", typ: elf.SHT_DYNAMIC, data: dynamic.Bytes(), link: 1, entsize: 16},
+		{name: ".gnu.version_d", typ: elf.SHT_GNU_VERDEF, data: verdef.Bytes(), link: 1},
+		{name: ".gnu.version_r", typ: elf.SHT_GNU_VERNEED, data: verneed.Bytes(), link: 1},
+	}
+	if e.gnuHash {
+		sections = append(sections, &section{name: ".gnu.hash", typ: elf.SHT_GNU_HASH})
+	}
+	sections = append(sections, &section{name: ".shstrtab", typ: elf.SHT_STRTAB})
+	for _, s := range sections[1:] {
+		s.nameOffset = uint32(len(shstrtab))
+		shstrtab = append(append(shstrtab, s.name...), 0)
+	}
+	sections[1].data = dynstr
+	sections[len(sections)-1].data = shstrtab
+
+	body := &bytes.Buffer{}
+	off := uint64(64)
+	var headers []elf.Section64
+	for _, s := range sections {
+		h := elf.Section64{Name: s.nameOffset, Type: uint32(s.typ), Link: s.link, Entsize: s.entsize}
+		if s.typ != elf.SHT_NULL {
+			h.Off, h.Size, h.Addralign = off, uint64(len(s.data)), 1
+			body.Write(s.data)
+			off += uint64(len(s.data))
+		}
+		headers = append(headers, h)
+	}
+	hdr := elf.Header64{
+		Type:      uint16(e.typ),
+		Machine:   uint16(elf.EM_X86_64),
+		Version:   uint32(elf.EV_CURRENT),
+		Shoff:     off,
+		Ehsize:    64,
+		Shentsize: 64,
+		Shnum:     uint16(len(sections)),
+		Shstrndx:  uint16(len(sections) - 1),
+	}
+	copy(hdr.Ident[:], elf.ELFMAG)
+	hdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	hdr.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	hdr.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+
+	b := &bytes.Buffer{}
+	if err := binary.Write(b, le, hdr); err != nil {
+		t.Fatalf("failed to write ELF header: %v", err)
+	}
+	b.Write(body.Bytes())
+	if err := binary.Write(b, le, headers); err != nil {
+		t.Fatalf("failed to write ELF section headers: %v", err)
+	}
+	return b.Bytes()
+}
+
+func TestELFDep(t *testing.T) {
+	for _, tc := range []struct {
+		soname, version, marker string
+		want                    string
+	}{
+		{"libfoo.so.1", "", "(64bit)", "libfoo.so.1()(64bit)"},
+		{"libc.so.6", "GLIBC_2.17", "(64bit)", "libc.so.6(GLIBC_2.17)(64bit)"},
+		{"libfoo.so.1", "", "", "libfoo.so.1"},
+		{"libc.so.6", "GLIBC_2.0", "", "libc.so.6(GLIBC_2.0)"},
+	} {
+		if got := elfDep(tc.soname, tc.version, tc.marker); got != tc.want {
+			t.Errorf("elfDep(%q, %q, %q) = %q, want %q", tc.soname, tc.version, tc.marker, got, tc.want)
+		}
+	}
+}
+
+func TestAutoProvides(t *testing.T) {
+	noSoname := testELF{typ: elf.ET_DYN}.bytes(t)
+	testCases := []struct {
+		name string
+		file RPMFile
+		want []string
+	}{{
+		name: "library",
+		file: RPMFile{Name: "/usr/lib64/libfoo.so.1.2", Mode: 0755, Body: testELF{
+			typ:     elf.ET_DYN,
+			soname:  "libfoo.so.1",
+			verdefs: []string{"libfoo.so.1", "FOO_1.0", "FOO_1.1"},
+		}.bytes(t)},
+		want: []string{"libfoo.so.1(FOO_1.0)(64bit)", "libfoo.so.1(FOO_1.1)(64bit)", "libfoo.so.1()(64bit)"},
+	}, {
+		name: "no soname",
+		file: RPMFile{Name: "/usr/lib64/libbar.so.2", Mode: 0755, Body: noSoname},
+		want: []string{"libbar.so.2()(64bit)"},
+	}, {
+		name: "reader",
+		file: RPMFile{Name: "/usr/lib64/libbar.so.2", Mode: 0755, Reader: bytes.NewReader(noSoname), Size: int64(len(noSoname))},
+		want: []string{"libbar.so.2()(64bit)"},
+	}, {
+		name: "pie",
+		file: RPMFile{Name: "/usr/bin/foo", Mode: 0755, Body: testELF{typ: elf.ET_DYN, pie: true}.bytes(t)},
+	}, {
+		name: "not executable",
+		file: RPMFile{Name: "/usr/lib64/libfoo.so.1", Mode: 0644, Body: testELF{typ: elf.ET_DYN, soname: "libfoo.so.1"}.bytes(t)},
+	}, {
+		name: "not elf",
+		file: RPMFile{Name: "/usr/bin/foo", Mode: 0755, Body: []byte("#!/bin/sh\necho foo\n")},
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewRPM(RPMMetaData{Name: "test", Version: "1.0", Summary: "summary", AutoProvides: true})
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			r.AddFile(tc.file)
+			if err := r.Write(ioutil.Discard); err != nil {
+				t.Fatalf("Write returned error %v", err)
+			}
+			var got []string
+			for _, p := range r.Provides {
+				if p.Sense&SenseFindProvides != 0 {
+					got = append(got, p.Name)
+				}
+			}
+			if d := cmp.Diff(tc.want, got); d != "" {
+				t.Errorf("unexpected provides (-want, +got): %s", d)
+			}
+		})
+	}
+}
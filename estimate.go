@@ -0,0 +1,73 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"io"
+)
+
+// signatureAllowance is the room EstimateSize leaves for each signature of a
+// signed package. An OpenPGP signature by a 4096 bit RSA key takes about 540
+// bytes.
+const signatureAllowance = 1024
+
+// SizeEstimate is the size of an rpm file predicted by EstimateSize.
+type SizeEstimate struct {
+	// Header is the size of the lead, the signature header and the header.
+	// It is exact for unsigned packages of less than 4GiB, and an upper bound
+	// for signed packages.
+	Header int64
+	// Payload is the size of the uncompressed payload, which is exact with
+	// the "none" compressor, and an upper bound of the compressed payload for
+	// all but incompressible content.
+	Payload int64
+}
+
+// Total returns the estimated size of the rpm file.
+func (s SizeEstimate) Total() int64 {
+	return s.Header + s.Payload
+}
+
+// EstimateSize predicts the size of the rpm file Write would produce, without
+// compressing the payload nor signing, so that storage can be allocated or
+// repository limits checked before the expensive Write. The content of the
+// files is read, like Write does, to compute the file digests, except for
+// files added with a Reader, which are not consumed.
+func (r *RPM) EstimateSize() (SizeEstimate, error) {
+	c, err := r.describeClone()
+	if err != nil {
+		return SizeEstimate{}, err
+	}
+	// The payload is not compressed, but the header names the compressor of r.
+	c.compressedPayload = nopWriteCloser{c.payload}
+	c.progress = &progressWriter{w: io.MultiWriter(c.compressedPayload, c.archiveDigest)}
+	c.cpio = newCPIOWriter(c.progress)
+	hb, s, err := c.buildHeaders()
+	if err != nil {
+		return SizeEstimate{}, err
+	}
+	if r.headerSigner != nil {
+		s.Add(sigRSA, EntryBytes(make([]byte, signatureAllowance)))
+	}
+	if r.pgpSigner != nil {
+		s.Add(sigPGP, EntryBytes(make([]byte, signatureAllowance)))
+	}
+	sb, err := s.Bytes()
+	if err != nil {
+		return SizeEstimate{}, err
+	}
+	header := 0x60 + len(sb) + len(signaturePadding(len(sb))) + len(hb)
+	return SizeEstimate{Header: int64(header), Payload: c.payload.n}, nil
+}
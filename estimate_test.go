@@ -0,0 +1,74 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEstimateSize(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		compressor string
+		signed     bool
+		opts       []Option
+	}{
+		{"none", "none", false, nil},
+		{"gzip", "gzip", false, nil},
+		{"zstd", "zstd", false, nil},
+		{"xz", "xz", true, nil},
+		{"el7", "gzip", false, []Option{WithProfile(ProfileEL7)}},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewRPM(RPMMetaData{Name: "estimate", Version: "1.0", Summary: "summary", Licence: "MIT", Compressor: tc.compressor}, tc.opts...)
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			content := strings.Repeat("estimate ", 1000)
+			r.AddFile(RPMFile{Name: "/usr/share/estimate/body", Body: []byte(content)})
+			r.AddFile(RPMFile{Name: "/usr/share/estimate/reader", Reader: strings.NewReader(content), Size: int64(len(content))})
+			r.AddPostin("echo postin")
+			if tc.signed {
+				if err := r.SetPGPKey(newTestEntity(t, "signer")); err != nil {
+					t.Fatalf("SetPGPKey returned error %v", err)
+				}
+			}
+			e, err := r.EstimateSize()
+			if err != nil {
+				t.Fatalf("EstimateSize returned error %v", err)
+			}
+			b := buildRPM(t, r)
+			header := int64(len(b) - len(readPayload(t, b)))
+			payload := int64(len(b)) - header
+			switch {
+			case tc.signed && (e.Header < header || e.Header > header+2*signatureAllowance):
+				t.Errorf("estimated header size %d, want at least %d", e.Header, header)
+			case !tc.signed && e.Header != header:
+				t.Errorf("estimated header size %d, want %d", e.Header, header)
+			}
+			if tc.compressor == "none" && e.Payload != payload || e.Payload < payload {
+				t.Errorf("estimated payload size %d, the payload has %d bytes", e.Payload, payload)
+			}
+			if e.Total() != e.Header+e.Payload {
+				t.Errorf("Total() = %d, want %d", e.Total(), e.Header+e.Payload)
+			}
+			if files := extractRPM(t, b); files["/usr/share/estimate/reader"] != content {
+				t.Errorf("EstimateSize consumed the reader of a file")
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// PayloadReader reads the files of the payload of an rpm file, the way
+// archive/tar.Reader does: Next advances to the next file, and Read reads
+// its content.
+//
+// The files are read in the order of the payload. Some files of the header
+// may not be in it, rpmbuild leaves ghost files out. The files of a hard link
+// set are all read, but only the last one has content.
+type PayloadReader struct {
+	r      *bufio.Reader
+	closer io.Closer
+	files  []FileInfo
+	index  map[string]int
+	// left is the content of the current file not read yet, pad the padding
+	// after it.
+	left, pad int64
+	done      bool
+}
+
+// Payload returns a reader of the payload of p, read from r, which must be
+// at the start of the payload, where ReadPackage stops reading.
+// The returned reader must be closed, to release the decompressor.
+func (p *Package) Payload(r io.Reader) (*PayloadReader, error) {
+	return p.payload(r, nil)
+}
+
+// payload returns a reader of the payload of p, which also writes the
+// uncompressed payload to archive, if set.
+func (p *Package) payload(r io.Reader, archive io.Writer) (*PayloadReader, error) {
+	info, err := p.Info()
+	if err != nil {
+		return nil, err
+	}
+	z, closer, err := payloadDecompressor(info.PayloadCompressor, bufio.NewReader(r))
+	if err != nil {
+		return nil, err
+	}
+	if archive != nil {
+		z = io.TeeReader(z, archive)
+	}
+	pr := &PayloadReader{
+		r:      bufio.NewReader(z),
+		closer: closer,
+		files:  info.Files,
+		index:  make(map[string]int),
+	}
+	for ii, f := range info.Files {
+		pr.index[f.Name] = ii
+	}
+	return pr, nil
+}
+
+// payloadDecompressor returns a reader decompressing r with the
+// PAYLOADCOMPRESSOR compressor, and the closer releasing it, if any.
+func payloadDecompressor(compressor string, r *bufio.Reader) (io.Reader, io.Closer, error) {
+	var z io.Reader
+	var err error
+	switch compressor {
+	case "":
+		// Like rpm, read payloads without PAYLOADCOMPRESSOR as gzip or as is.
+		if magic, _ := r.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+			z, err = gzip.NewReader(r)
+		} else {
+			z = r
+		}
+	case "gzip":
+		z, err = gzip.NewReader(r)
+	case "bzip2":
+		z = bzip2.NewReader(r)
+	case "xz":
+		z, err = xz.NewReader(r)
+	case "lzma":
+		z, err = lzma.NewReader(r)
+	case "zstd":
+		d, derr := zstd.NewReader(r)
+		if derr != nil {
+			return nil, nil, errors.Wrap(derr, "failed to create payload decompressor")
+		}
+		return d, closerFunc(d.Close), nil
+	default:
+		return nil, nil, errors.Errorf("unknown payload compressor %q", compressor)
+	}
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to create payload decompressor")
+	}
+	return z, nil, nil
+}
+
+type closerFunc func()
+
+func (f closerFunc) Close() error {
+	f()
+	return nil
+}
+
+// Next advances to the next file of the payload, and returns it as recorded
+// in the header. It returns io.EOF at the end of the payload.
+func (pr *PayloadReader) Next() (FileInfo, error) {
+	if pr.done {
+		return FileInfo{}, io.EOF
+	}
+	if _, err := io.CopyN(ioutil.Discard, pr.r, pr.left+pr.pad); err != nil {
+		return FileInfo{}, errors.Wrap(err, "failed to skip payload file")
+	}
+	pr.left, pr.pad = 0, 0
+	magic := make([]byte, 6)
+	if _, err := io.ReadFull(pr.r, magic); err != nil {
+		return FileInfo{}, errors.Wrap(err, "failed to read payload file header")
+	}
+	switch string(magic) {
+	case "070701", "070702":
+		return pr.nextNewc()
+	case "07070X":
+		return pr.nextStripped()
+	default:
+		return FileInfo{}, errors.Errorf("unknown cpio magic %q in payload", magic)
+	}
+}
+
+// nextNewc reads the rest of a newc cpio header, 13 hexadecimal fields and
+// the name, padded to 4 bytes with the magic.
+func (pr *PayloadReader) nextNewc() (FileInfo, error) {
+	b := make([]byte, 13*8)
+	if _, err := io.ReadFull(pr.r, b); err != nil {
+		return FileInfo{}, errors.Wrap(err, "failed to read payload file header")
+	}
+	field := func(i int) (int64, error) {
+		return strconv.ParseInt(string(b[8*i:8*i+8]), 16, 64)
+	}
+	size, err := field(6)
+	if err != nil {
+		return FileInfo{}, errors.Wrap(err, "invalid payload file size")
+	}
+	namesize, err := field(11)
+	if err != nil || namesize < 1 {
+		return FileInfo{}, errors.Errorf("invalid payload file name size %q", b[88:96])
+	}
+	name := make([]byte, namesize+pad4(110+namesize))
+	if _, err := io.ReadFull(pr.r, name); err != nil {
+		return FileInfo{}, errors.Wrap(err, "failed to read payload file name")
+	}
+	n := string(name[:namesize-1])
+	if n == "TRAILER!!!" {
+		pr.done = true
+		return FileInfo{}, io.EOF
+	}
+	// rpm writes ./usr/bin/foo, rpmpack /usr/bin/foo.
+	n = "/" + strings.TrimPrefix(strings.TrimPrefix(n, "."), "/")
+	ii, ok := pr.index[n]
+	if !ok {
+		return FileInfo{}, errors.Errorf("payload file %s is not in the header", n)
+	}
+	pr.left, pr.pad = size, pad4(size)
+	return pr.files[ii], nil
+}
+
+// nextStripped reads the rest of a stripped cpio header of rpm, the index of
+// the file in the header in hexadecimal and 2 bytes of padding. The size of
+// the file is in the header.
+func (pr *PayloadReader) nextStripped() (FileInfo, error) {
+	b := make([]byte, 8+2)
+	if _, err := io.ReadFull(pr.r, b); err != nil {
+		return FileInfo{}, errors.Wrap(err, "failed to read payload file header")
+	}
+	ii, err := strconv.ParseUint(string(b[:8]), 16, 64)
+	if err != nil || ii >= uint64(len(pr.files)) {
+		return FileInfo{}, errors.Errorf("invalid payload file index %q", b[:8])
+	}
+	f := pr.files[ii]
+	pr.left, pr.pad = f.Size, pad4(f.Size)
+	return f, nil
+}
+
+func pad4(n int64) int64 {
+	return (4 - n%4) % 4
+}
+
+// Read reads the content of the current file. It returns io.EOF at the end
+// of the file.
+func (pr *PayloadReader) Read(p []byte) (int, error) {
+	if pr.left == 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > pr.left {
+		p = p[:pr.left]
+	}
+	n, err := pr.r.Read(p)
+	pr.left -= int64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// Close releases the decompressor. It does not close the underlying reader.
+func (pr *PayloadReader) Close() error {
+	if pr.closer != nil {
+		return pr.closer.Close()
+	}
+	return nil
+}
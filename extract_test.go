@@ -0,0 +1,158 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// extractRPM returns the content of the files of the payload of the rpm
+// file b, by name.
+func extractRPM(t *testing.T, b []byte) map[string]string {
+	t.Helper()
+	rd := bytes.NewReader(b)
+	p, err := ReadPackage(rd)
+	if err != nil {
+		t.Fatalf("ReadPackage returned error %v", err)
+	}
+	pr, err := p.Payload(rd)
+	if err != nil {
+		t.Fatalf("Payload returned error %v", err)
+	}
+	defer pr.Close()
+	files := make(map[string]string)
+	for {
+		f, err := pr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatalf("Next returned error %v", err)
+		}
+		body, err := ioutil.ReadAll(pr)
+		if err != nil {
+			t.Fatalf("reading %s returned error %v", f.Name, err)
+		}
+		files[f.Name] = string(body)
+	}
+}
+
+func TestPayloadReader(t *testing.T) {
+	for _, compressor := range []string{"gzip", "xz", "lzma", "zstd", "none"} {
+		t.Run(compressor, func(t *testing.T) {
+			r, err := NewRPM(RPMMetaData{Name: "extract", Summary: "summary", Compressor: compressor})
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			r.AddFile(RPMFile{Name: "/opt/extract", Mode: 040755})
+			r.AddFile(RPMFile{Name: "/opt/extract/a", Body: []byte("a")})
+			r.AddFile(RPMFile{Name: "/opt/extract/bcdef", Body: []byte("bcdef")})
+			r.AddFile(NewSymlink("/opt/extract/link", "a"))
+			r.AddFile(RPMFile{Name: "/opt/extract/ghost", Type: GhostFile})
+			want := map[string]string{
+				"/opt/extract":       "",
+				"/opt/extract/a":     "a",
+				"/opt/extract/bcdef": "bcdef",
+				"/opt/extract/ghost": "",
+				"/opt/extract/link":  "a",
+			}
+			if d := cmp.Diff(want, extractRPM(t, buildRPM(t, r))); d != "" {
+				t.Errorf("payload differs (-want +got):\n%s", d)
+			}
+		})
+	}
+}
+
+func TestPayloadReaderSkipsUnread(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "extract", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/a", Body: []byte("abcdef")})
+	r.AddFile(RPMFile{Name: "/b", Body: []byte("b")})
+	rd := bytes.NewReader(buildRPM(t, r))
+	p, err := ReadPackage(rd)
+	if err != nil {
+		t.Fatalf("ReadPackage returned error %v", err)
+	}
+	pr, err := p.Payload(rd)
+	if err != nil {
+		t.Fatalf("Payload returned error %v", err)
+	}
+	defer pr.Close()
+	if f, err := pr.Next(); err != nil || f.Name != "/a" || f.Size != 6 {
+		t.Fatalf("Next() = %+v, %v, want /a", f, err)
+	}
+	if _, err := pr.Read(make([]byte, 2)); err != nil {
+		t.Fatalf("Read returned error %v", err)
+	}
+	if f, err := pr.Next(); err != nil || f.Name != "/b" {
+		t.Fatalf("Next() = %+v, %v, want /b", f, err)
+	}
+	if _, err := pr.Next(); err != io.EOF {
+		t.Errorf("Next() at the end returned error %v, want io.EOF", err)
+	}
+}
+
+func TestPayloadReaderLargeFiles(t *testing.T) {
+	defer func(l int64) { longSizeLimit = l }(longSizeLimit)
+	longSizeLimit = 4
+
+	r, err := NewRPM(RPMMetaData{Name: "extract", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/large", Body: []byte("abcdefg")})
+	r.AddFile(RPMFile{Name: "/small", Body: []byte("xy")})
+	want := map[string]string{"/large": "abcdefg", "/small": "xy"}
+	if d := cmp.Diff(want, extractRPM(t, buildRPM(t, r))); d != "" {
+		t.Errorf("payload differs (-want +got):\n%s", d)
+	}
+}
+
+func TestPayloadReaderHardlinks(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "extract", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/a", Body: []byte("data")})
+	if err := r.AddHardlink("/b", "/a"); err != nil {
+		t.Fatalf("AddHardlink returned error %v", err)
+	}
+	// Only the last file of the set has content.
+	want := map[string]string{"/a": "", "/b": "data"}
+	if d := cmp.Diff(want, extractRPM(t, buildRPM(t, r))); d != "" {
+		t.Errorf("payload differs (-want +got):\n%s", d)
+	}
+}
+
+func TestPayloadReaderStrippedIndex(t *testing.T) {
+	for _, index := range []string{"00000001", "-0000001", "+0000000", "0000000x"} {
+		pr := &PayloadReader{
+			r:     bufio.NewReader(strings.NewReader("07070X" + index + "\x00\x00")),
+			files: []FileInfo{{RPMFile: RPMFile{Name: "/a"}}},
+		}
+		if f, err := pr.Next(); err == nil {
+			t.Errorf("Next() of stripped index %q = %+v, want an error", index, f)
+		}
+	}
+}
@@ -1,5 +1,13 @@
 package rpmpack
 
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
 // FileType is the type of a file inside a RPM package.
 type FileType int32
 
@@ -33,6 +41,170 @@ const (
 	ReadmeFile
 	// ExcludeFile is not a part of the package, and should not be installed.
 	ExcludeFile
+	// UnpatchedFile is reserved for future use; conforming packages may not use this flag.
+	UnpatchedFile
+	// PubkeyFile is a public key.
+	PubkeyFile
+	// ArtifactFile is a build side-effect, like a build-id link or an SBOM, rather than
+	// a file of the package proper. It is neither a config nor a doc file.
+	ArtifactFile
+)
+
+// fileDirectives are the %files directives of a spec file, in the order
+// String writes them. %config is handled separately, for its options.
+var fileDirectives = []struct {
+	name string
+	t    FileType
+}{
+	{"doc", DocFile},
+	{"license", LicenceFile},
+	{"readme", ReadmeFile},
+	{"pubkey", PubkeyFile},
+	{"artifact", ArtifactFile},
+	{"ghost", GhostFile},
+	{"missingok", MissingOkFile},
+}
+
+// ParseFileType parses the attributes of a file as written in the %files
+// section of a spec file, like "%config(noreplace) %ghost", and returns the
+// flags they set. The % is optional and directives are separated by spaces.
+// %config takes the options noreplace and missingok, like
+// "%config(noreplace,missingok)", and "noreplace" on its own is short for
+// %config(noreplace). "licence" is accepted for %license.
+func ParseFileType(s string) (FileType, error) {
+	var t FileType
+	for _, d := range splitDirectives(s) {
+		name, opts := strings.TrimPrefix(d, "%"), ""
+		if i := strings.Index(name, "("); i >= 0 {
+			if !strings.HasSuffix(name, ")") {
+				return 0, errors.Errorf("invalid file attribute %q: unbalanced parentheses", d)
+			}
+			name, opts = name[:i], name[i+1:len(name)-1]
+		}
+		switch name {
+		case "config":
+			t |= ConfigFile
+			for _, o := range strings.FieldsFunc(opts, func(r rune) bool { return r == ',' || r == ' ' }) {
+				switch o {
+				case "noreplace":
+					t |= NoReplaceFile
+				case "missingok":
+					t |= MissingOkFile
+				default:
+					return 0, errors.Errorf("invalid file attribute %q: unknown %%config option %q", d, o)
+				}
+			}
+			continue
+		case "noreplace":
+			name, t = "", t|ConfigFile|NoReplaceFile
+		case "licence":
+			name = "license"
+		}
+		if opts != "" {
+			return 0, errors.Errorf("invalid file attribute %q: %%%s takes no options", d, name)
+		}
+		if name == "" {
+			continue
+		}
+		found := false
+		for _, fd := range fileDirectives {
+			if fd.name == name {
+				t |= fd.t
+				found = true
+			}
+		}
+		if !found {
+			return 0, errors.Errorf("unknown file attribute %q", d)
+		}
+	}
+	return t, nil
+}
+
+// splitDirectives splits s at the spaces outside of parentheses.
+func splitDirectives(s string) []string {
+	var ds []string
+	depth, start := 0, -1
+	for i, c := range s {
+		switch {
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ' ' || c == '\t':
+			if depth == 0 {
+				if start >= 0 {
+					ds = append(ds, s[start:i])
+				}
+				start = -1
+				continue
+			}
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		ds = append(ds, s[start:])
+	}
+	return ds
+}
+
+// String returns the file attributes in the syntax of the %files section of
+// a spec file, like "%config(noreplace) %ghost", as parsed by ParseFileType.
+// Flags without a directive are written as a number.
+func (t FileType) String() string {
+	var ds []string
+	rest := t
+	if t&ConfigFile != 0 {
+		var opts []string
+		if t&NoReplaceFile != 0 {
+			opts = append(opts, "noreplace")
+		}
+		if t&MissingOkFile != 0 {
+			opts = append(opts, "missingok")
+		}
+		d := "%config"
+		if len(opts) > 0 {
+			d += "(" + strings.Join(opts, ",") + ")"
+		}
+		ds = append(ds, d)
+		rest &^= ConfigFile | NoReplaceFile | MissingOkFile
+	}
+	for _, fd := range fileDirectives {
+		if rest&fd.t != 0 {
+			ds = append(ds, "%"+fd.name)
+			rest &^= fd.t
+		}
+	}
+	if rest != 0 {
+		ds = append(ds, fmt.Sprintf("%#x", uint32(rest)))
+	}
+	return strings.Join(ds, " ")
+}
+
+// VerifyFlags selects the file attributes `rpm -V` checks, the RPMVERIFY_* values of rpm.
+// https://github.com/rpm-software-management/rpm/blob/master/include/rpm/rpmfiles.h
+type VerifyFlags uint32
+
+const (
+	// VerifyDigest checks the file content digest.
+	VerifyDigest VerifyFlags = 1 << iota
+	// VerifySize checks the file size.
+	VerifySize
+	// VerifyLinkTo checks the symlink target.
+	VerifyLinkTo
+	// VerifyUser checks the file owner.
+	VerifyUser
+	// VerifyGroup checks the file group.
+	VerifyGroup
+	// VerifyMTime checks the file modification time.
+	VerifyMTime
+	// VerifyMode checks the file mode.
+	VerifyMode
+	// VerifyRdev checks the device number.
+	VerifyRdev
+	// VerifyCaps checks the file capabilities.
+	VerifyCaps
 )
 
 // RPMFile contains a particular file's entry and data.
@@ -44,4 +216,85 @@ type RPMFile struct {
 	Group string
 	MTime uint32
 	Type  FileType
+	// NoVerify are the attributes `rpm -V` should not check, the equivalent of
+	// %verify(not ...) in a spec file. By default everything is verified.
+	NoVerify VerifyFlags
+	// Caps are the POSIX capabilities rpm sets on a regular file when installing
+	// it, in the text form of cap_from_text(3) like "cap_net_bind_service+ep",
+	// the equivalent of %caps in a spec file.
+	Caps string
+	// SELinuxContext is the security context of the file, like
+	// "system_u:object_r:httpd_exec_t:s0", written to FILECONTEXTS. rpm labels
+	// the files it installs with the contexts of the loaded policy, so the
+	// context only takes effect without a relabel if the policy has a
+	// matching file context rule, for example one added by semanage fcontext
+	// in the policy package it depends on.
+	SELinuxContext string
+	// Lang is the language of the file, like "de" or "pt_BR", the equivalent
+	// of %lang in a spec file. rpm only installs it if the language is in
+	// %_install_langs. Several languages are separated by "|", like "de|fr".
+	Lang string
+	// Reader, if set, is the content of a regular file, read by Write instead
+	// of Body, so that large files do not have to be held in memory.
+	// Size must be its exact length in bytes. Files of 4 GiB or more make
+	// the package require rpmlib(LargeFiles), rpm 4.12 or later.
+	// Write reads the content once per pass over the payload, seeking back to
+	// where it started if Reader is an io.Seeker. The content of other readers
+	// is copied to a temporary file by the first pass, until Write returns.
+	Reader io.Reader
+	Size   int64
+	// DevMajor and DevMinor are the device number of a character (020000) or
+	// block (060000) device. rpm stores it in 16 bits, so both must be below 256.
+	DevMajor, DevMinor uint32
+}
+
+// NewSymlink returns a symlink at destPath pointing to target. The target of a
+// symlink is its Body, which is the content of its payload entry and its
+// FILELINKTOS value.
+func NewSymlink(destPath, target string) RPMFile {
+	return RPMFile{
+		Name:  destPath,
+		Body:  []byte(target),
+		Mode:  0120777,
+		Owner: "root",
+		Group: "root",
+	}
+}
+
+// NewDevice returns a character or block device node at destPath. mode holds
+// the file type, 020000 or 060000, and the permissions.
+func NewDevice(destPath string, mode uint, major, minor uint32) RPMFile {
+	return RPMFile{
+		Name:     destPath,
+		Mode:     mode,
+		Owner:    "root",
+		Group:    "root",
+		DevMajor: major,
+		DevMinor: minor,
+	}
+}
+
+// NewFIFO returns a named pipe at destPath with the permissions perm.
+func NewFIFO(destPath string, perm uint) RPMFile {
+	return RPMFile{
+		Name:  destPath,
+		Mode:  010000 | perm&07777,
+		Owner: "root",
+		Group: "root",
+	}
+}
+
+// NewArtifactFile returns a regular file flagged as an artifact, for example an SBOM
+// shipped with the package. rpm -V does not check the content, size and mtime
+// of the file, so it can be regenerated after installation.
+func NewArtifactFile(destPath string, body []byte) RPMFile {
+	return RPMFile{
+		Name:     destPath,
+		Body:     body,
+		Mode:     0100644,
+		Owner:    "root",
+		Group:    "root",
+		Type:     ArtifactFile,
+		NoVerify: VerifyDigest | VerifySize | VerifyMTime,
+	}
 }
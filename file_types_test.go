@@ -1,7 +1,11 @@
 package rpmpack
 
 import (
+	"bytes"
+	"io/ioutil"
 	"testing"
+
+	"github.com/google/go-cmp/cmp"
 )
 
 func TestFileTypeSetting(t *testing.T) {
@@ -30,3 +34,141 @@ func TestFileTypeCombining(t *testing.T) {
 		t.Error("Combining file types should have the bitmask of both")
 	}
 }
+
+func TestNewArtifactFile(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "sbom", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(NewArtifactFile("/usr/share/sbom/sbom.json", []byte("{}")))
+	r.AddFile(RPMFile{Name: "/usr/share/sbom/README", Body: []byte("readme")})
+	if err := r.Write(ioutil.Discard); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	if d := cmp.Diff([]uint32{0, 4096}, r.fileflags); d != "" {
+		t.Errorf("fileflags differ (want->got):\n%s", d)
+	}
+	if d := cmp.Diff([]uint32{0xffffffff, 0xffffffdc}, r.fileverifyflags); d != "" {
+		t.Errorf("fileverifyflags differ (want->got):\n%s", d)
+	}
+	if r.filemodes[1] != 0100644 {
+		t.Errorf("artifact file mode = %o, want 0100644", r.filemodes[1])
+	}
+}
+
+func TestParseFileType(t *testing.T) {
+	testCases := []struct {
+		in       string
+		want     FileType
+		wantText string
+	}{
+		{"", GenericFile, ""},
+		{"%config", ConfigFile, "%config"},
+		{"%config(noreplace)", ConfigFile | NoReplaceFile, "%config(noreplace)"},
+		{"noreplace", ConfigFile | NoReplaceFile, "%config(noreplace)"},
+		{"%config(missingok, noreplace)", ConfigFile | NoReplaceFile | MissingOkFile, "%config(noreplace,missingok)"},
+		{"%config(noreplace) %ghost", ConfigFile | NoReplaceFile | GhostFile, "%config(noreplace) %ghost"},
+		{"%doc %license", DocFile | LicenceFile, "%doc %license"},
+		{"licence", LicenceFile, "%license"},
+		{"%ghost %missingok", GhostFile | MissingOkFile, "%ghost %missingok"},
+		{"%artifact", ArtifactFile, "%artifact"},
+		{"readme pubkey", ReadmeFile | PubkeyFile, "%readme %pubkey"},
+	}
+	for _, tc := range testCases {
+		got, err := ParseFileType(tc.in)
+		if err != nil {
+			t.Errorf("ParseFileType(%q) returned error %v", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("ParseFileType(%q) = %#x, want %#x", tc.in, uint32(got), uint32(tc.want))
+		}
+		if got.String() != tc.wantText {
+			t.Errorf("ParseFileType(%q).String() = %q, want %q", tc.in, got.String(), tc.wantText)
+		}
+	}
+
+	for _, in := range []string{"executable", "%config(sometimes)", "%doc(x)", "%config(noreplace"} {
+		if _, err := ParseFileType(in); err == nil {
+			t.Errorf("ParseFileType(%q) returned nil error", in)
+		}
+	}
+	if got, want := (SpecFile | DocFile).String(), "%doc 0x20"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestSymlink(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "link", Summary: "summary", Compressor: "none"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(NewSymlink("/usr/bin/link", "/usr/libexec/target"))
+	b := buildRPM(t, r)
+	h := readHeader(t, b)
+	if got, want := h.getStrings(tagFileLinkTos), []string{"/usr/libexec/target"}; !cmp.Equal(got, want) {
+		t.Errorf("FILELINKTOS = %q, want %q", got, want)
+	}
+	if got, want := h.getUint16s(tagFileModes), []uint16{0120777}; !cmp.Equal(got, want) {
+		t.Errorf("FILEMODES = %o, want %o", got, want)
+	}
+	files := readArchive(t, b)
+	if len(files) != 1 {
+		t.Fatalf("payload has %d files, want 1", len(files))
+	}
+	// The cpio reader returns the content of a symlink as Linkname.
+	if got := files[0]; got.Mode != 0120777 || got.Linkname != "/usr/libexec/target" {
+		t.Errorf("payload entry has mode %o and content %q, want a symlink to /usr/libexec/target", got.Mode, got.Linkname)
+	}
+
+	r, err = NewRPM(RPMMetaData{Name: "link", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(NewSymlink("/usr/bin/link", ""))
+	if err := r.Write(ioutil.Discard); err == nil {
+		t.Error("Write of a symlink without target returned nil error")
+	}
+}
+
+func TestDevices(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "dev", Summary: "summary", Compressor: "none"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(NewDevice("/dev/null", 020666, 1, 3))
+	r.AddFile(NewDevice("/dev/sda", 060660, 8, 0))
+	r.AddFile(NewFIFO("/run/fifo", 0600))
+	b := buildRPM(t, r)
+	h := readHeader(t, b)
+	if got, want := h.getUint16s(tagFileRDevs), []uint16{0x0103, 0x0800, 1}; !cmp.Equal(got, want) {
+		t.Errorf("FILERDEVS = %#x, want %#x", got, want)
+	}
+	if got, want := h.getUint32s(tagFileSizes), []uint32{0, 0, 0}; !cmp.Equal(got, want) {
+		t.Errorf("FILESIZES = %d, want %d", got, want)
+	}
+	for _, f := range readArchive(t, b) {
+		if f.Size != 0 {
+			t.Errorf("payload entry %s has size %d, want 0", f.Name, f.Size)
+		}
+		if f.Mode&0170000 == 0100000 {
+			t.Errorf("payload entry %s is a regular file", f.Name)
+		}
+	}
+	info, err := ReadRPMInfo(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("ReadRPMInfo returned error %v", err)
+	}
+	if f := info.Files[0]; f.Mode != 020666 || f.DevMajor != 1 || f.DevMinor != 3 {
+		t.Errorf("ReadRPMInfo: %s has mode %o and number %d:%d, want 20666 and 1:3", f.Name, f.Mode, f.DevMajor, f.DevMinor)
+	}
+
+	r, err = NewRPM(RPMMetaData{Name: "dev", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(NewDevice("/dev/big", 020600, 259, 0))
+	if err := r.Write(ioutil.Discard); err == nil {
+		t.Error("Write of a device with major 259 returned nil error")
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// File colors, as rpmfc sets them. When two packages install the same path
+// with different colors, like the x86_64 and i686 builds of a library
+// package, rpm installs the file of the preferred color instead of reporting
+// a conflict.
+const (
+	fileColorELF32   = 1 << 0
+	fileColorELF64   = 1 << 1
+	fileColorMIPSN32 = 1 << 2
+
+	// elfFlagMIPSABI2 in the flags of a 32 bit MIPS file marks the N32 ABI.
+	elfFlagMIPSABI2  = 0x20
+	elf32FlagsOffset = 36
+)
+
+// File classes without a color, other files only have one if they are ELF.
+const (
+	fileClassUnknown = ""
+	fileClassDir     = "directory"
+	fileClassSymlink = "symbolic link"
+)
+
+// elfMachineNames are the names file(1) gives to the common ELF machines.
+var elfMachineNames = map[elf.Machine]string{
+	elf.EM_386:     "Intel 80386",
+	elf.EM_X86_64:  "x86-64",
+	elf.EM_ARM:     "ARM",
+	elf.EM_AARCH64: "ARM aarch64",
+	elf.EM_PPC:     "PowerPC or cisco 4500",
+	elf.EM_PPC64:   "64-bit PowerPC or cisco 7500",
+	elf.EM_S390:    "IBM S/390",
+	elf.EM_MIPS:    "MIPS",
+	elf.EM_RISCV:   "UCB RISC-V",
+}
+
+// elfTypeNames are the names file(1) gives to the ELF file types.
+var elfTypeNames = map[elf.Type]string{
+	elf.ET_REL:  "relocatable",
+	elf.ET_EXEC: "executable",
+	elf.ET_DYN:  "shared object",
+	elf.ET_CORE: "core file",
+}
+
+// elfColor returns the color and the class of the ELF file in ra, like
+// (2, "ELF 64-bit LSB shared object, x86-64"), or (0, "") if it is not an
+// ELF file.
+func elfColor(ra io.ReaderAt) (uint32, string, error) {
+	f, err := elf.NewFile(ra)
+	if err != nil {
+		// Not an ELF file.
+		return 0, fileClassUnknown, nil
+	}
+	defer f.Close()
+	bits, color := "64-bit", uint32(fileColorELF64)
+	if f.Class == elf.ELFCLASS32 {
+		bits, color = "32-bit", fileColorELF32
+		if f.Machine == elf.EM_MIPS {
+			b := make([]byte, 4)
+			if _, err := ra.ReadAt(b, elf32FlagsOffset); err != nil {
+				return 0, "", errors.Wrap(err, "failed to read the ELF flags")
+			}
+			if f.ByteOrder.Uint32(b)&elfFlagMIPSABI2 != 0 {
+				color = fileColorMIPSN32
+			}
+		}
+	}
+	order := "LSB"
+	if f.ByteOrder == binary.BigEndian {
+		order = "MSB"
+	}
+	typ, ok := elfTypeNames[f.Type]
+	if !ok {
+		typ = f.Type.String()
+	}
+	machine, ok := elfMachineNames[f.Machine]
+	if !ok {
+		machine = f.Machine.String()
+	}
+	return color, fmt.Sprintf("ELF %s %s %s, %s", bits, order, typ, machine), nil
+}
+
+// addFileColors sets the color and the class of every file, like rpmbuild
+// does for multilib packages. Only ELF files have a color.
+func (r *RPM) addFileColors() error {
+	dict := map[string]uint32{fileClassUnknown: 0}
+	r.classdict = []string{fileClassUnknown}
+	r.filecolors = make([]uint32, len(r.archive))
+	r.fileclasses = make([]uint32, len(r.archive))
+	for _, e := range r.archive {
+		f := e.file
+		class := fileClassUnknown
+		switch {
+		case f.Mode&0170000 == 040000:
+			class = fileClassDir
+		case f.Mode&0170000 == 0120000:
+			class = fileClassSymlink
+		case f.Mode&0170000 == 0100000 && f.Type&GhostFile == 0 && e.size() > 0:
+			ra, err := e.readerAt()
+			if err != nil {
+				return errors.Wrapf(err, "failed to read file %q", f.Name)
+			}
+			color, c, err := elfColor(ra)
+			if err != nil {
+				return errors.Wrapf(err, "failed to read the ELF class of %q", f.Name)
+			}
+			r.filecolors[e.index], class = color, c
+		}
+		idx, ok := dict[class]
+		if !ok {
+			idx = uint32(len(r.classdict))
+			dict[class] = idx
+			r.classdict = append(r.classdict, class)
+		}
+		r.fileclasses[e.index] = idx
+	}
+	// Only the last file of a hard link set has content.
+	for _, set := range r.hardlinkSets {
+		last := set.indexes[len(set.indexes)-1]
+		for _, ii := range set.indexes {
+			r.filecolors[ii] = r.filecolors[last]
+			r.fileclasses[ii] = r.fileclasses[last]
+		}
+	}
+	return nil
+}
+
+func (r *RPM) writeFileColorIndexes(h *index) {
+	if r.FileColors {
+		h.Add(tagFileColors, EntryUint32(r.filecolors))
+		h.Add(tagFileClass, EntryUint32(r.fileclasses))
+		h.Add(tagClassDict, EntryStringSlice(r.classdict))
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// elfHeader returns a bare little endian ELF header, without sections.
+func elfHeader(t *testing.T, class elf.Class, machine elf.Machine, flags uint32) []byte {
+	t.Helper()
+	ident := [elf.EI_NIDENT]byte{0x7f, 'E', 'L', 'F', byte(class), byte(elf.ELFDATA2LSB), byte(elf.EV_CURRENT)}
+	b := &bytes.Buffer{}
+	var err error
+	if class == elf.ELFCLASS32 {
+		err = binary.Write(b, binary.LittleEndian, elf.Header32{
+			Ident: ident, Type: uint16(elf.ET_DYN), Machine: uint16(machine),
+			Version: uint32(elf.EV_CURRENT), Flags: flags, Ehsize: 52,
+		})
+	} else {
+		err = binary.Write(b, binary.LittleEndian, elf.Header64{
+			Ident: ident, Type: uint16(elf.ET_DYN), Machine: uint16(machine),
+			Version: uint32(elf.EV_CURRENT), Flags: flags, Ehsize: 64,
+		})
+	}
+	if err != nil {
+		t.Fatalf("binary.Write returned error %v", err)
+	}
+	return b.Bytes()
+}
+
+func TestELFColor(t *testing.T) {
+	testCases := []struct {
+		name      string
+		content   []byte
+		wantColor uint32
+		wantClass string
+	}{{
+		name:      "elf64",
+		content:   elfHeader(t, elf.ELFCLASS64, elf.EM_X86_64, 0),
+		wantColor: 2,
+		wantClass: "ELF 64-bit LSB shared object, x86-64",
+	}, {
+		name:      "elf32",
+		content:   elfHeader(t, elf.ELFCLASS32, elf.EM_386, 0),
+		wantColor: 1,
+		wantClass: "ELF 32-bit LSB shared object, Intel 80386",
+	}, {
+		name:      "mips n32",
+		content:   elfHeader(t, elf.ELFCLASS32, elf.EM_MIPS, 0x20),
+		wantColor: 4,
+		wantClass: "ELF 32-bit LSB shared object, MIPS",
+	}, {
+		name:    "script",
+		content: []byte("#!/bin/sh\n"),
+	}}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			color, class, err := elfColor(bytes.NewReader(tc.content))
+			if err != nil {
+				t.Fatalf("elfColor returned error %v", err)
+			}
+			if color != tc.wantColor || class != tc.wantClass {
+				t.Errorf("elfColor = %d, %q, want %d, %q", color, class, tc.wantColor, tc.wantClass)
+			}
+		})
+	}
+}
+
+func TestFileColors(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "colors", Summary: "summary", FileColors: true})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(NewDir("/usr/lib", 0755))
+	r.AddFile(RPMFile{Name: "/usr/lib/libfoo.so.1", Body: elfHeader(t, elf.ELFCLASS32, elf.EM_386, 0), Mode: 0755})
+	r.AddFile(RPMFile{Name: "/usr/lib64/libfoo.so.1", Body: elfHeader(t, elf.ELFCLASS64, elf.EM_X86_64, 0), Mode: 0755})
+	r.AddFile(NewSymlink("/usr/lib64/libfoo.so", "libfoo.so.1"))
+	r.AddFile(RPMFile{Name: "/usr/share/foo", Body: []byte("foo")})
+	if err := r.AddHardlink("/usr/lib64/libfoo.so.1.0", "/usr/lib64/libfoo.so.1"); err != nil {
+		t.Fatalf("AddHardlink returned error %v", err)
+	}
+	b := buildRPM(t, r)
+	h := readHeader(t, b)
+	if d := cmp.Diff([]uint32{0, 1, 0, 2, 2, 0}, h.getUint32s(tagFileColors)); d != "" {
+		t.Errorf("FILECOLORS differs (-want, +got): %s", d)
+	}
+	if d := cmp.Diff([]uint32{1, 2, 3, 4, 4, 0}, h.getUint32s(tagFileClass)); d != "" {
+		t.Errorf("FILECLASS differs (-want, +got): %s", d)
+	}
+	wantDict := []string{"", "directory", "ELF 32-bit LSB shared object, Intel 80386", "symbolic link", "ELF 64-bit LSB shared object, x86-64"}
+	if d := cmp.Diff(wantDict, h.getStrings(tagClassDict)); d != "" {
+		t.Errorf("CLASSDICT differs (-want, +got): %s", d)
+	}
+	info, err := ReadRPMInfo(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("ReadRPMInfo returned error %v", err)
+	}
+	if f := info.Files[3]; f.Color != 2 || f.Class != "ELF 64-bit LSB shared object, x86-64" {
+		t.Errorf("ReadRPMInfo: %s has color %d and class %q, want 2 and the x86-64 class", f.Name, f.Color, f.Class)
+	}
+
+	r, err = NewRPM(RPMMetaData{Name: "colors", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/lib64/libfoo.so.1", Body: elfHeader(t, elf.ELFCLASS64, elf.EM_X86_64, 0), Mode: 0755})
+	if _, ok := readHeader(t, buildRPM(t, r)).entries[tagFileColors]; ok {
+		t.Error("FILECOLORS is written without FileColors")
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"io"
+	"os"
+	"os/user"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// FileFromInfo returns the RPMFile at name in the package for the file at path
+// p on disk, as described by info, usually from os.Lstat; for an fs.DirEntry,
+// see its Info method. The mode has the rpm file type bits of info, its permissions and
+// its setuid, setgid and sticky bits. The owner and group are looked up by
+// the ids of the file where the system has them, or left numeric for
+// SetOwnerIDs when the ids have no name. Symlinks point to the target read
+// from p, the content of regular files is read from p by Write, and devices
+// get their device numbers.
+func FileFromInfo(name, p string, info os.FileInfo) (RPMFile, error) {
+	f := RPMFile{
+		Name:  name,
+		MTime: uint32(info.ModTime().Unix()),
+	}
+	mode, err := fileMode(info)
+	if err != nil {
+		return RPMFile{}, errors.Wrapf(err, "failed to add %s", p)
+	}
+	f.Mode = mode
+	if uid, gid, ok := fileOwnerIDs(info); ok {
+		f.Owner, f.Group = lookupUser(uid), lookupGroup(gid)
+	}
+	m := info.Mode()
+	switch {
+	case m&os.ModeSymlink != 0:
+		target, err := os.Readlink(p)
+		if err != nil {
+			return RPMFile{}, err
+		}
+		f.Body = []byte(target)
+	case m&os.ModeDevice != 0:
+		f.DevMajor, f.DevMinor = fileDevice(info)
+	case m.IsRegular():
+		f.Reader = &lazyReader{open: func() (io.ReadCloser, error) { return os.Open(p) }}
+		f.Size = info.Size()
+	}
+	return f, nil
+}
+
+// fileMode returns the rpm mode of info, with the file type bits.
+func fileMode(info os.FileInfo) (uint, error) {
+	m := info.Mode()
+	mode := uint(m.Perm())
+	if m&os.ModeSetuid != 0 {
+		mode |= 04000
+	}
+	if m&os.ModeSetgid != 0 {
+		mode |= 02000
+	}
+	if m&os.ModeSticky != 0 {
+		mode |= 01000
+	}
+	switch {
+	case m.IsRegular():
+		mode |= 0100000
+	case m.IsDir():
+		mode |= 040000
+	case m&os.ModeSymlink != 0:
+		mode |= 0120000
+	case m&os.ModeCharDevice != 0:
+		mode |= 020000
+	case m&os.ModeDevice != 0:
+		mode |= 060000
+	case m&os.ModeNamedPipe != 0:
+		mode |= 010000
+	case m&os.ModeSocket != 0:
+		mode |= 0140000
+	default:
+		return 0, errors.Errorf("unsupported file type %s", m&os.ModeType)
+	}
+	return mode, nil
+}
+
+// lookupUser returns the name of the user uid, or uid itself.
+func lookupUser(uid uint32) string {
+	id := strconv.FormatUint(uint64(uid), 10)
+	if u, err := user.LookupId(id); err == nil {
+		return u.Username
+	}
+	return id
+}
+
+// lookupGroup returns the name of the group gid, or gid itself.
+func lookupGroup(gid uint32) string {
+	id := strconv.FormatUint(uint64(gid), 10)
+	if g, err := user.LookupGroupId(id); err == nil {
+		return g.Name
+	}
+	return id
+}
@@ -0,0 +1,32 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+// +build !linux
+
+package rpmpack
+
+import (
+	"os"
+)
+
+// fileOwnerIDs has no ids of the files to return.
+func fileOwnerIDs(info os.FileInfo) (uint32, uint32, bool) {
+	return 0, 0, false
+}
+
+// fileDevice has no device numbers to return.
+func fileDevice(info os.FileInfo) (uint32, uint32) {
+	return 0, 0
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestFileFromInfo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rpmpack")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir returned error %v", err)
+	}
+	defer os.RemoveAll(dir)
+	bin := filepath.Join(dir, "bin")
+	if err := ioutil.WriteFile(bin, []byte("binary"), 0755); err != nil {
+		t.Fatalf("ioutil.WriteFile returned error %v", err)
+	}
+	if err := os.Chmod(bin, 0755|os.ModeSetuid); err != nil {
+		t.Fatalf("os.Chmod returned error %v", err)
+	}
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0750); err != nil {
+		t.Fatalf("os.Mkdir returned error %v", err)
+	}
+	if err := os.Chmod(sub, 0750|os.ModeSticky); err != nil {
+		t.Fatalf("os.Chmod returned error %v", err)
+	}
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink("bin", link); err != nil {
+		t.Fatalf("os.Symlink returned error %v", err)
+	}
+	for _, tc := range []struct {
+		path  string
+		mode  uint
+		body  string
+		size  int64
+		major uint32
+		minor uint32
+	}{
+		{path: bin, mode: 0104755, size: 6},
+		{path: sub, mode: 041750},
+		{path: link, mode: 0120777, body: "bin"},
+		{path: "/dev/null", mode: 020666, major: 1, minor: 3},
+	} {
+		if tc.path == "/dev/null" && runtime.GOOS != "linux" {
+			continue
+		}
+		info, err := os.Lstat(tc.path)
+		if err != nil {
+			t.Fatalf("os.Lstat returned error %v", err)
+		}
+		f, err := FileFromInfo("/usr/share/info/file", tc.path, info)
+		if err != nil {
+			t.Fatalf("FileFromInfo(%s) returned error %v", tc.path, err)
+		}
+		if f.Name != "/usr/share/info/file" || f.Mode != tc.mode || string(f.Body) != tc.body || f.Size != tc.size || f.DevMajor != tc.major || f.DevMinor != tc.minor {
+			t.Errorf("FileFromInfo(%s) = %+v, want mode %o, body %q, size %d and device %d,%d", tc.path, f, tc.mode, tc.body, tc.size, tc.major, tc.minor)
+		}
+		if f.MTime != uint32(info.ModTime().Unix()) {
+			t.Errorf("FileFromInfo(%s).MTime = %d, want %d", tc.path, f.MTime, info.ModTime().Unix())
+		}
+		// The test files are owned by the user running the test.
+		if u, err := user.Current(); err == nil && runtime.GOOS == "linux" && tc.path != "/dev/null" && f.Owner != u.Username {
+			t.Errorf("FileFromInfo(%s).Owner = %q, want %q", tc.path, f.Owner, u.Username)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"io/fs"
+	"path"
+
+	"github.com/pkg/errors"
+)
+
+// FSOption changes how AddFS adds the files of an fs.FS.
+type FSOption func(*fsOptions)
+
+type fsOptions struct {
+	owner, group string
+	mtime        uint32
+	mtimeSet     bool
+}
+
+// FSOwner sets the owner and group of the files added by AddFS, root by default.
+func FSOwner(owner, group string) FSOption {
+	return func(o *fsOptions) {
+		o.owner, o.group = owner, group
+	}
+}
+
+// FSMTime sets the modification time of the files added by AddFS, instead of
+// the one reported by the fs.FS. embed.FS reports no modification time.
+func FSMTime(mtime uint32) FSOption {
+	return func(o *fsOptions) {
+		o.mtime, o.mtimeSet = mtime, true
+	}
+}
+
+// readLinkFS is implemented by the fs.FS that can read symlinks, like
+// fs.ReadLinkFS of newer go versions.
+type readLinkFS interface {
+	ReadLink(name string) (string, error)
+}
+
+// AddFS adds every file, directory and symlink of fsys under the directory
+// prefix, for example the static assets of an embed.FS. prefix itself is
+// added as a directory, unless it is "/".
+// Directories get the mode 0755, files 0644, or 0755 if they are executable
+// in fsys. Symlinks are only supported if fsys has a ReadLink method.
+// The content of the files is read by AddFS, and held in memory.
+func (r *RPM) AddFS(fsys fs.FS, prefix string, opts ...FSOption) error {
+	o := &fsOptions{owner: "root", group: "root"}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		f := RPMFile{
+			Name:  path.Join(prefix, name),
+			Owner: o.owner,
+			Group: o.group,
+			MTime: o.mtime,
+		}
+		if !o.mtimeSet && !info.ModTime().IsZero() {
+			f.MTime = uint32(info.ModTime().Unix())
+		}
+		switch {
+		case d.IsDir():
+			f.Mode = 040755
+		case d.Type()&fs.ModeSymlink != 0:
+			l, ok := fsys.(readLinkFS)
+			if !ok {
+				return errors.Errorf("failed to add symlink %s: the fs.FS cannot read symlinks", name)
+			}
+			target, err := l.ReadLink(name)
+			if err != nil {
+				return err
+			}
+			f.Mode = 0120777
+			f.Body = []byte(target)
+		case d.Type().IsRegular():
+			f.Mode = 0100644
+			if info.Mode()&0111 != 0 {
+				f.Mode = 0100755
+			}
+			if f.Body, err = fs.ReadFile(fsys, name); err != nil {
+				return err
+			}
+		default:
+			return errors.Errorf("failed to add %s: unsupported file type %s", name, d.Type())
+		}
+		return r.AddFile(f)
+	})
+}
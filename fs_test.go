@@ -0,0 +1,64 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// linkFS is a MapFS that reads symlink targets from the file data.
+type linkFS struct {
+	fstest.MapFS
+}
+
+func (l linkFS) ReadLink(name string) (string, error) {
+	return string(l.MapFS[name].Data), nil
+}
+
+func TestAddFS(t *testing.T) {
+	fsys := linkFS{fstest.MapFS{
+		"index.html":    {Data: []byte("<html>"), Mode: 0444},
+		"bin/run":       {Data: []byte("#!/bin/sh"), Mode: 0555, ModTime: time.Unix(1000, 0)},
+		"css/style.css": {Data: []byte("body{}")},
+		"latest":        {Data: []byte("index.html"), Mode: fs.ModeSymlink | 0777},
+	}}
+	r, err := NewRPM(RPMMetaData{Name: "fs", Version: "1.0", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	if err := r.AddFS(fsys, "/usr/share/fs", FSOwner("www", "www")); err != nil {
+		t.Fatalf("AddFS returned error %v", err)
+	}
+	want := map[string]RPMFile{
+		"/usr/share/fs":               {Name: "/usr/share/fs", Mode: 040755, Owner: "www", Group: "www"},
+		"/usr/share/fs/bin":           {Name: "/usr/share/fs/bin", Mode: 040755, Owner: "www", Group: "www"},
+		"/usr/share/fs/bin/run":       {Name: "/usr/share/fs/bin/run", Body: []byte("#!/bin/sh"), Mode: 0100755, Owner: "www", Group: "www", MTime: 1000},
+		"/usr/share/fs/css":           {Name: "/usr/share/fs/css", Mode: 040755, Owner: "www", Group: "www"},
+		"/usr/share/fs/css/style.css": {Name: "/usr/share/fs/css/style.css", Body: []byte("body{}"), Mode: 0100644, Owner: "www", Group: "www"},
+		"/usr/share/fs/index.html":    {Name: "/usr/share/fs/index.html", Body: []byte("<html>"), Mode: 0100644, Owner: "www", Group: "www"},
+		"/usr/share/fs/latest":        {Name: "/usr/share/fs/latest", Body: []byte("index.html"), Mode: 0120777, Owner: "www", Group: "www"},
+	}
+	if d := cmp.Diff(want, r.files); d != "" {
+		t.Errorf("AddFS files mismatch (-want +got):\n%s", d)
+	}
+	if err := r.AddFS(struct{ fs.FS }{fsys.MapFS}, "/srv"); err == nil {
+		t.Error("AddFS of a symlink without ReadLink returned no error")
+	}
+}
@@ -1,10 +1,13 @@
 module github.com/google/rpmpack
 
-go 1.12
+go 1.16
 
 require (
 	github.com/cavaliercoder/go-cpio v0.0.0-20180626203310-925f9528c45e
 	github.com/google/go-cmp v0.3.1
+	github.com/klauspost/compress v1.10.10
 	github.com/pkg/errors v0.9.1
 	github.com/ulikunitz/xz v0.5.7
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
+	gopkg.in/yaml.v2 v2.3.0
 )
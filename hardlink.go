@@ -0,0 +1,125 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// hardlinkSet is a regular file and its hard links.
+type hardlinkSet struct {
+	// names are the files of the set, sorted like the header.
+	names []string
+	// indexes are the positions of the files in the header.
+	indexes []int
+}
+
+// AddHardlink adds name as a hard link to the regular file target, which must
+// have been added before. The files of a hard link set share their inode, and
+// the content is stored once in the payload, with the last file of the set.
+// The link has the mode, owner and content of target as they are when the rpm
+// is written.
+func (r *RPM) AddHardlink(name, target string) error {
+	var err error
+	if name, err = cleanPath(name); err != nil {
+		return err
+	}
+	if target, err = cleanPath(target); err != nil {
+		return err
+	}
+	if t, ok := r.hardlinks[target]; ok {
+		target = t
+	}
+	f, err := r.hardlinkTarget(target)
+	if err != nil {
+		return errors.Wrapf(err, "cannot link %s to %s", name, target)
+	}
+	if _, ok := r.files[name]; ok || name == target {
+		return errors.Errorf("cannot link %s to %s: %s is already in the package", name, target, name)
+	}
+	f.Name = name
+	if err := r.checkPath(f); err != nil {
+		return errors.Wrapf(err, "cannot link %s to %s", name, target)
+	}
+	r.putFile(f)
+	r.hardlinks[name] = target
+	return nil
+}
+
+// hardlinkTarget returns the file target, which must be a regular file.
+func (r *RPM) hardlinkTarget(target string) (RPMFile, error) {
+	f, ok := r.files[target]
+	if !ok {
+		return f, errors.New("the target is not in the package")
+	}
+	if t := f.Mode & 0170000; (t != 0 && t != 0100000) || f.Type&GhostFile != 0 {
+		return f, errors.New("the target is not a regular file")
+	}
+	return f, nil
+}
+
+// prepareHardlinks gives the hard links the current attributes of their
+// target, and computes the hard link sets and the inodes of the files, in
+// the order of the header, fnames.
+func (r *RPM) prepareHardlinks(fnames []string) error {
+	r.hardlinkSets = make(map[string]*hardlinkSet)
+	for name, target := range r.hardlinks {
+		f, err := r.hardlinkTarget(target)
+		if err != nil {
+			return errors.Wrapf(err, "invalid hard link %s to %s", name, target)
+		}
+		f.Name = name
+		r.files[name] = f
+		s, ok := r.hardlinkSets[target]
+		if !ok {
+			s = &hardlinkSet{names: []string{target}}
+			r.hardlinkSets[target] = s
+		}
+		s.names = append(s.names, name)
+		r.hardlinkSets[name] = s
+	}
+	for _, s := range r.hardlinkSets {
+		sort.Strings(s.names)
+	}
+	r.fileinodes = make([]int32, len(fnames))
+	for ii, fn := range fnames {
+		r.fileinodes[ii] = int32(ii + 1)
+		if s, ok := r.hardlinkSets[fn]; ok {
+			if len(s.indexes) > 0 {
+				r.fileinodes[ii] = r.fileinodes[s.indexes[0]]
+			}
+			s.indexes = append(s.indexes, ii)
+		}
+	}
+	return nil
+}
+
+// fillHardlinks copies the size and digests of the last file of the set,
+// which has the content, to the other files of the set.
+func (r *RPM) fillHardlinks(s *hardlinkSet) {
+	last := s.indexes[len(s.indexes)-1]
+	for _, ii := range s.indexes[:len(s.indexes)-1] {
+		r.filesizes[ii] = r.filesizes[last]
+		r.filedigests[ii] = r.filedigests[last]
+		if r.imaSigner != nil {
+			r.filesignatures[ii] = r.filesignatures[last]
+		}
+		if r.veritySigner != nil {
+			r.veritysignatures[ii] = r.veritysignatures[last]
+		}
+	}
+}
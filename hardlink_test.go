@@ -0,0 +1,103 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHardlinks(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "links", Summary: "summary", Compressor: "none"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/bin/b", Body: []byte("tool"), Mode: 0755})
+	r.AddFile(RPMFile{Name: "/usr/bin/other", Body: []byte("other")})
+	for _, l := range []struct{ name, target string }{
+		{"/usr/bin/a", "/usr/bin/b"},
+		{"/usr/sbin/c", "/usr/bin/a"},
+	} {
+		if err := r.AddHardlink(l.name, l.target); err != nil {
+			t.Fatalf("AddHardlink(%s, %s) returned error %v", l.name, l.target, err)
+		}
+	}
+	b := buildRPM(t, r)
+	h := readHeader(t, b)
+	if got, want := h.getUint32s(tagFileINodes), []uint32{1, 1, 3, 1}; !cmp.Equal(got, want) {
+		t.Errorf("FILEINODES = %v, want %v", got, want)
+	}
+	if got, want := h.getUint32s(tagFileSizes), []uint32{4, 4, 5, 4}; !cmp.Equal(got, want) {
+		t.Errorf("FILESIZES = %v, want %v", got, want)
+	}
+	if got := h.getUint32s(tagSize); !cmp.Equal(got, []uint32{9}) {
+		t.Errorf("SIZE = %v, want [9]", got)
+	}
+	if d := h.getStrings(tagFileDigests); d[0] == "" || d[0] != d[1] || d[0] != d[3] {
+		t.Errorf("FILEDIGESTS = %q, want the same digest for the hard links", d)
+	}
+	if got := h.getStrings(tagRequires); !contains(got, "rpmlib(PartialHardlinkSets)") {
+		t.Errorf("REQUIRENAME = %q, want rpmlib(PartialHardlinkSets)", got)
+	}
+
+	type entry struct {
+		Name  string
+		Inode int64
+		Links int
+		Body  string
+	}
+	var got []entry
+	for _, f := range readArchive(t, b) {
+		got = append(got, entry{f.Name, f.Inode, f.Links, string(f.Body)})
+	}
+	want := []entry{
+		{"/usr/bin/a", 1, 3, ""},
+		{"/usr/bin/b", 1, 3, ""},
+		{"/usr/bin/other", 3, 1, "other"},
+		{"/usr/sbin/c", 1, 3, "tool"},
+	}
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("payload differs (-want +got):\n%s", d)
+	}
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAddHardlinkErrors(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "links", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/bin/tool", Body: []byte("tool")})
+	r.AddFile(NewDir("/usr/share/dir", 0755))
+	for _, l := range []struct{ name, target string }{
+		{"/usr/bin/a", "/usr/bin/missing"},
+		{"/usr/bin/a", "/usr/share/dir"},
+		{"/usr/share/dir", "/usr/bin/tool"},
+		{"/usr/bin/tool", "/usr/bin/tool"},
+	} {
+		if err := r.AddHardlink(l.name, l.target); err == nil {
+			t.Errorf("AddHardlink(%s, %s) returned nil error", l.name, l.target)
+		}
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"sort"
 
 	"github.com/pkg/errors"
@@ -27,11 +28,29 @@ const (
 	signatures = 0x3e
 	immutable  = 0x3f
 
+	typeChar        = 0x01
+	typeInt8        = 0x02
 	typeInt16       = 0x03
 	typeInt32       = 0x04
+	typeInt64       = 0x05
 	typeString      = 0x06
 	typeBinary      = 0x07
 	typeStringArray = 0x08
+	typeI18NString  = 0x09
+)
+
+// ErrHeaderTooLarge is returned when a header exceeds the limits of rpm, which
+// refuses to read it.
+var ErrHeaderTooLarge = errors.New("header exceeds the limits of rpm")
+
+// The limits rpm checks when reading a header, see hdrblobRead in lib/header.c.
+// The signature header is read before anything is verified, so its limits
+// are much lower.
+const (
+	headerMaxEntries    = 0xffff     // HEADER_TAGS_MAX
+	headerMaxData       = 0x0fffffff // HEADER_DATA_MAX
+	signatureMaxEntries = 32
+	signatureMaxData    = 64 << 20
 )
 
 // Only integer types are aligned. This is not just an optimization - some versions
@@ -39,6 +58,7 @@ const (
 var boundaries = map[int]int{
 	typeInt16: 2,
 	typeInt32: 4,
+	typeInt64: 8,
 }
 
 type IndexEntry struct {
@@ -47,25 +67,78 @@ type IndexEntry struct {
 }
 
 func (e IndexEntry) indexBytes(tag, contentOffset int) []byte {
-	b := &bytes.Buffer{}
-	if err := binary.Write(b, binary.BigEndian, []int32{int32(tag), int32(e.rpmtype), int32(contentOffset), int32(e.count)}); err != nil {
-		// binary.Write can fail if the underlying Write fails, or the types are invalid.
-		// bytes.Buffer's write never error out, it can only panic with OOM.
-		panic(err)
-	}
-	return b.Bytes()
+	b := make([]byte, 16)
+	putIndexEntry(b, tag, e.rpmtype, contentOffset, e.count)
+	return b
+}
+
+// putIndexEntry puts the 16 bytes of an index entry at the start of b.
+func putIndexEntry(b []byte, tag, rpmtype, offset, count int) {
+	binary.BigEndian.PutUint32(b, uint32(tag))
+	binary.BigEndian.PutUint32(b[4:], uint32(rpmtype))
+	binary.BigEndian.PutUint32(b[8:], uint32(offset))
+	binary.BigEndian.PutUint32(b[12:], uint32(count))
 }
 
-func intEntry(rpmtype, size int, value interface{}) IndexEntry {
-	b := &bytes.Buffer{}
-	if err := binary.Write(b, binary.BigEndian, value); err != nil {
-		// binary.Write can fail if the underlying Write fails, or the types are invalid.
-		// bytes.Buffer's write never error out, it can only panic with OOM.
-		panic(err)
+// intEntry encodes the integers of value, a slice of count integers, in a
+// single allocation. Header construction is dominated by these entries when
+// building many small packages, so reflection through binary.Write is avoided.
+func intEntry(rpmtype, count int, value interface{}) IndexEntry {
+	var b []byte
+	switch v := value.(type) {
+	case []int8:
+		b = make([]byte, len(v))
+		for ii, n := range v {
+			b[ii] = byte(n)
+		}
+	case []uint8:
+		b = append([]byte(nil), v...)
+	case []int16:
+		b = make([]byte, 2*len(v))
+		for ii, n := range v {
+			binary.BigEndian.PutUint16(b[2*ii:], uint16(n))
+		}
+	case []uint16:
+		b = make([]byte, 2*len(v))
+		for ii, n := range v {
+			binary.BigEndian.PutUint16(b[2*ii:], n)
+		}
+	case []int32:
+		b = make([]byte, 4*len(v))
+		for ii, n := range v {
+			binary.BigEndian.PutUint32(b[4*ii:], uint32(n))
+		}
+	case []uint32:
+		b = make([]byte, 4*len(v))
+		for ii, n := range v {
+			binary.BigEndian.PutUint32(b[4*ii:], n)
+		}
+	case []int64:
+		b = make([]byte, 8*len(v))
+		for ii, n := range v {
+			binary.BigEndian.PutUint64(b[8*ii:], uint64(n))
+		}
+	case []uint64:
+		b = make([]byte, 8*len(v))
+		for ii, n := range v {
+			binary.BigEndian.PutUint64(b[8*ii:], n)
+		}
+	default:
+		panic(fmt.Sprintf("unsupported integer type %T", value))
 	}
-	return IndexEntry{rpmtype, size, b.Bytes()}
+	return IndexEntry{rpmtype, count, b}
 }
 
+// EntryChar returns a CHAR entry, an array of single characters.
+func EntryChar(value []byte) IndexEntry {
+	return IndexEntry{typeChar, len(value), value}
+}
+func EntryInt8(value []int8) IndexEntry {
+	return intEntry(typeInt8, len(value), value)
+}
+func EntryUint8(value []uint8) IndexEntry {
+	return intEntry(typeInt8, len(value), value)
+}
 func EntryInt16(value []int16) IndexEntry {
 	return intEntry(typeInt16, len(value), value)
 }
@@ -78,20 +151,56 @@ func EntryInt32(value []int32) IndexEntry {
 func EntryUint32(value []uint32) IndexEntry {
 	return intEntry(typeInt32, len(value), value)
 }
+func EntryInt64(value []int64) IndexEntry {
+	return intEntry(typeInt64, len(value), value)
+}
+func EntryUint64(value []uint64) IndexEntry {
+	return intEntry(typeInt64, len(value), value)
+}
 func EntryString(value string) IndexEntry {
-	return IndexEntry{typeString, 1, append([]byte(value), byte(00))}
+	return IndexEntry{typeString, 1, nullTerminated(value)}
 }
+
+// nullTerminated returns the bytes of s and its null terminator.
+func nullTerminated(s string) []byte {
+	b := make([]byte, len(s)+1)
+	copy(b, s)
+	return b
+}
+
+// EntryI18NString returns a localized string entry holding only the
+// untranslated value, the "C" locale of the header i18n table.
+func EntryI18NString(value string) IndexEntry {
+	return IndexEntry{typeI18NString, 1, nullTerminated(value)}
+}
+
+// EntryI18NStrings returns a localized string entry with a value for each
+// locale of the header i18n table, in the order of the table.
+func EntryI18NStrings(values []string) IndexEntry {
+	e := EntryStringSlice(values)
+	e.rpmtype = typeI18NString
+	return e
+}
+
 func EntryBytes(value []byte) IndexEntry {
 	return IndexEntry{typeBinary, len(value), value}
 }
 
 func EntryStringSlice(value []string) IndexEntry {
-	b := [][]byte{}
+	n := 0
+	for _, v := range value {
+		n += len(v) + 1
+	}
+	if len(value) == 0 {
+		// An empty array is still terminated.
+		n = 1
+	}
+	b := make([]byte, 0, n)
 	for _, v := range value {
-		b = append(b, []byte(v))
+		b = append(b, v...)
+		b = append(b, 0)
 	}
-	bb := append(bytes.Join(b, []byte{00}), byte(00))
-	return IndexEntry{typeStringArray, len(value), bb}
+	return IndexEntry{typeStringArray, len(value), b[:n]}
 }
 
 type index struct {
@@ -111,8 +220,24 @@ func (i *index) AddEntries(m map[int]IndexEntry) {
 	}
 }
 
+// addI18NTable adds the i18n table that localized strings index into.
+// rpm reads I18NSTRING entries through the table, so a header holding them
+// without one is corrupt. The table is only added when it is needed, and an
+// existing table is left as is.
+func (i *index) addI18NTable() {
+	if _, ok := i.entries[tagHeaderI18NTable]; ok {
+		return
+	}
+	for _, e := range i.entries {
+		if e.rpmtype == typeI18NString {
+			i.Add(tagHeaderI18NTable, EntryStringSlice([]string{"C"}))
+			return
+		}
+	}
+}
+
 func (i *index) sortedTags() []int {
-	t := []int{}
+	t := make([]int, 0, len(i.entries))
 	for k := range i.entries {
 		t = append(t, k)
 	}
@@ -120,50 +245,136 @@ func (i *index) sortedTags() []int {
 	return t
 }
 
-func pad(w *bytes.Buffer, rpmtype, offset int) {
+// padding returns the number of bytes needed at offset to align an entry of rpmtype.
+func padding(rpmtype, offset int) int {
 	// We need to align integer entries...
 	if b, ok := boundaries[rpmtype]; ok && offset%b != 0 {
-		if _, err := w.Write(make([]byte, b-offset%b)); err != nil {
-			// binary.Write can fail if the underlying Write fails, or the types are invalid.
-			// bytes.Buffer's write never error out, it can only panic with OOM.
-			panic(err)
-		}
+		return b - offset%b
 	}
+	return 0
 }
 
 // Bytes returns the bytes of the index.
 func (i *index) Bytes() ([]byte, error) {
-	w := &bytes.Buffer{}
-	// Even the header has three parts: The lead, the index entries, and the entries.
-	// Because of alignment, we can only tell the actual size and offset after writing
-	// the entries.
-	entryData := &bytes.Buffer{}
-	tags := i.sortedTags()
-	offsets := make([]int, len(tags))
-	for ii, tag := range tags {
+	l := i.layout()
+	w := bytes.NewBuffer(make([]byte, 0, l.len()))
+	if _, err := i.write(w, l); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+// WriteTo writes the index to w as it is generated, without building it in
+// memory first. It can be used to compute the digest of a header by passing a
+// hash.Hash, possibly combined with other writers using io.MultiWriter.
+func (i *index) WriteTo(w io.Writer) (int64, error) {
+	return i.write(w, i.layout())
+}
+
+// indexLayout is where the entries of an index go.
+type indexLayout struct {
+	tags    []int
+	entries []IndexEntry
+	offsets []int
+	// size is the size of the data, including the eigenHeader.
+	size int
+}
+
+// len returns the size of the written index.
+func (l indexLayout) len() int {
+	return 16 + 16*(len(l.tags)+1) + l.size
+}
+
+// layout computes the offsets of the entries, which depend on the alignment
+// of the entries before them, in a single pass over the sorted entries.
+func (i *index) layout() indexLayout {
+	l := indexLayout{tags: i.sortedTags()}
+	l.entries = make([]IndexEntry, len(l.tags))
+	l.offsets = make([]int, len(l.tags))
+	for ii, tag := range l.tags {
 		e := i.entries[tag]
-		pad(entryData, e.rpmtype, entryData.Len())
-		offsets[ii] = entryData.Len()
-		entryData.Write(e.data)
+		l.size += padding(e.rpmtype, l.size)
+		l.entries[ii] = e
+		l.offsets[ii] = l.size
+		l.size += len(e.data)
 	}
-	entryData.Write(i.eigenHeader().data)
+	l.size += 0x10 // eigenHeader
+	return l
+}
 
+// zeros is the padding aligning the entries, at most 7 bytes.
+var zeros [8]byte
+
+func (i *index) write(w io.Writer, l indexLayout) (int64, error) {
+	// Even the header has three parts: The lead, the index entries, and the entries.
+	if err := i.checkLimits(l.size); err != nil {
+		return 0, err
+	}
+	// The lead and the index entries are written at once.
+	b := make([]byte, 16+16*(len(l.tags)+1))
 	// 4 magic and 4 reserved
-	w.Write([]byte{0x8e, 0xad, 0xe8, 0x01, 0, 0, 0, 0})
+	copy(b, []byte{0x8e, 0xad, 0xe8, 0x01, 0, 0, 0, 0})
 	// 4 count and 4 size
 	// We add the pseudo-entry "eigenHeader" to count.
-	if err := binary.Write(w, binary.BigEndian, []int32{int32(len(i.entries)) + 1, int32(entryData.Len())}); err != nil {
-		return nil, errors.Wrap(err, "failed to write eigenHeader")
+	binary.BigEndian.PutUint32(b[8:], uint32(len(l.tags)+1))
+	binary.BigEndian.PutUint32(b[12:], uint32(l.size))
+	// The eigenHeader index entry
+	putIndexEntry(b[16:], i.h, typeBinary, l.size-0x10, 0x10)
+	// All of the other index entries
+	for ii, tag := range l.tags {
+		e := l.entries[ii]
+		putIndexEntry(b[32+16*ii:], tag, e.rpmtype, l.offsets[ii], e.count)
 	}
-	// Write the eigenHeader index entry
-	w.Write(i.eigenHeader().indexBytes(i.h, entryData.Len()-0x10))
-	// Write all of the other index entries
-	for ii, tag := range tags {
-		e := i.entries[tag]
-		w.Write(e.indexBytes(tag, offsets[ii]))
+	cw := &countingWriter{w: w}
+	cw.Write(b)
+	// And the entries, with their alignment.
+	written := 0
+	for ii, e := range l.entries {
+		cw.Write(zeros[:l.offsets[ii]-written])
+		cw.Write(e.data)
+		written = l.offsets[ii] + len(e.data)
 	}
-	w.Write(entryData.Bytes())
-	return w.Bytes(), nil
+	eigen := i.eigenHeader()
+	cw.Write(eigen.data)
+	return cw.n, errors.Wrap(cw.err, "failed to write index")
+}
+
+// checkLimits checks that rpm can read the index, with size bytes of data.
+func (i *index) checkLimits(size int) error {
+	name, maxEntries, maxData := "header", headerMaxEntries, headerMaxData
+	if i.h == signatures {
+		name, maxEntries, maxData = "signature header", signatureMaxEntries, signatureMaxData
+	}
+	// The eigenHeader is an entry too.
+	if n := len(i.entries) + 1; n > maxEntries {
+		return errors.Wrapf(ErrHeaderTooLarge, "%s has %d entries, rpm reads at most %d", name, n, maxEntries)
+	}
+	if size > maxData {
+		return errors.Wrapf(ErrHeaderTooLarge, "%s has %d bytes of data, rpm reads at most %d", name, size, maxData)
+	}
+	return nil
+}
+
+// countingWriter counts the bytes written, and keeps the first error so that
+// callers can check it once at the end. A short write without an error is an
+// io.ErrShortWrite, so that a writer dropping bytes cannot truncate the rpm.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	if err == nil && n < len(p) {
+		err = io.ErrShortWrite
+	}
+	c.err = err
+	return n, err
 }
 
 // the eigenHeader is a weird entry. Its index entry is sorted first, but its content
@@ -172,23 +383,18 @@ func (i *index) Bytes() ([]byte, error) {
 // Which is always 0x10 * number of entries.
 // I kid you not.
 func (i *index) eigenHeader() IndexEntry {
-	b := &bytes.Buffer{}
-	if err := binary.Write(b, binary.BigEndian, []int32{int32(i.h), int32(typeBinary), -int32(0x10 * (len(i.entries) + 1)), int32(0x10)}); err != nil {
-		// binary.Write can fail if the underlying Write fails, or the types are invalid.
-		// bytes.Buffer's write never error out, it can only panic with OOM.
-		panic(err)
-	}
-
-	return EntryBytes(b.Bytes())
+	b := make([]byte, 0x10)
+	putIndexEntry(b, i.h, typeBinary, -0x10*(len(i.entries)+1), 0x10)
+	return EntryBytes(b)
 }
 
-func lead(name, fullVersion string) []byte {
+func lead(name, fullVersion, arch, os string, source bool) []byte {
 	// RPM format = 0xedabeedb
 	// version 3.0 = 0x0300
-	// type binary = 0x0000
-	// machine archnum (i386?) = 0x0001
+	// type binary = 0x0000, source = 0x0001
+	// machine archnum, see leadArchNum
 	// name ( 66 bytes, with null termination)
-	// osnum (linux?) = 0x0001
+	// osnum, see leadOSNum
 	// sig type (header-style) = 0x0005
 	// reserved 16 bytes of 0x00
 	n := []byte(fmt.Sprintf("%s-%s", name, fullVersion))
@@ -196,9 +402,15 @@ func lead(name, fullVersion string) []byte {
 		n = n[:65]
 	}
 	n = append(n, make([]byte, 66-len(n))...)
-	b := []byte{0xed, 0xab, 0xee, 0xdb, 0x03, 0x00, 0x00, 0x00, 0x00, 0x01}
+	b := []byte{0xed, 0xab, 0xee, 0xdb, 0x03, 0x00, 0x00, 0x00}
+	if source {
+		b[7] = 0x01
+	}
+	archnum := leadArchNum(arch)
+	b = append(b, byte(archnum>>8), byte(archnum))
 	b = append(b, n...)
-	b = append(b, []byte{0x00, 0x01, 0x00, 0x05}...)
+	osnum := leadOSNum(os)
+	b = append(b, byte(osnum>>8), byte(osnum), 0x00, 0x05)
 	b = append(b, make([]byte, 16)...)
 	return b
 }
@@ -15,10 +15,14 @@
 package rpmpack
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"fmt"
+	"io/ioutil"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
 )
 
 func TestLead(t *testing.T) {
@@ -32,12 +36,55 @@ func TestLead(t *testing.T) {
 		"abcabcabcabcabcabcabcabcabcabcabcabcabcabcabcabcabcabcabcabcabc",
 	}
 	for _, n := range names {
-		if got := len(lead(n, "1-2")); got != 0x60 {
+		if got := len(lead(n, "1-2", "noarch", "linux", false)); got != 0x60 {
 			t.Errorf("len(lead(%s)) = %#x, want %#x", n, got, 0x60)
 		}
 	}
 }
 
+func TestLeadArchNum(t *testing.T) {
+	testCases := []struct {
+		arch string
+		want []byte
+	}{
+		{"noarch", []byte{0x00, 0x01}},
+		{"x86_64", []byte{0x00, 0x01}},
+		{"aarch64", []byte{0x00, 0x13}},
+		{"ppc64le", []byte{0x00, 0x10}},
+		{"s390x", []byte{0x00, 0x0f}},
+		{"riscv64", []byte{0x00, 0x16}},
+		{"armv7hl", []byte{0x00, 0x0c}},
+	}
+	for _, tc := range testCases {
+		if got := lead("foo", "1-2", tc.arch, "linux", false)[8:10]; !bytes.Equal(got, tc.want) {
+			t.Errorf("archnum of lead(%s) = %x, want %x", tc.arch, got, tc.want)
+		}
+	}
+}
+
+func TestLeadOSNum(t *testing.T) {
+	testCases := []struct {
+		os   string
+		want []byte
+	}{
+		{"linux", []byte{0x00, 0x01}},
+		{"aix", []byte{0x00, 0x05}},
+		{"AIX", []byte{0x00, 0x05}},
+		{"solaris", []byte{0x00, 0x03}},
+		{"darwin", []byte{0x00, 0x15}},
+		{"plan9", []byte{0x00, 0x01}},
+	}
+	for _, tc := range testCases {
+		l := lead("foo", "1-2", "noarch", tc.os, false)
+		if got := l[76:78]; !bytes.Equal(got, tc.want) {
+			t.Errorf("osnum of lead(%s) = %x, want %x", tc.os, got, tc.want)
+		}
+		if got := l[78:80]; !bytes.Equal(got, []byte{0x00, 0x05}) {
+			t.Errorf("signature type of lead(%s) = %x, want 0005", tc.os, got)
+		}
+	}
+}
+
 func TestEntry(t *testing.T) {
 	testCases := []struct {
 		name           string
@@ -67,6 +114,27 @@ func TestEntry(t *testing.T) {
 		offset:         0x222,
 		wantIndexBytes: "0000010f000000080000022200000002",
 		wantData:       "737472696e6700617272617900",
+	}, {
+		name:           "int8",
+		value:          []int8{-1, 2},
+		tag:            0x0110,
+		offset:         3,
+		wantIndexBytes: "00000110000000020000000300000002",
+		wantData:       "ff02",
+	}, {
+		name:           "char",
+		value:          []byte("ab"),
+		tag:            0x0111,
+		offset:         3,
+		wantIndexBytes: "00000111000000010000000300000002",
+		wantData:       "6162",
+	}, {
+		name:           "int64",
+		value:          []int64{0x42},
+		tag:            0x0112,
+		offset:         8,
+		wantIndexBytes: "00000112000000050000000800000001",
+		wantData:       "0000000000000042",
 	}}
 	for _, tc := range testCases {
 		tc := tc
@@ -79,6 +147,12 @@ func TestEntry(t *testing.T) {
 				e = EntryString(v)
 			case []int32:
 				e = EntryInt32(v)
+			case []int8:
+				e = EntryInt8(v)
+			case []byte:
+				e = EntryChar(v)
+			case []int64:
+				e = EntryInt64(v)
 			}
 			gotBytes := e.indexBytes(tc.tag, tc.offset)
 			if d := cmp.Diff(tc.wantIndexBytes, fmt.Sprintf("%x", gotBytes)); d != "" {
@@ -112,3 +186,216 @@ func TestIndex(t *testing.T) {
 		t.Errorf("i.Bytes() unexpected value (want-> got): \n%s", d)
 	}
 }
+
+func TestIndexSmallTypes(t *testing.T) {
+	i := newIndex(immutable)
+	i.Add(0x1111, EntryChar([]byte("x")))
+	i.Add(0x2222, EntryUint8([]uint8{1, 255}))
+	i.Add(0x3333, EntryUint32([]uint32{7}))
+	b, err := i.Bytes()
+	if err != nil {
+		t.Fatalf("i.Bytes() returned error: %v", err)
+	}
+	got, _, err := readIndex(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("readIndex returned error: %v", err)
+	}
+	h := &Header{got}
+	if got, want := h.Type(0x1111), "CHAR"; got != want {
+		t.Errorf("h.Type(0x1111) = %q, want %q", got, want)
+	}
+	if got, want := h.Ints(0x2222), []uint64{1, 255}; !cmp.Equal(got, want) {
+		t.Errorf("h.Ints(0x2222) = %v, want %v", got, want)
+	}
+	if got, want := h.Ints(0x3333), []uint64{7}; !cmp.Equal(got, want) {
+		t.Errorf("h.Ints(0x3333) = %v, want %v", got, want)
+	}
+}
+
+func TestIndexLimits(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		h       int
+		entries int
+		data    int
+		wantErr bool
+	}{
+		{"header", immutable, 1000, 1 << 20, false},
+		{"header entries", immutable, headerMaxEntries, 0, true},
+		{"signature", signatures, signatureMaxEntries - 2, 4096, false},
+		{"signature entries", signatures, signatureMaxEntries, 0, true},
+		{"signature data", signatures, 1, signatureMaxData, true},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			i := newIndex(tc.h)
+			for tag := 0; tag < tc.entries; tag++ {
+				i.Add(0x10000+tag, EntryUint16([]uint16{1}))
+			}
+			if tc.data > 0 {
+				i.Add(0x8000, EntryBytes(make([]byte, tc.data)))
+			}
+			_, err := i.WriteTo(ioutil.Discard)
+			if got := errors.Cause(err) == ErrHeaderTooLarge; got != tc.wantErr {
+				t.Errorf("i.WriteTo() returned error %v, want ErrHeaderTooLarge %t", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestI18NTable(t *testing.T) {
+	testCases := []struct {
+		name      string
+		entries   map[int]IndexEntry
+		wantTable bool
+	}{{
+		name:      "plain strings",
+		entries:   map[int]IndexEntry{tagName: EntryString("name")},
+		wantTable: false,
+	}, {
+		name:      "localized strings",
+		entries:   map[int]IndexEntry{tagName: EntryString("name"), tagSummary: EntryI18NString("summary")},
+		wantTable: true,
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			i := newIndex(immutable)
+			i.AddEntries(tc.entries)
+			i.addI18NTable()
+			if _, got := i.entries[tagHeaderI18NTable]; got != tc.wantTable {
+				t.Errorf("i18n table present = %t, want %t", got, tc.wantTable)
+			}
+		})
+	}
+}
+
+func TestI18NTableInRPM(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "i18n", Version: "1.0", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	h := readHeader(t, buildRPM(t, r))
+	for _, tag := range []int{tagSummary, tagDescription, tagGroup} {
+		if got := h.entries[tag].rpmtype; got != typeI18NString {
+			t.Errorf("tag %d has type %d, want %d", tag, got, typeI18NString)
+		}
+	}
+	if d := cmp.Diff([]string{"C"}, h.getStrings(tagHeaderI18NTable)); d != "" {
+		t.Errorf("i18n table mismatch (-want +got):\n%s", d)
+	}
+	if got := h.getString(tagSummary); got != "summary" {
+		t.Errorf("summary = %q, want %q", got, "summary")
+	}
+}
+
+func TestIndexWriteTo(t *testing.T) {
+	i := newIndex(immutable)
+	i.AddEntries(map[int]IndexEntry{
+		tagName:      EntryString("odd"),
+		tagFileSizes: EntryUint32([]uint32{1, 2}),
+		tagFileModes: EntryUint16([]uint16{0644}),
+		tagBasenames: EntryStringSlice([]string{"a", "bc"}),
+	})
+	want, err := i.Bytes()
+	if err != nil {
+		t.Fatalf("i.Bytes() returned error: %v", err)
+	}
+	b := &bytes.Buffer{}
+	n, err := i.WriteTo(b)
+	if err != nil {
+		t.Fatalf("i.WriteTo() returned error: %v", err)
+	}
+	if n != int64(len(want)) {
+		t.Errorf("i.WriteTo() = %d, want %d", n, len(want))
+	}
+	if !bytes.Equal(want, b.Bytes()) {
+		t.Errorf("i.WriteTo() wrote %x, want %x", b.Bytes(), want)
+	}
+}
+
+// largeIndex returns a header index with the file tags of n files.
+func largeIndex(n int) *index {
+	basenames := make([]string, n)
+	dirindexes := make([]uint32, n)
+	sizes := make([]uint32, n)
+	modes := make([]uint16, n)
+	digests := make([]string, n)
+	for ii := range basenames {
+		basenames[ii] = fmt.Sprintf("file%d", ii)
+		dirindexes[ii] = uint32(ii % 100)
+		sizes[ii] = uint32(ii)
+		modes[ii] = 0100644
+		digests[ii] = fmt.Sprintf("%x", sha256.Sum256([]byte(basenames[ii])))
+	}
+	i := newIndex(immutable)
+	i.Add(tagBasenames, EntryStringSlice(basenames))
+	i.Add(tagDirindexes, EntryUint32(dirindexes))
+	i.Add(tagFileSizes, EntryUint32(sizes))
+	i.Add(tagFileModes, EntryUint16(modes))
+	i.Add(tagFileDigests, EntryStringSlice(digests))
+	i.Add(tagFileUserName, EntryStringSlice(make([]string, n)))
+	i.Add(tagFileGroupName, EntryStringSlice(make([]string, n)))
+	return i
+}
+
+func BenchmarkIndexDigest(b *testing.B) {
+	i := largeIndex(100000)
+	b.Run("bytes", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			hb, err := i.Bytes()
+			if err != nil {
+				b.Fatalf("i.Bytes() returned error: %v", err)
+			}
+			sha256.Sum256(hb)
+		}
+	})
+	b.Run("stream", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			h := sha256.New()
+			if _, err := i.WriteTo(h); err != nil {
+				b.Fatalf("i.WriteTo() returned error: %v", err)
+			}
+			h.Sum(nil)
+		}
+	})
+	b.Run("discard", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			if _, err := i.WriteTo(ioutil.Discard); err != nil {
+				b.Fatalf("i.WriteTo() returned error: %v", err)
+			}
+		}
+	})
+}
+
+// smallIndex is the index of a small package, with few entries of each type.
+func smallIndex() *index {
+	i := newIndex(immutable)
+	i.Add(tagName, EntryString("small"))
+	i.Add(tagVersion, EntryString("1.0"))
+	i.Add(tagRelease, EntryString("1"))
+	i.Add(tagSummary, EntryI18NString("a small package"))
+	i.Add(tagEpoch, EntryUint32([]uint32{0}))
+	i.Add(tagBuildTime, EntryInt32([]int32{1600000000}))
+	i.Add(tagBasenames, EntryStringSlice([]string{"bin", "small"}))
+	i.Add(tagDirnames, EntryStringSlice([]string{"/usr/", "/usr/bin/"}))
+	i.Add(tagDirindexes, EntryUint32([]uint32{0, 1}))
+	i.Add(tagFileSizes, EntryUint32([]uint32{4096, 1234}))
+	i.Add(tagFileModes, EntryUint16([]uint16{040755, 0100755}))
+	i.Add(tagFileRDevs, EntryInt16([]int16{0, 0}))
+	i.Add(tagLongSize, EntryInt64([]int64{5330}))
+	i.Add(tagPayloadDigest, EntryStringSlice([]string{"0123456789abcdef"}))
+	return i
+}
+
+func BenchmarkSmallIndex(b *testing.B) {
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		if _, err := smallIndex().Bytes(); err != nil {
+			b.Fatalf("i.Bytes() returned error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Translation holds the Summary and Description of a package in a locale.
+// An empty Description is the untranslated one.
+type Translation struct {
+	Summary     string
+	Description string
+}
+
+// locales returns the header i18n table, "C", the untranslated locale, then
+// the locales of the translations, sorted.
+func (r *RPM) locales() []string {
+	l := []string{}
+	for locale := range r.Translations {
+		l = append(l, locale)
+	}
+	sort.Strings(l)
+	return append([]string{"C"}, l...)
+}
+
+func (r *RPM) checkTranslations() error {
+	for _, locale := range r.locales()[1:] {
+		if locale == "C" || locale == "" || strings.ContainsAny(locale, " \t\n") {
+			return errors.Errorf("invalid translation locale %q", locale)
+		}
+		t := r.Translations[locale]
+		if t.Summary == "" {
+			return errors.Errorf("invalid translation %q: summary is empty", locale)
+		}
+		if err := checkSummaryText(t.Summary); err != nil {
+			return errors.Wrapf(err, "invalid translation %q", locale)
+		}
+		if err := checkDescriptionText(t.Description); err != nil {
+			return errors.Wrapf(err, "invalid translation %q", locale)
+		}
+	}
+	return nil
+}
+
+// writeFileLang records the language of a file, FILELANGS has an empty
+// string for the files of all languages.
+func (r *RPM) writeFileLang(f RPMFile) error {
+	for _, l := range strings.Split(f.Lang, "|") {
+		if f.Lang != "" && (l == "" || strings.ContainsAny(l, " \t\n,")) {
+			return errors.Errorf("file %s has an invalid language %q", f.Name, f.Lang)
+		}
+	}
+	r.filelangs = append(r.filelangs, f.Lang)
+	return nil
+}
+
+// writeI18NIndexes writes the summary and description with their
+// translations, and the i18n table when there are translations.
+func (r *RPM) writeI18NIndexes(h *index) {
+	if len(r.Translations) == 0 {
+		h.Add(tagSummary, EntryI18NString(r.Summary))
+		h.Add(tagDescription, EntryI18NString(r.Description))
+		return
+	}
+	locales := r.locales()
+	summaries := []string{r.Summary}
+	descriptions := []string{r.Description}
+	for _, locale := range locales[1:] {
+		t := r.Translations[locale]
+		summaries = append(summaries, t.Summary)
+		if t.Description == "" {
+			t.Description = r.Description
+		}
+		descriptions = append(descriptions, t.Description)
+	}
+	h.Add(tagHeaderI18NTable, EntryStringSlice(locales))
+	h.Add(tagSummary, EntryI18NStrings(summaries))
+	h.Add(tagDescription, EntryI18NStrings(descriptions))
+}
@@ -0,0 +1,125 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTranslations(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{
+		Name:        "test",
+		Summary:     "summary",
+		Description: "description",
+		Translations: map[string]Translation{
+			"fr":    {Summary: "résumé", Description: "la description"},
+			"de":    {Summary: "Zusammenfassung"},
+			"pt_BR": {Summary: "resumo", Description: "descrição"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	if err := r.checkSummary(); err != nil {
+		t.Fatalf("checkSummary returned error %v", err)
+	}
+	h := newIndex(immutable)
+	r.writeGenIndexes(h)
+	h.addI18NTable()
+	b, err := h.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes returned error %v", err)
+	}
+	read, _, err := readIndex(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("readIndex returned error %v", err)
+	}
+	for _, tc := range []struct {
+		tag  int
+		want []string
+	}{
+		{tagHeaderI18NTable, []string{"C", "de", "fr", "pt_BR"}},
+		{tagSummary, []string{"summary", "Zusammenfassung", "résumé", "resumo"}},
+		{tagDescription, []string{"description", "description", "la description", "descrição"}},
+	} {
+		if d := cmp.Diff(tc.want, read.getStrings(tc.tag)); d != "" {
+			t.Errorf("unexpected tag %d (-want, +got): %s", tc.tag, d)
+		}
+	}
+	if got := read.entries[tagSummary].rpmtype; got != typeI18NString {
+		t.Errorf("summary has type %d, want %d", got, typeI18NString)
+	}
+	if got, want := read.getString(tagSummary), "summary"; got != want {
+		t.Errorf("getString(tagSummary) = %q, want %q", got, want)
+	}
+	// The group is not translated, it only has a value for "C".
+	if got := read.entries[tagGroup].count; got != 1 {
+		t.Errorf("group has %d values, want 1", got)
+	}
+}
+
+func TestTranslationsValidation(t *testing.T) {
+	for _, tr := range []map[string]Translation{
+		{"C": {Summary: "summary"}},
+		{"": {Summary: "summary"}},
+		{"de DE": {Summary: "summary"}},
+		{"de": {}},
+		{"de": {Summary: "two\nlines"}},
+		{"de": {Summary: "summary", Description: "nul\x00"}},
+	} {
+		r, err := NewRPM(RPMMetaData{Name: "test", Summary: "summary", Translations: tr})
+		if err != nil {
+			t.Fatalf("NewRPM returned error %v", err)
+		}
+		if err := r.checkSummary(); err == nil {
+			t.Errorf("checkSummary accepted translations %q", tr)
+		}
+	}
+}
+
+func TestFileLangs(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "langs", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/bin/foo", Body: []byte("foo"), Mode: 0755})
+	r.AddFile(RPMFile{Name: "/usr/share/locale/de/LC_MESSAGES/foo.mo", Body: []byte("de"), Lang: "de"})
+	r.AddFile(RPMFile{Name: "/usr/share/man/pt_BR/man1/foo.1", Body: []byte("pt"), Lang: "pt_BR|pt"})
+	b := buildRPM(t, r)
+	if d := cmp.Diff([]string{"", "de", "pt_BR|pt"}, readHeader(t, b).getStrings(tagFileLangs)); d != "" {
+		t.Errorf("FILELANGS differs (-want, +got): %s", d)
+	}
+	info, err := ReadRPMInfo(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("ReadRPMInfo returned error %v", err)
+	}
+	if got := info.Files[1].Lang; got != "de" {
+		t.Errorf("ReadRPMInfo: Lang = %q, want de", got)
+	}
+
+	for _, lang := range []string{"de fr", "de,fr", "de|", "|"} {
+		r, err := NewRPM(RPMMetaData{Name: "langs", Summary: "summary"})
+		if err != nil {
+			t.Fatalf("NewRPM returned error %v", err)
+		}
+		r.AddFile(RPMFile{Name: "/usr/share/foo", Body: []byte("foo"), Lang: lang})
+		if err := r.Write(&bytes.Buffer{}); err == nil {
+			t.Errorf("Write with the language %q returned no error", lang)
+		}
+	}
+}
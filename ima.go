@@ -0,0 +1,94 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// SetIMASigner signs the content of every regular file with key, and stores
+// the signatures in the FILESIGNATURES tag. rpm installs them as the
+// security.ima extended attribute of the files, for systems enforcing IMA
+// appraisal. The public key has to be loaded in the .ima kernel keyring.
+// The signatures are IMA v2 signatures (as created by `evmctl ima_sign`) of
+// the file digests, so they use the FileDigest algorithm.
+func (r *RPM) SetIMASigner(key crypto.Signer) error {
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal the public key")
+	}
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(der, &spki); err != nil {
+		return errors.Wrap(err, "failed to parse the public key")
+	}
+	// The key id is the last 4 bytes of the subject key identifier of the key.
+	skid := sha1.Sum(spki.PublicKey.Bytes)
+	r.imaSigner = key
+	r.imaKeyID = skid[len(skid)-4:]
+	return nil
+}
+
+// writeFileSignature adds the IMA signature of a file from its digest sum, or
+// an empty one if the file is not signed, to keep the file arrays aligned.
+func (r *RPM) writeFileSignature(sum []byte, regular bool) error {
+	if r.imaSigner == nil {
+		return nil
+	}
+	if !regular {
+		r.filesignatures = append(r.filesignatures, "")
+		return nil
+	}
+	sig, err := r.imaSigner.Sign(rand.Reader, sum, r.fileDigest.hash)
+	if err != nil {
+		return errors.Wrap(err, "failed to create IMA signature")
+	}
+	// struct signature_v2_hdr of the kernel: EVM_IMA_XATTR_DIGSIG, version 2,
+	// the hash algorithm, the key id, and the signature size, all big endian.
+	b := &bytes.Buffer{}
+	b.Write([]byte{0x03, 0x02, r.fileDigest.ima})
+	b.Write(r.imaKeyID)
+	binary.Write(b, binary.BigEndian, uint16(len(sig)))
+	b.Write(sig)
+	r.filesignatures = append(r.filesignatures, fmt.Sprintf("%x", b.Bytes()))
+	return nil
+}
+
+func (r *RPM) writeFileSignatureIndexes(h *index) {
+	if r.imaSigner == nil {
+		return
+	}
+	// The length is the size of the longest signature, in bytes.
+	l := 0
+	for _, s := range r.filesignatures {
+		if len(s)/2 > l {
+			l = len(s) / 2
+		}
+	}
+	h.Add(tagFileSignatures, EntryStringSlice(r.filesignatures))
+	h.Add(tagFileSignatureLen, EntryUint32([]uint32{uint32(l)}))
+}
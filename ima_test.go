@@ -0,0 +1,78 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+)
+
+func TestIMASignatures(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey returned error %v", err)
+	}
+	r, err := NewRPM(RPMMetaData{Name: "ima", Version: "1.0", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	if err := r.SetIMASigner(key); err != nil {
+		t.Fatalf("SetIMASigner returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/bin/ima", Body: []byte("binary"), Mode: 0755})
+	r.AddFile(RPMFile{Name: "/usr/lib/ima", Mode: 040755})
+	h := readHeader(t, buildRPM(t, r))
+	sigs := h.getStrings(tagFileSignatures)
+	if len(sigs) != 2 {
+		t.Fatalf("got %d file signatures, want 2", len(sigs))
+	}
+	if sigs[1] != "" {
+		t.Errorf("directory signature = %q, want empty", sigs[1])
+	}
+	b, err := hex.DecodeString(sigs[0])
+	if err != nil {
+		t.Fatalf("file signature %q is not hex: %v", sigs[0], err)
+	}
+	if len(b) < 9 || b[0] != 0x03 || b[1] != 0x02 || b[2] != 4 {
+		t.Fatalf("file signature header %x, want 030204", b)
+	}
+	if n := int(binary.BigEndian.Uint16(b[7:9])); n != len(b)-9 {
+		t.Errorf("signature size = %d, want %d", n, len(b)-9)
+	}
+	digest := sha256.Sum256([]byte("binary"))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], b[9:]); err != nil {
+		t.Errorf("file signature does not verify: %v", err)
+	}
+	if got := h.getUint32s(tagFileSignatureLen); len(got) != 1 || int(got[0]) != len(b) {
+		t.Errorf("file signature length = %v, want [%d]", got, len(b))
+	}
+}
+
+func TestNoIMASignatures(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "ima", Version: "1.0", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/bin/ima", Body: []byte("binary")})
+	h := readHeader(t, buildRPM(t, r))
+	if _, ok := h.entries[tagFileSignatures]; ok {
+		t.Error("file signatures written without an IMA signer")
+	}
+}
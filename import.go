@@ -0,0 +1,185 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ImportRules control how AddDir maps a directory tree to the rpm.
+// Patterns are path.Match patterns, matched against the slash separated path
+// relative to the imported directory, like "bin/*".
+type ImportRules struct {
+	// Exclude skips the matching files, and the content of matching directories.
+	Exclude []string
+	// Owner and Group own the files matching no Owners rule, root if empty.
+	Owner, Group string
+	// Owners sets the owner and group of the matching files, the last
+	// matching rule wins.
+	Owners []OwnerRule
+	// FileMode, if set, replaces the permissions of the regular files.
+	FileMode uint
+	// ModeMask is cleared from the permissions of every file, like a umask.
+	ModeMask uint
+	// Type is the type of the regular files, like ConfigFile or DocFile.
+	Type FileType
+	// Rewrites change the destination paths, the first rule whose From is a
+	// prefix of a destination path replaces that prefix with To.
+	Rewrites []PathRewrite
+}
+
+// OwnerRule sets the owner and group of the files matching Pattern.
+type OwnerRule struct {
+	Pattern, Owner, Group string
+}
+
+// PathRewrite replaces the destination path prefix From with To.
+type PathRewrite struct {
+	From, To string
+}
+
+func matchAny(patterns []string, name string) (bool, error) {
+	for _, p := range patterns {
+		ok, err := path.Match(p, name)
+		if err != nil {
+			return false, errors.Wrapf(err, "invalid pattern %q", p)
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (ir ImportRules) rewrite(name string) string {
+	for _, rw := range ir.Rewrites {
+		if name == rw.From || strings.HasPrefix(name, strings.TrimSuffix(rw.From, "/")+"/") {
+			return path.Join(rw.To, strings.TrimPrefix(name, rw.From))
+		}
+	}
+	return name
+}
+
+// AddDir adds the directory tree src from disk under the directory dest,
+// following rules. dest itself is added as a directory, unless it is "/".
+// If src is a file, it is added as dest.
+// Symlinks are added as symlinks, and the modes of the files are the modes on
+// disk, as FileFromInfo converts them. The content of the files is read by Write,
+// which opens them only while reading them.
+func (r *RPM) AddDir(src, dest string, rules ImportRules) error {
+	return filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if excluded, err := matchAny(rules.Exclude, rel); err != nil {
+			return err
+		} else if excluded && rel != "." {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		f, err := FileFromInfo(rules.rewrite(path.Join(dest, rel)), p, info)
+		if err != nil {
+			return err
+		}
+		// The owners come from the rules, and not from the build host.
+		f.Owner, f.Group = rules.Owner, rules.Group
+		if f.Owner == "" {
+			f.Owner = "root"
+		}
+		if f.Group == "" {
+			f.Group = "root"
+		}
+		for _, o := range rules.Owners {
+			ok, err := path.Match(o.Pattern, rel)
+			if err != nil {
+				return errors.Wrapf(err, "invalid pattern %q", o.Pattern)
+			}
+			if ok {
+				f.Owner, f.Group = o.Owner, o.Group
+			}
+		}
+		if f.Mode&0170000 == 0100000 {
+			if rules.FileMode != 0 {
+				f.Mode = 0100000 | rules.FileMode
+			}
+			f.Type = rules.Type
+		}
+		f.Mode &^= rules.ModeMask
+		return r.AddFile(f)
+	})
+}
+
+// lazyReader reads the content of a file opened by open, keeping it open
+// only while it is read, so that adding many files does not exhaust the file
+// descriptors. Seeking reopens the file.
+type lazyReader struct {
+	open func() (io.ReadCloser, error)
+	rc   io.ReadCloser
+	off  int64
+}
+
+func (l *lazyReader) Read(p []byte) (int, error) {
+	if l.rc == nil {
+		rc, err := l.open()
+		if err != nil {
+			return 0, err
+		}
+		if _, err := io.CopyN(ioutil.Discard, rc, l.off); err != nil {
+			rc.Close()
+			return 0, err
+		}
+		l.rc = rc
+	}
+	n, err := l.rc.Read(p)
+	l.off += int64(n)
+	if err == io.EOF {
+		l.rc.Close()
+		l.rc = nil
+	}
+	return n, err
+}
+
+func (l *lazyReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += l.off
+	default:
+		return 0, errors.New("lazyReader: unsupported whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("lazyReader: negative position")
+	}
+	if l.rc != nil && offset != l.off {
+		l.rc.Close()
+		l.rc = nil
+	}
+	l.off = offset
+	return offset, nil
+}
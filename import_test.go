@@ -0,0 +1,115 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAddDir(t *testing.T) {
+	src, err := ioutil.TempDir("", "rpmpack")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir returned error %v", err)
+	}
+	defer os.RemoveAll(src)
+	for _, d := range []string{"bin", "etc", "cache"} {
+		if err := os.Mkdir(filepath.Join(src, d), 0775); err != nil {
+			t.Fatalf("os.Mkdir returned error %v", err)
+		}
+	}
+	for name, content := range map[string]string{
+		"bin/tool":     "#!/bin/sh",
+		"etc/app.conf": "a=b",
+		"cache/data":   "cached",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(src, name), []byte(content), 0664); err != nil {
+			t.Fatalf("ioutil.WriteFile returned error %v", err)
+		}
+	}
+	// Set the modes explicitly, regardless of the umask.
+	for name, mode := range map[string]os.FileMode{".": 0775, "bin": 0775, "etc": 0775, "bin/tool": 0775, "etc/app.conf": 0664} {
+		if err := os.Chmod(filepath.Join(src, name), mode); err != nil {
+			t.Fatalf("os.Chmod returned error %v", err)
+		}
+	}
+	if err := os.Symlink("bin/tool", filepath.Join(src, "tool")); err != nil {
+		t.Fatalf("os.Symlink returned error %v", err)
+	}
+
+	r, err := NewRPM(RPMMetaData{Name: "dir", Version: "1.0", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	err = r.AddDir(src, "/opt/app", ImportRules{
+		Exclude:  []string{"cache"},
+		Owners:   []OwnerRule{{Pattern: "etc/*", Owner: "app", Group: "apps"}},
+		ModeMask: 002,
+		Rewrites: []PathRewrite{{From: "/opt/app/etc", To: "/etc/app"}},
+	})
+	if err != nil {
+		t.Fatalf("AddDir returned error %v", err)
+	}
+	info, err := ReadRPMInfo(bytes.NewReader(buildRPM(t, r)))
+	if err != nil {
+		t.Fatalf("ReadRPMInfo returned error %v", err)
+	}
+	type file struct {
+		Name, Owner, Group string
+		Mode               uint
+		Size               int64
+	}
+	got := []file{}
+	for _, f := range info.Files {
+		got = append(got, file{f.Name, f.Owner, f.Group, f.Mode, f.Size})
+	}
+	want := []file{
+		{"/etc/app", "root", "root", 040775, 4096},
+		{"/etc/app/app.conf", "app", "apps", 0100664, 3},
+		{"/opt/app", "root", "root", 040775, 4096},
+		{"/opt/app/bin", "root", "root", 040775, 4096},
+		{"/opt/app/bin/tool", "root", "root", 0100775, 9},
+		{"/opt/app/tool", "root", "root", 0120775, 8},
+	}
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("AddDir files mismatch (-want +got):\n%s", d)
+	}
+}
+
+func TestAddDirFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "rpmpack")
+	if err != nil {
+		t.Fatalf("ioutil.TempFile returned error %v", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("a=b")
+	f.Close()
+	r, err := NewRPM(RPMMetaData{Name: "dir", Version: "1.0", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	if err := r.AddDir(f.Name(), "/etc/app.conf", ImportRules{Owner: "app", FileMode: 0640, Type: ConfigFile}); err != nil {
+		t.Fatalf("AddDir returned error %v", err)
+	}
+	got := r.files["/etc/app.conf"]
+	if got.Mode != 0100640 || got.Owner != "app" || got.Group != "root" || got.Type != ConfigFile || got.Size != 3 {
+		t.Errorf("AddDir added %+v, want a 0640 config file owned by app:root", got)
+	}
+}
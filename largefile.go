@@ -0,0 +1,111 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// ErrSizeMismatch is returned by Write when the size tags of the signature
+// header do not match the package, which rpm would reject.
+var ErrSizeMismatch = errors.New("signature size tags do not match the package")
+
+// longSizeLimit is the largest size the 32-bit size tags and cpio headers
+// hold. Larger sizes are written to the 64-bit tags instead.
+var longSizeLimit int64 = math.MaxUint32
+
+// largeFiles reports whether a file is too large for FILESIZES, and the
+// package needs rpmlib(LargeFiles).
+func (r *RPM) largeFiles() bool {
+	for _, s := range r.filesizes {
+		if s > longSizeLimit {
+			return true
+		}
+	}
+	return false
+}
+
+// writeFileSizeIndexes writes the file sizes, to LONGFILESIZES if one of
+// them does not fit FILESIZES. rpm reads either, never both.
+func (r *RPM) writeFileSizeIndexes(h *index) {
+	if r.largeFiles() {
+		h.Add(tagLongFileSizes, EntryInt64(r.filesizes))
+		return
+	}
+	sizes := make([]uint32, len(r.filesizes))
+	for ii, s := range r.filesizes {
+		sizes[ii] = uint32(s)
+	}
+	h.Add(tagFileSizes, EntryUint32(sizes))
+}
+
+// writeSizeIndexes writes the installed size of the package, to LONGSIZE if
+// it does not fit SIZE.
+func (r *RPM) writeSizeIndexes(h *index) {
+	if r.payloadSize > longSizeLimit {
+		h.Add(tagLongSize, EntryInt64([]int64{r.payloadSize}))
+		return
+	}
+	h.Add(tagSize, EntryUint32([]uint32{uint32(r.payloadSize)}))
+}
+
+// writeSizeSignatures writes the size of the header and payload, n, and the
+// size of the uncompressed payload, the cpio archive with its headers and
+// padding, to the 64-bit tags if they do not fit the 32-bit ones.
+func (r *RPM) writeSizeSignatures(sigHeader *index, n int64) {
+	if n > longSizeLimit {
+		sigHeader.Add(sigLongSize, EntryInt64([]int64{n}))
+	} else {
+		sigHeader.Add(sigSize, EntryUint32([]uint32{uint32(n)}))
+	}
+	if r.archiveSize > longSizeLimit {
+		sigHeader.Add(sigLongArchiveSize, EntryInt64([]int64{r.archiveSize}))
+	} else {
+		sigHeader.Add(sigPayloadSize, EntryUint32([]uint32{uint32(r.archiveSize)}))
+	}
+}
+
+// checkSizeSignatures checks the size tags of the signature header s against
+// the size of the header and payload, n, and the size of the archive, before
+// Write writes them. A custom signature can replace them.
+func (r *RPM) checkSizeSignatures(s *index, n int64) error {
+	for _, c := range []struct {
+		name        string
+		short, long int
+		want        int64
+	}{
+		{"SIZE", sigSize, sigLongSize, n},
+		{"PAYLOADSIZE", sigPayloadSize, sigLongArchiveSize, r.archiveSize},
+	} {
+		var got []int64
+		for _, v := range s.getUint32s(c.short) {
+			got = append(got, int64(v))
+		}
+		for _, v := range s.getUint64s(c.long) {
+			got = append(got, int64(v))
+		}
+		if len(got) == 0 {
+			return errors.Wrapf(ErrSizeMismatch, "%s is missing", c.name)
+		}
+		for _, v := range got {
+			if v != c.want {
+				return errors.Wrapf(ErrSizeMismatch, "%s is %d, want %d", c.name, v, c.want)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+)
+
+func TestLargeFiles(t *testing.T) {
+	// Lower the limit, rather than writing 4GiB.
+	defer func(l int64) { longSizeLimit = l }(longSizeLimit)
+	longSizeLimit = 4
+
+	r, err := NewRPM(RPMMetaData{Name: "large", Summary: "summary", Compressor: "none"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/large", Body: []byte("abcdef")})
+	r.AddFile(RPMFile{Name: "/small", Body: []byte("xy")})
+	b := buildRPM(t, r)
+	h := readHeader(t, b)
+	if got, want := h.getUint64s(tagLongFileSizes), []uint64{6, 2}; !cmp.Equal(got, want) {
+		t.Errorf("LONGFILESIZES = %v, want %v", got, want)
+	}
+	if got, want := h.getUint64s(tagLongSize), []uint64{8}; !cmp.Equal(got, want) {
+		t.Errorf("LONGSIZE = %v, want %v", got, want)
+	}
+	for _, tag := range []int{tagFileSizes, tagSize} {
+		if _, ok := h.entries[tag]; ok {
+			t.Errorf("tag %d is written together with its 64-bit version", tag)
+		}
+	}
+	if got := h.getStrings(tagRequires); !contains(got, "rpmlib(LargeFiles)") {
+		t.Errorf("REQUIRENAME = %q, want rpmlib(LargeFiles)", got)
+	}
+
+	rd := bytes.NewReader(b)
+	if _, err := readLead(rd); err != nil {
+		t.Fatalf("readLead returned error %v", err)
+	}
+	sig, err := readSignatures(rd)
+	if err != nil {
+		t.Fatalf("readSignatures returned error %v", err)
+	}
+	// The archive size is the size of the cpio archive, not of the files.
+	if got, want := sig.getUint64s(sigLongArchiveSize), []uint64{uint64(len(readPayload(t, b)))}; !cmp.Equal(got, want) {
+		t.Errorf("LONGARCHIVESIZE = %v, want %v", got, want)
+	}
+	if _, ok := sig.entries[sigLongSize]; !ok {
+		t.Error("LONGSIZE signature is missing")
+	}
+
+	// The large file is a stripped entry, the small one a regular newc entry.
+	want := []byte("07070X00000000\x00\x00abcdef\x00\x00070701")
+	if got := readPayload(t, b); !bytes.HasPrefix(got, want) {
+		t.Errorf("payload starts with %q, want %q", got[:len(want)], want)
+	}
+
+	info, err := ReadRPMInfo(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("ReadRPMInfo returned error %v", err)
+	}
+	if got := []int64{info.Files[0].Size, info.Files[1].Size}; !cmp.Equal(got, []int64{6, 2}) {
+		t.Errorf("ReadRPMInfo: sizes = %v, want [6 2]", got)
+	}
+}
+
+func TestSmallFilesHaveNoLongSizes(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "small", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/small", Body: []byte("xy")})
+	h := readHeader(t, buildRPM(t, r))
+	for _, tag := range []int{tagLongFileSizes, tagLongSize} {
+		if _, ok := h.entries[tag]; ok {
+			t.Errorf("tag %d is written for small files", tag)
+		}
+	}
+	if got := h.getStrings(tagRequires); contains(got, "rpmlib(LargeFiles)") {
+		t.Errorf("REQUIRENAME = %q, want no rpmlib(LargeFiles)", got)
+	}
+}
+
+func TestSizeSignatures(t *testing.T) {
+	for _, compressor := range []string{"gzip", "xz", "lzma", "zstd", "none"} {
+		for _, threads := range []int{0, 4} {
+			if threads > 1 && compressor != "gzip" && compressor != "zstd" {
+				continue
+			}
+			for _, buffered := range []bool{false, true} {
+				compressor, threads, buffered := compressor, threads, buffered
+				name := fmt.Sprintf("%s threads %d buffered %v", compressor, threads, buffered)
+				t.Run(name, func(t *testing.T) {
+					r, err := NewRPM(RPMMetaData{Name: "sizes", Summary: "summary", Compressor: compressor, CompressorThreads: threads})
+					if err != nil {
+						t.Fatalf("NewRPM returned error %v", err)
+					}
+					r.AddFile(RPMFile{Name: "/usr/share/sizes/file", Body: bytes.Repeat([]byte("sizes "), 1000)})
+					r.AddFile(RPMFile{Name: "/usr/share/sizes/odd", Body: []byte("odd")})
+					w := &bytes.Buffer{}
+					if buffered {
+						f, ferr := ioutil.TempFile("", "rpmpack")
+						if ferr != nil {
+							t.Fatalf("ioutil.TempFile returned error %v", ferr)
+						}
+						defer os.Remove(f.Name())
+						defer f.Close()
+						err = r.WriteBuffered(w, f)
+					} else {
+						err = r.Write(w)
+					}
+					if err != nil {
+						t.Fatalf("Write returned error %v", err)
+					}
+					b := w.Bytes()
+					rd := bytes.NewReader(b[0x60:])
+					sig, err := readSignatures(rd)
+					if err != nil {
+						t.Fatalf("readSignatures returned error %v", err)
+					}
+					headerStart := len(b) - rd.Len()
+					if headerStart%8 != 0 {
+						t.Errorf("header starts at offset %d, not aligned to 8 bytes", headerStart)
+					}
+					if got, want := sig.getUint32s(sigSize), []uint32{uint32(len(b) - headerStart)}; !cmp.Equal(got, want) {
+						t.Errorf("SIZE = %v, want %v", got, want)
+					}
+					info, err := ReadRPMInfo(bytes.NewReader(b))
+					if err != nil {
+						t.Fatalf("ReadRPMInfo returned error %v", err)
+					}
+					z, _, err := payloadDecompressor(info.PayloadCompressor, bufio.NewReader(bytes.NewReader(readPayload(t, b))))
+					if err != nil {
+						t.Fatalf("payloadDecompressor returned error %v", err)
+					}
+					archive, err := ioutil.ReadAll(z)
+					if err != nil {
+						t.Fatalf("failed to decompress the payload: %v", err)
+					}
+					if got, want := sig.getUint32s(sigPayloadSize), []uint32{uint32(len(archive))}; !cmp.Equal(got, want) {
+						t.Errorf("PAYLOADSIZE = %v, want %v", got, want)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestSizeSignaturesMismatch(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "sizes", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/share/sizes/file", Body: []byte("sizes")})
+	r.AddCustomSig(sigPayloadSize, EntryUint32([]uint32{5}))
+	if err := r.Write(ioutil.Discard); errors.Cause(err) != ErrSizeMismatch {
+		t.Errorf("Write returned error %v, want ErrSizeMismatch", err)
+	}
+}
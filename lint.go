@@ -0,0 +1,200 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrLint is returned by Write with StrictLint when Lint finds errors.
+var ErrLint = errors.New("package has lint errors")
+
+// LintSeverity tells apart the problems which break the package, or get it
+// rejected by repositories, from the suspicious ones.
+type LintSeverity int
+
+const (
+	// LintWarning is a problem which is likely a mistake.
+	LintWarning LintSeverity = iota
+	// LintError is a problem rpm, rpmlint or repositories reject.
+	LintError
+)
+
+// String returns "W" or "E", like rpmlint.
+func (s LintSeverity) String() string {
+	if s == LintError {
+		return "E"
+	}
+	return "W"
+}
+
+// LintIssue is a problem found by Lint.
+type LintIssue struct {
+	Severity LintSeverity
+	// Check names the check, after the rpmlint one when there is one, like
+	// "dangling-symlink".
+	Check string
+	// File is the file or the scriptlet of the problem, like "/usr/bin/foo"
+	// or "%post", or empty for the package.
+	File    string
+	Message string
+}
+
+// String formats the issue like rpmlint, "E: check file message".
+func (i LintIssue) String() string {
+	s := fmt.Sprintf("%s: %s", i.Severity, i.Check)
+	if i.File != "" {
+		s += " " + i.File
+	}
+	return s + " " + i.Message
+}
+
+// Lint checks r for the problems rpmlint and repositories report, before the
+// package is written:
+//   - a missing Summary or License.
+//   - relocation prefixes and scriptlet interpreters which are not absolute
+//     paths.
+//   - scriptlets without an interpreter, and scriptlets starting with a
+//     shebang line naming another interpreter, whose shebang rpm ignores.
+//   - files under /tmp or /var/tmp, which are cleaned on reboot.
+//   - world writable files, other than the ones with the sticky bit, like the
+//     directory /tmp, and symlinks.
+//   - symlinks to a path which is not in the payload. The target can be in
+//     another package, so they are only warnings.
+//
+// The package problems come first, then the ones of the files, by name, and
+// then the ones of the scriptlets.
+func (r *RPM) Lint() []LintIssue {
+	var issues []LintIssue
+	add := func(s LintSeverity, check, file, format string, a ...interface{}) {
+		issues = append(issues, LintIssue{Severity: s, Check: check, File: file, Message: fmt.Sprintf(format, a...)})
+	}
+	if r.Summary == "" {
+		add(LintError, "no-summary-tag", "", "the package has no Summary")
+	}
+	if r.Licence == "" {
+		add(LintError, "no-license", "", "the package has no License")
+	}
+	for _, p := range r.Prefixes {
+		if !path.IsAbs(p) {
+			add(LintError, "non-absolute-prefix", "", "the prefix %q is not an absolute path", p)
+		}
+	}
+
+	fnames := make([]string, 0, len(r.files))
+	for fn := range r.files {
+		fnames = append(fnames, fn)
+	}
+	sort.Strings(fnames)
+	for _, fn := range fnames {
+		f := r.files[fn]
+		if inTmp(fn) {
+			add(LintError, "dir-or-file-in-tmp", fn, "the file is removed when the temporary directories are cleaned")
+		}
+		if worldWritable(f) {
+			add(LintError, "world-writable", fn, "the mode %o lets any user change the file", f.Mode&07777)
+		}
+		if f.Mode&0170000 == 0120000 {
+			target := string(f.Body)
+			if !path.IsAbs(target) {
+				target = path.Join(path.Dir(fn), target)
+			}
+			if !r.hasPath(path.Clean(target)) {
+				add(LintWarning, "dangling-symlink", fn, "the target %q is not in the package", string(f.Body))
+			}
+		}
+	}
+
+	lintScript := func(name string, s scriptlet) {
+		prog := s.interpreter()
+		if prog[0] == "" {
+			add(LintError, "scriptlet-without-interpreter", name, "the scriptlet has no interpreter")
+			return
+		}
+		if prog[0] != LuaInterpreter && !path.IsAbs(prog[0]) {
+			add(LintError, "non-absolute-interpreter", name, "the interpreter %q is not an absolute path", prog[0])
+		}
+		if strings.HasPrefix(s.body, "#!") {
+			shebang := strings.Fields(strings.SplitN(s.body[2:], "\n", 2)[0])
+			if len(shebang) > 0 && shebang[0] != prog[0] {
+				add(LintWarning, "ignored-shebang", name, "rpm runs the scriptlet with %s, not %s", prog[0], shebang[0])
+			}
+		}
+	}
+	for _, ss := range scriptletSections {
+		if s, ok := r.scriptlets[ss.t]; ok && (s.body != "" || len(s.prog) > 0) {
+			lintScript(ss.name, s)
+		}
+	}
+	for _, t := range r.triggers {
+		lintScript("%"+triggerSections[t.Type], scriptlet{body: t.Script, prog: []string{t.Interpreter}})
+	}
+	for _, t := range r.fileTriggers {
+		name := "%file" + triggerSections[t.Type]
+		if t.Transaction {
+			name = "%transfile" + triggerSections[t.Type]
+		}
+		lintScript(name, scriptlet{body: t.Script, prog: []string{t.Interpreter}})
+	}
+	return issues
+}
+
+// checkLint returns ErrLint, listing the errors of Lint, if it finds any.
+func (r *RPM) checkLint() error {
+	var errs []string
+	for _, i := range r.Lint() {
+		if i.Severity == LintError {
+			errs = append(errs, i.String())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Wrap(ErrLint, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// hasPath reports whether p is a file of r, or a directory holding one.
+func (r *RPM) hasPath(p string) bool {
+	if _, ok := r.files[p]; ok || p == "/" {
+		return true
+	}
+	for fn := range r.files {
+		if strings.HasPrefix(fn, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// inTmp reports whether name is under /tmp or /var/tmp.
+func inTmp(name string) bool {
+	for _, tmp := range []string{"/tmp", "/var/tmp"} {
+		if name == tmp || strings.HasPrefix(name, tmp+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// worldWritable reports whether f is writable by any user, without the sticky
+// bit. The mode of symlinks does not matter.
+func worldWritable(f RPMFile) bool {
+	return f.Mode&02 != 0 && f.Mode&01000 == 0 && f.Mode&0170000 != 0120000
+}
@@ -0,0 +1,134 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+)
+
+func TestLint(t *testing.T) {
+	testCases := []struct {
+		name  string
+		md    RPMMetaData
+		setup func(*RPM)
+		want  []string
+	}{{
+		name: "clean",
+		setup: func(r *RPM) {
+			r.AddFile(RPMFile{Name: "/usr/bin/lint", Mode: 0100755})
+			r.AddFile(NewSymlink("/usr/bin/lint2", "lint"))
+			r.AddFile(NewSymlink("/usr/share/lint", "/usr/bin"))
+			r.AddFile(RPMFile{Name: "/var/spool/lint", Mode: 041777})
+			r.AddPostin("echo post")
+			r.AddPrein("#!/bin/sh\necho pre")
+		},
+	}, {
+		name: "no license",
+		md:   RPMMetaData{Licence: ""},
+		want: []string{"E: no-license"},
+	}, {
+		name: "relative prefix",
+		md:   RPMMetaData{Prefixes: []string{"opt/lint"}},
+		want: []string{"E: non-absolute-prefix"},
+	}, {
+		name: "files",
+		setup: func(r *RPM) {
+			r.AddFile(RPMFile{Name: "/tmp/lint", Mode: 0100644})
+			r.AddFile(RPMFile{Name: "/etc/lint.conf", Mode: 0100666})
+			r.AddFile(NewSymlink("/usr/bin/dangling", "../lib/missing"))
+		},
+		want: []string{
+			"E: world-writable /etc/lint.conf",
+			"E: dir-or-file-in-tmp /tmp/lint",
+			"W: dangling-symlink /usr/bin/dangling",
+		},
+	}, {
+		name: "scriptlets",
+		setup: func(r *RPM) {
+			r.AddPostin("echo post")
+			r.SetScriptletInterpreter(PostinScriptlet, "bash")
+			r.AddPreun("#!/usr/bin/python3\nprint('preun')")
+			r.AddPostun("echo postun")
+			r.SetScriptletInterpreter(PostunScriptlet, "")
+		},
+		want: []string{
+			"E: non-absolute-interpreter %post",
+			"W: ignored-shebang %preun",
+			"E: scriptlet-without-interpreter %postun",
+		},
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			md := tc.md
+			md.Name, md.Version, md.Summary = "lint", "1.0", "summary"
+			if tc.name != "no license" {
+				md.Licence = "MIT"
+			}
+			r, err := NewRPM(md)
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			if tc.setup != nil {
+				tc.setup(r)
+			}
+			var got []string
+			for _, i := range r.Lint() {
+				s := i.Severity.String() + ": " + i.Check
+				if i.File != "" {
+					s += " " + i.File
+				}
+				got = append(got, s)
+			}
+			if d := cmp.Diff(tc.want, got); d != "" {
+				t.Errorf("Lint() mismatch (-want +got):\n%s", d)
+			}
+		})
+	}
+}
+
+func TestStrictLint(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "lint", Version: "1.0", Summary: "summary", StrictLint: true})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/bin/lint", Mode: 0100755})
+	// Warnings do not fail Write.
+	r.AddFile(NewSymlink("/usr/bin/dangling", "missing"))
+	err = r.Write(ioutil.Discard)
+	if errors.Cause(err) != ErrLint {
+		t.Fatalf("Write returned error %v, want ErrLint", err)
+	}
+	if !strings.Contains(err.Error(), "E: no-license") || strings.Contains(err.Error(), "dangling") {
+		t.Errorf("Write returned error %q, want only the missing license", err)
+	}
+	r, err = NewRPM(RPMMetaData{Name: "lint", Version: "1.0", Summary: "summary", Licence: "MIT", StrictLint: true})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(NewSymlink("/usr/bin/dangling", "missing"))
+	if err := r.Write(ioutil.Discard); err != nil {
+		t.Errorf("Write returned error %v", err)
+	}
+	issue := LintIssue{Severity: LintWarning, Check: "dangling-symlink", File: "/usr/bin/dangling", Message: "the target is missing"}
+	if got, want := issue.String(), "W: dangling-symlink /usr/bin/dangling the target is missing"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,346 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package manifest builds rpms from a declarative description, so that build
+// systems which are not written in go can use rpmpack. A manifest is YAML,
+// or JSON, which is also valid YAML, for example:
+//
+//	name: hello
+//	version: 1.0.0
+//	release: "1"
+//	summary: says hello
+//	license: ASL 2.0
+//	requires: ["bash", "glibc >= 2.28"]
+//	files:
+//	  - src: build/hello
+//	    dst: /usr/bin/hello
+//	    mode: 0755
+//	  - src: etc/*.conf
+//	    dst: /etc/hello/
+//	    type: noreplace
+//	  - dst: /var/lib/hello
+//	    owner: hello
+//	scripts:
+//	  postin: echo installed
+//	scriptfiles:
+//	  preun: scripts/preun.sh
+//	changelog:
+//	  - time: 2020-06-01
+//	    author: Jane Doe <jane@example.com> - 1.0.0-1
+//	    text: "- Initial release"
+//
+// The fields of the metadata are the fields of rpmpack.RPMMetaData, in lower
+// case. The dependencies are relations like "glibc >= 2.28", see
+// rpmpack.Relations.Set. The files and the scriptlet files are relative to
+// the directory of the manifest, see File. Unknown fields are errors.
+package manifest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/rpmpack"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Manifest is the declarative description of an rpm.
+type Manifest struct {
+	Name        string `yaml:"name"`
+	Version     string `yaml:"version"`
+	Release     string `yaml:"release"`
+	Epoch       uint32 `yaml:"epoch"`
+	Arch        string `yaml:"arch"`
+	OS          string `yaml:"os"`
+	Summary     string `yaml:"summary"`
+	Description string `yaml:"description"`
+	Vendor      string `yaml:"vendor"`
+	Packager    string `yaml:"packager"`
+	Group       string `yaml:"group"`
+	URL         string `yaml:"url"`
+	Licence     string `yaml:"license"`
+	Compressor  string `yaml:"compressor"`
+	DistTag     string `yaml:"disttag"`
+	DistURL     string `yaml:"disturl"`
+	Platform    string `yaml:"platform"`
+
+	ModularityLabel string `yaml:"modularitylabel"`
+
+	Provides    []string `yaml:"provides"`
+	Obsoletes   []string `yaml:"obsoletes"`
+	Suggests    []string `yaml:"suggests"`
+	Recommends  []string `yaml:"recommends"`
+	Supplements []string `yaml:"supplements"`
+	Enhances    []string `yaml:"enhances"`
+	Requires    []string `yaml:"requires"`
+	Conflicts   []string `yaml:"conflicts"`
+
+	OrderWithRequires []string `yaml:"orderwithrequires"`
+
+	Files []File `yaml:"files"`
+	// Scripts are the scriptlets, and ScriptFiles the files holding them,
+	// relative to the manifest. A scriptlet is in either of them.
+	Scripts     Scripts     `yaml:"scripts"`
+	ScriptFiles Scripts     `yaml:"scriptfiles"`
+	Changelog   []Changelog `yaml:"changelog"`
+}
+
+// Scripts are the scriptlets of the rpm, run with /bin/sh.
+type Scripts struct {
+	Prein     string `yaml:"prein"`
+	Postin    string `yaml:"postin"`
+	Preun     string `yaml:"preun"`
+	Postun    string `yaml:"postun"`
+	Pretrans  string `yaml:"pretrans"`
+	Posttrans string `yaml:"posttrans"`
+}
+
+// Changelog is a changelog entry. Time is a date like 2020-06-01, or a full
+// RFC 3339 time.
+type Changelog struct {
+	Time   time.Time `yaml:"time"`
+	Author string    `yaml:"author"`
+	Text   string    `yaml:"text"`
+}
+
+// UnmarshalYAML parses the time of the entry, which is a string in JSON.
+func (c *Changelog) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v struct {
+		Time   string `yaml:"time"`
+		Author string `yaml:"author"`
+		Text   string `yaml:"text"`
+	}
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+	*c = Changelog{Author: v.Author, Text: v.Text}
+	if v.Time == "" {
+		return nil
+	}
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if t, err := time.Parse(layout, v.Time); err == nil {
+			c.Time = t
+			return nil
+		}
+	}
+	return errors.Errorf("invalid changelog time %q, want a date like 2020-06-01 or an RFC 3339 time", v.Time)
+}
+
+// File adds the files matching the glob Src, relative to the manifest, to
+// the rpm. A single match is added as Dst, unless Dst ends with a slash, in
+// which case the matches are added in the Dst directory. Directories are
+// added recursively. Without Src, Dst is an empty directory.
+type File struct {
+	Src   string `yaml:"src"`
+	Dst   string `yaml:"dst"`
+	Mode  uint   `yaml:"mode"`
+	Owner string `yaml:"owner"`
+	Group string `yaml:"group"`
+	// Type are the attributes of the file as in the %files section of a spec
+	// file, like "config(noreplace) ghost", see rpmpack.ParseFileType.
+	// "noreplace" is short for a config file kept when changed.
+	Type    string   `yaml:"type"`
+	Exclude []string `yaml:"exclude"`
+}
+
+// Parse parses the YAML or JSON manifest b.
+func Parse(b []byte) (*Manifest, error) {
+	m := &Manifest{}
+	if err := yaml.UnmarshalStrict(b, m); err != nil {
+		return nil, err
+	}
+	if m.Name == "" || m.Version == "" {
+		return nil, errors.New("name and version are required")
+	}
+	return m, nil
+}
+
+// Read reads and parses the manifest file name.
+func Read(name string) (*Manifest, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	m, err := Parse(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", name)
+	}
+	return m, nil
+}
+
+func relations(values []string) (rpmpack.Relations, error) {
+	var rs rpmpack.Relations
+	for _, v := range values {
+		if err := rs.Set(v); err != nil {
+			return nil, err
+		}
+	}
+	return rs, nil
+}
+
+// Build creates the rpm described by m. The files are relative to dir,
+// usually the directory of the manifest.
+func (m *Manifest) Build(dir string) (*rpmpack.RPM, error) {
+	md := rpmpack.RPMMetaData{
+		Name:        m.Name,
+		Version:     m.Version,
+		Release:     m.Release,
+		Epoch:       m.Epoch,
+		Arch:        m.Arch,
+		OS:          m.OS,
+		Summary:     m.Summary,
+		Description: m.Description,
+		Vendor:      m.Vendor,
+		Packager:    m.Packager,
+		Group:       m.Group,
+		URL:         m.URL,
+		Licence:     m.Licence,
+		Compressor:  m.Compressor,
+		DistTag:     m.DistTag,
+		DistURL:     m.DistURL,
+		Platform:    m.Platform,
+
+		ModularityLabel: m.ModularityLabel,
+	}
+	if md.Arch == "" {
+		md.Arch = "noarch"
+	}
+	if md.OS == "" {
+		md.OS = "linux"
+	}
+	if md.Summary == "" {
+		md.Summary = md.Name
+	}
+	for _, rel := range []struct {
+		values []string
+		dst    *rpmpack.Relations
+	}{
+		{m.Provides, &md.Provides},
+		{m.Obsoletes, &md.Obsoletes},
+		{m.Suggests, &md.Suggests},
+		{m.Recommends, &md.Recommends},
+		{m.Supplements, &md.Supplements},
+		{m.Enhances, &md.Enhances},
+		{m.Requires, &md.Requires},
+		{m.Conflicts, &md.Conflicts},
+		{m.OrderWithRequires, &md.OrderWithRequires},
+	} {
+		rs, err := relations(rel.values)
+		if err != nil {
+			return nil, err
+		}
+		*rel.dst = rs
+	}
+	r, err := rpmpack.NewRPM(md)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range m.Files {
+		if err := f.add(r, dir); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range []struct {
+		name        string
+		script, src string
+		add         func(string)
+	}{
+		{"prein", m.Scripts.Prein, m.ScriptFiles.Prein, r.AddPrein},
+		{"postin", m.Scripts.Postin, m.ScriptFiles.Postin, r.AddPostin},
+		{"preun", m.Scripts.Preun, m.ScriptFiles.Preun, r.AddPreun},
+		{"postun", m.Scripts.Postun, m.ScriptFiles.Postun, r.AddPostun},
+		{"pretrans", m.Scripts.Pretrans, m.ScriptFiles.Pretrans, r.AddPretrans},
+		{"posttrans", m.Scripts.Posttrans, m.ScriptFiles.Posttrans, r.AddPosttrans},
+	} {
+		script, err := readScript(dir, s.name, s.script, s.src)
+		if err != nil {
+			return nil, err
+		}
+		s.add(script)
+	}
+	for _, c := range m.Changelog {
+		if c.Time.IsZero() || c.Author == "" {
+			return nil, errors.Errorf("changelog entry %q needs a time and an author", c.Text)
+		}
+		r.AddChangelog(rpmpack.ChangelogEntry{Time: c.Time, Name: c.Author, Text: c.Text})
+	}
+	return r, nil
+}
+
+// readScript returns the scriptlet name, either script or the content of the
+// file src, relative to dir.
+func readScript(dir, name, script, src string) (string, error) {
+	if src == "" {
+		return script, nil
+	}
+	if script != "" {
+		return "", errors.Errorf("the %s scriptlet is both in scripts and scriptfiles", name)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, src))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read the %s scriptlet", name)
+	}
+	return string(b), nil
+}
+
+func (f File) add(r *rpmpack.RPM, dir string) error {
+	if !path.IsAbs(f.Dst) {
+		return errors.Errorf("file destination %q is not absolute", f.Dst)
+	}
+	t, err := rpmpack.ParseFileType(f.Type)
+	if err != nil {
+		return errors.Wrapf(err, "invalid file type of %s", f.Dst)
+	}
+	if f.Src == "" {
+		mode := f.Mode
+		if mode == 0 {
+			mode = 0755
+		}
+		return r.AddFile(rpmpack.RPMFile{Name: f.Dst, Mode: 040000 | mode, Owner: f.Owner, Group: f.Group, Type: t})
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, f.Src))
+	if err != nil {
+		return errors.Wrapf(err, "invalid glob %q", f.Src)
+	}
+	if len(matches) == 0 {
+		return errors.Errorf("no file matches %q", f.Src)
+	}
+	sort.Strings(matches)
+	rules := rpmpack.ImportRules{
+		Exclude:  f.Exclude,
+		Owner:    f.Owner,
+		Group:    f.Group,
+		FileMode: f.Mode,
+		Type:     t,
+	}
+	intoDir := strings.HasSuffix(f.Dst, "/")
+	if len(matches) > 1 && !intoDir {
+		return fmt.Errorf("%q matches several files, end %s with a slash to add them in a directory", f.Src, f.Dst)
+	}
+	for _, src := range matches {
+		dst := f.Dst
+		if intoDir {
+			dst = path.Join(dst, filepath.Base(src))
+		}
+		if err := r.AddDir(src, dst, rules); err != nil {
+			return errors.Wrapf(err, "failed to add %s", src)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/rpmpack"
+)
+
+const testManifest = `
+name: hello
+version: 1.0.0
+release: "1"
+requires: ["bash", "glibc>=2.28"]
+files:
+  - src: bin/*
+    dst: /usr/bin/
+    mode: 0755
+  - src: hello.conf
+    dst: /etc/hello.conf
+    type: noreplace
+  - dst: /var/lib/hello
+    owner: hello
+scripts:
+  postin: echo installed
+scriptfiles:
+  preun: scripts/preun.sh
+changelog:
+  - time: 2020-06-01
+    author: Jane Doe <jane@example.com> - 1.0.0-1
+    text: "- Initial release"
+  - time: 2020-07-01T10:00:00Z
+    author: Jane Doe <jane@example.com> - 1.0.0-2
+    text: "- Fix the greeting"
+`
+
+func TestManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rpmpack")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir returned error %v", err)
+	}
+	defer os.RemoveAll(dir)
+	for _, d := range []string{"bin", "scripts"} {
+		if err := os.Mkdir(filepath.Join(dir, d), 0755); err != nil {
+			t.Fatalf("os.Mkdir returned error %v", err)
+		}
+	}
+	for name, content := range map[string]string{
+		"manifest.yaml":    testManifest,
+		"bin/hello":        "#!/bin/sh",
+		"bin/bye":          "#!/bin/sh",
+		"hello.conf":       "a=b",
+		"scripts/preun.sh": "echo removing",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("ioutil.WriteFile returned error %v", err)
+		}
+	}
+	m, err := Read(filepath.Join(dir, "manifest.yaml"))
+	if err != nil {
+		t.Fatalf("Read returned error %v", err)
+	}
+	r, err := m.Build(dir)
+	if err != nil {
+		t.Fatalf("Build returned error %v", err)
+	}
+	b := &bytes.Buffer{}
+	if err := r.Write(b); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	info, err := rpmpack.ReadRPMInfo(b)
+	if err != nil {
+		t.Fatalf("ReadRPMInfo returned error %v", err)
+	}
+	type file struct {
+		Name, Owner string
+		Mode        uint
+		Type        rpmpack.FileType
+	}
+	got := []file{}
+	for _, f := range info.Files {
+		got = append(got, file{f.Name, f.Owner, f.Mode, f.Type})
+	}
+	want := []file{
+		{"/etc/hello.conf", "root", 0100644, rpmpack.ConfigFile | rpmpack.NoReplaceFile},
+		{"/usr/bin/bye", "root", 0100755, rpmpack.GenericFile},
+		{"/usr/bin/hello", "root", 0100755, rpmpack.GenericFile},
+		{"/var/lib/hello", "hello", 040755, rpmpack.GenericFile},
+	}
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("files mismatch (-want +got):\n%s", d)
+	}
+	tags, err := r.DescribeTags()
+	if err != nil {
+		t.Fatalf("DescribeTags returned error %v", err)
+	}
+	changelog := 0
+	for _, tag := range tags {
+		if tag.Name == "CHANGELOGNAME" {
+			changelog = tag.Count
+		}
+	}
+	if changelog != 2 {
+		t.Errorf("changelog has %d entries, want 2", changelog)
+	}
+	spec := &bytes.Buffer{}
+	if err := r.WriteSpec(spec); err != nil {
+		t.Fatalf("WriteSpec returned error %v", err)
+	}
+	if !strings.Contains(spec.String(), "\n%preun\necho removing\n") {
+		t.Errorf("the preun scriptlet is not the content of scripts/preun.sh:\n%s", spec)
+	}
+	if info.Name != "hello" || info.Version != "1.0.0" || info.Release != "1" || info.Arch != "noarch" {
+		t.Errorf("unexpected rpm info %+v", info)
+	}
+}
+
+func TestManifestChangelogErrors(t *testing.T) {
+	for _, c := range []Changelog{
+		{Author: "Jane Doe", Text: "- no time"},
+		{Time: time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC), Text: "- no author"},
+	} {
+		m := &Manifest{Name: "x", Version: "1", Changelog: []Changelog{c}}
+		if _, err := m.Build(os.TempDir()); err == nil {
+			t.Errorf("Build accepted changelog entry %+v", c)
+		}
+	}
+}
+
+func TestManifestErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		f    File
+	}{
+		{"relative destination", File{Src: "x", Dst: "usr/bin/x"}},
+		{"unknown type", File{Dst: "/x", Type: "executable"}},
+		{"no match", File{Src: "missing", Dst: "/x"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := rpmpack.NewRPM(rpmpack.RPMMetaData{Name: "x", Version: "1", Summary: "x"})
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			if err := tc.f.add(r, os.TempDir()); err == nil {
+				t.Errorf("add(%+v) returned no error", tc.f)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		name, manifest string
+		ok             bool
+	}{
+		{"yaml", "name: hello\nversion: 1.0.0\n", true},
+		{"json", `{"name": "hello", "version": "1.0.0", "requires": ["bash"], "files": [{"dst": "/var/lib/hello", "mode": 493}], "changelog": [{"time": "2020-06-01", "author": "Jane Doe", "text": "- Initial release"}]}`, true},
+		{"invalid time", "name: hello\nversion: 1.0.0\nchangelog:\n  - time: June 1st\n    author: Jane Doe\n", false},
+		{"no version", "name: hello\n", false},
+		{"unknown field", "name: hello\nversion: 1.0.0\nlicence: MIT\n", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := Parse([]byte(tc.manifest))
+			if !tc.ok {
+				if err == nil {
+					t.Errorf("Parse(%q) returned no error", tc.manifest)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error %v", tc.manifest, err)
+			}
+			if m.Name != "hello" || m.Version != "1.0.0" {
+				t.Errorf("Parse(%q) = %+v", tc.manifest, m)
+			}
+		})
+	}
+}
+
+func TestScriptFilesErrors(t *testing.T) {
+	for name, m := range map[string]*Manifest{
+		"both":    {Name: "x", Version: "1", Scripts: Scripts{Postin: "true"}, ScriptFiles: Scripts{Postin: "postin.sh"}},
+		"missing": {Name: "x", Version: "1", ScriptFiles: Scripts{Postin: "missing.sh"}},
+	} {
+		if _, err := m.Build(os.TempDir()); err == nil {
+			t.Errorf("Build with %s scriptlets returned no error", name)
+		}
+	}
+}
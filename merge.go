@@ -0,0 +1,98 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Merge adds the files, scriptlets and relations of other to r.
+// Both packages must have the same name and version. A file path that exists
+// in both packages, or a file of other conflicting with a directory of r, is
+// an error. Scriptlets of other are appended to the ones of r, and relations
+// are added if r does not already have them.
+// Nothing is changed if an error is returned.
+func (r *RPM) Merge(other *RPM) error {
+	if r.Name != other.Name {
+		return errors.Errorf("cannot merge package %q into %q", other.Name, r.Name)
+	}
+	if r.FullVersion() != other.FullVersion() {
+		return errors.Errorf("cannot merge version %q into %q", other.FullVersion(), r.FullVersion())
+	}
+	if r.sourcePackage != other.sourcePackage {
+		return errors.New("cannot merge a source rpm with a binary rpm")
+	}
+	if r.specFile != "" && other.specFile != "" {
+		return errors.Errorf("cannot merge spec file %q into %q", other.specFile, r.specFile)
+	}
+	for fn, f := range other.files {
+		if _, ok := r.files[fn]; ok {
+			return errors.Errorf("file %q exists in both packages", fn)
+		}
+		if err := r.checkPath(f); err != nil {
+			return err
+		}
+	}
+
+	for t, o := range other.scriptlets {
+		if s := r.scriptlets[t]; s.body != "" && o.body != "" && !s.sameInterpreter(o) {
+			return errors.Errorf("cannot merge scriptlets with different interpreters %q and %q", o.interpreter(), s.interpreter())
+		}
+	}
+
+	for _, f := range other.files {
+		r.putFile(f)
+	}
+	for n, t := range other.hardlinks {
+		r.hardlinks[n] = t
+	}
+	for t, o := range other.scriptlets {
+		s := r.scriptlets[t]
+		switch {
+		case s.body == "":
+			s.body = o.body
+		case o.body != "":
+			s.body = s.body + "\n" + o.body
+		}
+		s.flags |= o.flags
+		if len(s.prog) == 0 {
+			s.prog = o.prog
+		}
+		r.scriptlets[t] = s
+	}
+	r.triggers = append(r.triggers, other.triggers...)
+	r.fileTriggers = append(r.fileTriggers, other.fileTriggers...)
+	if r.specFile == "" {
+		r.specFile = other.specFile
+	}
+	r.sources = append(r.sources, other.sources...)
+	r.patches = append(r.patches, other.patches...)
+	for _, rel := range []struct{ dst, src *Relations }{
+		{&r.Provides, &other.Provides},
+		{&r.Obsoletes, &other.Obsoletes},
+		{&r.Suggests, &other.Suggests},
+		{&r.Recommends, &other.Recommends},
+		{&r.Supplements, &other.Supplements},
+		{&r.Enhances, &other.Enhances},
+		{&r.Requires, &other.Requires},
+		{&r.Conflicts, &other.Conflicts},
+		{&r.OrderWithRequires, &other.OrderWithRequires},
+	} {
+		for _, v := range *rel.src {
+			rel.dst.addIfMissing(v)
+		}
+	}
+	return nil
+}
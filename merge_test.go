@@ -0,0 +1,132 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func newMergeRPM(t *testing.T, md RPMMetaData, files ...string) *RPM {
+	t.Helper()
+	r, err := NewRPM(md)
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	for _, f := range files {
+		r.AddFile(RPMFile{Name: f, Body: []byte(f)})
+	}
+	return r
+}
+
+func TestMerge(t *testing.T) {
+	md := RPMMetaData{Name: "base", Version: "1.0", Release: "1", Summary: "summary"}
+	base := newMergeRPM(t, md, "/usr/bin/base")
+	base.AddPostin("echo base")
+	if err := base.Requires.Set("bash"); err != nil {
+		t.Fatalf("Requires.Set returned error %v", err)
+	}
+
+	plugin := newMergeRPM(t, md, "/usr/lib/base/plugin.so")
+	plugin.AddPostin("echo plugin")
+	plugin.AddPreun("echo preun")
+	for _, v := range []string{"bash", "glibc >= 2.17"} {
+		if err := plugin.Requires.Set(v); err != nil {
+			t.Fatalf("Requires.Set(%q) returned error %v", v, err)
+		}
+	}
+
+	if err := base.Merge(plugin); err != nil {
+		t.Fatalf("Merge returned error %v", err)
+	}
+	if _, ok := base.files["/usr/lib/base/plugin.so"]; !ok {
+		t.Errorf("merged file missing")
+	}
+	if got, want := base.scriptlets[PostinScriptlet].body, "echo base\necho plugin"; got != want {
+		t.Errorf("postin = %q, want %q", got, want)
+	}
+	if got, want := base.scriptlets[PreunScriptlet].body, "echo preun"; got != want {
+		t.Errorf("preun = %q, want %q", got, want)
+	}
+	if d := cmp.Diff("bash,glibc>=2.17", base.Requires.String()); d != "" {
+		t.Errorf("requires differ (want->got):\n%s", d)
+	}
+	if d := cmp.Diff("base=1.0-1", base.Provides.String()); d != "" {
+		t.Errorf("provides differ (want->got):\n%s", d)
+	}
+}
+
+func TestMergeConflicts(t *testing.T) {
+	md := RPMMetaData{Name: "base", Version: "1.0", Summary: "summary"}
+	testCases := []struct {
+		name  string
+		other RPMMetaData
+		files []string
+	}{{
+		name:  "different name",
+		other: RPMMetaData{Name: "other", Version: "1.0", Summary: "summary"},
+	}, {
+		name:  "different version",
+		other: RPMMetaData{Name: "base", Version: "2.0", Summary: "summary"},
+	}, {
+		name:  "same file",
+		other: md,
+		files: []string{"/usr/bin/base"},
+	}, {
+		name:  "file under file",
+		other: md,
+		files: []string{"/usr/bin/base/data"},
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			base := newMergeRPM(t, md, "/usr/bin/base")
+			other := newMergeRPM(t, tc.other, tc.files...)
+			other.AddPostin("echo other")
+			if err := base.Merge(other); err == nil {
+				t.Fatalf("Merge should have returned an error")
+			}
+			if got := base.scriptlets[PostinScriptlet].body; got != "" {
+				t.Errorf("failed merge changed postin to %q", got)
+			}
+		})
+	}
+}
+
+func TestMergeInterpreters(t *testing.T) {
+	md := RPMMetaData{Name: "base", Version: "1.0", Summary: "summary"}
+	base := newMergeRPM(t, md)
+	base.AddPostin("print('base')")
+	base.SetScriptletInterpreter(PostinScriptlet, LuaInterpreter)
+	other := newMergeRPM(t, md)
+	other.AddPostin("echo other")
+	if err := base.Merge(other); err == nil {
+		t.Fatalf("Merge should have returned an error")
+	}
+	if got, want := base.scriptlets[PostinScriptlet].body, "print('base')"; got != want {
+		t.Errorf("failed merge changed postin to %q", got)
+	}
+
+	other = newMergeRPM(t, md)
+	other.AddPostin("print('other')")
+	other.SetScriptletInterpreter(PostinScriptlet, LuaInterpreter)
+	if err := base.Merge(other); err != nil {
+		t.Fatalf("Merge returned error %v", err)
+	}
+	if got, want := base.scriptlets[PostinScriptlet].body, "print('base')\nprint('other')"; got != want {
+		t.Errorf("postin = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"fmt"
+)
+
+// MinimalRPM returns the smallest package rpm will install: the required
+// metadata plus a single file, /usr/share/<name>/README.
+// It is meant for test fixtures of tools that consume rpm files, the values it
+// picks are not sensible defaults for real packages.
+// It panics if the package cannot be created.
+func MinimalRPM(name, version string) *RPM {
+	r, err := NewRPM(RPMMetaData{
+		Name:        name,
+		Version:     version,
+		Release:     "1",
+		Summary:     fmt.Sprintf("%s test package", name),
+		Description: fmt.Sprintf("%s is a minimal package for testing.", name),
+		Licence:     "Public Domain",
+		Group:       "Unspecified",
+	})
+	if err != nil {
+		panic(err)
+	}
+	if err := r.AddFile(RPMFile{
+		Name:  fmt.Sprintf("/usr/share/%s/README", name),
+		Body:  []byte(fmt.Sprintf("%s %s\n", name, version)),
+		Mode:  0100644,
+		Owner: "root",
+		Group: "root",
+	}); err != nil {
+		panic(err)
+	}
+	return r
+}
@@ -0,0 +1,54 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMinimalRPM(t *testing.T) {
+	r := MinimalRPM("fixture", "1.0")
+	got, err := ReadRPMInfo(bytes.NewReader(buildRPM(t, r)))
+	if err != nil {
+		t.Fatalf("ReadRPMInfo returned error %v", err)
+	}
+	want := &RPMInfo{
+		Name:              "fixture",
+		Version:           "1.0",
+		Release:           "1",
+		Arch:              "noarch",
+		PayloadCompressor: "gzip",
+		PayloadFlags:      "9",
+		Files: []FileInfo{{
+			RPMFile: RPMFile{
+				Name:  "/usr/share/fixture/README",
+				Mode:  0100644,
+				Owner: "root",
+				Group: "root",
+			},
+			Size:   12,
+			Digest: "a754fb82e30233262523740367315df93d8c1851110dded78ea822e20937380d",
+		}},
+	}
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("MinimalRPM unexpected value (want->got):\n%s", d)
+	}
+	if d := cmp.Diff([]string{"README"}, r.basenames); d != "" {
+		t.Errorf("MinimalRPM basenames differ (want->got):\n%s", d)
+	}
+}
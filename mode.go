@@ -0,0 +1,79 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ModePolicy returns the mode a file should be packaged with.
+type ModePolicy func(f RPMFile) uint
+
+// SetModePolicy registers a policy that Write applies to every file.
+// In strict mode Write fails, listing every file whose mode the policy would
+// change. Otherwise the files are packaged with the mode the policy returns.
+func (r *RPM) SetModePolicy(p ModePolicy, strict bool) {
+	r.modePolicy = p
+	r.modePolicyStrict = strict
+}
+
+// WorldReadable is a ModePolicy which makes files and directories readable by
+// everyone, and removes the write permission of others. Directories are made
+// searchable as well. Symlinks and the files listed as sensitive keep their mode.
+func WorldReadable(sensitive ...string) ModePolicy {
+	skip := map[string]bool{}
+	for _, s := range sensitive {
+		skip[s] = true
+	}
+	return func(f RPMFile) uint {
+		switch {
+		case skip[f.Name], f.Mode&0170000 == 0120000:
+			return f.Mode
+		case f.Mode&0170000 == 040000:
+			return (f.Mode | 0555) &^ 0002
+		default:
+			return (f.Mode | 0444) &^ 0002
+		}
+	}
+}
+
+// applyModePolicy runs the mode policy over all of the files.
+func (r *RPM) applyModePolicy() error {
+	if r.modePolicy == nil {
+		return nil
+	}
+	var violations []string
+	for fn, f := range r.files {
+		mode := r.modePolicy(f)
+		if mode == f.Mode {
+			continue
+		}
+		if r.modePolicyStrict {
+			violations = append(violations, fmt.Sprintf("%s has mode %#o, want %#o", fn, f.Mode, mode))
+			continue
+		}
+		f.Mode = mode
+		r.files[fn] = f
+	}
+	if len(violations) > 0 {
+		sort.Strings(violations)
+		return errors.Errorf("file mode policy violations: %s", strings.Join(violations, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWorldReadable(t *testing.T) {
+	p := WorldReadable("/etc/secret")
+	testCases := []struct {
+		name string
+		file RPMFile
+		want uint
+	}{
+		{"private file", RPMFile{Name: "/etc/a", Mode: 0100600}, 0100644},
+		{"implicit regular file", RPMFile{Name: "/etc/a", Mode: 0600}, 0644},
+		{"world writable file", RPMFile{Name: "/etc/a", Mode: 0100777}, 0100775},
+		{"private dir", RPMFile{Name: "/etc/d", Mode: 040700}, 040755},
+		{"symlink", RPMFile{Name: "/etc/l", Mode: 0120777}, 0120777},
+		{"sensitive file", RPMFile{Name: "/etc/secret", Mode: 0100600}, 0100600},
+		{"compliant file", RPMFile{Name: "/etc/a", Mode: 0100755}, 0100755},
+	}
+	for _, tc := range testCases {
+		if got := p(tc.file); got != tc.want {
+			t.Errorf("%s: WorldReadable(%#o) = %#o, want %#o", tc.name, tc.file.Mode, got, tc.want)
+		}
+	}
+}
+
+func TestModePolicy(t *testing.T) {
+	testCases := []struct {
+		name          string
+		strict        bool
+		errExpected   bool
+		wantFileModes []uint16
+	}{{
+		name:          "lenient",
+		wantFileModes: []uint16{0100644, 0100775, 0100600},
+	}, {
+		name:        "strict",
+		strict:      true,
+		errExpected: true,
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewRPM(RPMMetaData{Name: "policy", Summary: "summary"})
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			r.AddFile(RPMFile{Name: "/etc/a", Mode: 0600})
+			r.AddFile(RPMFile{Name: "/etc/b", Mode: 0777})
+			r.AddFile(RPMFile{Name: "/etc/secret", Mode: 0600})
+			r.SetModePolicy(WorldReadable("/etc/secret"), tc.strict)
+			err = r.Write(ioutil.Discard)
+			if tc.errExpected {
+				if err == nil {
+					t.Fatalf("Write should have returned an error")
+				}
+				want := "file mode policy violations: /etc/a has mode 0600, want 0644; /etc/b has mode 0777, want 0775"
+				if err.Error() != want {
+					t.Errorf("Write returned error %q, want %q", err, want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Write returned error %v", err)
+			}
+			if d := cmp.Diff(tc.wantFileModes, r.filemodes); d != "" {
+				t.Errorf("filemodes differ (want->got):\n%s", d)
+			}
+		})
+	}
+}
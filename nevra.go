@@ -0,0 +1,114 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// NEVRA is the name, epoch, version, release and architecture of a package,
+// which identify it in a repository, like "bash-5.2.15-3.fc38.x86_64".
+type NEVRA struct {
+	Name    string
+	Epoch   uint32
+	Version string
+	Release string
+	Arch    string
+}
+
+// ParseNEVRA parses a name-[epoch:]version-release.arch string, like
+// "bash-1:5.2.15-3.fc38.x86_64", or the file name of an rpm, ending in .rpm.
+// The name can have dashes, the version and release cannot, and the
+// architecture is after the last dot.
+func ParseNEVRA(s string) (NEVRA, error) {
+	var n NEVRA
+	rest := strings.TrimSuffix(s, ".rpm")
+	i := strings.LastIndexByte(rest, '.')
+	if i < 0 {
+		return n, errors.Errorf("invalid NEVRA %q: no architecture", s)
+	}
+	rest, n.Arch = rest[:i], rest[i+1:]
+	i = strings.LastIndexByte(rest, '-')
+	if i < 0 {
+		return n, errors.Errorf("invalid NEVRA %q: no release", s)
+	}
+	rest, n.Release = rest[:i], rest[i+1:]
+	i = strings.LastIndexByte(rest, '-')
+	if i < 0 {
+		return n, errors.Errorf("invalid NEVRA %q: no version", s)
+	}
+	n.Name, n.Version = rest[:i], rest[i+1:]
+	if i := strings.IndexByte(n.Version, ':'); i >= 0 {
+		e, err := strconv.ParseUint(n.Version[:i], 10, 32)
+		if err != nil {
+			return n, errors.Errorf("invalid NEVRA %q: invalid epoch %q", s, n.Version[:i])
+		}
+		n.Epoch, n.Version = uint32(e), n.Version[i+1:]
+	}
+	for _, f := range []struct{ field, v string }{
+		{"name", n.Name}, {"version", n.Version}, {"release", n.Release}, {"arch", n.Arch},
+	} {
+		if f.v == "" {
+			return n, errors.Errorf("invalid NEVRA %q: empty %s", s, f.field)
+		}
+	}
+	if err := validateName(n.Name); err != nil {
+		return n, errors.Wrapf(err, "invalid NEVRA %q", s)
+	}
+	if err := validateVersion("version", n.Version); err != nil {
+		return n, errors.Wrapf(err, "invalid NEVRA %q", s)
+	}
+	if err := validateVersion("release", n.Release); err != nil {
+		return n, errors.Wrapf(err, "invalid NEVRA %q", s)
+	}
+	return n, nil
+}
+
+// fullVersion returns version-release, or the version without a release.
+func (n NEVRA) fullVersion() string {
+	if n.Release != "" {
+		return n.Version + "-" + n.Release
+	}
+	return n.Version
+}
+
+// String returns the name-[epoch:]version-release.arch string of n. The epoch
+// is left out when it is 0.
+func (n NEVRA) String() string {
+	if n.Epoch != 0 {
+		return fmt.Sprintf("%s-%d:%s.%s", n.Name, n.Epoch, n.fullVersion(), n.Arch)
+	}
+	return fmt.Sprintf("%s-%s.%s", n.Name, n.fullVersion(), n.Arch)
+}
+
+// FileName returns the conventional file name of the package,
+// name-version-release.arch.rpm. Following rpm, the epoch is not part of it.
+func (n NEVRA) FileName() string {
+	return fmt.Sprintf("%s-%s.%s.rpm", n.Name, n.fullVersion(), n.Arch)
+}
+
+// NEVRA returns the NEVRA of the package. The architecture of a source rpm
+// is "src".
+func (r *RPM) NEVRA() NEVRA {
+	arch := r.Arch
+	if r.sourcePackage {
+		arch = "src"
+	}
+	return NEVRA{Name: r.Name, Epoch: r.Epoch, Version: r.Version, Release: r.Release, Arch: arch}
+}
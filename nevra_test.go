@@ -0,0 +1,95 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseNEVRA(t *testing.T) {
+	for _, tc := range []struct {
+		s       string
+		want    NEVRA
+		wantErr bool
+	}{
+		{s: "bash-5.2.15-3.fc38.x86_64", want: NEVRA{Name: "bash", Version: "5.2.15", Release: "3.fc38", Arch: "x86_64"}},
+		{s: "perl-Time-HiRes-4:1.9764-1.el9.aarch64", want: NEVRA{Name: "perl-Time-HiRes", Epoch: 4, Version: "1.9764", Release: "1.el9", Arch: "aarch64"}},
+		{s: "tzdata-2024a-1.fc40.noarch.rpm", want: NEVRA{Name: "tzdata", Version: "2024a", Release: "1.fc40", Arch: "noarch"}},
+		{s: "rpmpack-0:1.0~rc1-1.src", want: NEVRA{Name: "rpmpack", Version: "1.0~rc1", Release: "1", Arch: "src"}},
+		{s: "bash-5.2.15-3", wantErr: true},
+		{s: "bash-5.2.15.x86_64", wantErr: true},
+		{s: "bash.x86_64", wantErr: true},
+		{s: "-5.2.15-3.x86_64", wantErr: true},
+		{s: "bash-x:5.2.15-3.x86_64", wantErr: true},
+		{s: "bash-5.2.15-3.", wantErr: true},
+		{s: "bash 5-5.2.15-3.x86_64", wantErr: true},
+	} {
+		got, err := ParseNEVRA(tc.s)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("ParseNEVRA(%q) returned error %v, want error: %v", tc.s, err, tc.wantErr)
+			continue
+		}
+		if err == nil && got != tc.want {
+			t.Errorf("ParseNEVRA(%q) = %+v, want %+v", tc.s, got, tc.want)
+		}
+	}
+}
+
+func TestNEVRAString(t *testing.T) {
+	for _, tc := range []struct {
+		n                  NEVRA
+		want, wantFileName string
+	}{
+		{
+			n:            NEVRA{Name: "bash", Version: "5.2.15", Release: "3.fc38", Arch: "x86_64"},
+			want:         "bash-5.2.15-3.fc38.x86_64",
+			wantFileName: "bash-5.2.15-3.fc38.x86_64.rpm",
+		},
+		{
+			n:            NEVRA{Name: "perl-Time-HiRes", Epoch: 4, Version: "1.9764", Release: "1.el9", Arch: "aarch64"},
+			want:         "perl-Time-HiRes-4:1.9764-1.el9.aarch64",
+			wantFileName: "perl-Time-HiRes-1.9764-1.el9.aarch64.rpm",
+		},
+	} {
+		if got := tc.n.String(); got != tc.want {
+			t.Errorf("%+v.String() = %q, want %q", tc.n, got, tc.want)
+		}
+		if got := tc.n.FileName(); got != tc.wantFileName {
+			t.Errorf("%+v.FileName() = %q, want %q", tc.n, got, tc.wantFileName)
+		}
+		if got, err := ParseNEVRA(tc.n.String()); err != nil || !cmp.Equal(got, tc.n) {
+			t.Errorf("ParseNEVRA(%q) = %+v, %v, want %+v", tc.n.String(), got, err, tc.n)
+		}
+	}
+}
+
+func TestRPMNEVRA(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "nevra", Epoch: 2, Version: "1.0", Release: "1", Arch: "x86_64", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	if got, want := r.NEVRA().String(), "nevra-2:1.0-1.x86_64"; got != want {
+		t.Errorf("NEVRA() = %q, want %q", got, want)
+	}
+	s, err := NewSourceRPM(RPMMetaData{Name: "nevra", Version: "1.0", Release: "1", Arch: "x86_64", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewSourceRPM returned error %v", err)
+	}
+	if got, want := s.NEVRA().String(), "nevra-1.0-1.src"; got != want {
+		t.Errorf("source NEVRA() = %q, want %q", got, want)
+	}
+}
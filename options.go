@@ -0,0 +1,80 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"golang.org/x/crypto/openpgp"
+)
+
+// Option is an optional setting of NewRPM. Options setting a field of
+// RPMMetaData replace its value, the others configure the rpm like the
+// matching Set method once it is created.
+type Option func(*options)
+
+type options struct {
+	meta      RPMMetaData
+	configure []func(*RPM) error
+}
+
+// WithCompressor sets RPMMetaData.Compressor, like "zstd:19".
+func WithCompressor(c string) Option {
+	return func(o *options) {
+		o.meta.Compressor = c
+	}
+}
+
+// WithCompressorThreads sets RPMMetaData.CompressorThreads.
+func WithCompressorThreads(n int) Option {
+	return func(o *options) {
+		o.meta.CompressorThreads = n
+	}
+}
+
+// WithDigest sets RPMMetaData.FileDigest, the digest algorithm of the files.
+func WithDigest(d string) Option {
+	return func(o *options) {
+		o.meta.FileDigest = d
+	}
+}
+
+// WithSigner signs the rpm with s, see SetSigner.
+func WithSigner(s Signer) Option {
+	return func(o *options) {
+		o.configure = append(o.configure, func(r *RPM) error {
+			r.SetSigner(s)
+			return nil
+		})
+	}
+}
+
+// WithPGPKey signs the rpm with the private key of e, see SetPGPKey.
+func WithPGPKey(e *openpgp.Entity) Option {
+	return func(o *options) {
+		o.configure = append(o.configure, func(r *RPM) error {
+			return r.SetPGPKey(e)
+		})
+	}
+}
+
+// WithProgressHandler reports the progress of Write to f, see
+// SetProgressHandler.
+func WithProgressHandler(f func(Progress) error) Option {
+	return func(o *options) {
+		o.configure = append(o.configure, func(r *RPM) error {
+			r.SetProgressHandler(f)
+			return nil
+		})
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func TestOptions(t *testing.T) {
+	e := newTestEntity(t, "options")
+	var reports int
+	r, err := NewRPM(RPMMetaData{Name: "options", Version: "1.0", Summary: "summary", Compressor: "gzip"},
+		WithCompressor("zstd"),
+		WithDigest("sha512"),
+		WithPGPKey(e),
+		WithProgressHandler(func(Progress) error {
+			reports++
+			return nil
+		}))
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	if r.Compressor != "zstd" || r.FileDigest != "sha512" {
+		t.Errorf("NewRPM() has compressor %q and file digest %q, want zstd and sha512", r.Compressor, r.FileDigest)
+	}
+	r.AddFile(RPMFile{Name: "/usr/share/options/file", Body: []byte("content")})
+	b := buildRPM(t, r)
+	if _, err := VerifySignature(bytes.NewReader(b), openpgp.EntityList{e}); err != nil {
+		t.Errorf("VerifySignature returned error %v", err)
+	}
+	if reports == 0 {
+		t.Error("the progress handler was not called")
+	}
+	info, err := ReadRPMInfo(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("ReadRPMInfo returned error %v", err)
+	}
+	if info.PayloadCompressor != "zstd" {
+		t.Errorf("PAYLOADCOMPRESSOR is %q, want zstd", info.PayloadCompressor)
+	}
+}
+
+func TestOptionsErrors(t *testing.T) {
+	e := newTestEntity(t, "encrypted")
+	e.PrivateKey = &packet.PrivateKey{Encrypted: true}
+	for name, opt := range map[string]Option{
+		"compressor": WithCompressor("bzip2"),
+		"digest":     WithDigest("crc32"),
+		"pgp key":    WithPGPKey(e),
+	} {
+		if _, err := NewRPM(RPMMetaData{Name: "options", Version: "1.0"}, opt); err == nil {
+			t.Errorf("NewRPM with an invalid %s returned no error", name)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SetOwnerIDs names the numeric user and group ids used as the Owner and
+// Group of files, like "1000". rpm only records owners by name, and installs
+// files with an owner it does not know, like a number, as root. Write fails
+// for numeric owners other than 0, which is root, that have no name here.
+func (r *RPM) SetOwnerIDs(users, groups map[uint32]string) {
+	r.userNames = users
+	r.groupNames = groups
+}
+
+// SetWarningHandler sets a function that Write calls with the problems of the
+// package that do not prevent writing it, like files owned by users that
+// might not exist when the package is installed.
+func (r *RPM) SetWarningHandler(f func(string)) {
+	r.warn = f
+}
+
+// resolveOwners replaces numeric owners and groups of the files by their
+// names, and checks the names. Without RequireFileOwners, it warns about
+// the users and groups other than root that the package does not provide,
+// rpm installs the files as root if they do not exist.
+func (r *RPM) resolveOwners() error {
+	fnames := []string{}
+	for fn := range r.files {
+		fnames = append(fnames, fn)
+	}
+	sort.Strings(fnames)
+	warned := map[string]bool{}
+	for _, fn := range fnames {
+		f := r.files[fn]
+		var err error
+		if f.Owner, err = resolveOwner("user", f.Owner, r.userNames); err != nil {
+			return errors.Wrapf(err, "invalid owner of %s", fn)
+		}
+		if f.Group, err = resolveOwner("group", f.Group, r.groupNames); err != nil {
+			return errors.Wrapf(err, "invalid group of %s", fn)
+		}
+		r.files[fn] = f
+		if r.warn == nil || r.RequireFileOwners {
+			continue
+		}
+		for _, o := range []string{"user(" + f.Owner + ")", "group(" + f.Group + ")"} {
+			if o == "user(root)" || o == "group(root)" || warned[o] || r.provides(o) {
+				continue
+			}
+			warned[o] = true
+			r.warn(fmt.Sprintf("files like %s are owned by %s, rpm installs them as root if it does not exist", fn, o))
+		}
+	}
+	return nil
+}
+
+// resolveOwner returns the name of the user or group owner, root if it is
+// empty or 0.
+func resolveOwner(kind, owner string, names map[uint32]string) (string, error) {
+	if owner == "" {
+		return "root", nil
+	}
+	if id, err := strconv.ParseUint(owner, 10, 32); err == nil {
+		if id == 0 {
+			return "root", nil
+		}
+		n, ok := names[uint32(id)]
+		if !ok {
+			return "", errors.Errorf("numeric %s id %d has no name, rpm ignores numeric ids", kind, id)
+		}
+		owner = n
+	}
+	if len(owner) > 32 || strings.HasPrefix(owner, "-") || strings.ContainsAny(owner, " \t\n:,/") {
+		return "", errors.Errorf("invalid %s name %q", kind, owner)
+	}
+	return owner, nil
+}
+
+// provides reports whether the package provides name, with any version.
+func (r *RPM) provides(name string) bool {
+	for _, p := range r.Provides {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestResolveOwner(t *testing.T) {
+	names := map[uint32]string{1000: "alice"}
+	for _, tc := range []struct {
+		owner   string
+		want    string
+		wantErr bool
+	}{
+		{owner: "", want: "root"},
+		{owner: "0", want: "root"},
+		{owner: "1000", want: "alice"},
+		{owner: "daemon", want: "daemon"},
+		{owner: "1001", wantErr: true},
+		{owner: "a:b", wantErr: true},
+		{owner: "-x", wantErr: true},
+		{owner: "with space", wantErr: true},
+	} {
+		got, err := resolveOwner("user", tc.owner, names)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("resolveOwner(%q) returned error %v, want error: %v", tc.owner, err, tc.wantErr)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("resolveOwner(%q) = %q, want %q", tc.owner, got, tc.want)
+		}
+	}
+}
+
+func TestOwnerIDs(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "owners", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.SetOwnerIDs(map[uint32]string{1000: "alice"}, map[uint32]string{100: "users"})
+	r.AddFile(RPMFile{Name: "/home/alice", Mode: 040700, Owner: "1000", Group: "100"})
+	r.AddFile(RPMFile{Name: "/home/root", Mode: 040700, Owner: "0", Group: "0"})
+	h := readHeader(t, buildRPM(t, r))
+	if got, want := h.getStrings(tagFileUserName), []string{"alice", "root"}; !cmp.Equal(got, want) {
+		t.Errorf("FILEUSERNAME = %q, want %q", got, want)
+	}
+	if got, want := h.getStrings(tagFileGroupName), []string{"users", "root"}; !cmp.Equal(got, want) {
+		t.Errorf("FILEGROUPNAME = %q, want %q", got, want)
+	}
+
+	r, err = NewRPM(RPMMetaData{Name: "owners", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/home/bob", Mode: 040700, Owner: "1001"})
+	if err := r.Write(ioutil.Discard); err == nil {
+		t.Error("Write with an unnamed numeric owner returned nil error")
+	}
+}
+
+func TestOwnerWarnings(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "owners", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	if err := r.AddSysusers("owners", []byte("u owners - -\n")); err != nil {
+		t.Fatalf("AddSysusers returned error %v", err)
+	}
+	var got []string
+	r.SetWarningHandler(func(m string) { got = append(got, m) })
+	r.AddFile(RPMFile{Name: "/var/lib/owners", Mode: 040700, Owner: "owners", Group: "owners"})
+	r.AddFile(RPMFile{Name: "/var/lib/other/a", Body: []byte("a"), Owner: "other"})
+	r.AddFile(RPMFile{Name: "/var/lib/other/b", Body: []byte("b"), Owner: "other"})
+	buildRPM(t, r)
+	want := []string{"files like /var/lib/other/a are owned by user(other), rpm installs them as root if it does not exist"}
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("warnings differ (-want +got):\n%s", d)
+	}
+}
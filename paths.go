@@ -0,0 +1,93 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// cleanPath returns the payload path name with Windows separators converted
+// to slashes, and without a trailing slash. It returns an error if name is
+// not absolute, or has empty, "." or ".." components, which would give broken
+// file names in the header.
+func cleanPath(name string) (string, error) {
+	p := strings.Replace(name, "\\", "/", -1)
+	if len(p) > 1 {
+		p = strings.TrimSuffix(p, "/")
+	}
+	if !strings.HasPrefix(p, "/") {
+		return "", errors.Errorf("invalid path %q: it must be absolute", name)
+	}
+	if strings.IndexByte(p, 0) >= 0 {
+		return "", errors.Errorf("invalid path %q: it has a NUL byte", name)
+	}
+	if p == "/" {
+		return p, nil
+	}
+	for _, c := range strings.Split(p[1:], "/") {
+		switch c {
+		case "":
+			return "", errors.Errorf("invalid path %q: it has duplicate slashes", name)
+		case ".", "..":
+			return "", errors.Errorf("invalid path %q: it has a %q component", name, c)
+		}
+	}
+	return p, nil
+}
+
+func isDir(f RPMFile) bool {
+	return f.Mode&0170000 == 040000
+}
+
+// checkPath checks that f can be added to the package: its path is not in
+// the package yet, its parents are not files, and if it is not a directory,
+// no file is under it. rpm refuses to install a package where they are.
+// Adding a directory again with the same attributes is not a conflict.
+func (r *RPM) checkPath(f RPMFile) error {
+	if old, ok := r.files[f.Name]; ok {
+		if isDir(f) && isDir(old) && f.Mode == old.Mode && f.Owner == old.Owner && f.Group == old.Group && f.Type == old.Type {
+			return nil
+		}
+		return errors.Errorf("cannot add %s: it is already in the package", f.Name)
+	}
+	for d := path.Dir(f.Name); d != "/" && d != "."; d = path.Dir(d) {
+		if p, ok := r.files[d]; ok && !isDir(p) {
+			return errors.Errorf("cannot add %s: its parent %s is not a directory", f.Name, d)
+		}
+	}
+	if child, ok := r.parentDirs[f.Name]; ok && !isDir(f) {
+		return errors.Errorf("cannot add %s: it is not a directory, but the package has %s under it", f.Name, child)
+	}
+	return nil
+}
+
+// putFile adds f, which checkPath accepted, to the files of the package.
+func (r *RPM) putFile(f RPMFile) {
+	if _, ok := r.files[f.Name]; ok {
+		// The same directory again.
+		return
+	}
+	r.files[f.Name] = f
+	for d := path.Dir(f.Name); d != "/" && d != "."; d = path.Dir(d) {
+		if _, ok := r.parentDirs[d]; ok {
+			// And its parents too.
+			break
+		}
+		r.parentDirs[d] = f.Name
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"testing"
+)
+
+func TestCleanPath(t *testing.T) {
+	for _, tc := range []struct {
+		name, want string
+		wantErr    bool
+	}{
+		{name: "/usr/bin/app", want: "/usr/bin/app"},
+		{name: "/usr/lib/app/", want: "/usr/lib/app"},
+		{name: "\\Program Files\\app", want: "/Program Files/app"},
+		{name: "/", want: "/"},
+		{name: "usr/bin/app", wantErr: true},
+		{name: "", wantErr: true},
+		{name: "/usr//bin/app", wantErr: true},
+		{name: "/usr/bin/../lib/app", wantErr: true},
+		{name: "/usr/./bin/app", wantErr: true},
+		{name: "/usr/bin/..", wantErr: true},
+		{name: "/usr/bin/app\x00", wantErr: true},
+	} {
+		got, err := cleanPath(tc.name)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("cleanPath(%q) returned error %v, want error: %v", tc.name, err, tc.wantErr)
+		}
+		if got != tc.want {
+			t.Errorf("cleanPath(%q) = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestAddFileCleansPath(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "paths", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	if err := r.AddFile(RPMFile{Name: "\\opt\\app\\", Mode: 040755}); err != nil {
+		t.Fatalf("AddFile returned error %v", err)
+	}
+	if _, ok := r.files["/opt/app"]; !ok {
+		t.Errorf("AddFile added %v, want /opt/app", r.files)
+	}
+	if err := r.AddFile(RPMFile{Name: "opt/app/data"}); err == nil {
+		t.Error("AddFile with a relative path returned no error")
+	}
+	if err := r.AddHardlink("/opt/../link", "/opt/app"); err == nil {
+		t.Error("AddHardlink with a .. component returned no error")
+	}
+}
+
+func TestAddFileConflicts(t *testing.T) {
+	dir := RPMFile{Name: "/etc/app", Mode: 040755}
+	file := RPMFile{Name: "/etc/app/app.conf", Body: []byte("conf")}
+	for _, tc := range []struct {
+		name    string
+		files   []RPMFile
+		wantErr bool
+	}{
+		{name: "dir and file", files: []RPMFile{dir, file}},
+		{name: "same dir twice", files: []RPMFile{dir, file, dir}},
+		{name: "same file twice", files: []RPMFile{file, file}, wantErr: true},
+		{name: "dir with other mode", files: []RPMFile{dir, {Name: "/etc/app", Mode: 040700}}, wantErr: true},
+		{name: "file under file", files: []RPMFile{{Name: "/etc/app", Body: []byte("app")}, file}, wantErr: true},
+		{name: "file under symlink", files: []RPMFile{NewSymlink("/etc/app", "/opt/app"), file}, wantErr: true},
+		{name: "file over dir", files: []RPMFile{file, {Name: "/etc/app", Body: []byte("app")}}, wantErr: true},
+		{name: "file over parent dir", files: []RPMFile{file, {Name: "/etc", Body: []byte("etc")}}, wantErr: true},
+		{name: "dir over parent dir", files: []RPMFile{file, {Name: "/etc", Mode: 040755}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewRPM(RPMMetaData{Name: "conflicts", Summary: "summary"})
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			var addErr error
+			for _, f := range tc.files {
+				if err := r.AddFile(f); err != nil {
+					addErr = err
+				}
+			}
+			if (addErr != nil) != tc.wantErr {
+				t.Errorf("AddFile returned error %v, want error: %v", addErr, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestAddHardlinkConflicts(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "conflicts", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/bin/app", Body: []byte("app")})
+	r.AddFile(RPMFile{Name: "/usr/lib/app/data", Body: []byte("data")})
+	if err := r.AddHardlink("/usr/lib/app", "/usr/bin/app"); err == nil {
+		t.Error("AddHardlink over a directory returned no error")
+	}
+	if err := r.AddHardlink("/usr/bin/app/link", "/usr/bin/app"); err == nil {
+		t.Error("AddHardlink under a file returned no error")
+	}
+}
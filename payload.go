@@ -0,0 +1,260 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+
+	cpio "github.com/cavaliercoder/go-cpio"
+	"github.com/pkg/errors"
+)
+
+// archiveEntry is a file of the cpio payload, as written by the first pass.
+type archiveEntry struct {
+	file  RPMFile
+	links int
+	inode int64
+	// index is the index of the file in the header.
+	index int
+	// offset is where the content of a seekable Reader starts.
+	offset int64
+}
+
+func (e archiveEntry) size() int64 {
+	if e.file.Reader != nil {
+		return e.file.Size
+	}
+	return int64(len(e.file.Body))
+}
+
+// content returns the content of the file, from its start.
+func (e archiveEntry) content() (io.Reader, error) {
+	if e.file.Reader == nil {
+		return bytes.NewReader(e.file.Body), nil
+	}
+	if s, ok := e.file.Reader.(io.Seeker); ok {
+		if _, err := s.Seek(e.offset, io.SeekStart); err != nil {
+			return nil, errors.Wrap(err, "failed to seek to the start of the file content")
+		}
+	}
+	return e.file.Reader, nil
+}
+
+// cpioWriter is a cpio archive, together with the writer under it for the
+// entries that cpio.Writer cannot write.
+type cpioWriter struct {
+	*cpio.Writer
+	w io.Writer
+}
+
+func newCPIOWriter(w io.Writer) *cpioWriter {
+	return &cpioWriter{Writer: cpio.NewWriter(w), w: w}
+}
+
+// writeTo writes the entry to the cpio archive, and its content to digests.
+func (e archiveEntry) writeTo(w *cpioWriter, digests ...io.Writer) error {
+	f := e.file
+	size := e.size()
+	if size > longSizeLimit {
+		return e.writeStripped(w, digests...)
+	}
+	hdr := &cpio.Header{
+		Name:    f.Name,
+		Inode:   e.inode,
+		Mode:    cpio.FileMode(f.Mode),
+		ModTime: time.Unix(int64(f.MTime), 0),
+		Size:    size,
+		Links:   e.links,
+	}
+	if err := w.WriteHeader(hdr); err != nil {
+		return errors.Wrap(err, "failed to write payload file header")
+	}
+	return e.copyContent(w, digests...)
+}
+
+// writeStripped writes the entry as an rpm "stripped" cpio entry, for files
+// too large for the 32-bit size of the newc header. The entry only has the
+// index of the file in the header, which holds everything else, and rpm
+// reads it since 4.12.
+func (e archiveEntry) writeStripped(w *cpioWriter, digests ...io.Writer) error {
+	// Flush pads the previous entry, the stripped entry bypasses w.
+	if err := w.Flush(); err != nil {
+		return errors.Wrap(err, "failed to write payload file header")
+	}
+	// 6 magic, 8 hex index and 2 padding to a 4-byte boundary.
+	if _, err := fmt.Fprintf(w.w, "07070X%08x\x00\x00", e.index); err != nil {
+		return errors.Wrap(err, "failed to write payload file header")
+	}
+	if err := e.copyContent(w.w, digests...); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(make([]byte, (4-e.size()%4)%4)); err != nil {
+		return errors.Wrap(err, "failed to write payload file content")
+	}
+	return nil
+}
+
+// copyContent copies exactly the content of the entry to w and digests.
+func (e archiveEntry) copyContent(w io.Writer, digests ...io.Writer) error {
+	f := e.file
+	size := e.size()
+	content, err := e.content()
+	if err != nil {
+		return err
+	}
+	n, err := io.CopyN(io.MultiWriter(append([]io.Writer{w}, digests...)...), content, size)
+	if err == io.EOF {
+		return errors.Errorf("file %s has %d bytes, want %d", f.Name, n, size)
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to write payload file content")
+	}
+	if m, _ := content.Read(make([]byte, 1)); m > 0 {
+		return errors.Errorf("file %s has more than %d bytes", f.Name, size)
+	}
+	return nil
+}
+
+// payloadWriter returns a writer compressing the payload to w as set in m,
+// together with the PAYLOADCOMPRESSOR and PAYLOADFLAGS values.
+func payloadWriter(m RPMMetaData, w io.Writer) (io.WriteCloser, string, string, error) {
+	if m.CustomCompressor == nil && m.CompressorThreads > 1 {
+		return newParallelCompressor(m.Compressor, m.CompressorThreads, w)
+	}
+	if m.CustomCompressor == nil {
+		return newCompressor(m.Compressor, w)
+	}
+	// The level of a custom compressor is unknown, so PAYLOADFLAGS is omitted.
+	z, err := m.CustomCompressor.NewWriter(w)
+	if err != nil {
+		return nil, "", "", errors.Wrap(err, "failed to create compression writer")
+	}
+	return z, m.CustomCompressor.Name(), "", nil
+}
+
+// WriteCPIO closes the rpm and writes only its payload to w, without the
+// lead and the headers: the cpio archive of the files as Write would write
+// it, compressed with the compressor of r if compressed is true. It can be
+// diffed against the payload of other packages, or unpacked by tools which
+// do not read rpm files. The content of the files is read, and the payload
+// compressed, once.
+func (r *RPM) WriteCPIO(w io.Writer, compressed bool) error {
+	if r.closed {
+		return ErrWriteAfterClose
+	}
+	if compressed {
+		if _, err := w.Write(r.payloadHead); err != nil {
+			return errors.Wrap(err, "failed to write payload")
+		}
+		r.payload.w = teeHash{r.payload.w.(hash.Hash), w}
+	} else {
+		r.progress.w = io.MultiWriter(r.progress.w, w)
+	}
+	if err := r.writeFirstPass(); err != nil {
+		return errors.Wrap(err, "failed to write payload")
+	}
+	r.closed = true
+	return nil
+}
+
+// copyPayload writes the compressed payload to w, from the payload buffer of
+// WriteBuffered if there is one.
+func (r *RPM) copyPayload(w io.Writer) error {
+	if r.payloadBuffer == nil {
+		return r.writeArchive(w)
+	}
+	if err := r.progress.canceled(); err != nil {
+		return err
+	}
+	if _, err := r.payloadBuffer.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, "failed to seek to the start of the payload buffer")
+	}
+	digest := sha256.New()
+	if _, err := io.CopyN(io.MultiWriter(w, digest), r.payloadBuffer, r.payload.n); err != nil {
+		return errors.Wrap(err, "failed to copy the payload buffer")
+	}
+	if !bytes.Equal(digest.Sum(nil), r.payloadDigest) {
+		return errors.New("the payload buffer differs from the payload in the header")
+	}
+	if r.progress.f != nil {
+		return r.progress.f(Progress{Phase: PhasePayload, Bytes: r.progress.p.Bytes, Total: r.progress.p.Bytes})
+	}
+	return nil
+}
+
+// teeHash is a hash also writing the hashed data to w.
+type teeHash struct {
+	hash.Hash
+	w io.Writer
+}
+
+func (t teeHash) Write(b []byte) (int, error) {
+	if _, err := t.w.Write(b); err != nil {
+		return 0, err
+	}
+	return t.Hash.Write(b)
+}
+
+// writeArchive compresses the payload again from the entries of the first
+// pass, and writes it to w. The header already holds the size and digest of
+// the first pass, so writeArchive fails if the payload is not the same, for
+// example if a custom compressor is not deterministic.
+func (r *RPM) writeArchive(w io.Writer) error {
+	digest := sha256.New()
+	cw := &countingWriter{w: io.MultiWriter(w, digest)}
+	z, _, _, err := payloadWriter(r.RPMMetaData, cw)
+	if err != nil {
+		return err
+	}
+	// The first pass wrote the same uncompressed payload.
+	progress := &progressWriter{w: z, f: r.progress.f, ctx: r.progress.ctx, p: Progress{Phase: PhasePayload, Total: r.progress.p.Bytes}}
+	c := newCPIOWriter(progress)
+	for _, e := range r.archive {
+		if err := progress.startFile(e.file.Name); err != nil {
+			abortCompressor(z)
+			return err
+		}
+		if err := e.writeTo(c); err != nil {
+			abortCompressor(z)
+			return errors.Wrapf(err, "failed to write file %q", e.file.Name)
+		}
+	}
+	if err := c.Close(); err != nil {
+		abortCompressor(z)
+		return errors.Wrap(err, "failed to close cpio payload")
+	}
+	if err := progress.done(); err != nil {
+		abortCompressor(z)
+		return err
+	}
+	if err := z.Close(); err != nil {
+		return errors.Wrap(err, "failed to close compressed payload")
+	}
+	if cw.err != nil {
+		return cw.err
+	}
+	if cw.n != r.payload.n || !bytes.Equal(digest.Sum(nil), r.payloadDigest) {
+		return errors.New("the payload differs from the one in the header, the compressor is not deterministic")
+	}
+	if progress.p.Bytes != r.archiveSize {
+		return errors.Wrapf(ErrSizeMismatch, "the archive has %d bytes, PAYLOADSIZE is %d", progress.p.Bytes, r.archiveSize)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriteCPIO(t *testing.T) {
+	build := func(compressor string) *RPM {
+		r, err := NewRPM(RPMMetaData{Name: "cpio", Version: "1.0", Summary: "summary", Compressor: compressor})
+		if err != nil {
+			t.Fatalf("NewRPM returned error %v", err)
+		}
+		r.AddFile(RPMFile{Name: "/usr/share/cpio/file", Body: []byte("content"), MTime: 1600000000})
+		r.AddFile(RPMFile{Name: "/usr/share/cpio/link", Body: []byte("file"), Mode: 0120777, MTime: 1600000000})
+		return r
+	}
+	archive := readPayload(t, buildRPM(t, build("none")))
+	for _, compressor := range []string{"gzip", "lzma", "xz", "zstd", "none"} {
+		payload := readPayload(t, buildRPM(t, build(compressor)))
+		for _, compressed := range []bool{true, false} {
+			want := archive
+			if compressed {
+				want = payload
+			}
+			r := build(compressor)
+			b := &bytes.Buffer{}
+			if err := r.WriteCPIO(b, compressed); err != nil {
+				t.Fatalf("WriteCPIO(%s, %v) returned error %v", compressor, compressed, err)
+			}
+			if diff := cmp.Diff(want, b.Bytes()); diff != "" {
+				t.Errorf("WriteCPIO(%s, %v) differs from the payload of the rpm:\n%s", compressor, compressed, diff)
+			}
+			if err := r.Write(&bytes.Buffer{}); err != ErrWriteAfterClose {
+				t.Errorf("Write after WriteCPIO returned error %v, want %v", err, ErrWriteAfterClose)
+			}
+		}
+	}
+}
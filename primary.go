@@ -0,0 +1,293 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNotWritten is returned by WritePrimaryXML before the rpm is written.
+var ErrNotWritten = errors.New("rpm has not been written")
+
+// primaryFiles matches the files createrepo_c lists in primary.xml, the
+// others are only in filelists.xml.
+var primaryFiles = regexp.MustCompile(`^(.*bin/.*|/etc/.*|/usr/lib/sendmail)$`)
+
+// written is what Write records of the rpm file it wrote, for the repository
+// metadata.
+type written struct {
+	signature, header      *index
+	headerStart, headerEnd int64
+	size                   int64
+	sha256                 string
+}
+
+type primaryPackage struct {
+	XMLName     xml.Name        `xml:"package"`
+	Type        string          `xml:"type,attr"`
+	Name        string          `xml:"name"`
+	Arch        string          `xml:"arch"`
+	Version     primaryVersion  `xml:"version"`
+	Checksum    primaryChecksum `xml:"checksum"`
+	Summary     string          `xml:"summary"`
+	Description string          `xml:"description"`
+	Packager    string          `xml:"packager"`
+	URL         string          `xml:"url"`
+	Time        primaryTime     `xml:"time"`
+	Size        primarySize     `xml:"size"`
+	Location    primaryLocation `xml:"location"`
+	Format      primaryFormat   `xml:"format"`
+}
+
+type primaryVersion struct {
+	Epoch string `xml:"epoch,attr"`
+	Ver   string `xml:"ver,attr"`
+	Rel   string `xml:"rel,attr"`
+}
+
+type primaryChecksum struct {
+	Type  string `xml:"type,attr"`
+	PkgID string `xml:"pkgid,attr"`
+	Value string `xml:",chardata"`
+}
+
+type primaryTime struct {
+	File  uint64 `xml:"file,attr"`
+	Build uint64 `xml:"build,attr"`
+}
+
+type primarySize struct {
+	Package   int64  `xml:"package,attr"`
+	Installed uint64 `xml:"installed,attr"`
+	Archive   uint64 `xml:"archive,attr"`
+}
+
+type primaryLocation struct {
+	Href string `xml:"href,attr"`
+}
+
+type primaryFormat struct {
+	License     string             `xml:"rpm:license"`
+	Vendor      string             `xml:"rpm:vendor"`
+	Group       string             `xml:"rpm:group"`
+	BuildHost   string             `xml:"rpm:buildhost"`
+	SourceRPM   string             `xml:"rpm:sourcerpm"`
+	HeaderRange primaryHeaderRange `xml:"rpm:header-range"`
+	Provides    *primaryEntries    `xml:"rpm:provides,omitempty"`
+	Requires    *primaryEntries    `xml:"rpm:requires,omitempty"`
+	Conflicts   *primaryEntries    `xml:"rpm:conflicts,omitempty"`
+	Obsoletes   *primaryEntries    `xml:"rpm:obsoletes,omitempty"`
+	Suggests    *primaryEntries    `xml:"rpm:suggests,omitempty"`
+	Enhances    *primaryEntries    `xml:"rpm:enhances,omitempty"`
+	Recommends  *primaryEntries    `xml:"rpm:recommends,omitempty"`
+	Supplements *primaryEntries    `xml:"rpm:supplements,omitempty"`
+	Files       []primaryFile      `xml:"file"`
+}
+
+type primaryHeaderRange struct {
+	Start int64 `xml:"start,attr"`
+	End   int64 `xml:"end,attr"`
+}
+
+type primaryEntries struct {
+	Entries []primaryEntry `xml:"rpm:entry"`
+}
+
+type primaryEntry struct {
+	Name  string `xml:"name,attr"`
+	Flags string `xml:"flags,attr,omitempty"`
+	Epoch string `xml:"epoch,attr,omitempty"`
+	Ver   string `xml:"ver,attr,omitempty"`
+	Rel   string `xml:"rel,attr,omitempty"`
+	Pre   string `xml:"pre,attr,omitempty"`
+}
+
+type primaryFile struct {
+	Type string `xml:"type,attr,omitempty"`
+	Name string `xml:",chardata"`
+}
+
+// primaryFlags are the flags of primary.xml entries, by comparison sense.
+var primaryFlags = map[rpmSense]string{
+	SenseLess:                 "LT",
+	SenseGreater:              "GT",
+	SenseEqual:                "EQ",
+	SenseLess | SenseEqual:    "LE",
+	SenseGreater | SenseEqual: "GE",
+}
+
+// WritePrimaryXML writes the <package> element of the rpm in the primary.xml
+// metadata of a yum repository, as createrepo_c would, after Write. href is
+// the location of the rpm file in the repository, like
+// "Packages/f/foo-1.0-1.x86_64.rpm". The checksum is the SHA256 of the rpm
+// file, and the file time is its build time. The element goes in the
+// <metadata> element of primary.xml, which declares the rpm namespace; only
+// the files createrepo_c lists in primary.xml are included, like the ones in
+// /etc and in bin directories.
+func (r *RPM) WritePrimaryXML(w io.Writer, href string) error {
+	if r.written == nil {
+		return ErrNotWritten
+	}
+	b, err := xml.MarshalIndent(r.written.primaryPackage(href), "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal primary.xml")
+	}
+	if _, err := w.Write(append(b, '\n')); err != nil {
+		return errors.Wrap(err, "failed to write primary.xml")
+	}
+	return nil
+}
+
+func (wr *written) primaryPackage(href string) primaryPackage {
+	h, s := wr.header, wr.signature
+	first := func(v []uint64) uint64 {
+		if len(v) == 0 {
+			return 0
+		}
+		return v[0]
+	}
+	hh, sh := &Header{h}, &Header{s}
+	installed := first(hh.Ints(tagLongSize))
+	if installed == 0 {
+		installed = first(hh.Ints(tagSize))
+	}
+	archive := first(sh.Ints(sigLongArchiveSize))
+	if archive == 0 {
+		archive = first(sh.Ints(sigPayloadSize))
+	}
+	p := primaryPackage{
+		Type: "rpm",
+		Name: h.getString(tagName),
+		Arch: h.getString(tagArch),
+		Version: primaryVersion{
+			Epoch: fmt.Sprintf("%d", first(hh.Ints(tagEpoch))),
+			Ver:   h.getString(tagVersion),
+			Rel:   h.getString(tagRelease),
+		},
+		Checksum:    primaryChecksum{Type: "sha256", PkgID: "YES", Value: wr.sha256},
+		Summary:     h.getString(tagSummary),
+		Description: h.getString(tagDescription),
+		Packager:    h.getString(tagPackager),
+		URL:         h.getString(tagURL),
+		Time:        primaryTime{File: first(hh.Ints(tagBuildTime)), Build: first(hh.Ints(tagBuildTime))},
+		Size:        primarySize{Package: wr.size, Installed: installed, Archive: archive},
+		Location:    primaryLocation{Href: href},
+		Format: primaryFormat{
+			License:     h.getString(tagLicence),
+			Vendor:      h.getString(tagVendor),
+			Group:       h.getString(tagGroup),
+			BuildHost:   h.getString(tagBuildHost),
+			SourceRPM:   h.getString(tagSourceRPM),
+			HeaderRange: primaryHeaderRange{Start: wr.headerStart, End: wr.headerEnd},
+			Provides:    primaryDeps(h, tagProvides, tagProvideVersion, tagProvideFlags),
+			Requires:    primaryDeps(h, tagRequires, tagRequireVersion, tagRequireFlags),
+			Conflicts:   primaryDeps(h, tagConflicts, tagConflictVersion, tagConflictFlags),
+			Obsoletes:   primaryDeps(h, tagObsoletes, tagObsoleteVersion, tagObsoleteFlags),
+			Suggests:    primaryDeps(h, tagSuggests, tagSuggestVersion, tagSuggestFlags),
+			Enhances:    primaryDeps(h, tagEnhances, tagEnhanceVersion, tagEnhanceFlags),
+			Recommends:  primaryDeps(h, tagRecommends, tagRecommendVersion, tagRecommendFlags),
+			Supplements: primaryDeps(h, tagSupplements, tagSupplementVersion, tagSupplementFlags),
+		},
+	}
+	for _, f := range packageFiles(h) {
+		if primaryFiles.MatchString(f.Name) {
+			p.Format.Files = append(p.Format.Files, f)
+		}
+	}
+	return p
+}
+
+// packageFiles returns the files of a header, with their type for
+// directories and ghosts.
+func packageFiles(h *index) []primaryFile {
+	var files []primaryFile
+	dirs, dirindexes := h.getStrings(tagDirnames), h.getUint32s(tagDirindexes)
+	modes, flags := h.getUint16s(tagFileModes), h.getUint32s(tagFileFlags)
+	for i, b := range h.getStrings(tagBasenames) {
+		if i >= len(dirindexes) || int(dirindexes[i]) >= len(dirs) {
+			break
+		}
+		f := primaryFile{Name: dirs[dirindexes[i]] + b}
+		switch {
+		case i < len(flags) && FileType(flags[i])&GhostFile != 0:
+			f.Type = "ghost"
+		case i < len(modes) && modes[i]&0170000 == 040000:
+			f.Type = "dir"
+		}
+		files = append(files, f)
+	}
+	return files
+}
+
+// sensePrereq (64) is RPMSENSE_PREREQ, the legacy PreReq tag of old packages.
+const sensePrereq rpmSense = 1 << 6
+
+// primaryDeps returns the dependencies of a kind, without the rpmlib()
+// requirements, like createrepo_c. Only the requirements of the %pre and %post
+// scriptlets are marked pre="1".
+func primaryDeps(h *index, nameTag, versionTag, flagsTag int) *primaryEntries {
+	names, versions, flags := h.getStrings(nameTag), h.getStrings(versionTag), h.getUint32s(flagsTag)
+	e := &primaryEntries{}
+	seen := map[primaryEntry]bool{}
+	for i, n := range names {
+		var (
+			v string
+			f rpmSense
+		)
+		if i < len(versions) {
+			v = versions[i]
+		}
+		if i < len(flags) {
+			f = rpmSense(flags[i])
+		}
+		if f&SenseRPMLib != 0 || strings.HasPrefix(n, "rpmlib(") {
+			continue
+		}
+		entry := primaryEntry{Name: n, Flags: primaryFlags[f&senseCompareMask]}
+		if v != "" {
+			entry.Epoch, entry.Ver, entry.Rel = splitEVR(v)
+		}
+		if nameTag == tagRequires && f&(sensePrereq|SenseScriptPre|SenseScriptPost) != 0 {
+			entry.Pre = "1"
+		}
+		if seen[entry] {
+			continue
+		}
+		seen[entry] = true
+		e.Entries = append(e.Entries, entry)
+	}
+	if len(e.Entries) == 0 {
+		return nil
+	}
+	return e
+}
+
+// splitEVR splits [epoch:]version[-release], the epoch is "0" if not set.
+func splitEVR(evr string) (epoch, version, release string) {
+	epoch = "0"
+	if i := strings.Index(evr, ":"); i >= 0 {
+		epoch, evr = evr[:i], evr[i+1:]
+	}
+	if i := strings.LastIndex(evr, "-"); i >= 0 {
+		return epoch, evr[:i], evr[i+1:]
+	}
+	return epoch, evr, ""
+}
@@ -0,0 +1,129 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWritePrimaryXML(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{
+		Name:      "primary",
+		Version:   "1.0",
+		Release:   "1",
+		Arch:      "x86_64",
+		Summary:   "summary",
+		Licence:   "MIT",
+		BuildTime: time.Unix(1600000000, 0),
+		Requires: Relations{
+			{Name: "bash", Sense: SenseScriptPre},
+			{Name: "coreutils", Sense: SenseScriptPost},
+			{Name: "glibc", Version: "1:2.17-3", Sense: SenseGreater | SenseEqual},
+			{Name: "systemd", Sense: SensePosttrans},
+		},
+		Conflicts: Relations{{Name: "other", Sense: SenseScriptPre}},
+	})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	for _, f := range []RPMFile{
+		{Name: "/usr/bin/primary", Body: []byte("bin"), Mode: 0755},
+		{Name: "/etc/primary", Mode: 040755},
+		{Name: "/etc/primary/log", Type: GhostFile},
+		{Name: "/usr/share/primary/data", Body: []byte("data")},
+	} {
+		if err := r.AddFile(f); err != nil {
+			t.Fatalf("AddFile returned error %v", err)
+		}
+	}
+	if err := r.WritePrimaryXML(&bytes.Buffer{}, ""); err != ErrNotWritten {
+		t.Errorf("WritePrimaryXML before Write returned error %v, want %v", err, ErrNotWritten)
+	}
+	b := buildRPM(t, r)
+	x := &bytes.Buffer{}
+	if err := r.WritePrimaryXML(x, "Packages/primary-1.0-1.x86_64.rpm"); err != nil {
+		t.Fatalf("WritePrimaryXML returned error %v", err)
+	}
+	got := x.String()
+
+	p, err := ReadPackage(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("ReadPackage returned error %v", err)
+	}
+	hb, err := p.Header.i.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes returned error %v", err)
+	}
+	start := bytes.Index(b, hb)
+	for _, want := range []string{
+		`<package type="rpm">`,
+		`<version epoch="0" ver="1.0" rel="1"></version>`,
+		fmt.Sprintf(`<checksum type="sha256" pkgid="YES">%x</checksum>`, sha256.Sum256(b)),
+		`<time file="1600000000" build="1600000000"></time>`,
+		fmt.Sprintf(`<size package="%d" installed="7"`, len(b)),
+		`<location href="Packages/primary-1.0-1.x86_64.rpm"></location>`,
+		`<rpm:license>MIT</rpm:license>`,
+		fmt.Sprintf(`<rpm:header-range start="%d" end="%d"></rpm:header-range>`, start, start+len(hb)),
+		`<rpm:entry name="primary" flags="EQ" epoch="0" ver="1.0" rel="1"></rpm:entry>`,
+		`<rpm:entry name="bash" pre="1"></rpm:entry>`,
+		`<rpm:entry name="coreutils" pre="1"></rpm:entry>`,
+		`<rpm:entry name="glibc" flags="GE" epoch="1" ver="2.17" rel="3"></rpm:entry>`,
+		`<rpm:entry name="systemd"></rpm:entry>`,
+		`<rpm:entry name="other"></rpm:entry>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("primary.xml does not contain %s:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "rpmlib(") {
+		t.Errorf("primary.xml contains rpmlib requirements:\n%s", got)
+	}
+	var files []string
+	for _, l := range strings.Split(got, "\n") {
+		if l = strings.TrimSpace(l); strings.HasPrefix(l, "<file") {
+			files = append(files, l)
+		}
+	}
+	wantFiles := []string{
+		`<file type="dir">/etc/primary</file>`,
+		`<file type="ghost">/etc/primary/log</file>`,
+		`<file>/usr/bin/primary</file>`,
+	}
+	if d := cmp.Diff(wantFiles, files); d != "" {
+		t.Errorf("primary.xml files mismatch (-want +got):\n%s", d)
+	}
+}
+
+func TestSplitEVR(t *testing.T) {
+	for evr, want := range map[string][3]string{
+		"1.0":      {"0", "1.0", ""},
+		"1.0-2":    {"0", "1.0", "2"},
+		"3:1.0-2":  {"3", "1.0", "2"},
+		"3:1.0":    {"3", "1.0", ""},
+		"1.0-2-b3": {"0", "1.0-2", "b3"},
+	} {
+		e, v, r := splitEVR(evr)
+		if got := [3]string{e, v, r}; got != want {
+			t.Errorf("splitEVR(%q) = %v, want %v", evr, got, want)
+		}
+	}
+}
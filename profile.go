@@ -0,0 +1,212 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrProfileViolation is returned by Write when the package breaks the
+// conventions of its profile, see WithProfile.
+var ErrProfileViolation = errors.New("package does not follow the conventions of its profile")
+
+// Profile holds the conventions of a distribution: the defaults it gives to
+// the metadata of the packages, and the checks of the packages its tooling
+// rejects, which Write runs before writing them. See WithProfile.
+type Profile struct {
+	name     string
+	defaults func(*RPMMetaData)
+	checks   []func(*RPM) []string
+	// headerSHA1 adds the SHA-1 digest of the header to the signature header,
+	// which rpm checks before 4.14 introduced the SHA-256 one.
+	headerSHA1 bool
+}
+
+// String returns the name of the profile, like "suse".
+func (p *Profile) String() string {
+	return p.name
+}
+
+// ProfileSUSE follows the conventions of SUSE Linux Enterprise and openSUSE,
+// so that the packages pass rpmlint, which the Open Build Service runs on
+// every package:
+//   - the payload is compressed with xz, and the files digested with SHA-256,
+//     like SUSE Linux Enterprise and Leap do, which Tumbleweed reads too.
+//   - the package must have a License and a %changelog.
+//   - no file may be under /tmp or /var/tmp.
+//   - setuid and setgid files must be managed by permctl, which changes their
+//     mode after installing them, so their mode is not verified, like
+//     %verify(not mode) in a spec file.
+//   - files must not be world writable, unless they have the sticky bit,
+//     like the directory /tmp.
+var ProfileSUSE = &Profile{
+	name: "suse",
+	defaults: func(m *RPMMetaData) {
+		if m.Compressor == "" && m.CustomCompressor == nil {
+			m.Compressor = "xz"
+		}
+		if m.FileDigest == "" {
+			m.FileDigest = "sha256"
+		}
+	},
+	checks: []func(*RPM) []string{
+		func(r *RPM) []string {
+			var v []string
+			if r.Licence == "" {
+				v = append(v, "no-license: License is not set")
+			}
+			if len(r.changelog) == 0 {
+				v = append(v, "no-changelogname-tag: the package has no changelog")
+			}
+			return v
+		},
+		func(r *RPM) []string {
+			return r.fileViolations(func(f RPMFile) string {
+				if inTmp(f.Name) {
+					return "dir-or-file-in-tmp"
+				}
+				return ""
+			})
+		},
+		func(r *RPM) []string {
+			return r.fileViolations(func(f RPMFile) string {
+				if f.Mode&(04000|02000) != 0 && f.NoVerify&VerifyMode == 0 {
+					return "permissions-file-setuid-bit: setuid or setgid, without %verify(not mode)"
+				}
+				return ""
+			})
+		},
+		func(r *RPM) []string {
+			return r.fileViolations(func(f RPMFile) string {
+				if worldWritable(f) {
+					return "permissions-world-writable"
+				}
+				return ""
+			})
+		},
+	},
+}
+
+// el7Features are the rpmlib() features rpmpack uses which rpm 4.11 does not
+// have, other than the zstd payload compression.
+var el7Features = map[string]bool{
+	"rpmlib(LargeFiles)":       true,
+	"rpmlib(FileTriggers)":     true,
+	"rpmlib(RichDependencies)": true,
+	"rpmlib(CaretInVersions)":  true,
+}
+
+// ProfileEL7 restricts the package to what rpm 4.11, the rpm of Enterprise
+// Linux 7, understands, so that one configuration can build packages for EL7
+// and current distributions:
+//   - the payload is compressed with xz by default, and must be compressed
+//     with gzip or xz, or not at all.
+//   - the package must not have weak dependencies, which rpm 4.11 ignores, nor
+//     use the rpmlib() features of later versions: files of 4 GiB or more,
+//     file triggers, rich dependencies and carets in versions.
+//   - the signature header also has the SHA-1 digest of the header, the one
+//     rpm 4.11 checks.
+var ProfileEL7 = &Profile{
+	name: "el7",
+	defaults: func(m *RPMMetaData) {
+		if m.Compressor == "" && m.CustomCompressor == nil {
+			m.Compressor = "xz"
+		}
+	},
+	checks: []func(*RPM) []string{
+		func(r *RPM) []string {
+			switch r.payloadCompressor {
+			case "gzip", "xz", "":
+				return nil
+			}
+			return []string{fmt.Sprintf("the %s payload compression needs a later rpm", r.payloadCompressor)}
+		},
+		func(r *RPM) []string {
+			var v []string
+			for _, d := range []struct {
+				name string
+				rels Relations
+			}{
+				{"recommends", r.Recommends},
+				{"suggests", r.Suggests},
+				{"supplements", r.Supplements},
+				{"enhances", r.Enhances},
+			} {
+				if len(d.rels) > 0 {
+					v = append(v, fmt.Sprintf("%s are weak dependencies, which need rpm 4.12", d.name))
+				}
+			}
+			return v
+		},
+		func(r *RPM) []string {
+			var v []string
+			for _, rel := range r.Requires {
+				if rel.Sense&SenseRPMLib != 0 && el7Features[rel.Name] {
+					v = append(v, fmt.Sprintf("%s needs rpm %s", rel.Name, rel.Version))
+				}
+			}
+			return v
+		},
+	},
+	headerSHA1: true,
+}
+
+// WithProfile makes the rpm follow the conventions of p. The fields of
+// RPMMetaData p has defaults for are set if they are empty, so Options after
+// it still replace them, and Write fails with ErrProfileViolation, listing
+// the violations, when the package breaks the conventions.
+func WithProfile(p *Profile) Option {
+	return func(o *options) {
+		if p.defaults != nil {
+			p.defaults(&o.meta)
+		}
+		o.configure = append(o.configure, func(r *RPM) error {
+			r.profile = p
+			return nil
+		})
+	}
+}
+
+// checkProfile runs the checks of the profile of r, if any.
+func (r *RPM) checkProfile() error {
+	if r.profile == nil {
+		return nil
+	}
+	var violations []string
+	for _, c := range r.profile.checks {
+		violations = append(violations, c(r)...)
+	}
+	if len(violations) > 0 {
+		return errors.Wrapf(ErrProfileViolation, "%s: %s", r.profile, strings.Join(violations, "; "))
+	}
+	return nil
+}
+
+// fileViolations returns the violations check reports for the files of r,
+// sorted by file name.
+func (r *RPM) fileViolations(check func(RPMFile) string) []string {
+	var v []string
+	for _, f := range r.files {
+		if s := check(f); s != "" {
+			v = append(v, fmt.Sprintf("%s: %s", f.Name, s))
+		}
+	}
+	sort.Strings(v)
+	return v
+}
@@ -0,0 +1,185 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestProfileSUSE(t *testing.T) {
+	testCases := []struct {
+		name string
+		md   RPMMetaData
+		file RPMFile
+		// want are the violations, none if empty.
+		want []string
+	}{{
+		name: "conforming",
+		md:   RPMMetaData{Licence: "MIT"},
+		file: RPMFile{Name: "/usr/bin/suse", Mode: 0100755},
+	}, {
+		name: "permctl setuid",
+		md:   RPMMetaData{Licence: "MIT"},
+		file: RPMFile{Name: "/usr/bin/suse", Mode: 0104755, NoVerify: VerifyMode},
+	}, {
+		name: "sticky directory",
+		md:   RPMMetaData{Licence: "MIT"},
+		file: RPMFile{Name: "/var/lib/suse", Mode: 041777},
+	}, {
+		name: "no license",
+		file: RPMFile{Name: "/usr/bin/suse", Mode: 0100755},
+		want: []string{"no-license"},
+	}, {
+		name: "tmp",
+		md:   RPMMetaData{Licence: "MIT"},
+		file: RPMFile{Name: "/var/tmp/suse", Mode: 0100644},
+		want: []string{"dir-or-file-in-tmp"},
+	}, {
+		name: "setuid",
+		md:   RPMMetaData{Licence: "MIT"},
+		file: RPMFile{Name: "/usr/bin/suse", Mode: 0104755},
+		want: []string{"permissions-file-setuid-bit"},
+	}, {
+		name: "world writable",
+		md:   RPMMetaData{Licence: "MIT"},
+		file: RPMFile{Name: "/etc/suse.conf", Mode: 0100666},
+		want: []string{"permissions-world-writable"},
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tc.md.Name, tc.md.Version, tc.md.Summary = "suse", "1.0", "summary"
+			r, err := NewRPM(tc.md, WithProfile(ProfileSUSE))
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			r.AddChangelog(ChangelogEntry{Time: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), Name: "A <a@example.com>", Text: "- first"})
+			if err := r.AddFile(tc.file); err != nil {
+				t.Fatalf("AddFile returned error %v", err)
+			}
+			err = r.Write(ioutil.Discard)
+			if len(tc.want) == 0 {
+				if err != nil {
+					t.Errorf("Write returned error %v", err)
+				}
+				return
+			}
+			if errors.Cause(err) != ErrProfileViolation {
+				t.Fatalf("Write returned error %v, want ErrProfileViolation", err)
+			}
+			for _, w := range tc.want {
+				if !strings.Contains(err.Error(), w) {
+					t.Errorf("error %q does not report %s", err, w)
+				}
+			}
+		})
+	}
+}
+
+func TestProfileSUSEDefaults(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "suse", Version: "1.0", Summary: "summary", Licence: "MIT"}, WithProfile(ProfileSUSE))
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	if r.Compressor != "xz" || r.FileDigest != "sha256" {
+		t.Errorf("NewRPM() has compressor %q and file digest %q, want xz and sha256", r.Compressor, r.FileDigest)
+	}
+	r, err = NewRPM(RPMMetaData{Name: "suse", Version: "1.0", Summary: "summary", Licence: "MIT", Compressor: "zstd"}, WithProfile(ProfileSUSE))
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	if r.Compressor != "zstd" {
+		t.Errorf("NewRPM() has compressor %q, want the zstd of the metadata", r.Compressor)
+	}
+	// The changelog is missing.
+	if err := r.Write(&bytes.Buffer{}); errors.Cause(err) != ErrProfileViolation || !strings.Contains(err.Error(), "no-changelogname-tag") {
+		t.Errorf("Write returned error %v, want a missing changelog", err)
+	}
+}
+
+func TestProfileEL7(t *testing.T) {
+	testCases := []struct {
+		name  string
+		md    RPMMetaData
+		files []RPMFile
+		// want are the violations, none if empty.
+		want []string
+	}{{
+		name: "conforming",
+		md:   RPMMetaData{Requires: Relations{{Name: "bash", Version: "4.2~rc1", Sense: SenseGreater | SenseEqual}}},
+	}, {
+		name: "gzip",
+		md:   RPMMetaData{Compressor: "gzip:6"},
+	}, {
+		name: "zstd",
+		md:   RPMMetaData{Compressor: "zstd"},
+		want: []string{"zstd"},
+	}, {
+		name: "weak dependencies",
+		md:   RPMMetaData{Recommends: Relations{{Name: "bash-completion"}}, Enhances: Relations{{Name: "bash"}}},
+		want: []string{"recommends", "enhances"},
+	}, {
+		name: "rich dependency",
+		md:   RPMMetaData{Requires: Relations{{Name: "(bash or zsh)"}}},
+		want: []string{"rpmlib(RichDependencies)"},
+	}, {
+		name: "caret",
+		md:   RPMMetaData{Release: "1^git"},
+		want: []string{"rpmlib(CaretInVersions)"},
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tc.md.Name, tc.md.Version, tc.md.Summary = "el7", "1.0", "summary"
+			r, err := NewRPM(tc.md, WithProfile(ProfileEL7))
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			r.AddFile(RPMFile{Name: "/usr/bin/el7", Body: []byte("el7"), Mode: 0100755})
+			b := &bytes.Buffer{}
+			err = r.Write(b)
+			if len(tc.want) > 0 {
+				if errors.Cause(err) != ErrProfileViolation {
+					t.Fatalf("Write returned error %v, want ErrProfileViolation", err)
+				}
+				for _, w := range tc.want {
+					if !strings.Contains(err.Error(), w) {
+						t.Errorf("error %q does not report %s", err, w)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Write returned error %v", err)
+			}
+			s, err := readSignatures(bytes.NewReader(b.Bytes()[0x60:]))
+			if err != nil {
+				t.Fatalf("readSignatures returned error %v", err)
+			}
+			if s.getString(sigSHA1) == "" {
+				t.Error("the signature header has no SHA1 digest")
+			}
+			if err := Verify(bytes.NewReader(b.Bytes()), nil); err != nil {
+				t.Errorf("Verify returned error %v", err)
+			}
+		})
+	}
+}
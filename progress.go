@@ -0,0 +1,117 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"context"
+	"io"
+)
+
+// Phase is a pass of Write over the payload.
+type Phase int
+
+const (
+	// PhaseDigest is the first pass, computing the size and digests of the
+	// payload and its files for the headers.
+	PhaseDigest Phase = iota
+	// PhasePayload is the second pass, writing the payload after the headers.
+	PhasePayload
+)
+
+func (p Phase) String() string {
+	switch p {
+	case PhaseDigest:
+		return "digest"
+	case PhasePayload:
+		return "payload"
+	}
+	return "unknown"
+}
+
+// Progress is reported by Write while it writes the payload.
+type Progress struct {
+	Phase Phase
+	// File is the file being written, empty once the phase is done.
+	File string
+	// Bytes is the size of the uncompressed payload written so far in the
+	// phase. Total is the size of the uncompressed payload, which is only
+	// known in PhasePayload.
+	Bytes, Total int64
+}
+
+// progressInterval is the number of payload bytes between two reports
+// within a file.
+const progressInterval = 1 << 20
+
+// SetProgressHandler sets a function that Write calls when it starts writing
+// each file of the payload, every megabyte of content, and at the end of each
+// phase. If f returns an error, Write stops and returns it, so f can also
+// enforce a timeout.
+func (r *RPM) SetProgressHandler(f func(Progress) error) {
+	r.progress.f = f
+}
+
+// progressWriter counts the bytes of the uncompressed payload written to w,
+// and reports them. It stops once ctx, if any, is done.
+type progressWriter struct {
+	w        io.Writer
+	f        func(Progress) error
+	ctx      context.Context
+	p        Progress
+	reported int64
+}
+
+func (pw *progressWriter) Write(b []byte) (int, error) {
+	if err := pw.canceled(); err != nil {
+		return 0, err
+	}
+	n, err := pw.w.Write(b)
+	pw.p.Bytes += int64(n)
+	if err == nil && pw.p.Bytes-pw.reported >= progressInterval {
+		err = pw.report()
+	}
+	return n, err
+}
+
+// startFile reports the start of the file name.
+func (pw *progressWriter) startFile(name string) error {
+	pw.p.File = name
+	return pw.report()
+}
+
+// done reports the end of the phase.
+func (pw *progressWriter) done() error {
+	pw.p.File = ""
+	return pw.report()
+}
+
+func (pw *progressWriter) report() error {
+	if err := pw.canceled(); err != nil {
+		return err
+	}
+	pw.reported = pw.p.Bytes
+	if pw.f == nil {
+		return nil
+	}
+	return pw.f(pw.p)
+}
+
+// canceled returns the error of ctx once it is done.
+func (pw *progressWriter) canceled() error {
+	if pw.ctx == nil {
+		return nil
+	}
+	return pw.ctx.Err()
+}
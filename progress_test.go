@@ -0,0 +1,99 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+)
+
+func TestProgressHandler(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "progress", Version: "1.0", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	big := bytes.Repeat([]byte("x"), 3*progressInterval)
+	r.AddFile(RPMFile{Name: "/usr/share/progress/big", Body: big})
+	r.AddFile(RPMFile{Name: "/usr/share/progress/small", Body: []byte("small")})
+	var got []Progress
+	r.SetProgressHandler(func(p Progress) error {
+		got = append(got, p)
+		return nil
+	})
+	if err := r.Write(ioutil.Discard); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+
+	type report struct {
+		phase Phase
+		file  string
+	}
+	var reports []report
+	last := map[Phase]Progress{}
+	for _, p := range got {
+		if p.Bytes < last[p.Phase].Bytes {
+			t.Errorf("progress went back from %d to %d bytes", last[p.Phase].Bytes, p.Bytes)
+		}
+		last[p.Phase] = p
+		if n := len(reports); n == 0 || reports[n-1] != (report{p.Phase, p.File}) {
+			reports = append(reports, report{p.Phase, p.File})
+		}
+	}
+	want := []report{
+		{PhaseDigest, "/usr/share/progress/big"},
+		{PhaseDigest, "/usr/share/progress/small"},
+		{PhaseDigest, ""},
+		{PhasePayload, "/usr/share/progress/big"},
+		{PhasePayload, "/usr/share/progress/small"},
+		{PhasePayload, ""},
+	}
+	if d := cmp.Diff(want, reports, cmp.AllowUnexported(report{})); d != "" {
+		t.Errorf("progress reports mismatch (-want +got):\n%s", d)
+	}
+	if len(got) < len(want)+4 {
+		t.Errorf("got %d progress reports, want reports within the big file", len(got))
+	}
+	done := last[PhasePayload]
+	if done.Total == 0 || done.Bytes != done.Total || last[PhaseDigest].Bytes != done.Total {
+		t.Errorf("the payload phase ended at %d bytes of %d, the digest phase at %d", done.Bytes, done.Total, last[PhaseDigest].Bytes)
+	}
+}
+
+func TestProgressHandlerError(t *testing.T) {
+	errStop := errors.New("stop")
+	for _, phase := range []Phase{PhaseDigest, PhasePayload} {
+		phase := phase
+		t.Run(phase.String(), func(t *testing.T) {
+			r, err := NewRPM(RPMMetaData{Name: "progress", Version: "1.0", Summary: "summary"})
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			r.AddFile(RPMFile{Name: "/usr/share/progress/big", Body: bytes.Repeat([]byte("x"), 2*progressInterval)})
+			r.SetProgressHandler(func(p Progress) error {
+				if p.Phase == phase && p.Bytes > 0 {
+					return errStop
+				}
+				return nil
+			})
+			if err := r.Write(ioutil.Discard); errors.Cause(err) != errStop {
+				t.Errorf("Write returned error %v, want %v", err, errStop)
+			}
+		})
+	}
+}
@@ -0,0 +1,463 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNotRPM is returned when reading data that does not start with an rpm lead.
+	ErrNotRPM = errors.New("not an rpm file")
+	// ErrBadHeader is returned when a header of an rpm file cannot be parsed.
+	ErrBadHeader = errors.New("malformed rpm header")
+)
+
+// RPMInfo holds information read back from an existing rpm file.
+type RPMInfo struct {
+	Name,
+	Version,
+	Release,
+	Arch string
+	// PayloadCompressor is the compression of the payload (RPMTAG_PAYLOADCOMPRESSOR),
+	// for example "gzip" or "xz".
+	PayloadCompressor string
+	// PayloadFlags is the compression level of the payload (RPMTAG_PAYLOADFLAGS).
+	PayloadFlags string
+	// Source is set for source rpms (RPMTAG_SOURCEPACKAGE).
+	Source bool
+	// Files is the file list stored in the header, in header order.
+	Files []FileInfo
+}
+
+// FileInfo describes a file as recorded in the header of an rpm file.
+// Body is only set for symlinks, where it holds the link target, as it does when
+// adding a symlink with AddFile.
+type FileInfo struct {
+	RPMFile
+	Size   int64
+	Digest string
+	LinkTo string
+	// Color and Class are the multilib color and the class of the file,
+	// like 2 and "ELF 64-bit LSB shared object, x86-64", if the package has
+	// them. See RPMMetaData.FileColors.
+	Color uint32
+	Class string
+}
+
+// Lead is the lead of an rpm file, its first 96 bytes. rpm only checks its
+// magic, the headers hold the same information.
+type Lead struct {
+	// Major and Minor are the version of the file format, 3.0.
+	Major, Minor byte
+	// Source is set for source rpms.
+	Source bool
+	// ArchNum and OSNum are the numbers of the architecture and the operating
+	// system in rpmrc, like 1 for x86_64 and 1 for linux.
+	ArchNum, OSNum uint16
+	// Name is name-version-release, truncated to 65 bytes.
+	Name string
+	// SignatureType is the type of the signature, 5 for a signature header.
+	SignatureType uint16
+}
+
+// Header is the signature header or the main header of an rpm file. Values
+// are read by tag number, as in rpm's lib/rpmtag.h, and the getters return
+// the zero value if the header does not have the tag with a matching type.
+type Header struct {
+	i *index
+}
+
+// Tags returns the tags of the header, sorted.
+func (h *Header) Tags() []int {
+	return h.i.sortedTags()
+}
+
+// Type returns the rpm type of tag, like "STRING" or "INT32", or "" if the
+// header does not have it.
+func (h *Header) Type(tag int) string {
+	e, ok := h.i.entries[tag]
+	if !ok {
+		return ""
+	}
+	if n, ok := typeNames[e.rpmtype]; ok {
+		return n
+	}
+	return fmt.Sprintf("%d", e.rpmtype)
+}
+
+// String returns a STRING or I18NSTRING value. For localized strings, the
+// untranslated value is returned.
+func (h *Header) String(tag int) string {
+	return h.i.getString(tag)
+}
+
+// Strings returns a STRING_ARRAY or I18NSTRING value.
+func (h *Header) Strings(tag int) []string {
+	return h.i.getStrings(tag)
+}
+
+// Ints returns an INT8, INT16, INT32 or INT64 value. rpm integers are unsigned.
+func (h *Header) Ints(tag int) []uint64 {
+	var v []uint64
+	e := h.i.entries[tag]
+	switch e.rpmtype {
+	case typeInt8:
+		for _, n := range e.data {
+			v = append(v, uint64(n))
+		}
+	case typeInt16:
+		for _, n := range h.i.getUint16s(tag) {
+			v = append(v, uint64(n))
+		}
+	case typeInt32:
+		for _, n := range h.i.getUint32s(tag) {
+			v = append(v, uint64(n))
+		}
+	case typeInt64:
+		v = h.i.getUint64s(tag)
+	}
+	return v
+}
+
+// Bytes returns a BIN value.
+func (h *Header) Bytes(tag int) []byte {
+	e, ok := h.i.entries[tag]
+	if !ok || e.rpmtype != typeBinary {
+		return nil
+	}
+	return e.data
+}
+
+// Package is an rpm file up to the start of its payload, as read by
+// ReadPackage.
+type Package struct {
+	Lead      Lead
+	Signature *Header
+	Header    *Header
+}
+
+// ReadPackage reads the lead, signature header and main header of an rpm
+// file. It stops reading at the start of the payload.
+func ReadPackage(r io.Reader) (*Package, error) {
+	l, err := readLead(r)
+	if err != nil {
+		return nil, err
+	}
+	s, err := readSignatures(r)
+	if err != nil {
+		return nil, err
+	}
+	h, _, err := readIndex(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read header")
+	}
+	return &Package{Lead: l, Signature: &Header{s}, Header: &Header{h}}, nil
+}
+
+// ReadRPMInfo reads the lead, signature and header of an rpm file.
+// It stops reading at the start of the payload.
+func ReadRPMInfo(r io.Reader) (*RPMInfo, error) {
+	p, err := ReadPackage(r)
+	if err != nil {
+		return nil, err
+	}
+	return p.Info()
+}
+
+// Info returns the information of the main header of the package.
+func (p *Package) Info() (*RPMInfo, error) {
+	h := p.Header.i
+	files, err := readFiles(h)
+	if err != nil {
+		return nil, err
+	}
+	return &RPMInfo{
+		Name:              h.getString(tagName),
+		Version:           h.getString(tagVersion),
+		Release:           h.getString(tagRelease),
+		Arch:              h.getString(tagArch),
+		PayloadCompressor: h.getString(tagPayloadCompressor),
+		PayloadFlags:      h.getString(tagPayloadFlags),
+		Source:            len(h.getUint32s(tagSourcePackage)) > 0,
+		Files:             files,
+	}, nil
+}
+
+// readFiles reconstructs the file list from the file tags of a header.
+func readFiles(h *index) ([]FileInfo, error) {
+	basenames := h.getStrings(tagBasenames)
+	dirnames := h.getStrings(tagDirnames)
+	dirindexes := h.getUint32s(tagDirindexes)
+	// Packages with files of 4 GiB or more only have LONGFILESIZES.
+	sizes := h.getUint64s(tagLongFileSizes)
+	if sizes == nil {
+		for _, s := range h.getUint32s(tagFileSizes) {
+			sizes = append(sizes, uint64(s))
+		}
+	}
+	modes := h.getUint16s(tagFileModes)
+	owners := h.getStrings(tagFileUserName)
+	groups := h.getStrings(tagFileGroupName)
+	mtimes := h.getUint32s(tagFileMTimes)
+	digests := h.getStrings(tagFileDigests)
+	linktos := h.getStrings(tagFileLinkTos)
+	flags := h.getUint32s(tagFileFlags)
+	verifyFlags := h.getUint32s(tagFileVerifyFlags)
+	rdevs := h.getUint16s(tagFileRDevs)
+	caps := h.getStrings(tagFileCaps)
+	contexts := h.getStrings(tagFileContexts)
+	langs := h.getStrings(tagFileLangs)
+	colors := h.getUint32s(tagFileColors)
+	classes := h.getUint32s(tagFileClass)
+	classDict := h.getStrings(tagClassDict)
+
+	n := len(basenames)
+	for _, l := range []int{len(dirindexes), len(sizes), len(modes), len(owners), len(groups), len(mtimes), len(digests), len(linktos), len(flags), len(verifyFlags)} {
+		if l != n {
+			return nil, errors.Wrap(ErrBadHeader, "file tags have different lengths")
+		}
+	}
+	files := make([]FileInfo, n)
+	for ii := range files {
+		if int(dirindexes[ii]) >= len(dirnames) {
+			return nil, errors.Wrapf(ErrBadHeader, "dirindex %d out of range", dirindexes[ii])
+		}
+		f := FileInfo{
+			RPMFile: RPMFile{
+				Name:     dirnames[dirindexes[ii]] + basenames[ii],
+				Mode:     uint(modes[ii]),
+				Owner:    owners[ii],
+				Group:    groups[ii],
+				MTime:    mtimes[ii],
+				Type:     FileType(flags[ii]),
+				NoVerify: VerifyFlags(^verifyFlags[ii]),
+			},
+			Size:   int64(sizes[ii]),
+			Digest: digests[ii],
+			LinkTo: linktos[ii],
+		}
+		if f.LinkTo != "" {
+			f.Body = []byte(f.LinkTo)
+		}
+		if ii < len(caps) {
+			f.Caps = caps[ii]
+		}
+		if ii < len(contexts) {
+			f.SELinuxContext = contexts[ii]
+		}
+		if ii < len(langs) {
+			f.Lang = langs[ii]
+		}
+		if ii < len(colors) {
+			f.Color = colors[ii]
+		}
+		if ii < len(classes) && int(classes[ii]) < len(classDict) {
+			f.Class = classDict[classes[ii]]
+		}
+		if t := f.Mode & 0170000; (t == 020000 || t == 060000) && ii < len(rdevs) {
+			f.DevMajor, f.DevMinor = uint32(rdevs[ii]>>8), uint32(rdevs[ii]&0xff)
+		}
+		files[ii] = f
+	}
+	return files, nil
+}
+
+func readLead(r io.Reader) (Lead, error) {
+	l := make([]byte, 0x60)
+	if _, err := io.ReadFull(r, l); err != nil {
+		return Lead{}, errors.Wrap(err, "failed to read lead")
+	}
+	if !bytes.Equal(l[:4], []byte{0xed, 0xab, 0xee, 0xdb}) {
+		return Lead{}, ErrNotRPM
+	}
+	name := l[10:76]
+	if end := bytes.IndexByte(name, 0); end >= 0 {
+		name = name[:end]
+	}
+	return Lead{
+		Major:         l[4],
+		Minor:         l[5],
+		Source:        binary.BigEndian.Uint16(l[6:]) == 1,
+		ArchNum:       binary.BigEndian.Uint16(l[8:]),
+		Name:          string(name),
+		OSNum:         binary.BigEndian.Uint16(l[76:]),
+		SignatureType: binary.BigEndian.Uint16(l[78:]),
+	}, nil
+}
+
+// readSignatures reads the signature header and the padding that follows it.
+func readSignatures(r io.Reader) (*index, error) {
+	s, n, err := readIndex(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read signatures")
+	}
+	if _, err := io.ReadFull(r, make([]byte, (8-n%8)%8)); err != nil {
+		return nil, errors.Wrap(err, "failed to read signature padding")
+	}
+	return s, nil
+}
+
+// readIndex reads a header structure, as written by index.Bytes.
+// It returns the index together with the number of bytes read.
+func readIndex(r io.Reader) (*index, int, error) {
+	var intro struct {
+		Magic    [4]byte
+		Reserved [4]byte
+		Count    int32
+		Size     int32
+	}
+	if err := binary.Read(r, binary.BigEndian, &intro); err != nil {
+		return nil, 0, err
+	}
+	if !bytes.Equal(intro.Magic[:], []byte{0x8e, 0xad, 0xe8, 0x01}) || intro.Count < 1 || intro.Size < 0 {
+		return nil, 0, ErrBadHeader
+	}
+	// The counts are checked against the limits of rpm before anything is
+	// allocated, the file may not be an rpm written by rpmpack.
+	if intro.Count > headerMaxEntries || intro.Size > headerMaxData {
+		return nil, 0, errors.Wrapf(ErrBadHeader, "%d entries and %d bytes of data exceed the limits of rpm", intro.Count, intro.Size)
+	}
+	recs := make([][4]int32, 1, intro.Count)
+	if err := binary.Read(r, binary.BigEndian, recs); err != nil {
+		return nil, 0, err
+	}
+	// The eigenHeader tells a signature header, which has lower limits.
+	if recs[0][0] == signatures && (intro.Count > signatureMaxEntries || intro.Size > signatureMaxData) {
+		return nil, 0, errors.Wrapf(ErrBadHeader, "%d entries and %d bytes of data exceed the limits of rpm for a signature header", intro.Count, intro.Size)
+	}
+	recs = recs[:intro.Count]
+	if err := binary.Read(r, binary.BigEndian, recs[1:]); err != nil {
+		return nil, 0, err
+	}
+	data := make([]byte, intro.Size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, 0, err
+	}
+	// The first record is the eigenHeader. Its tag tells which header this is.
+	i := newIndex(int(recs[0][0]))
+	for _, rec := range recs[1:] {
+		tag, rpmtype, offset, count := int(rec[0]), int(rec[1]), int(rec[2]), int(rec[3])
+		if offset < 0 || offset > len(data) || count < 0 {
+			return nil, 0, errors.Wrapf(ErrBadHeader, "tag %d", tag)
+		}
+		n, err := entryLen(rpmtype, count, data[offset:])
+		if err != nil {
+			return nil, 0, errors.Wrapf(err, "tag %d", tag)
+		}
+		i.Add(tag, IndexEntry{rpmtype, count, data[offset : offset+n]})
+	}
+	return i, 16 + 16*len(recs) + len(data), nil
+}
+
+// entryLen returns the number of bytes used by an entry at the beginning of data.
+func entryLen(rpmtype, count int, data []byte) (int, error) {
+	var n int
+	switch rpmtype {
+	case typeInt16:
+		n = 2 * count
+	case typeInt32:
+		n = 4 * count
+	case typeInt64:
+		n = 8 * count
+	case typeChar, typeInt8, typeBinary:
+		n = count
+	case typeString:
+		count = 1
+		fallthrough
+	case typeStringArray, typeI18NString:
+		for ; count > 0; count-- {
+			end := bytes.IndexByte(data[n:], 0)
+			if end < 0 {
+				return 0, ErrBadHeader
+			}
+			n += end + 1
+		}
+	default:
+		return 0, errors.Wrapf(ErrBadHeader, "unknown type %d", rpmtype)
+	}
+	if n > len(data) {
+		return 0, ErrBadHeader
+	}
+	return n, nil
+}
+
+// getString returns a string tag, or "" if the tag is missing.
+// For localized strings, the first (untranslated) value is returned.
+func (i *index) getString(tag int) string {
+	e, ok := i.entries[tag]
+	if !ok || (e.rpmtype != typeString && e.rpmtype != typeI18NString) {
+		return ""
+	}
+	if end := bytes.IndexByte(e.data, 0); end >= 0 {
+		return string(e.data[:end])
+	}
+	return string(e.data)
+}
+
+// getStrings returns a string array tag, or nil if the tag is missing.
+// For localized strings, the values of all the locales are returned.
+func (i *index) getStrings(tag int) []string {
+	e, ok := i.entries[tag]
+	if !ok || (e.rpmtype != typeStringArray && e.rpmtype != typeI18NString) {
+		return nil
+	}
+	return strings.SplitN(string(bytes.TrimSuffix(e.data, []byte{0})), "\x00", e.count)
+}
+
+// getUint32s returns an int32 array tag, or nil if the tag is missing.
+func (i *index) getUint32s(tag int) []uint32 {
+	e, ok := i.entries[tag]
+	if !ok || e.rpmtype != typeInt32 {
+		return nil
+	}
+	v := make([]uint32, e.count)
+	for ii := range v {
+		v[ii] = binary.BigEndian.Uint32(e.data[4*ii:])
+	}
+	return v
+}
+
+// getUint64s returns an int64 array tag, or nil if the tag is missing.
+func (i *index) getUint64s(tag int) []uint64 {
+	e, ok := i.entries[tag]
+	if !ok || e.rpmtype != typeInt64 {
+		return nil
+	}
+	v := make([]uint64, e.count)
+	for ii := range v {
+		v[ii] = binary.BigEndian.Uint64(e.data[8*ii:])
+	}
+	return v
+}
+
+// getUint16s returns an int16 array tag, or nil if the tag is missing.
+func (i *index) getUint16s(tag int) []uint16 {
+	e, ok := i.entries[tag]
+	if !ok || e.rpmtype != typeInt16 {
+		return nil
+	}
+	v := make([]uint16, e.count)
+	for ii := range v {
+		v[ii] = binary.BigEndian.Uint16(e.data[2*ii:])
+	}
+	return v
+}
@@ -0,0 +1,287 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	cpio "github.com/cavaliercoder/go-cpio"
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+)
+
+// buildRPM writes r and returns the resulting rpm file.
+func buildRPM(t *testing.T, r *RPM) []byte {
+	t.Helper()
+	b := &bytes.Buffer{}
+	if err := r.Write(b); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	return b.Bytes()
+}
+
+var readerFiles = []FileInfo{{
+	RPMFile: RPMFile{
+		Name:  "/usr/share/reader/file",
+		Mode:  0100644,
+		Owner: "root",
+		Group: "root",
+	},
+	Size:   7,
+	Digest: "ed7002b439e9ac845f22357d822bac1444730fbdb6016d3ec9432297b9ec9f73",
+}}
+
+func TestReadRPMInfo(t *testing.T) {
+	testCases := []struct {
+		compressor string
+		want       RPMInfo
+	}{{
+		compressor: "gzip",
+		want: RPMInfo{
+			Name:              "reader",
+			Version:           "1.2",
+			Release:           "3",
+			Arch:              "x86_64",
+			PayloadCompressor: "gzip",
+			PayloadFlags:      "9",
+			Files:             readerFiles,
+		},
+	}, {
+		compressor: "xz",
+		want: RPMInfo{
+			Name:              "reader",
+			Version:           "1.2",
+			Release:           "3",
+			Arch:              "x86_64",
+			PayloadCompressor: "xz",
+			PayloadFlags:      "6",
+			Files:             readerFiles,
+		},
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.compressor, func(t *testing.T) {
+			r, err := NewRPM(RPMMetaData{
+				Name:       "reader",
+				Version:    "1.2",
+				Release:    "3",
+				Arch:       "x86_64",
+				Compressor: tc.compressor,
+				Summary:    "summary",
+			})
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			r.AddFile(RPMFile{Name: "/usr/share/reader/file", Body: []byte("content"), Mode: 0644})
+			got, err := ReadRPMInfo(bytes.NewReader(buildRPM(t, r)))
+			if err != nil {
+				t.Fatalf("ReadRPMInfo returned error %v", err)
+			}
+			if d := cmp.Diff(&tc.want, got); d != "" {
+				t.Errorf("ReadRPMInfo unexpected value (want->got):\n%s", d)
+			}
+		})
+	}
+}
+
+func TestReadRPMInfoFiles(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "files", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/etc/files", Mode: 040750, Owner: "root", Group: "wheel", MTime: 1000})
+	r.AddFile(RPMFile{Name: "/etc/files/config", Body: []byte("a=b\n"), Mode: 0640, Owner: "root", Group: "wheel", MTime: 2000, Type: ConfigFile | NoReplaceFile})
+	r.AddFile(RPMFile{Name: "/etc/files/link", Body: []byte("config"), Mode: 0120777, Owner: "root", Group: "root", MTime: 3000})
+	r.AddFile(RPMFile{Name: "/var/log/files.log", Mode: 0644, Owner: "nobody", Group: "nobody", Type: GhostFile, NoVerify: VerifyDigest | VerifySize | VerifyMTime})
+	info, err := ReadRPMInfo(bytes.NewReader(buildRPM(t, r)))
+	if err != nil {
+		t.Fatalf("ReadRPMInfo returned error %v", err)
+	}
+	want := []FileInfo{{
+		RPMFile: RPMFile{Name: "/etc/files", Mode: 040750, Owner: "root", Group: "wheel", MTime: 1000},
+		Size:    4096,
+	}, {
+		RPMFile: RPMFile{Name: "/etc/files/config", Mode: 0100640, Owner: "root", Group: "wheel", MTime: 2000, Type: ConfigFile | NoReplaceFile},
+		Size:    4,
+		Digest:  "77e7ce77c707a8147bb65a710ac1af3fca02c8dd2be36762ec9611d90fb5c041",
+	}, {
+		RPMFile: RPMFile{Name: "/etc/files/link", Body: []byte("config"), Mode: 0120777, Owner: "root", Group: "root", MTime: 3000},
+		Size:    6,
+		LinkTo:  "config",
+	}, {
+		RPMFile: RPMFile{Name: "/var/log/files.log", Mode: 0100644, Owner: "nobody", Group: "nobody", Type: GhostFile, NoVerify: VerifyDigest | VerifySize | VerifyMTime},
+	}}
+	if d := cmp.Diff(want, info.Files); d != "" {
+		t.Errorf("ReadRPMInfo files differ (want->got):\n%s", d)
+	}
+}
+
+func TestReadRPMInfoNotRPM(t *testing.T) {
+	if _, err := ReadRPMInfo(bytes.NewReader(make([]byte, 0x100))); err != ErrNotRPM {
+		t.Errorf("ReadRPMInfo returned error %v, want %v", err, ErrNotRPM)
+	}
+}
+
+func TestReadIndexLimits(t *testing.T) {
+	intro := func(count, size uint32, eigen int32) []byte {
+		b := []byte{0x8e, 0xad, 0xe8, 0x01, 0, 0, 0, 0}
+		b = append(b, byte(count>>24), byte(count>>16), byte(count>>8), byte(count))
+		b = append(b, byte(size>>24), byte(size>>16), byte(size>>8), byte(size))
+		return append(b, byte(eigen>>24), byte(eigen>>16), byte(eigen>>8), byte(eigen), 0, 0, 0, 7, 0, 0, 0, 0, 0, 0, 0, 16)
+	}
+	for _, tc := range []struct {
+		name    string
+		b       []byte
+		wantBad bool
+	}{
+		{"huge count", intro(0x7fffffff, 16, immutable)[:16], true},
+		{"huge size", intro(1, 0x7fffffff, immutable), true},
+		{"signature count", intro(64, 16, signatures), true},
+		{"signature size", intro(1, signatureMaxData+1, signatures), true},
+		{"truncated records", intro(1000, 16, immutable), false},
+		{"truncated data", intro(1, signatureMaxData, signatures), false},
+	} {
+		_, _, err := readIndex(bytes.NewReader(tc.b))
+		if err == nil {
+			t.Errorf("%s: readIndex returned no error", tc.name)
+			continue
+		}
+		if got := errors.Cause(err) == ErrBadHeader; got != tc.wantBad {
+			t.Errorf("%s: readIndex returned error %v, want ErrBadHeader: %v", tc.name, err, tc.wantBad)
+		}
+	}
+}
+
+// readHeader returns the main header of an rpm file.
+func TestReadPackage(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "reader", Version: "1.0", Release: "1", Arch: "aarch64", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/share/reader/file", Body: []byte("content"), Mode: 0644})
+	r.AddCustomTag(0x1f40, EntryBytes([]byte{1, 2, 3}))
+	p, err := ReadPackage(bytes.NewReader(buildRPM(t, r)))
+	if err != nil {
+		t.Fatalf("ReadPackage returned error %v", err)
+	}
+	wantLead := Lead{Major: 3, Name: "reader-1.0-1", ArchNum: 19, OSNum: 1, SignatureType: 5}
+	if d := cmp.Diff(wantLead, p.Lead); d != "" {
+		t.Errorf("ReadPackage: Lead differs (-want +got):\n%s", d)
+	}
+	if got := p.Signature.Type(sigSHA256); got != "STRING" {
+		t.Errorf("signature SHA256 has type %q, want STRING", got)
+	}
+	h := p.Header
+	if got := h.String(tagName); got != "reader" {
+		t.Errorf("NAME = %q, want reader", got)
+	}
+	if got := h.Strings(tagBasenames); !cmp.Equal(got, []string{"file"}) {
+		t.Errorf("BASENAMES = %q, want [file]", got)
+	}
+	if got := h.Ints(tagSize); !cmp.Equal(got, []uint64{7}) {
+		t.Errorf("SIZE = %v, want [7]", got)
+	}
+	if got := h.Ints(tagFileModes); !cmp.Equal(got, []uint64{0100644}) {
+		t.Errorf("FILEMODES = %v, want [0100644]", got)
+	}
+	if got := h.Bytes(0x1f40); !cmp.Equal(got, []byte{1, 2, 3}) {
+		t.Errorf("custom tag = %v, want [1 2 3]", got)
+	}
+	if got := h.Ints(tagName); got != nil {
+		t.Errorf("Ints(NAME) = %v, want nil", got)
+	}
+	if got := h.Type(tagSourcePackage); got != "" {
+		t.Errorf("Type(SOURCEPACKAGE) = %q, want none", got)
+	}
+	if info, err := p.Info(); err != nil || info.Name != "reader" || len(info.Files) != 1 {
+		t.Errorf("Info() = %+v, %v, want the reader package", info, err)
+	}
+
+	s, err := NewSourceRPM(RPMMetaData{Name: "reader", Version: "1.0", Release: "1", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewSourceRPM returned error %v", err)
+	}
+	s.AddSpec(RPMFile{Name: "reader.spec", Body: []byte("Name: reader")})
+	p, err = ReadPackage(bytes.NewReader(buildRPM(t, s)))
+	if err != nil {
+		t.Fatalf("ReadPackage returned error %v", err)
+	}
+	if !p.Lead.Source {
+		t.Error("the lead of a source rpm is not read as a source rpm")
+	}
+}
+
+func readHeader(t *testing.T, b []byte) *index {
+	t.Helper()
+	rd := bytes.NewReader(b)
+	if _, err := readLead(rd); err != nil {
+		t.Fatalf("readLead returned error %v", err)
+	}
+	if _, err := readSignatures(rd); err != nil {
+		t.Fatalf("readSignatures returned error %v", err)
+	}
+	h, _, err := readIndex(rd)
+	if err != nil {
+		t.Fatalf("readIndex returned error %v", err)
+	}
+	return h
+}
+
+// readPayload returns the (compressed) payload of the rpm file b.
+func readPayload(t *testing.T, b []byte) []byte {
+	t.Helper()
+	rd := bytes.NewReader(b)
+	if _, err := readLead(rd); err != nil {
+		t.Fatalf("readLead returned error %v", err)
+	}
+	if _, err := readSignatures(rd); err != nil {
+		t.Fatalf("readSignatures returned error %v", err)
+	}
+	if _, _, err := readIndex(rd); err != nil {
+		t.Fatalf("readIndex returned error %v", err)
+	}
+	return b[len(b)-rd.Len():]
+}
+
+// archivedFile is an entry of a cpio payload, with its content.
+type archivedFile struct {
+	*cpio.Header
+	Body []byte
+}
+
+// readArchive returns the entries of the uncompressed payload of the rpm
+// file b, which must have been written with the "none" compressor.
+func readArchive(t *testing.T, b []byte) []archivedFile {
+	t.Helper()
+	c := cpio.NewReader(bytes.NewReader(readPayload(t, b)))
+	var files []archivedFile
+	for {
+		h, err := c.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatalf("failed to read payload entry: %v", err)
+		}
+		body, err := ioutil.ReadAll(c)
+		if err != nil {
+			t.Fatalf("failed to read payload file %s: %v", h.Name, err)
+		}
+		files = append(files, archivedFile{h, body})
+	}
+}
@@ -0,0 +1,318 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+// Repository builds the metadata of a yum/dnf repository, like createrepo_c:
+// the primary.xml, filelists.xml and other.xml files and the repomd.xml index
+// of the repodata directory.
+type Repository struct {
+	// Time is the revision and the timestamp of the metadata files,
+	// SOURCE_DATE_EPOCH or time.Now() if not set.
+	Time time.Time
+	// Signer, if set, signs repomd.xml to repomd.xml.asc, which dnf checks
+	// with repo_gpgcheck.
+	Signer   Signer
+	packages []repoPackage
+}
+
+type repoPackage struct {
+	*written
+	href string
+}
+
+// NewRepository returns an empty repository.
+func NewRepository() *Repository {
+	return &Repository{}
+}
+
+// Add adds an rpm built by Write at href, the location of the rpm file
+// relative to the root of the repository, like "Packages/foo-1.0-1.x86_64.rpm".
+func (r *Repository) Add(p *RPM, href string) error {
+	if p.written == nil {
+		return ErrNotWritten
+	}
+	r.packages = append(r.packages, repoPackage{p.written, href})
+	return nil
+}
+
+// AddFile adds an rpm file read from rd at href, see Add.
+func (r *Repository) AddFile(rd io.Reader, href string) error {
+	digest := sha256.New()
+	cr := &countingReader{r: io.TeeReader(rd, digest)}
+	if _, err := readLead(cr); err != nil {
+		return errors.Wrapf(err, "failed to read %s", href)
+	}
+	s, err := readSignatures(cr)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read %s", href)
+	}
+	start := cr.n
+	h, _, err := readIndex(cr)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read the header of %s", href)
+	}
+	end := cr.n
+	if _, err := io.Copy(ioutil.Discard, cr); err != nil {
+		return errors.Wrapf(err, "failed to read %s", href)
+	}
+	w := &written{
+		signature:   s,
+		header:      h,
+		headerStart: start,
+		headerEnd:   end,
+		size:        cr.n,
+		sha256:      fmt.Sprintf("%x", digest.Sum(nil)),
+	}
+	r.packages = append(r.packages, repoPackage{w, href})
+	return nil
+}
+
+// countingReader counts the bytes read.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type repoFilelists struct {
+	XMLName  xml.Name           `xml:"filelists"`
+	Xmlns    string             `xml:"xmlns,attr"`
+	Count    int                `xml:"packages,attr"`
+	Packages []repoFilesPackage `xml:"package"`
+}
+
+type repoFilesPackage struct {
+	PkgID   string         `xml:"pkgid,attr"`
+	Name    string         `xml:"name,attr"`
+	Arch    string         `xml:"arch,attr"`
+	Version primaryVersion `xml:"version"`
+	Files   []primaryFile  `xml:"file"`
+}
+
+type repoOther struct {
+	XMLName  xml.Name           `xml:"otherdata"`
+	Xmlns    string             `xml:"xmlns,attr"`
+	Count    int                `xml:"packages,attr"`
+	Packages []repoOtherPackage `xml:"package"`
+}
+
+type repoOtherPackage struct {
+	PkgID     string          `xml:"pkgid,attr"`
+	Name      string          `xml:"name,attr"`
+	Arch      string          `xml:"arch,attr"`
+	Version   primaryVersion  `xml:"version"`
+	Changelog []repoChangelog `xml:"changelog"`
+}
+
+type repoChangelog struct {
+	Author string `xml:"author,attr"`
+	Date   uint32 `xml:"date,attr"`
+	Text   string `xml:",chardata"`
+}
+
+type repoPrimary struct {
+	XMLName  xml.Name         `xml:"metadata"`
+	Xmlns    string           `xml:"xmlns,attr"`
+	XmlnsRPM string           `xml:"xmlns:rpm,attr"`
+	Count    int              `xml:"packages,attr"`
+	Packages []primaryPackage `xml:"package"`
+}
+
+type repomd struct {
+	XMLName  xml.Name     `xml:"repomd"`
+	Xmlns    string       `xml:"xmlns,attr"`
+	XmlnsRPM string       `xml:"xmlns:rpm,attr"`
+	Revision int64        `xml:"revision"`
+	Data     []repomdData `xml:"data"`
+}
+
+type repomdData struct {
+	Type         string          `xml:"type,attr"`
+	Checksum     repomdChecksum  `xml:"checksum"`
+	OpenChecksum repomdChecksum  `xml:"open-checksum"`
+	Location     primaryLocation `xml:"location"`
+	Timestamp    int64           `xml:"timestamp"`
+	Size         int             `xml:"size"`
+	OpenSize     int             `xml:"open-size"`
+}
+
+type repomdChecksum struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// Write writes the metadata of the repository to the repodata directory of
+// dir, the root of the repository, which is created if needed. The metadata
+// files are gzip compressed and named after their SHA256, like createrepo_c
+// does, so that clients never mix files of different revisions.
+func (r *Repository) Write(dir string) error {
+	packages := make([]repoPackage, len(r.packages))
+	copy(packages, r.packages)
+	sort.SliceStable(packages, func(i, j int) bool {
+		return packages[i].href < packages[j].href
+	})
+	t := r.Time
+	if t.IsZero() {
+		epoch, err := sourceDateEpoch()
+		if err != nil {
+			return err
+		}
+		t = epoch
+	}
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	primary := repoPrimary{
+		Xmlns:    "http://linux.duke.edu/metadata/common",
+		XmlnsRPM: "http://linux.duke.edu/metadata/rpm",
+		Count:    len(packages),
+	}
+	filelists := repoFilelists{Xmlns: "http://linux.duke.edu/metadata/filelists", Count: len(packages)}
+	other := repoOther{Xmlns: "http://linux.duke.edu/metadata/other", Count: len(packages)}
+	for _, p := range packages {
+		pp := p.primaryPackage(p.href)
+		primary.Packages = append(primary.Packages, pp)
+		filelists.Packages = append(filelists.Packages, repoFilesPackage{
+			PkgID:   p.sha256,
+			Name:    pp.Name,
+			Arch:    pp.Arch,
+			Version: pp.Version,
+			Files:   packageFiles(p.header),
+		})
+		op := repoOtherPackage{PkgID: p.sha256, Name: pp.Name, Arch: pp.Arch, Version: pp.Version}
+		times, names, texts := p.header.getUint32s(tagChangelogTime), p.header.getStrings(tagChangelogName), p.header.getStrings(tagChangelogText)
+		// The header has the newest entries first, other.xml the oldest.
+		for i := len(times) - 1; i >= 0; i-- {
+			if i < len(names) && i < len(texts) {
+				op.Changelog = append(op.Changelog, repoChangelog{Author: names[i], Date: times[i], Text: texts[i]})
+			}
+		}
+		other.Packages = append(other.Packages, op)
+	}
+
+	repodata := filepath.Join(dir, "repodata")
+	if err := os.MkdirAll(repodata, 0755); err != nil {
+		return errors.Wrap(err, "failed to create repodata")
+	}
+	md := repomd{
+		Xmlns:    "http://linux.duke.edu/metadata/repo",
+		XmlnsRPM: "http://linux.duke.edu/metadata/rpm",
+		Revision: t.Unix(),
+	}
+	for _, f := range []struct {
+		name string
+		v    interface{}
+	}{
+		{"primary", primary},
+		{"filelists", filelists},
+		{"other", other},
+	} {
+		d, err := writeRepoData(repodata, f.name, f.v, t)
+		if err != nil {
+			return err
+		}
+		md.Data = append(md.Data, d)
+	}
+	b, err := marshalRepoXML(md)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(repodata, "repomd.xml"), b, 0644); err != nil {
+		return errors.Wrap(err, "failed to write repomd.xml")
+	}
+	if r.Signer == nil {
+		return nil
+	}
+	sig, err := r.Signer.Sign(bytes.NewReader(b))
+	if err != nil {
+		return errors.Wrap(err, "failed to sign repomd.xml")
+	}
+	asc := &bytes.Buffer{}
+	aw, err := armor.Encode(asc, "PGP SIGNATURE", nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to armor the signature")
+	}
+	if _, err := aw.Write(sig); err != nil {
+		return errors.Wrap(err, "failed to armor the signature")
+	}
+	if err := aw.Close(); err != nil {
+		return errors.Wrap(err, "failed to armor the signature")
+	}
+	asc.WriteString("\n")
+	return errors.Wrap(ioutil.WriteFile(filepath.Join(repodata, "repomd.xml.asc"), asc.Bytes(), 0644), "failed to write repomd.xml.asc")
+}
+
+// writeRepoData writes a compressed metadata file to repodata, and returns
+// its repomd.xml entry.
+func writeRepoData(repodata, name string, v interface{}, t time.Time) (repomdData, error) {
+	b, err := marshalRepoXML(v)
+	if err != nil {
+		return repomdData{}, err
+	}
+	z := &bytes.Buffer{}
+	// The gzip header has no name nor time, for reproducible metadata.
+	zw := gzip.NewWriter(z)
+	if _, err := zw.Write(b); err != nil {
+		return repomdData{}, errors.Wrapf(err, "failed to compress %s.xml", name)
+	}
+	if err := zw.Close(); err != nil {
+		return repomdData{}, errors.Wrapf(err, "failed to compress %s.xml", name)
+	}
+	sum := fmt.Sprintf("%x", sha256.Sum256(z.Bytes()))
+	href := fmt.Sprintf("repodata/%s-%s.xml.gz", sum, name)
+	if err := ioutil.WriteFile(filepath.Join(repodata, filepath.Base(href)), z.Bytes(), 0644); err != nil {
+		return repomdData{}, errors.Wrapf(err, "failed to write %s.xml", name)
+	}
+	return repomdData{
+		Type:         name,
+		Checksum:     repomdChecksum{Type: "sha256", Value: sum},
+		OpenChecksum: repomdChecksum{Type: "sha256", Value: fmt.Sprintf("%x", sha256.Sum256(b))},
+		Location:     primaryLocation{Href: href},
+		Timestamp:    t.Unix(),
+		Size:         z.Len(),
+		OpenSize:     len(b),
+	}, nil
+}
+
+func marshalRepoXML(v interface{}) ([]byte, error) {
+	b, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal repository metadata")
+	}
+	return append([]byte(xml.Header), append(b, '\n')...), nil
+}
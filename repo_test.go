@@ -0,0 +1,158 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/crypto/openpgp"
+)
+
+func repoRPM(t *testing.T, name string) *RPM {
+	t.Helper()
+	r, err := NewRPM(RPMMetaData{Name: name, Version: "1.0", Release: "1", Arch: "noarch", Summary: "summary", BuildTime: time.Unix(1600000000, 0)})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	if err := r.AddFile(RPMFile{Name: "/usr/share/" + name + "/file", Body: []byte("content")}); err != nil {
+		t.Fatalf("AddFile returned error %v", err)
+	}
+	r.AddChangelog(ChangelogEntry{Time: time.Unix(1500000000, 0), Name: "A <a@example.com>", Text: "- old"})
+	r.AddChangelog(ChangelogEntry{Time: time.Unix(1600000000, 0), Name: "A <a@example.com>", Text: "- new"})
+	return r
+}
+
+func readRepoData(t *testing.T, dir string, d repomdData, v interface{}) {
+	t.Helper()
+	z, err := ioutil.ReadFile(filepath.Join(dir, d.Location.Href))
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", d.Type, err)
+	}
+	if got := fmt.Sprintf("%x", sha256.Sum256(z)); got != d.Checksum.Value || len(z) != d.Size {
+		t.Errorf("%s has checksum %s and size %d, repomd.xml has %s and %d", d.Type, got, len(z), d.Checksum.Value, d.Size)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(z))
+	if err != nil {
+		t.Fatalf("gzip.NewReader returned error %v", err)
+	}
+	b, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("failed to decompress %s: %v", d.Type, err)
+	}
+	if got := fmt.Sprintf("%x", sha256.Sum256(b)); got != d.OpenChecksum.Value || len(b) != d.OpenSize {
+		t.Errorf("%s has open checksum %s and size %d, repomd.xml has %s and %d", d.Type, got, len(b), d.OpenChecksum.Value, d.OpenSize)
+	}
+	if err := xml.Unmarshal(b, v); err != nil {
+		t.Fatalf("failed to parse %s: %v", d.Type, err)
+	}
+}
+
+func TestRepository(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rpmpack")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir returned error %v", err)
+	}
+	defer os.RemoveAll(dir)
+	signer := newTestEntity(t, "signer")
+
+	built := repoRPM(t, "built")
+	buildRPM(t, built)
+	file := buildRPM(t, repoRPM(t, "file"))
+	repo := NewRepository()
+	repo.Time = time.Unix(1700000000, 0)
+	repo.Signer = entitySigner{signer}
+	if err := repo.Add(repoRPM(t, "unbuilt"), "unbuilt.rpm"); err != ErrNotWritten {
+		t.Errorf("Add of an unbuilt rpm returned error %v, want %v", err, ErrNotWritten)
+	}
+	if err := repo.Add(built, "Packages/built-1.0-1.noarch.rpm"); err != nil {
+		t.Fatalf("Add returned error %v", err)
+	}
+	if err := repo.AddFile(bytes.NewReader(file), "Packages/file-1.0-1.noarch.rpm"); err != nil {
+		t.Fatalf("AddFile returned error %v", err)
+	}
+	if err := repo.Write(dir); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "repodata", "repomd.xml"))
+	if err != nil {
+		t.Fatalf("failed to read repomd.xml: %v", err)
+	}
+	sig, err := os.Open(filepath.Join(dir, "repodata", "repomd.xml.asc"))
+	if err != nil {
+		t.Fatalf("failed to open repomd.xml.asc: %v", err)
+	}
+	defer sig.Close()
+	if _, err := openpgp.CheckArmoredDetachedSignature(openpgp.EntityList{signer}, bytes.NewReader(b), sig); err != nil {
+		t.Errorf("invalid signature of repomd.xml: %v", err)
+	}
+	md := repomd{}
+	if err := xml.Unmarshal(b, &md); err != nil {
+		t.Fatalf("failed to parse repomd.xml: %v", err)
+	}
+	if md.Revision != 1700000000 || len(md.Data) != 3 {
+		t.Fatalf("repomd.xml has revision %d and %d files, want 1700000000 and 3", md.Revision, len(md.Data))
+	}
+
+	primary := repoPrimary{}
+	readRepoData(t, dir, md.Data[0], &primary)
+	if len(primary.Packages) != 2 || primary.Count != 2 {
+		t.Fatalf("primary.xml has %d packages, want 2", len(primary.Packages))
+	}
+	for i, want := range []struct {
+		name, href string
+		rpm        []byte
+	}{
+		{"built", "Packages/built-1.0-1.noarch.rpm", buildRPM(t, repoRPM(t, "built"))},
+		{"file", "Packages/file-1.0-1.noarch.rpm", file},
+	} {
+		p := primary.Packages[i]
+		if p.Name != want.name || p.Location.Href != want.href {
+			t.Errorf("package %d is %s at %s, want %s at %s", i, p.Name, p.Location.Href, want.name, want.href)
+		}
+		if sum := fmt.Sprintf("%x", sha256.Sum256(want.rpm)); p.Checksum.Value != sum || p.Size.Package != int64(len(want.rpm)) {
+			t.Errorf("package %s has checksum %s and size %d, want %s and %d", p.Name, p.Checksum.Value, p.Size.Package, sum, len(want.rpm))
+		}
+	}
+	if d := cmp.Diff(primary.Packages[0].Format.HeaderRange, primary.Packages[1].Format.HeaderRange); d != "" {
+		t.Errorf("header ranges of Add and AddFile differ (-built +file):\n%s", d)
+	}
+
+	filelists := repoFilelists{}
+	readRepoData(t, dir, md.Data[1], &filelists)
+	if d := cmp.Diff([]primaryFile{{Name: "/usr/share/file/file"}}, filelists.Packages[1].Files); d != "" {
+		t.Errorf("filelists.xml mismatch (-want +got):\n%s", d)
+	}
+
+	other := repoOther{}
+	readRepoData(t, dir, md.Data[2], &other)
+	var texts []string
+	for _, c := range other.Packages[0].Changelog {
+		texts = append(texts, c.Text)
+	}
+	if d := cmp.Diff([]string{"- old", "- new"}, texts); d != "" {
+		t.Errorf("other.xml changelog mismatch (-want +got):\n%s", d)
+	}
+}
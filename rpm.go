@@ -19,18 +19,25 @@ package rpmpack
 
 import (
 	"bytes"
-	"compress/gzip"
+	"context"
+	"crypto"
+	"crypto/sha1"
 	"crypto/sha256"
+	"crypto/x509"
 	"fmt"
+	"hash"
 	"io"
+	"io/ioutil"
+	"math"
+	"os"
 	"path"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
 
-	cpio "github.com/cavaliercoder/go-cpio"
 	"github.com/pkg/errors"
-	"github.com/ulikunitz/xz"
-	"github.com/ulikunitz/xz/lzma"
 )
 
 var (
@@ -53,29 +60,145 @@ type RPMMetaData struct {
 	URL,
 	Packager,
 	Group,
-	Licence,
-	BuildHost,
+	Licence string
+	// BuildHost is the BUILDHOST of the package. It is never looked up, so
+	// that packages built in ephemeral containers do not carry their random
+	// host names. It is empty by default, or "localhost" with
+	// SOURCE_DATE_EPOCH.
+	BuildHost string
+	// DistTag, DistURL and Platform carry the provenance of the package, like
+	// rpmbuild of a distribution: the dist tag, like "fc32", the URL of the
+	// package in the distribution, and the build platform, like
+	// "x86_64-redhat-linux-gnu". They are only written when set.
+	DistTag,
+	DistURL,
+	Platform string
+	// ModularityLabel is the module stream of the package, like
+	// "nodejs:12:8020020200707094456:a7025d6e". Module tooling rejects
+	// packages of a module without it. It is only written when set.
+	ModularityLabel string
+	// Cookie, OptFlags and SourceRPM are the build cookie, like
+	// "buildhost 1600000000", the compiler flags of the build, and the file
+	// name of the source rpm, as rpmbuild writes them. The source rpm defaults
+	// to N-V-R.src.rpm, Cookie and OptFlags are only written when set.
+	Cookie,
+	OptFlags,
+	SourceRPM string
+	// Prefixes makes the package relocatable, like "/opt/foo", with
+	// "rpm --prefix". All the files must be under one of them.
+	Prefixes []string
+	// Compressor is the payload compression: "gzip" (the default), "lzma", "xz"
+	// "zstd" or "none". gzip, xz and lzma take an optional level, like "xz:9".
 	Compressor string
-	Epoch     uint32
+	// CompressorThreads, if above 1, compresses gzip and zstd payloads on as
+	// many goroutines, in independently compressed chunks that rpm reads as a
+	// single stream. The payload is slightly larger, and does not depend on
+	// the number of threads.
+	CompressorThreads int
+	// CustomCompressor, if set, compresses the payload instead of Compressor.
+	CustomCompressor Compressor
+	// FileDigest is the algorithm of the file digests: "md5", "sha1", "sha256"
+	// (the default) or "sha512".
+	FileDigest string
+	Epoch      uint32
+	// BuildTime is the BUILDTIME of the package, SOURCE_DATE_EPOCH if not set.
+	// It is not written when zero, and must be between 1970 and 2106, the
+	// range of the 32 bit tag.
 	BuildTime time.Time
+	// FileMTime, if set, is the modification time of all of the files instead
+	// of their own MTime, for example SOURCE_DATE_EPOCH for reproducible builds.
+	FileMTime time.Time
 	Provides,
 	Obsoletes,
 	Suggests,
 	Recommends,
+	Supplements,
+	Enhances,
 	Requires,
 	Conflicts Relations
+	// OrderWithRequires are the packages rpm installs before this one, and
+	// erases after it, when they are in the same transaction, like
+	// "OrderWithRequires:" in a spec file. Unlike Requires, they are only an
+	// ordering hint and do not pull the packages in.
+	OrderWithRequires Relations
+	// NoSelfProvides stops NewRPM from adding the provides rpmbuild adds to
+	// every package, "name = [epoch:]version-release" and, unless the package
+	// is noarch, the same qualified with the ISA of the arch, like
+	// "name(x86-64)". Obsoletes and Conflicts of other packages, and "%{?_isa}"
+	// requirements, resolve against them.
+	NoSelfProvides bool
+	// AddParentDirs makes Write add a directory entry for every parent directory
+	// of the packaged files that was not added explicitly, so that the package
+	// owns them. The parents of the Prefixes are not added.
+	AddParentDirs bool
+	// DefaultDirMode is the permission mode of the directories added because of
+	// AddParentDirs, 0755 if not set. Explicitly added directories keep their mode.
+	DefaultDirMode uint
+	// DefaultDirOwner and DefaultDirGroup are the owner and group of the
+	// directories added because of AddParentDirs, root if not set.
+	DefaultDirOwner,
+	DefaultDirGroup string
+	// LegacyFileNames additionally writes the full file paths as the flat
+	// OLDFILENAMES array, for ancient consumers that do not read the
+	// basenames/dirnames split. It grows the header, so it is off by default.
+	LegacyFileNames bool
+	// ReservedSpace is the size in bytes of a zero filled RESERVEDSPACE
+	// signature tag. Signatures added later by Resign or rpmsign take their
+	// room from it, so the header and payload do not move in the file.
+	ReservedSpace uint
+	// AutoProvides makes Write scan the executable ELF files of the payload,
+	// and provide the sonames of the shared libraries the way rpmbuild does,
+	// like "libfoo.so.1()(64bit)", so that other packages can require them.
+	AutoProvides bool
+	// AutoRequires makes Write scan the executable files of the payload, and
+	// require the interpreters of scripts, like "/bin/bash", and the libraries
+	// ELF files need, like "libc.so.6(GLIBC_2.34)(64bit)".
+	AutoRequires bool
+	// AutoRequiresExclude are regular expressions of the requirements that
+	// AutoRequires should not add, like `^libfoo\.so`.
+	AutoRequiresExclude []string
+	// FileColors makes Write write the color and the class of every file, like
+	// rpmbuild: the color tells 32 bit ELF files from 64 bit ones, so that the
+	// x86_64 and i686 builds of a package can be installed together, as long
+	// as their other shared files are the same.
+	FileColors bool
+	// RequireFileOwners requires the users and groups owning the files, other
+	// than root, like "user(foo)", as rpm 4.19 does. See AddSysusers.
+	RequireFileOwners bool
+	// ConfigProvides makes Write provide and require
+	// "config(name) = [epoch:]version-release" when the package has %config
+	// files, as rpmbuild does.
+	ConfigProvides bool
+	// StrictHeaders makes Write check the finished headers against the rules
+	// of rpm: the region tags and trailers, the sorting and alignment of the
+	// entries, the types of the known tags and the required tags. Write fails
+	// with ErrNonConformingHeader listing the violations, rather than writing
+	// a package rpm rejects, for example because of a custom tag.
+	StrictHeaders bool
+	// StrictLint makes Write fail with ErrLint, listing the errors Lint finds,
+	// before it reads the files.
+	StrictLint bool
+	// Translations are the Summary and Description in other locales, by
+	// locale, like "de" or "pt_BR". rpm shows them according to LANG.
+	Translations map[string]Translation
 }
 
 // RPM holds the state of a particular rpm file. Please use NewRPM to instantiate it.
+// An RPM without files is a meta package, which only has relations and
+// scriptlets, like a virtual provide or a group of dependencies. Its header
+// has no file tags, and its payload is an empty archive.
 type RPM struct {
 	RPMMetaData
 	di                *dirIndex
-	payload           *bytes.Buffer
-	payloadSize       uint
-	cpio              *cpio.Writer
+	payload           *countingWriter
+	payloadDigest     []byte
+	payloadHead       []byte
+	payloadSize       int64
+	archiveSize       int64
+	cpio              *cpioWriter
 	basenames         []string
 	dirindexes        []uint32
-	filesizes         []uint32
+	filesizes         []int64
 	filemodes         []uint16
 	fileowners        []string
 	filegroups        []string
@@ -83,22 +206,114 @@ type RPM struct {
 	filedigests       []string
 	filelinktos       []string
 	fileflags         []uint32
+	filerdevs         []int16
+	fileinodes        []int32
+	filecaps          []string
+	hasFileCaps       bool
+	filecontexts      []string
+	hasFileContexts   bool
+	filelangs         []string
+	filecolors        []uint32
+	fileclasses       []uint32
+	classdict         []string
+	fileverifyflags   []uint32
+	fileDigest        fileDigest
+	imaSigner         crypto.Signer
+	imaKeyID          []byte
+	filesignatures    []string
+	veritySigner      crypto.Signer
+	verityCert        *x509.Certificate
+	veritysignatures  []string
 	closed            bool
+	written           *written
+	header            *HeaderBlob
+	profile           *Profile
 	compressedPayload io.WriteCloser
+	payloadCompressor string
+	payloadFlags      string
+	archiveDigest     hash.Hash
 	files             map[string]RPMFile
-	prein             string
-	postin            string
-	preun             string
-	postun            string
+	parentDirs        map[string]string
+	hardlinks         map[string]string
+	hardlinkSets      map[string]*hardlinkSet
+	archive           []archiveEntry
+	scriptlets        map[ScriptletType]scriptlet
+	triggers          []Trigger
+	fileTriggers      []FileTrigger
+	changelog         []ChangelogEntry
 	customTags        map[int]IndexEntry
 	customSigs        map[int]IndexEntry
-	pgpSigner         func([]byte) ([]byte, error)
+	pgpSigner         func(io.Reader) ([]byte, error)
+	headerSigner      func([]byte) ([]byte, error)
+	modePolicy        ModePolicy
+	modePolicyStrict  bool
+	userNames         map[uint32]string
+	groupNames        map[uint32]string
+	warn              func(string)
+	sourcePackage     bool
+	specFile          string
+	sources           []string
+	patches           []string
+	// mtimeClamp is SOURCE_DATE_EPOCH, the latest file modification time.
+	mtimeClamp time.Time
+	// fileSums are the file digests computed ahead by digestFiles.
+	fileSums map[string][]byte
+	// progress is the first pass of the payload, before compression.
+	progress *progressWriter
+	// firstPassErr is the error of the first pass, which leaves the payload
+	// half written: every later Write returns it.
+	firstPassErr error
+	// spooled hold the content of the readers that cannot seek, for the
+	// passes after the first one, until Write returns.
+	spooled []*os.File
+	// payloadBuffer holds the compressed payload of the first pass, see
+	// WriteBuffered.
+	payloadBuffer io.ReadSeeker
+}
+
+// Environment variables used as defaults for empty RPMMetaData fields, like
+// the %vendor and %packager macros of rpmbuild.
+const (
+	EnvVendor   = "RPM_VENDOR"
+	EnvPackager = "RPM_PACKAGER"
+)
+
+// EnvSourceDateEpoch marks a reproducible build, see https://reproducible-builds.org/specs/source-date-epoch/.
+const EnvSourceDateEpoch = "SOURCE_DATE_EPOCH"
+
+// sourceDateEpoch returns the time of SOURCE_DATE_EPOCH, or the zero time if
+// it is not set.
+func sourceDateEpoch() (time.Time, error) {
+	v, ok := os.LookupEnv(EnvSourceDateEpoch)
+	if !ok {
+		return time.Time{}, nil
+	}
+	sec, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || sec < 0 {
+		return time.Time{}, errors.Errorf("invalid %s %q, want a non-negative number of seconds", EnvSourceDateEpoch, v)
+	}
+	return time.Unix(sec, 0).UTC(), nil
 }
 
 // NewRPM creates and returns a new RPM struct.
-func NewRPM(m RPMMetaData) (*RPM, error) {
+// An empty Vendor or Packager is taken from the RPM_VENDOR or RPM_PACKAGER
+// environment variable, explicitly set values always win.
+// The build host is never looked up, an empty BuildHost is written as is,
+// or as "localhost" when SOURCE_DATE_EPOCH is set.
+// When SOURCE_DATE_EPOCH is set, it is also the default BuildTime, and file
+// modification times after it are clamped to it, like rpmbuild does with
+// %clamp_mtime_to_source_date_epoch. With the same inputs, Write then
+// produces the same bytes.
+// The options are applied in order, after the fields of m, see Option.
+func NewRPM(m RPMMetaData, opts ...Option) (*RPM, error) {
 	var err error
 
+	o := &options{meta: m}
+	for _, opt := range opts {
+		opt(o)
+	}
+	m = o.meta
+
 	if m.OS == "" {
 		m.OS = "linux"
 	}
@@ -107,43 +322,93 @@ func NewRPM(m RPMMetaData) (*RPM, error) {
 		m.Arch = "noarch"
 	}
 
-	p := &bytes.Buffer{}
-	var z io.WriteCloser
-	switch m.Compressor {
-	case "":
-		m.Compressor = "gzip"
-		fallthrough
-	case "gzip":
-		z, err = gzip.NewWriterLevel(p, 9)
-	case "lzma":
-		z, err = lzma.NewWriter(p)
-	case "xz":
-		z, err = xz.NewWriter(p)
-	default:
-		err = fmt.Errorf("unknown compressor type %s", m.Compressor)
+	if m.Vendor == "" {
+		m.Vendor = os.Getenv(EnvVendor)
+	}
+	if m.Packager == "" {
+		m.Packager = os.Getenv(EnvPackager)
+	}
+	epoch, err := sourceDateEpoch()
+	if err != nil {
+		return nil, err
+	}
+	if !epoch.IsZero() {
+		if m.BuildHost == "" {
+			m.BuildHost = "localhost"
+		}
+		if m.BuildTime.IsZero() {
+			m.BuildTime = epoch
+		}
+	}
+
+	if !m.BuildTime.IsZero() && (m.BuildTime.Unix() < 0 || m.BuildTime.Unix() > math.MaxUint32) {
+		return nil, errors.Errorf("build time %s does not fit in BUILDTIME", m.BuildTime)
+	}
+
+	if err := validateName(m.Name); err != nil {
+		return nil, err
+	}
+	if err := validateVersion("version", m.Version); err != nil {
+		return nil, err
+	}
+	if err := validateVersion("release", m.Release); err != nil {
+		return nil, err
 	}
+
+	// The first pass over the payload only computes its size and digests.
+	// Compressors like xz write their header when they are created, it is
+	// kept for the buffer of WriteBuffered, which is only known later.
+	payloadHead := &bytes.Buffer{}
+	payloadHash := sha256.New()
+	payload := &countingWriter{w: teeHash{payloadHash, payloadHead}}
+	z, compressor, payloadFlags, err := payloadWriter(m, payload)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to create compression writer")
+		return nil, err
 	}
+	payload.w = payloadHash
 
+	if m.FileDigest == "" {
+		m.FileDigest = "sha256"
+	}
+	fd, ok := fileDigests[m.FileDigest]
+	if !ok {
+		return nil, fmt.Errorf("unknown file digest type %s", m.FileDigest)
+	}
+
+	// The digest of the cpio archive before compression, for PAYLOADDIGESTALT.
+	archiveDigest := sha256.New()
+	progress := &progressWriter{w: io.MultiWriter(z, archiveDigest), p: Progress{Phase: PhaseDigest}}
 	rpm := &RPM{
 		RPMMetaData:       m,
+		fileDigest:        fd,
 		di:                newDirIndex(),
-		payload:           p,
+		payload:           payload,
+		payloadHead:       payloadHead.Bytes(),
 		compressedPayload: z,
-		cpio:              cpio.NewWriter(z),
+		payloadCompressor: compressor,
+		payloadFlags:      payloadFlags,
+		archiveDigest:     archiveDigest,
+		progress:          progress,
+		cpio:              newCPIOWriter(progress),
 		files:             make(map[string]RPMFile),
+		parentDirs:        make(map[string]string),
+		hardlinks:         make(map[string]string),
+		scriptlets:        make(map[ScriptletType]scriptlet),
 		customTags:        make(map[int]IndexEntry),
 		customSigs:        make(map[int]IndexEntry),
+		mtimeClamp:        epoch,
 	}
 
 	// A package must provide itself...
-	rpm.Provides.addIfMissing(&Relation{
-		Name:    rpm.Name,
-		Version: rpm.FullVersion(),
-		Sense:   SenseEqual,
-	})
+	for _, rel := range rpm.selfProvides() {
+		rpm.Provides.addIfMissing(rel)
+	}
 
+	for _, f := range o.configure {
+		if err := f(rpm); err != nil {
+			return nil, err
+		}
+	}
 	return rpm, nil
 }
 
@@ -156,32 +421,193 @@ func (r *RPM) FullVersion() string {
 	return r.Version
 }
 
-// Write closes the rpm and writes the whole rpm to an io.Writer
+// evr returns the [epoch:]version[-release] string used in relations.
+func (r *RPM) evr() string {
+	if r.Epoch != 0 {
+		return fmt.Sprintf("%d:%s", r.Epoch, r.FullVersion())
+	}
+	return r.FullVersion()
+}
+
+// selfProvides returns the provides of the package itself, see NoSelfProvides.
+func (r *RPM) selfProvides() Relations {
+	if r.NoSelfProvides {
+		return nil
+	}
+	rels := Relations{{Name: r.Name, Version: r.evr(), Sense: SenseEqual}}
+	if isa := isaName(r.Arch); isa != "" {
+		rels = append(rels, &Relation{Name: fmt.Sprintf("%s(%s)", r.Name, isa), Version: r.evr(), Sense: SenseEqual})
+	}
+	return rels
+}
+
+// FileName returns the conventional file name of the rpm, name-version-release.arch.rpm,
+// or name-version-release.src.rpm for a source rpm.
+// Following rpm, the epoch is not part of the file name.
+func (r *RPM) FileName() string {
+	return r.NEVRA().FileName()
+}
+
+// Write closes the rpm and writes the whole rpm to an io.Writer.
+// The compressed payload is streamed to w, and never held in memory: it is
+// compressed twice, once to compute the header and once to write it, three
+// times when the rpm is signed. The content of the files is read as many times.
 func (r *RPM) Write(w io.Writer) error {
+	return r.write(w, nil)
+}
+
+// WriteCtx is Write, stopping once ctx is done. The context is checked
+// between the files and as the payload is compressed, and its error is
+// returned wrapped, see errors.Cause.
+func (r *RPM) WriteCtx(ctx context.Context, w io.Writer) error {
+	r.progress.ctx = ctx
+	defer func() { r.progress.ctx = nil }()
+	return r.write(w, nil)
+}
+
+// WriteBuffered is Write compressing the payload once rather than twice: the
+// compressed payload of the first pass, which computes the sizes and digests
+// of the headers, is kept in buf, usually a temporary file, and copied after
+// the headers. It is also read back from buf by a header+payload signer.
+// buf needs room for the compressed payload, which is written from its start.
+func (r *RPM) WriteBuffered(w io.Writer, buf io.ReadWriteSeeker) error {
+	if _, err := buf.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, "failed to seek to the start of the payload buffer")
+	}
+	return r.write(w, buf)
+}
+
+func (r *RPM) write(w io.Writer, buf io.ReadWriteSeeker) error {
 	if r.closed {
 		return ErrWriteAfterClose
 	}
-	// Add all of the files, sorted alphabetically.
-	fnames := []string{}
-	for fn := range r.files {
-		fnames = append(fnames, fn)
-	}
-	sort.Strings(fnames)
-	for _, fn := range fnames {
-		if err := r.writeFile(r.files[fn]); err != nil {
-			return errors.Wrapf(err, "failed to write file %q", fn)
+	defer r.removeSpooled()
+	if buf != nil {
+		if _, err := buf.Write(r.payloadHead); err != nil {
+			return errors.Wrap(err, "failed to write the payload buffer")
 		}
+		r.payload.w = teeHash{r.payload.w.(hash.Hash), buf}
+		r.payloadBuffer = buf
 	}
-	if err := r.cpio.Close(); err != nil {
-		return errors.Wrap(err, "failed to close cpio payload")
+	hb, s, err := r.buildHeaders()
+	if err != nil {
+		return err
 	}
-	if err := r.compressedPayload.Close(); err != nil {
-		return errors.Wrap(err, "failed to close gzip payload")
+	sb, err := s.Bytes()
+	if err != nil {
+		return errors.Wrap(err, "failed to retrieve signatures header")
+	}
+	if r.StrictHeaders {
+		if err := checkHeaders(sb, hb); err != nil {
+			return err
+		}
+	}
+	size := int64(len(hb)) + r.payload.n
+	if err := r.checkSizeSignatures(s, size); err != nil {
+		return err
 	}
 
-	if _, err := w.Write(lead(r.Name, r.FullVersion())); err != nil {
+	// The rpm file is hashed and counted for its repository metadata.
+	digest := sha256.New()
+	cw := &countingWriter{w: io.MultiWriter(w, digest)}
+	if _, err := cw.Write(lead(r.Name, r.FullVersion(), r.Arch, r.OS, r.sourcePackage)); err != nil {
 		return errors.Wrap(err, "failed to write lead")
 	}
+	if _, err := cw.Write(sb); err != nil {
+		return errors.Wrap(err, "failed to write signature bytes")
+	}
+	if _, err := cw.Write(signaturePadding(len(sb))); err != nil {
+		return errors.Wrap(err, "failed to write signature padding")
+	}
+	headerStart := cw.n
+	if _, err := cw.Write(hb); err != nil {
+		return errors.Wrap(err, "failed to write header body")
+	}
+	r.closed = true
+	if err := r.copyPayload(cw); err != nil {
+		return errors.Wrap(err, "failed to write payload")
+	}
+	if n := cw.n - headerStart; n != size {
+		return errors.Wrapf(ErrSizeMismatch, "wrote %d bytes of header and payload, SIZE is %d", n, size)
+	}
+	h, _, err := readIndex(bytes.NewReader(hb))
+	if err != nil {
+		return errors.Wrap(err, "failed to read back the header")
+	}
+	r.written = &written{
+		signature:   s,
+		header:      h,
+		headerStart: headerStart,
+		headerEnd:   headerStart + int64(len(hb)),
+		size:        cw.n,
+		sha256:      fmt.Sprintf("%x", digest.Sum(nil)),
+	}
+	return nil
+}
+
+// buildHeaders runs the first pass over the payload, unless the header was
+// finalized already, and returns the bytes of the regular header and the
+// signature header.
+func (r *RPM) buildHeaders() ([]byte, *index, error) {
+	h, err := r.FinalizeHeader()
+	if err != nil {
+		return nil, nil, err
+	}
+	// Write the signatures
+	s := newIndex(signatures)
+	if err := r.writeSignatures(s, h.Bytes, h.SHA256); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to create signatures")
+	}
+
+	s.AddEntries(r.customSigs)
+	return h.Bytes, s, nil
+}
+
+// HeaderBlob is the header of an rpm, returned by FinalizeHeader.
+type HeaderBlob struct {
+	// Bytes is the immutable header region, which a header-only (RSAHEADER)
+	// signature signs.
+	Bytes []byte
+	// SHA256 is the digest of Bytes, as in the SHA256 signature tag.
+	SHA256 []byte
+}
+
+// FinalizeHeader runs the first pass over the payload and returns the header
+// of the rpm, so that it can be signed out of band by infrastructure without
+// access to the payload, see SetHeaderSignature. Write then writes the same
+// header: changes to r after FinalizeHeader are not part of the rpm.
+func (r *RPM) FinalizeHeader() (HeaderBlob, error) {
+	if r.closed {
+		return HeaderBlob{}, ErrWriteAfterClose
+	}
+	if r.header != nil {
+		return *r.header, nil
+	}
+	if r.firstPassErr != nil {
+		return HeaderBlob{}, r.firstPassErr
+	}
+	if r.StrictLint {
+		if err := r.checkLint(); err != nil {
+			return HeaderBlob{}, err
+		}
+	}
+	if err := r.checkSummary(); err != nil {
+		return HeaderBlob{}, err
+	}
+	if err := r.writeFirstPass(); err != nil {
+		return HeaderBlob{}, err
+	}
+	if r.AutoProvides || r.AutoRequires {
+		if err := r.addAutoDeps(); err != nil {
+			return HeaderBlob{}, err
+		}
+	}
+	if r.FileColors {
+		if err := r.addFileColors(); err != nil {
+			return HeaderBlob{}, err
+		}
+	}
+
 	// Write the regular header.
 	h := newIndex(immutable)
 	r.writeGenIndexes(h)
@@ -192,67 +618,254 @@ func (r *RPM) Write(w io.Writer) error {
 		r.writeFileIndexes(h)
 	}
 
+	if r.RequireFileOwners {
+		r.addOwnerRequirements()
+	}
+	if r.ConfigProvides {
+		r.addConfigProvide()
+	}
+	r.addRPMLibRequirements()
+	if err := r.checkProfile(); err != nil {
+		return HeaderBlob{}, err
+	}
 	if err := r.writeRelationIndexes(h); err != nil {
-		return err
+		return HeaderBlob{}, err
 	}
 	// CustomTags must be the last to be added, because they can overwrite values.
 	h.AddEntries(r.customTags)
-	hb, err := h.Bytes()
-	if err != nil {
-		return errors.Wrap(err, "failed to retrieve header")
+	h.addI18NTable()
+	// The header digest is computed while the header is generated.
+	hbuf := &bytes.Buffer{}
+	hsha := sha256.New()
+	if _, err := h.WriteTo(io.MultiWriter(hbuf, hsha)); err != nil {
+		return HeaderBlob{}, errors.Wrap(err, "failed to retrieve header")
 	}
-	// Write the signatures
-	s := newIndex(signatures)
-	if err := r.writeSignatures(s, hb); err != nil {
-		return errors.Wrap(err, "failed to create signatures")
+	r.header = &HeaderBlob{Bytes: hbuf.Bytes(), SHA256: hsha.Sum(nil)}
+	return *r.header, nil
+}
+
+// writeFirstPass writes the payload, computing the size and digests of the
+// payload and its files for the headers.
+func (r *RPM) writeFirstPass() error {
+	if err := r.checkSourcePackage(); err != nil {
+		return err
+	}
+	if r.AddParentDirs {
+		r.addParentDirs()
+	}
+	if err := r.applyModePolicy(); err != nil {
+		return err
+	}
+	if err := r.checkPrefixes(); err != nil {
+		return err
+	}
+	if err := r.resolveOwners(); err != nil {
+		return err
+	}
+	// Add all of the files, sorted alphabetically.
+	fnames := []string{}
+	for fn := range r.files {
+		fnames = append(fnames, fn)
+	}
+	sort.Strings(fnames)
+	if err := r.prepareHardlinks(fnames); err != nil {
+		return err
 	}
+	if err := r.writeFiles(fnames); err != nil {
+		r.firstPassErr = err
+		r.removeSpooled()
+		return err
+	}
+	return nil
+}
 
-	s.AddEntries(r.customSigs)
-	sb, err := s.Bytes()
-	if err != nil {
-		return errors.Wrap(err, "failed to retrieve signatures header")
+// removeSpooled removes the temporary files of the content of the readers.
+func (r *RPM) removeSpooled() {
+	for _, f := range r.spooled {
+		f.Close()
+		os.Remove(f.Name())
 	}
+	r.spooled = nil
+}
 
-	if _, err := w.Write(sb); err != nil {
-		return errors.Wrap(err, "failed to write signature bytes")
+// writeFiles writes the files to the payload. Once it fails, the payload
+// and the compressor are left half written.
+func (r *RPM) writeFiles(fnames []string) error {
+	r.fileSums = r.digestFiles(fnames)
+	for _, fn := range fnames {
+		if err := r.writeFile(r.files[fn]); err != nil {
+			abortCompressor(r.compressedPayload)
+			return errors.Wrapf(err, "failed to write file %q", fn)
+		}
 	}
-	//Signatures are padded to 8-byte boundaries
-	if _, err := w.Write(make([]byte, (8-len(sb)%8)%8)); err != nil {
-		return errors.Wrap(err, "failed to write signature padding")
+	if err := r.cpio.Close(); err != nil {
+		return errors.Wrap(err, "failed to close cpio payload")
 	}
-	if _, err := w.Write(hb); err != nil {
-		return errors.Wrap(err, "failed to write header body")
+	if err := r.progress.done(); err != nil {
+		abortCompressor(r.compressedPayload)
+		return err
+	}
+	r.archiveSize = r.progress.p.Bytes
+	if err := r.compressedPayload.Close(); err != nil {
+		return errors.Wrap(err, "failed to close compressed payload")
+	}
+	if r.payload.err != nil {
+		return errors.Wrap(r.payload.err, "failed to digest payload")
+	}
+	r.payloadDigest = r.payload.w.(hash.Hash).Sum(nil)
+	return nil
+}
+
+// checkSummary validates Summary and Description, and defaults an empty
+// Description to the Summary. Some repositories reject packages without them.
+// The Summary is a single line, the Description can span several lines and use
+// tabs, neither can have other control characters like NUL, which would also
+// cut the string in the header.
+func (r *RPM) checkSummary() error {
+	if r.Summary == "" {
+		return errors.New("invalid summary: summary is empty")
+	}
+	if err := checkSummaryText(r.Summary); err != nil {
+		return err
+	}
+	if r.Description == "" {
+		r.Description = r.Summary
+	}
+	if err := checkDescriptionText(r.Description); err != nil {
+		return err
+	}
+	return r.checkTranslations()
+}
+
+func checkSummaryText(s string) error {
+	for _, c := range s {
+		if unicode.IsControl(c) {
+			return errors.Errorf("invalid summary %q: control character %q is not allowed", s, c)
+		}
+	}
+	return nil
+}
+
+func checkDescriptionText(s string) error {
+	for _, c := range s {
+		if unicode.IsControl(c) && c != '\n' && c != '\t' {
+			return errors.Errorf("invalid description: control character %q is not allowed", c)
+		}
+	}
+	return nil
+}
+
+// checkPrefixes checks that the prefixes are clean absolute paths, and that
+// all of the files are under one of them, since rpm can only relocate those.
+func (r *RPM) checkPrefixes() error {
+	if len(r.Prefixes) == 0 {
+		return nil
+	}
+	for _, p := range r.Prefixes {
+		if !path.IsAbs(p) || path.Clean(p) != p || p == "/" {
+			return errors.Errorf("invalid prefix %q: it must be a clean absolute path, other than /", p)
+		}
+	}
+	for fn := range r.files {
+		if !r.underPrefixes(fn) {
+			return errors.Errorf("file %q is not under any of the prefixes %q", fn, r.Prefixes)
+		}
+	}
+	return nil
+}
+
+// underPrefixes reports whether fn is one of the prefixes or under one of
+// them, or whether the package is not relocatable.
+func (r *RPM) underPrefixes(fn string) bool {
+	if len(r.Prefixes) == 0 {
+		return true
+	}
+	for _, p := range r.Prefixes {
+		if fn == p || strings.HasPrefix(fn, p+"/") {
+			return true
+		}
 	}
-	_, err = w.Write(r.payload.Bytes())
-	return errors.Wrap(err, "failed to write payload")
+	return false
+}
 
+// signaturePadding returns the padding that follows a signature header of
+// n bytes. The signature header is padded to an 8-byte boundary, and the
+// padding is always 0x00 so that the output is byte-for-byte reproducible.
+func signaturePadding(n int) []byte {
+	return make([]byte, (8-n%8)%8)
 }
 
 // SetPGPSigner registers a function that will accept the header and payload as bytes,
 // and return a signature as bytes. The function should simulate what gpg does,
 // probably by using golang.org/x/crypto/openpgp or by forking a gpg process.
+// The payload is held in memory for f, SetSigner streams it instead.
 func (r *RPM) SetPGPSigner(f func([]byte) ([]byte, error)) {
-	r.pgpSigner = f
+	r.pgpSigner = func(data io.Reader) ([]byte, error) {
+		b, err := ioutil.ReadAll(data)
+		if err != nil {
+			return nil, err
+		}
+		return f(b)
+	}
 }
 
 // Only call this after the payload and header were written.
-func (r *RPM) writeSignatures(sigHeader *index, regHeader []byte) error {
-	sigHeader.Add(sigSize, EntryInt32([]int32{int32(r.payload.Len() + len(regHeader))}))
-	sigHeader.Add(sigSHA256, EntryString(fmt.Sprintf("%x", sha256.Sum256(regHeader))))
-	sigHeader.Add(sigPayloadSize, EntryInt32([]int32{int32(r.payloadSize)}))
+// headerSHA256 is the digest of regHeader.
+func (r *RPM) writeSignatures(sigHeader *index, regHeader, headerSHA256 []byte) error {
+	r.writeSizeSignatures(sigHeader, r.payload.n+int64(len(regHeader)))
+	sigHeader.Add(sigSHA256, EntryString(fmt.Sprintf("%x", headerSHA256)))
+	if r.profile != nil && r.profile.headerSHA1 {
+		sigHeader.Add(sigSHA1, EntryString(fmt.Sprintf("%x", sha1.Sum(regHeader))))
+	}
+	if r.ReservedSpace > 0 {
+		sigHeader.Add(sigReservedSpace, EntryBytes(make([]byte, r.ReservedSpace)))
+	}
+	r.writeVeritySignatureIndexes(sigHeader)
+	if r.headerSigner != nil {
+		s, err := r.headerSigner(regHeader)
+		if err != nil {
+			return errors.Wrap(err, "call to header signer failed")
+		}
+		tag, _ := signatureTags(s)
+		sigHeader.Add(tag, EntryBytes(s))
+	}
 	if r.pgpSigner != nil {
-		body := append([]byte{}, regHeader...)
-		body = append(body, r.payload.Bytes()...)
-		s, err := r.pgpSigner(body)
+		// The payload is written again for the signer, as it reads.
+		pr, pw := io.Pipe()
+		done := make(chan error, 1)
+		go func() {
+			err := r.copyPayload(pw)
+			pw.CloseWithError(err)
+			done <- err
+		}()
+		s, err := r.pgpSigner(io.MultiReader(bytes.NewReader(regHeader), pr))
+		// Stop the payload if the signer did not read all of it, and wait for
+		// it to be done with the content of the files.
+		pr.Close()
+		if perr := <-done; perr != nil && perr != io.ErrClosedPipe {
+			return errors.Wrap(perr, "failed to write payload for the signer")
+		}
 		if err != nil {
 			return errors.Wrap(err, "call to signer failed")
 		}
-		sigHeader.Add(sigPGP, EntryBytes(s))
+		_, tag := signatureTags(s)
+		sigHeader.Add(tag, EntryBytes(s))
 	}
 	return nil
 }
 
 func (r *RPM) writeRelationIndexes(h *index) error {
+	// rpm only accepts rich dependencies in requires, conflicts and the weak
+	// dependencies.
+	if err := r.Provides.checkNoRich(); err != nil {
+		return errors.Wrap(err, "failed to add provides")
+	}
+	if err := r.Obsoletes.checkNoRich(); err != nil {
+		return errors.Wrap(err, "failed to add obsoletes")
+	}
+	if err := r.OrderWithRequires.checkNoRich(); err != nil {
+		return errors.Wrap(err, "failed to add order")
+	}
 	// add all relation categories
 	if err := r.Provides.AddToIndex(h, tagProvides, tagProvideVersion, tagProvideFlags); err != nil {
 		return errors.Wrap(err, "failed to add provides")
@@ -266,73 +879,166 @@ func (r *RPM) writeRelationIndexes(h *index) error {
 	if err := r.Recommends.AddToIndex(h, tagRecommends, tagRecommendVersion, tagRecommendFlags); err != nil {
 		return errors.Wrap(err, "failed to add recommends")
 	}
+	if err := r.Supplements.AddToIndex(h, tagSupplements, tagSupplementVersion, tagSupplementFlags); err != nil {
+		return errors.Wrap(err, "failed to add supplements")
+	}
+	if err := r.Enhances.AddToIndex(h, tagEnhances, tagEnhanceVersion, tagEnhanceFlags); err != nil {
+		return errors.Wrap(err, "failed to add enhances")
+	}
 	if err := r.Requires.AddToIndex(h, tagRequires, tagRequireVersion, tagRequireFlags); err != nil {
 		return errors.Wrap(err, "failed to add requires")
 	}
 	if err := r.Conflicts.AddToIndex(h, tagConflicts, tagConflictVersion, tagConflictFlags); err != nil {
 		return errors.Wrap(err, "failed to add conflicts")
 	}
+	if err := r.OrderWithRequires.AddToIndex(h, tagOrderName, tagOrderVersion, tagOrderFlags); err != nil {
+		return errors.Wrap(err, "failed to add order")
+	}
+
+	return nil
+}
+
+// RequiresPre adds a requirement needed when running the %pre scriptlet,
+// the equivalent of "Requires(pre):" in a spec file.
+func (r *RPM) RequiresPre(rel *Relation) {
+	r.addScriptRequirement(rel, SenseScriptPre)
+}
+
+// RequiresPost adds a requirement needed when running the %post scriptlet,
+// the equivalent of "Requires(post):" in a spec file.
+func (r *RPM) RequiresPost(rel *Relation) {
+	r.addScriptRequirement(rel, SenseScriptPost)
+}
+
+// RequiresPreun adds a requirement needed when running the %preun scriptlet,
+// the equivalent of "Requires(preun):" in a spec file.
+func (r *RPM) RequiresPreun(rel *Relation) {
+	r.addScriptRequirement(rel, SenseScriptPreun)
+}
+
+// RequiresPostun adds a requirement needed when running the %postun scriptlet,
+// the equivalent of "Requires(postun):" in a spec file.
+func (r *RPM) RequiresPostun(rel *Relation) {
+	r.addScriptRequirement(rel, SenseScriptPostun)
+}
+
+// RequiresPretrans adds a requirement needed when running the %pretrans
+// scriptlet, the equivalent of "Requires(pretrans):" in a spec file.
+func (r *RPM) RequiresPretrans(rel *Relation) {
+	r.addScriptRequirement(rel, SensePretrans)
+}
+
+// RequiresPosttrans adds a requirement needed when running the %posttrans
+// scriptlet, the equivalent of "Requires(posttrans):" in a spec file.
+func (r *RPM) RequiresPosttrans(rel *Relation) {
+	r.addScriptRequirement(rel, SensePosttrans)
+}
 
+// scriptletSenses are the sense flags of the requirements of the scriptlets.
+var scriptletSenses = map[ScriptletType]rpmSense{
+	PreinScriptlet:     SenseScriptPre,
+	PostinScriptlet:    SenseScriptPost,
+	PreunScriptlet:     SenseScriptPreun,
+	PostunScriptlet:    SenseScriptPostun,
+	PretransScriptlet:  SensePretrans,
+	PosttransScriptlet: SensePosttrans,
+}
+
+// RequiresScriptlet adds a requirement needed when running the scriptlets ts,
+// like "Requires(post,preun):" in a spec file, as one requirement with the
+// flags of all of them.
+// A requirement only scoped to scriptlets is not a requirement of the
+// installed package: once the install scriptlets ran, rpm lets the required
+// package be erased, and dnf can remove it as an unneeded dependency. Add
+// rel to Requires too if the package needs it at run time.
+func (r *RPM) RequiresScriptlet(rel *Relation, ts ...ScriptletType) error {
+	var s rpmSense
+	for _, t := range ts {
+		f, ok := scriptletSenses[t]
+		if !ok {
+			return errors.Errorf("unknown scriptlet type %d", t)
+		}
+		s |= f
+	}
+	if s == 0 {
+		return errors.New("no scriptlet to scope the requirement to")
+	}
+	r.addScriptRequirement(rel, s)
 	return nil
 }
 
+func (r *RPM) addScriptRequirement(rel *Relation, s rpmSense) {
+	req := *rel
+	req.Sense |= s
+	r.Requires.addIfMissing(&req)
+}
+
 // AddCustomTag adds or overwrites a tag value in the index.
+// SetTag is the checked alternative.
 func (r *RPM) AddCustomTag(tag int, e IndexEntry) {
 	r.customTags[tag] = e
 }
 
 // AddCustomSig adds or overwrites a signature tag value.
+// SetSignatureTag is the checked alternative.
 func (r *RPM) AddCustomSig(tag int, e IndexEntry) {
 	r.customSigs[tag] = e
 }
 
 func (r *RPM) writeGenIndexes(h *index) {
-	h.Add(tagHeaderI18NTable, EntryString("C"))
-	h.Add(tagSize, EntryInt32([]int32{int32(r.payloadSize)}))
+	r.writeSizeIndexes(h)
 	h.Add(tagName, EntryString(r.Name))
 	h.Add(tagVersion, EntryString(r.Version))
 	h.Add(tagEpoch, EntryUint32([]uint32{r.Epoch}))
-	h.Add(tagSummary, EntryString(r.Summary))
-	h.Add(tagDescription, EntryString(r.Description))
+	r.writeI18NIndexes(h)
 	h.Add(tagBuildHost, EntryString(r.BuildHost))
 	if !r.BuildTime.IsZero() {
 		// time.Time zero value is confusing, avoid if not supplied
 		// see https://github.com/google/rpmpack/issues/43
-		h.Add(tagBuildTime, EntryInt32([]int32{int32(r.BuildTime.Unix())}))
+		// INSTALLTIME is never written, rpm sets it when installing the package.
+		h.Add(tagBuildTime, EntryUint32([]uint32{uint32(r.BuildTime.Unix())}))
 	}
 	h.Add(tagRelease, EntryString(r.Release))
 	h.Add(tagPayloadFormat, EntryString("cpio"))
-	h.Add(tagPayloadCompressor, EntryString(r.Compressor))
-	h.Add(tagPayloadFlags, EntryString("9"))
+	if r.payloadCompressor != "" {
+		h.Add(tagPayloadCompressor, EntryString(r.payloadCompressor))
+	}
+	if r.payloadFlags != "" {
+		h.Add(tagPayloadFlags, EntryString(r.payloadFlags))
+	}
 	h.Add(tagArch, EntryString(r.Arch))
 	h.Add(tagOS, EntryString(r.OS))
 	h.Add(tagVendor, EntryString(r.Vendor))
 	h.Add(tagLicence, EntryString(r.Licence))
 	h.Add(tagPackager, EntryString(r.Packager))
-	h.Add(tagGroup, EntryString(r.Group))
+	h.Add(tagGroup, EntryI18NString(r.Group))
 	h.Add(tagURL, EntryString(r.URL))
-	h.Add(tagPayloadDigest, EntryStringSlice([]string{fmt.Sprintf("%x", sha256.Sum256(r.payload.Bytes()))}))
-	h.Add(tagPayloadDigestAlgo, EntryInt32([]int32{hashAlgoSHA256}))
-
-	// rpm utilities look for the sourcerpm tag to deduce if this is not a source rpm (if it has a sourcerpm,
-	// it is NOT a source rpm).
-	h.Add(tagSourceRPM, EntryString(fmt.Sprintf("%s-%s.src.rpm", r.Name, r.FullVersion())))
-	if r.prein != "" {
-		h.Add(tagPrein, EntryString(r.prein))
-		h.Add(tagPreinProg, EntryString("/bin/sh"))
-	}
-	if r.postin != "" {
-		h.Add(tagPostin, EntryString(r.postin))
-		h.Add(tagPostinProg, EntryString("/bin/sh"))
+	if len(r.Prefixes) > 0 {
+		h.Add(tagPrefixes, EntryStringSlice(r.Prefixes))
 	}
-	if r.preun != "" {
-		h.Add(tagPreun, EntryString(r.preun))
-		h.Add(tagPreunProg, EntryString("/bin/sh"))
-	}
-	if r.postun != "" {
-		h.Add(tagPostun, EntryString(r.postun))
-		h.Add(tagPostunProg, EntryString("/bin/sh"))
+	for _, t := range []struct {
+		tag   int
+		value string
+	}{
+		{tagDistTag, r.DistTag},
+		{tagDistURL, r.DistURL},
+		{tagPlatform, r.Platform},
+		{tagModularityLabel, r.ModularityLabel},
+		{tagCookie, r.Cookie},
+		{tagOptFlags, r.OptFlags},
+	} {
+		if t.value != "" {
+			h.Add(t.tag, EntryString(t.value))
+		}
 	}
+	h.Add(tagPayloadDigest, EntryStringSlice([]string{fmt.Sprintf("%x", r.payloadDigest)}))
+	h.Add(tagPayloadDigestAlgo, EntryInt32([]int32{hashAlgoSHA256}))
+	h.Add(tagPayloadDigestAlt, EntryStringSlice([]string{fmt.Sprintf("%x", r.archiveDigest.Sum(nil))}))
+
+	r.writeSourceIndexes(h)
+	r.writeScriptletIndexes(h)
+	r.writeTriggerIndexes(h)
+	r.writeChangelogIndexes(h)
 }
 
 // WriteFileIndexes writes file related index headers to the header
@@ -340,7 +1046,7 @@ func (r *RPM) writeFileIndexes(h *index) {
 	h.Add(tagBasenames, EntryStringSlice(r.basenames))
 	h.Add(tagDirindexes, EntryUint32(r.dirindexes))
 	h.Add(tagDirnames, EntryStringSlice(r.di.AllDirs()))
-	h.Add(tagFileSizes, EntryUint32(r.filesizes))
+	r.writeFileSizeIndexes(h)
 	h.Add(tagFileModes, EntryUint16(r.filemodes))
 	h.Add(tagFileUserName, EntryStringSlice(r.fileowners))
 	h.Add(tagFileGroupName, EntryStringSlice(r.filegroups))
@@ -348,54 +1054,82 @@ func (r *RPM) writeFileIndexes(h *index) {
 	h.Add(tagFileDigests, EntryStringSlice(r.filedigests))
 	h.Add(tagFileLinkTos, EntryStringSlice(r.filelinktos))
 	h.Add(tagFileFlags, EntryUint32(r.fileflags))
+	h.Add(tagFileVerifyFlags, EntryUint32(r.fileverifyflags))
+	r.writeFileSignatureIndexes(h)
+	r.writeFileCapsIndexes(h)
+	r.writeFileContextIndexes(h)
+	r.writeFileColorIndexes(h)
+	if r.LegacyFileNames {
+		dirs := r.di.AllDirs()
+		names := make([]string, len(r.basenames))
+		for ii, b := range r.basenames {
+			names[ii] = dirs[r.dirindexes[ii]] + b
+		}
+		h.Add(tagOldFileNames, EntryStringSlice(names))
+	}
 
-	inodes := make([]int32, len(r.dirindexes))
 	digestAlgo := make([]int32, len(r.dirindexes))
-	verifyFlags := make([]int32, len(r.dirindexes))
-	fileRDevs := make([]int16, len(r.dirindexes))
-	fileLangs := make([]string, len(r.dirindexes))
-
-	for ii := range inodes {
-		// is inodes just a range from 1..len(dirindexes)? maybe different with hard links
-		inodes[ii] = int32(ii + 1)
-		digestAlgo[ii] = hashAlgoSHA256
-		// With regular files, it seems like we can always enable all of the verify flags
-		verifyFlags[ii] = int32(-1)
-		fileRDevs[ii] = int16(1)
-	}
-	h.Add(tagFileINodes, EntryInt32(inodes))
+
+	for ii := range digestAlgo {
+		digestAlgo[ii] = r.fileDigest.algo
+	}
+	// Hard links share their inode, see prepareHardlinks.
+	h.Add(tagFileINodes, EntryInt32(r.fileinodes))
 	h.Add(tagFileDigestAlgo, EntryInt32(digestAlgo))
-	h.Add(tagFileVerifyFlags, EntryInt32(verifyFlags))
-	h.Add(tagFileRDevs, EntryInt16(fileRDevs))
-	h.Add(tagFileLangs, EntryStringSlice(fileLangs))
+	h.Add(tagFileRDevs, EntryInt16(r.filerdevs))
+	h.Add(tagFileLangs, EntryStringSlice(r.filelangs))
 }
 
 // AddPrein adds a prein sciptlet
 func (r *RPM) AddPrein(s string) {
-	r.prein = s
+	r.addScriptlet(PreinScriptlet, s)
 }
 
 // AddPostin adds a postin sciptlet
 func (r *RPM) AddPostin(s string) {
-	r.postin = s
+	r.addScriptlet(PostinScriptlet, s)
 }
 
 // AddPreun adds a preun sciptlet
 func (r *RPM) AddPreun(s string) {
-	r.preun = s
+	r.addScriptlet(PreunScriptlet, s)
 }
 
 // AddPostun adds a postun sciptlet
 func (r *RPM) AddPostun(s string) {
-	r.postun = s
+	r.addScriptlet(PostunScriptlet, s)
 }
 
-// AddFile adds an RPMFile to an existing rpm.
-func (r *RPM) AddFile(f RPMFile) {
+// AddPretrans adds a pretrans sciptlet
+func (r *RPM) AddPretrans(s string) {
+	r.addScriptlet(PretransScriptlet, s)
+}
+
+// AddPosttrans adds a posttrans sciptlet
+func (r *RPM) AddPosttrans(s string) {
+	r.addScriptlet(PosttransScriptlet, s)
+}
+
+// AddFile adds an RPMFile to an existing rpm. The name must be an absolute
+// path, backslashes are taken as separators and a trailing slash is removed.
+// It returns an error if the path is invalid or already in the package, or
+// if the file conflicts with a directory: a parent of it is not a directory,
+// or it is not a directory and has files under it. Adding the same directory
+// twice is allowed.
+func (r *RPM) AddFile(f RPMFile) error {
+	name, err := cleanPath(f.Name)
+	if err != nil {
+		return err
+	}
+	f.Name = name
 	if f.Name == "/" { // rpm does not allow the root dir to be included.
-		return
+		return nil
 	}
-	r.files[f.Name] = f
+	if err := r.checkPath(f); err != nil {
+		return err
+	}
+	r.putFile(f)
+	return nil
 }
 
 // writeFile writes the file to the indexes and cpio.
@@ -403,45 +1137,177 @@ func (r *RPM) writeFile(f RPMFile) error {
 	dir, file := path.Split(f.Name)
 	r.dirindexes = append(r.dirindexes, r.di.Get(dir))
 	r.basenames = append(r.basenames, file)
+	// Owner and group are independent, each defaults to root.
+	if f.Owner == "" {
+		f.Owner = "root"
+	}
+	if f.Group == "" {
+		f.Group = "root"
+	}
 	r.fileowners = append(r.fileowners, f.Owner)
 	r.filegroups = append(r.filegroups, f.Group)
+	if !r.FileMTime.IsZero() {
+		f.MTime = uint32(r.FileMTime.Unix())
+	} else if !r.mtimeClamp.IsZero() && int64(f.MTime) > r.mtimeClamp.Unix() {
+		f.MTime = uint32(r.mtimeClamp.Unix())
+	}
 	r.filemtimes = append(r.filemtimes, f.MTime)
 	r.fileflags = append(r.fileflags, uint32(f.Type))
+	// With regular files, it seems like we can always enable all of the verify flags
+	r.fileverifyflags = append(r.fileverifyflags, ^uint32(f.NoVerify))
+	if err := r.writeFileCaps(f); err != nil {
+		return err
+	}
+	if err := r.writeFileContext(f); err != nil {
+		return err
+	}
+	if err := r.writeFileLang(f); err != nil {
+		return err
+	}
+
+	// FILERDEVS is only meaningful for devices, (major << 8) | minor.
+	if t := f.Mode & 0170000; t == 020000 || t == 060000 {
+		r.filerdevs = append(r.filerdevs, int16(f.DevMajor<<8|f.DevMinor))
+	} else {
+		r.filerdevs = append(r.filerdevs, 1)
+	}
 
 	links := 1
 	switch {
-	case f.Mode&040000 != 0: // directory
+	case f.Mode&0170000 == 040000: // directory
+		if len(f.Body) != 0 || f.Reader != nil {
+			return errors.Errorf("directory %s cannot have content", f.Name)
+		}
 		r.filesizes = append(r.filesizes, 4096)
-		r.filedigests = append(r.filedigests, "")
 		r.filelinktos = append(r.filelinktos, "")
 		links = 2
 	case f.Mode&0120000 == 0120000: //  symlink
-		r.filesizes = append(r.filesizes, uint32(len(f.Body)))
-		r.filedigests = append(r.filedigests, "")
+		if len(f.Body) == 0 || f.Reader != nil {
+			return errors.Errorf("symlink %s must have its target in Body", f.Name)
+		}
+		r.filesizes = append(r.filesizes, int64(len(f.Body)))
 		r.filelinktos = append(r.filelinktos, string(f.Body))
+	case f.Mode&0170000 == 020000, f.Mode&0170000 == 060000, f.Mode&0170000 == 010000: // device or fifo
+		if len(f.Body) != 0 || f.Reader != nil {
+			return errors.Errorf("special file %s cannot have content", f.Name)
+		}
+		if f.DevMajor > 0xff || f.DevMinor > 0xff {
+			return errors.Errorf("device %s has number %d:%d, rpm only supports numbers below 256", f.Name, f.DevMajor, f.DevMinor)
+		}
+		r.filesizes = append(r.filesizes, 0)
+		r.filelinktos = append(r.filelinktos, "")
+	case f.Type&GhostFile != 0: // ghost file, has no content to digest
+		f.Mode = f.Mode | 0100000
+		r.filesizes = append(r.filesizes, int64(len(f.Body)))
+		r.filelinktos = append(r.filelinktos, "")
 	default: // regular file
 		f.Mode = f.Mode | 0100000
-		r.filesizes = append(r.filesizes, uint32(len(f.Body)))
-		r.filedigests = append(r.filedigests, fmt.Sprintf("%x", sha256.Sum256(f.Body)))
+		r.filemodes = append(r.filemodes, uint16(f.Mode))
 		r.filelinktos = append(r.filelinktos, "")
+		return r.writeRegularFile(f)
 	}
 	r.filemodes = append(r.filemodes, uint16(f.Mode))
-	return r.writePayload(f, links)
+	r.filedigests = append(r.filedigests, "")
+	if err := r.writeFileSignature(nil, false); err != nil {
+		return err
+	}
+	if err := r.writeVeritySignature(nil, false); err != nil {
+		return err
+	}
+	return r.writePayload(archiveEntry{file: f, links: links})
 }
 
-func (r *RPM) writePayload(f RPMFile, links int) error {
-	hdr := &cpio.Header{
-		Name:  f.Name,
-		Mode:  cpio.FileMode(f.Mode),
-		Size:  int64(len(f.Body)),
-		Links: links,
+// writeRegularFile writes the content of a regular file to the payload, and
+// its digests, computed on the way, to the indexes.
+func (r *RPM) writeRegularFile(f RPMFile) error {
+	e := archiveEntry{file: f, links: 1}
+	set := r.hardlinkSets[f.Name]
+	if set != nil {
+		e.links = len(set.names)
+		if f.Name != set.names[len(set.names)-1] {
+			// Only the last file of the set has content, it sets the size and
+			// digests of the others when it is written.
+			e.file.Body, e.file.Reader = nil, nil
+			r.filesizes = append(r.filesizes, 0)
+			r.filedigests = append(r.filedigests, "")
+			if err := r.writeFileSignature(nil, false); err != nil {
+				return err
+			}
+			if err := r.writeVeritySignature(nil, false); err != nil {
+				return err
+			}
+			return r.writePayload(e)
+		}
+	}
+	var spool *os.File
+	if f.Reader != nil {
+		if s, ok := f.Reader.(io.Seeker); ok {
+			off, err := s.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return errors.Wrap(err, "failed to find the start of the file content")
+			}
+			e.offset = off
+		} else {
+			// The content is needed again by the later passes, it is spooled
+			// to a temporary file rather than held in memory.
+			var err error
+			if spool, err = ioutil.TempFile("", "rpmpack-"); err != nil {
+				return errors.Wrap(err, "failed to create a temporary file for the file content")
+			}
+			r.spooled = append(r.spooled, spool)
+			e.file.Reader = io.TeeReader(f.Reader, spool)
+		}
+	}
+	size := e.size()
+	if size < 0 {
+		return errors.Errorf("file %s has an unsupported size %d", f.Name, size)
+	}
+	r.filesizes = append(r.filesizes, size)
+	sum, ok := r.fileSums[f.Name]
+	digest := r.fileDigest.hash.New()
+	var digests []io.Writer
+	if !ok {
+		digests = append(digests, digest)
+	}
+	verity := &verityHasher{}
+	if r.veritySigner != nil {
+		digests = append(digests, verity)
+	}
+	if err := r.writePayload(e, digests...); err != nil {
+		return err
+	}
+	if spool != nil {
+		r.archive[len(r.archive)-1].file.Reader = spool
+	}
+	if !ok {
+		sum = digest.Sum(nil)
+	}
+	r.filedigests = append(r.filedigests, fmt.Sprintf("%x", sum))
+	if err := r.writeFileSignature(sum, true); err != nil {
+		return err
+	}
+	if err := r.writeVeritySignature(verity, true); err != nil {
+		return err
 	}
-	if err := r.cpio.WriteHeader(hdr); err != nil {
-		return errors.Wrap(err, "failed to write payload file header")
+	if set != nil {
+		r.fillHardlinks(set)
 	}
-	if _, err := r.cpio.Write(f.Body); err != nil {
-		return errors.Wrap(err, "failed to write payload file content")
+	return nil
+}
+
+// writePayload writes the entry to the first pass of the payload, and its
+// content to digests. The entry is kept for the later passes.
+func (r *RPM) writePayload(e archiveEntry, digests ...io.Writer) error {
+	// Every file has exactly one entry, in the order of the header.
+	e.index = len(r.archive)
+	e.inode = int64(r.fileinodes[e.index])
+	if err := r.progress.startFile(e.file.Name); err != nil {
+		return err
+	}
+	if err := e.writeTo(r.cpio, digests...); err != nil {
+		return err
 	}
-	r.payloadSize += uint(len(f.Body))
+	r.archive = append(r.archive, e)
+	r.payloadSize += e.size()
 	return nil
 }
@@ -1,12 +1,28 @@
 package rpmpack
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
 	"testing"
+	"time"
+
+	cpio "github.com/cavaliercoder/go-cpio"
+	"github.com/google/go-cmp/cmp"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+	"golang.org/x/crypto/openpgp"
 )
 
 func TestFileOwner(t *testing.T) {
-	r, err := NewRPM(RPMMetaData{})
+	r, err := NewRPM(RPMMetaData{Summary: "summary"})
 	if err != nil {
 		t.Fatalf("NewRPM returned error %v", err)
 	}
@@ -33,7 +49,7 @@ func TestFileOwner(t *testing.T) {
 
 // https://github.com/google/rpmpack/issues/49
 func Test100644(t *testing.T) {
-	r, err := NewRPM(RPMMetaData{})
+	r, err := NewRPM(RPMMetaData{Summary: "summary"})
 	if err != nil {
 		t.Fatalf("NewRPM returned error %v", err)
 	}
@@ -54,3 +70,855 @@ func Test100644(t *testing.T) {
 	}
 
 }
+
+func TestSignaturePadding(t *testing.T) {
+	for _, summary := range []string{"a", "ab", "abc", "abcd", "abcde", "abcdef", "abcdefg", "abcdefgh"} {
+		r, err := NewRPM(RPMMetaData{Name: "padding", Summary: summary})
+		if err != nil {
+			t.Fatalf("NewRPM returned error %v", err)
+		}
+		r.AddFile(RPMFile{Name: "/etc/padding", Body: []byte(summary)})
+		// The signature size depends on the header digest, so vary the header
+		// and sign it with a signature of varying length.
+		r.SetPGPSigner(func([]byte) ([]byte, error) {
+			return []byte(summary), nil
+		})
+		b := buildRPM(t, r)
+		rd := bytes.NewReader(b[0x60:])
+		_, n, err := readIndex(rd)
+		if err != nil {
+			t.Fatalf("readIndex returned error %v", err)
+		}
+		padLen := (8 - n%8) % 8
+		if padding := b[0x60+n : 0x60+n+padLen]; !bytes.Equal(padding, make([]byte, padLen)) {
+			t.Errorf("signature padding for %q is %x, want zeros", summary, padding)
+		}
+		start := 0x60 + n + padLen
+		if start%8 != 0 {
+			t.Errorf("header for %q starts at offset %d, not aligned to 8 bytes", summary, start)
+		}
+		if !bytes.HasPrefix(b[start:], []byte{0x8e, 0xad, 0xe8, 0x01}) {
+			t.Errorf("header for %q does not start right after the signature padding", summary)
+		}
+	}
+}
+
+func TestBuildTime(t *testing.T) {
+	// RPMTAG_INSTALLTIME is set by rpm when installing the package.
+	const tagInstallTime = 0x03f0 // 1008
+	r, err := NewRPM(RPMMetaData{Name: "buildtime", BuildTime: time.Unix(1600000000, 0), Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	h := readHeader(t, buildRPM(t, r))
+	if _, ok := h.entries[tagInstallTime]; ok {
+		t.Errorf("header should not contain INSTALLTIME")
+	}
+	e, ok := h.entries[tagBuildTime]
+	if !ok {
+		t.Fatalf("header should contain BUILDTIME")
+	}
+	if e.rpmtype != typeInt32 || e.count != 1 {
+		t.Errorf("BUILDTIME has type %d and count %d, want a single int32", e.rpmtype, e.count)
+	}
+	if got, want := fmt.Sprintf("%x", e.data), fmt.Sprintf("%08x", 1600000000); got != want {
+		t.Errorf("BUILDTIME = %s, want %s", got, want)
+	}
+}
+
+func TestBuildTimeRange(t *testing.T) {
+	for _, tc := range []struct {
+		buildTime time.Time
+		wantErr   bool
+	}{
+		{time.Unix(0, 0), false},
+		{time.Unix(1<<32-1, 0), false},
+		{time.Unix(-1, 0), true},
+		{time.Unix(1<<32, 0), true},
+	} {
+		_, err := NewRPM(RPMMetaData{Name: "buildtime", BuildTime: tc.buildTime, Summary: "summary"})
+		if gotErr := err != nil; gotErr != tc.wantErr {
+			t.Errorf("NewRPM with BuildTime %d returned error %v, want error %t", tc.buildTime.Unix(), err, tc.wantErr)
+		}
+	}
+}
+
+func TestFileMTimes(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		fileMTime time.Time
+		want      []uint32
+	}{
+		{"per file", time.Time{}, []uint32{1500000000, 1600000000}},
+		{"override", time.Unix(1700000000, 0), []uint32{1700000000, 1700000000}},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewRPM(RPMMetaData{Name: "mtime", Summary: "summary", Compressor: "none", FileMTime: tc.fileMTime})
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			r.AddFile(RPMFile{Name: "/etc/a", Body: []byte("a"), MTime: 1500000000})
+			r.AddFile(RPMFile{Name: "/etc/b", Body: []byte("b"), MTime: 1600000000})
+			b := buildRPM(t, r)
+			if got := readHeader(t, b).getUint32s(tagFileMTimes); !cmp.Equal(got, tc.want) {
+				t.Errorf("FILEMTIMES = %v, want %v", got, tc.want)
+			}
+			var got []uint32
+			for _, f := range readArchive(t, b) {
+				got = append(got, uint32(f.ModTime.Unix()))
+			}
+			if !cmp.Equal(got, tc.want) {
+				t.Errorf("payload mtimes = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestEpoch(t *testing.T) {
+	testCases := []struct {
+		name         string
+		md           RPMMetaData
+		wantProvides string
+		wantFileName string
+	}{{
+		name:         "no epoch",
+		md:           RPMMetaData{Name: "epoch", Version: "1.0", Release: "2", Arch: "x86_64", Summary: "summary"},
+		wantProvides: "epoch=1.0-2,epoch(x86-64)=1.0-2",
+		wantFileName: "epoch-1.0-2.x86_64.rpm",
+	}, {
+		name:         "epoch",
+		md:           RPMMetaData{Name: "epoch", Version: "1.0", Release: "2", Arch: "x86_64", Epoch: 3, Summary: "summary"},
+		wantProvides: "epoch=3:1.0-2,epoch(x86-64)=3:1.0-2",
+		wantFileName: "epoch-1.0-2.x86_64.rpm",
+	}, {
+		name:         "no release",
+		md:           RPMMetaData{Name: "epoch", Version: "1.0", Epoch: 1, Summary: "summary"},
+		wantProvides: "epoch=1:1.0",
+		wantFileName: "epoch-1.0.noarch.rpm",
+	}, {
+		name:         "no self provides",
+		md:           RPMMetaData{Name: "epoch", Version: "1.0", Release: "2", Arch: "aarch64", Summary: "summary", NoSelfProvides: true},
+		wantProvides: "",
+		wantFileName: "epoch-1.0-2.aarch64.rpm",
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewRPM(tc.md)
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			if got := r.Provides.String(); got != tc.wantProvides {
+				t.Errorf("provides = %s, want %s", got, tc.wantProvides)
+			}
+			if got := r.FileName(); got != tc.wantFileName {
+				t.Errorf("FileName() = %s, want %s", got, tc.wantFileName)
+			}
+			h := newIndex(immutable)
+			r.writeGenIndexes(h)
+			if d := cmp.Diff([]uint32{tc.md.Epoch}, h.getUint32s(tagEpoch)); d != "" {
+				t.Errorf("unexpected epoch tag (-want, +got): %s", d)
+			}
+		})
+	}
+}
+
+// setenv sets an environment variable, and returns a function restoring it.
+func setenv(t *testing.T, key, value string) func() {
+	t.Helper()
+	old, ok := os.LookupEnv(key)
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatalf("os.Setenv(%q) returned error %v", key, err)
+	}
+	return func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+// unsetenv unsets an environment variable, and returns a function restoring it.
+func unsetenv(t *testing.T, key string) func() {
+	t.Helper()
+	restore := setenv(t, key, "")
+	if err := os.Unsetenv(key); err != nil {
+		t.Fatalf("os.Unsetenv(%q) returned error %v", key, err)
+	}
+	return restore
+}
+
+func TestVendorPackagerFromEnv(t *testing.T) {
+	defer setenv(t, EnvVendor, "Env Vendor")()
+	defer setenv(t, EnvPackager, "Env Packager <env@example.com>")()
+	testCases := []struct {
+		name         string
+		md           RPMMetaData
+		wantVendor   string
+		wantPackager string
+	}{{
+		name:         "from env",
+		md:           RPMMetaData{Name: "env", Version: "1.0", Summary: "summary"},
+		wantVendor:   "Env Vendor",
+		wantPackager: "Env Packager <env@example.com>",
+	}, {
+		name:         "explicit wins",
+		md:           RPMMetaData{Name: "env", Version: "1.0", Vendor: "Vendor", Packager: "Packager", Summary: "summary"},
+		wantVendor:   "Vendor",
+		wantPackager: "Packager",
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewRPM(tc.md)
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			h := readHeader(t, buildRPM(t, r))
+			if got := h.getString(tagVendor); got != tc.wantVendor {
+				t.Errorf("vendor = %q, want %q", got, tc.wantVendor)
+			}
+			if got := h.getString(tagPackager); got != tc.wantPackager {
+				t.Errorf("packager = %q, want %q", got, tc.wantPackager)
+			}
+		})
+	}
+}
+
+func TestLegacyFileNames(t *testing.T) {
+	for _, legacy := range []bool{false, true} {
+		legacy := legacy
+		t.Run(fmt.Sprintf("legacy=%t", legacy), func(t *testing.T) {
+			r, err := NewRPM(RPMMetaData{Name: "legacy", Version: "1.0", LegacyFileNames: legacy, Summary: "summary"})
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			r.AddFile(RPMFile{Name: "/etc/legacy.conf", Body: []byte("a=b\n")})
+			r.AddFile(RPMFile{Name: "/usr/bin/legacy", Body: []byte("bin")})
+			h := readHeader(t, buildRPM(t, r))
+			if d := cmp.Diff([]string{"legacy.conf", "legacy"}, h.getStrings(tagBasenames)); d != "" {
+				t.Errorf("basenames mismatch (-want +got):\n%s", d)
+			}
+			var want []string
+			if legacy {
+				want = []string{"/etc/legacy.conf", "/usr/bin/legacy"}
+			}
+			if d := cmp.Diff(want, h.getStrings(tagOldFileNames)); d != "" {
+				t.Errorf("old file names mismatch (-want +got):\n%s", d)
+			}
+		})
+	}
+}
+
+func TestBuildHost(t *testing.T) {
+	testCases := []struct {
+		name      string
+		epoch     bool
+		buildHost string
+		want      string
+	}{{
+		name: "unset",
+		want: "",
+	}, {
+		name:      "explicit",
+		buildHost: "builder",
+		want:      "builder",
+	}, {
+		name:  "reproducible",
+		epoch: true,
+		want:  "localhost",
+	}, {
+		name:      "reproducible explicit",
+		epoch:     true,
+		buildHost: "builder",
+		want:      "builder",
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.epoch {
+				defer setenv(t, EnvSourceDateEpoch, "1580000000")()
+			} else {
+				defer unsetenv(t, EnvSourceDateEpoch)()
+			}
+			r, err := NewRPM(RPMMetaData{Name: "host", Version: "1.0", BuildHost: tc.buildHost, Summary: "summary"})
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			b := buildRPM(t, r)
+			if got := readHeader(t, b).getString(tagBuildHost); got != tc.want {
+				t.Errorf("build host = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSourceDateEpoch(t *testing.T) {
+	defer setenv(t, EnvSourceDateEpoch, "1550000000")()
+	e := newTestEntity(t, "signer")
+	build := func() []byte {
+		r, err := NewRPM(RPMMetaData{Name: "reproducible", Version: "1.0", Summary: "summary"})
+		if err != nil {
+			t.Fatalf("NewRPM returned error %v", err)
+		}
+		r.AddFile(RPMFile{Name: "/etc/old", Body: []byte("old"), MTime: 1500000000})
+		r.AddFile(RPMFile{Name: "/etc/new", Body: []byte("new"), MTime: 1600000000})
+		if err := r.SetPGPKey(e); err != nil {
+			t.Fatalf("SetPGPKey returned error %v", err)
+		}
+		return buildRPM(t, r)
+	}
+	b := build()
+	h := readHeader(t, b)
+	if got, want := h.getUint32s(tagBuildTime), []uint32{1550000000}; !cmp.Equal(got, want) {
+		t.Errorf("BUILDTIME = %v, want %v", got, want)
+	}
+	if got, want := h.getUint32s(tagFileMTimes), []uint32{1550000000, 1500000000}; !cmp.Equal(got, want) {
+		t.Errorf("FILEMTIMES = %v, want %v", got, want)
+	}
+	time.Sleep(time.Second)
+	if !bytes.Equal(b, build()) {
+		t.Errorf("building the same package twice gave different bytes")
+	}
+
+	defer setenv(t, EnvSourceDateEpoch, "yesterday")()
+	if _, err := NewRPM(RPMMetaData{Name: "reproducible", Version: "1.0", Summary: "summary"}); err == nil {
+		t.Errorf("NewRPM with an invalid %s should return an error", EnvSourceDateEpoch)
+	}
+}
+
+// countingCompressor is zlibCompressor counting the payloads it compresses.
+type countingCompressor struct {
+	zlibCompressor
+	n *int
+}
+
+func (c countingCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	*c.n++
+	return c.zlibCompressor.NewWriter(w)
+}
+
+func TestWriteBuffered(t *testing.T) {
+	defer setenv(t, EnvSourceDateEpoch, "1600000000")()
+	e := newTestEntity(t, "signer")
+	build := func(buffered bool) ([]byte, int) {
+		var n int
+		r, err := NewRPM(RPMMetaData{Name: "buffered", Version: "1.0", Summary: "summary", CustomCompressor: countingCompressor{n: &n}})
+		if err != nil {
+			t.Fatalf("NewRPM returned error %v", err)
+		}
+		r.AddFile(RPMFile{Name: "/usr/share/buffered/file", Body: bytes.Repeat([]byte("buffered "), 1000)})
+		if err := r.SetPGPKey(e); err != nil {
+			t.Fatalf("SetPGPKey returned error %v", err)
+		}
+		b := &bytes.Buffer{}
+		if !buffered {
+			if err := r.Write(b); err != nil {
+				t.Fatalf("Write returned error %v", err)
+			}
+			return b.Bytes(), n
+		}
+		f, err := ioutil.TempFile("", "rpmpack")
+		if err != nil {
+			t.Fatalf("ioutil.TempFile returned error %v", err)
+		}
+		defer os.Remove(f.Name())
+		defer f.Close()
+		if err := r.WriteBuffered(b, f); err != nil {
+			t.Fatalf("WriteBuffered returned error %v", err)
+		}
+		return b.Bytes(), n
+	}
+	want, n := build(false)
+	if n != 3 {
+		t.Errorf("Write compressed the payload %d times, want 3", n)
+	}
+	got, n := build(true)
+	if n != 1 {
+		t.Errorf("WriteBuffered compressed the payload %d times, want 1", n)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("WriteBuffered and Write wrote different packages")
+	}
+	if _, err := VerifySignature(bytes.NewReader(got), openpgp.EntityList{e}); err != nil {
+		t.Errorf("VerifySignature returned error %v", err)
+	}
+}
+
+func TestWriteBufferedCompressors(t *testing.T) {
+	for _, compressor := range []string{"gzip", "lzma", "xz", "zstd", "none"} {
+		compressor := compressor
+		t.Run(compressor, func(t *testing.T) {
+			build := func(buffered bool) []byte {
+				r, err := NewRPM(RPMMetaData{Name: "buffered", Version: "1.0", Summary: "summary", Compressor: compressor})
+				if err != nil {
+					t.Fatalf("NewRPM returned error %v", err)
+				}
+				r.AddFile(RPMFile{Name: "/usr/share/buffered/file", Body: bytes.Repeat([]byte("buffered "), 1000)})
+				b := &bytes.Buffer{}
+				if !buffered {
+					if err := r.Write(b); err != nil {
+						t.Fatalf("Write returned error %v", err)
+					}
+					return b.Bytes()
+				}
+				f, err := ioutil.TempFile("", "rpmpack")
+				if err != nil {
+					t.Fatalf("ioutil.TempFile returned error %v", err)
+				}
+				defer os.Remove(f.Name())
+				defer f.Close()
+				if err := r.WriteBuffered(b, f); err != nil {
+					t.Fatalf("WriteBuffered returned error %v", err)
+				}
+				return b.Bytes()
+			}
+			if !bytes.Equal(build(true), build(false)) {
+				t.Error("WriteBuffered and Write wrote different packages")
+			}
+		})
+	}
+}
+
+// failingWriter accepts n bytes, then fails, or drops the bytes when short.
+type failingWriter struct {
+	n     int
+	short bool
+}
+
+func (f *failingWriter) Write(p []byte) (int, error) {
+	if len(p) <= f.n {
+		f.n -= len(p)
+		return len(p), nil
+	}
+	n := f.n
+	f.n = 0
+	if f.short {
+		return n, nil
+	}
+	return n, errors.New("disk full")
+}
+
+func TestWriteErrors(t *testing.T) {
+	build := func(w io.Writer) error {
+		r, err := NewRPM(RPMMetaData{Name: "errors", Version: "1.0", Summary: "summary"})
+		if err != nil {
+			t.Fatalf("NewRPM returned error %v", err)
+		}
+		r.AddFile(RPMFile{Name: "/usr/share/errors/file", Body: bytes.Repeat([]byte("errors "), 1000)})
+		return r.Write(w)
+	}
+	b := &bytes.Buffer{}
+	if err := build(b); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	for _, short := range []bool{false, true} {
+		// In the lead, the signature header, its padding, the header and the payload.
+		for _, n := range []int{0, 0x20, 0x70, b.Len() / 2, b.Len() - 1} {
+			if err := build(&failingWriter{n: n, short: short}); err == nil {
+				t.Errorf("Write after %d bytes (short: %v) returned no error", n, short)
+			}
+		}
+	}
+}
+
+func TestWriteCtx(t *testing.T) {
+	for _, threads := range []int{0, 2} {
+		for _, at := range []Progress{
+			// Canceled before the write.
+			{},
+			{Phase: PhaseDigest, File: "/usr/share/canceled/b"},
+			{Phase: PhasePayload, File: "/usr/share/canceled/c"},
+		} {
+			ctx, cancel := context.WithCancel(context.Background())
+			r, err := NewRPM(RPMMetaData{Name: "canceled", Version: "1.0", Summary: "summary", CompressorThreads: threads})
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			for _, name := range []string{"a", "b", "c"} {
+				r.AddFile(RPMFile{Name: "/usr/share/canceled/" + name, Body: []byte(name)})
+			}
+			if at.File == "" {
+				cancel()
+			}
+			r.SetProgressHandler(func(p Progress) error {
+				if p.Phase == at.Phase && p.File == at.File {
+					cancel()
+				}
+				return nil
+			})
+			err = r.WriteCtx(ctx, ioutil.Discard)
+			if errors.Cause(err) != context.Canceled {
+				t.Errorf("WriteCtx canceled at %+v with %d threads returned error %v, want %v", at, threads, err, context.Canceled)
+			}
+			if r.progress.ctx != nil {
+				t.Errorf("WriteCtx canceled at %+v with %d threads kept the context", at, threads)
+			}
+			// The payload of the canceled write is half written, the rpm
+			// cannot be written again.
+			err = r.Write(ioutil.Discard)
+			if err == nil {
+				t.Errorf("Write after WriteCtx canceled at %+v with %d threads returned no error", at, threads)
+			} else if errors.Cause(err) != context.Canceled && err != ErrWriteAfterClose {
+				t.Errorf("Write after WriteCtx canceled at %+v with %d threads returned error %v, want %v or %v", at, threads, err, context.Canceled, ErrWriteAfterClose)
+			}
+		}
+	}
+	r, err := NewRPM(RPMMetaData{Name: "notcanceled", Version: "1.0", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	if err := r.WriteCtx(context.Background(), ioutil.Discard); err != nil {
+		t.Errorf("WriteCtx returned error %v", err)
+	}
+}
+
+func TestEmptyPayload(t *testing.T) {
+	for _, compressor := range []string{"gzip", "lzma", "xz", "zstd", "none"} {
+		compressor := compressor
+		t.Run(compressor, func(t *testing.T) {
+			r, err := NewRPM(RPMMetaData{Name: "empty", Version: "1.0", Compressor: compressor, Summary: "summary"})
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			p := bytes.NewReader(readPayload(t, buildRPM(t, r)))
+			var z io.Reader
+			switch compressor {
+			case "gzip":
+				z, err = gzip.NewReader(p)
+			case "lzma":
+				z, err = lzma.NewReader(p)
+			case "xz":
+				z, err = xz.NewReader(p)
+			case "zstd":
+				z, err = zstd.NewReader(p)
+			case "none":
+				z = p
+			}
+			if err != nil {
+				t.Fatalf("failed to open the %s payload: %v", compressor, err)
+			}
+			archive, err := ioutil.ReadAll(z)
+			if err != nil {
+				t.Fatalf("failed to decompress the payload: %v", err)
+			}
+			if !bytes.Contains(archive, []byte("TRAILER!!!")) {
+				t.Errorf("payload %q has no cpio trailer", archive)
+			}
+			if _, err := cpio.NewReader(bytes.NewReader(archive)).Next(); err != io.EOF {
+				t.Errorf("reading the first payload entry returned %v, want io.EOF", err)
+			}
+		})
+	}
+}
+
+func TestMetaPackage(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{
+		Name:      "meta",
+		Version:   "1.0",
+		Summary:   "summary",
+		Provides:  Relations{{Name: "virtual-thing"}},
+		Requires:  Relations{{Name: "foo"}, {Name: "bar", Version: "2.0", Sense: SenseGreater | SenseEqual}},
+		Conflicts: Relations{{Name: "baz"}},
+	})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddPostin("echo installed")
+	b := buildRPM(t, r)
+	h := readHeader(t, b)
+	for _, tag := range []int{tagBasenames, tagDirnames, tagDirindexes, tagFileSizes, tagFileModes, tagFileDigests, tagFileDigestAlgo, tagFileINodes} {
+		if _, ok := h.entries[tag]; ok {
+			t.Errorf("meta package has file tag %d", tag)
+		}
+	}
+	if got := h.getUint32s(tagSize); len(got) != 1 || got[0] != 0 {
+		t.Errorf("meta package has SIZE %v, want [0]", got)
+	}
+	if got := h.getString(tagPostin); got != "echo installed" {
+		t.Errorf("POSTIN = %q, want %q", got, "echo installed")
+	}
+	if err := Verify(bytes.NewReader(b), nil); err != nil {
+		t.Errorf("Verify returned error %v", err)
+	}
+	info, err := ReadRPMInfo(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("ReadRPMInfo returned error %v", err)
+	}
+	if len(info.Files) != 0 {
+		t.Errorf("meta package has files %v", info.Files)
+	}
+	if got := h.getStrings(tagConflicts); len(got) != 1 || got[0] != "baz" {
+		t.Errorf("CONFLICTNAME = %q, want [baz]", got)
+	}
+}
+
+func TestFileOwnerGroupDefaults(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "owners", Version: "1.0", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/etc/a", Mode: 0640, Group: "wheel"})
+	r.AddFile(RPMFile{Name: "/etc/b", Mode: 0644, Owner: "daemon"})
+	r.AddFile(RPMFile{Name: "/etc/c", Mode: 0644})
+	r.AddFile(RPMFile{Name: "/etc/d", Mode: 0600, Owner: "root", Group: "wheel"})
+	h := readHeader(t, buildRPM(t, r))
+	if d := cmp.Diff([]string{"root", "daemon", "root", "root"}, h.getStrings(tagFileUserName)); d != "" {
+		t.Errorf("file owners mismatch (-want +got):\n%s", d)
+	}
+	if d := cmp.Diff([]string{"wheel", "root", "root", "wheel"}, h.getStrings(tagFileGroupName)); d != "" {
+		t.Errorf("file groups mismatch (-want +got):\n%s", d)
+	}
+}
+
+func TestSummaryValidation(t *testing.T) {
+	testCases := []struct {
+		name            string
+		summary         string
+		description     string
+		wantErr         bool
+		wantDescription string
+	}{{
+		name:    "empty summary",
+		wantErr: true,
+	}, {
+		name:            "description defaults to summary",
+		summary:         "summary",
+		wantDescription: "summary",
+	}, {
+		name:            "multi line description",
+		summary:         "summary",
+		description:     "line 1\n\tline 2\n",
+		wantDescription: "line 1\n\tline 2\n",
+	}, {
+		name:        "nul in description",
+		summary:     "summary",
+		description: "before\x00after",
+		wantErr:     true,
+	}, {
+		name:    "newline in summary",
+		summary: "line 1\nline 2",
+		wantErr: true,
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewRPM(RPMMetaData{Name: "summary", Summary: tc.summary, Description: tc.description})
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			b := &bytes.Buffer{}
+			err = r.Write(b)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Write returned error %v, want error %t", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := readHeader(t, b.Bytes()).getString(tagDescription); got != tc.wantDescription {
+				t.Errorf("description = %q, want %q", got, tc.wantDescription)
+			}
+		})
+	}
+}
+
+func TestPayloadDigests(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "digests", Version: "1.0", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/share/digests/file", Body: []byte("content")})
+	b := buildRPM(t, r)
+	h := readHeader(t, b)
+	payload := readPayload(t, b)
+	z, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		t.Fatalf("failed to open the gzip payload: %v", err)
+	}
+	archive, err := ioutil.ReadAll(z)
+	if err != nil {
+		t.Fatalf("failed to decompress the payload: %v", err)
+	}
+	if d := cmp.Diff([]string{fmt.Sprintf("%x", sha256.Sum256(payload))}, h.getStrings(tagPayloadDigest)); d != "" {
+		t.Errorf("payload digest mismatch (-want +got):\n%s", d)
+	}
+	if d := cmp.Diff([]string{fmt.Sprintf("%x", sha256.Sum256(archive))}, h.getStrings(tagPayloadDigestAlt)); d != "" {
+		t.Errorf("uncompressed payload digest mismatch (-want +got):\n%s", d)
+	}
+}
+
+func TestFileReader(t *testing.T) {
+	build := func(f RPMFile) []byte {
+		r, err := NewRPM(RPMMetaData{Name: "reader", Version: "1.0", Summary: "summary"})
+		if err != nil {
+			t.Fatalf("NewRPM returned error %v", err)
+		}
+		r.AddFile(f)
+		if _, err := r.DescribeTags(); err != nil {
+			t.Fatalf("DescribeTags returned error %v", err)
+		}
+		return buildRPM(t, r)
+	}
+	body := bytes.Repeat([]byte("content"), 1000)
+	fromBody := build(RPMFile{Name: "/usr/share/reader/file", Body: body})
+	fromReader := build(RPMFile{Name: "/usr/share/reader/file", Reader: bytes.NewReader(body), Size: int64(len(body))})
+	if !bytes.Equal(fromBody, fromReader) {
+		t.Error("the rpm built from a reader differs from the one built from a body")
+	}
+	// Without Seek, the content is kept in a temporary file for the second
+	// pass, which is removed once the rpm is written.
+	tmp, err := ioutil.TempDir("", "rpmpack")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir returned error %v", err)
+	}
+	defer os.RemoveAll(tmp)
+	defer os.Setenv("TMPDIR", os.Getenv("TMPDIR"))
+	os.Setenv("TMPDIR", tmp)
+	notSeekable := struct{ io.Reader }{bytes.NewReader(body)}
+	fromStream := build(RPMFile{Name: "/usr/share/reader/file", Reader: notSeekable, Size: int64(len(body))})
+	if !bytes.Equal(fromBody, fromStream) {
+		t.Error("the rpm built from a stream differs from the one built from a body")
+	}
+	r, err := NewRPM(RPMMetaData{Name: "reader", Version: "1.0", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/share/reader/file", Reader: struct{ io.Reader }{bytes.NewReader(body)}, Size: int64(len(body)) + 1})
+	if err := r.Write(ioutil.Discard); err == nil {
+		t.Error("Write of a stream shorter than its size returned no error")
+	}
+	if left, err := ioutil.ReadDir(tmp); err != nil || len(left) > 0 {
+		t.Errorf("the temporary files of the streams were not removed: %v, %v", left, err)
+	}
+}
+
+func TestFileReaderSize(t *testing.T) {
+	for _, size := range []int64{6, 8} {
+		r, err := NewRPM(RPMMetaData{Name: "reader", Version: "1.0", Summary: "summary"})
+		if err != nil {
+			t.Fatalf("NewRPM returned error %v", err)
+		}
+		r.AddFile(RPMFile{Name: "/usr/share/reader/file", Reader: bytes.NewReader([]byte("content")), Size: size})
+		if err := r.Write(ioutil.Discard); err == nil {
+			t.Errorf("Write of a 7 bytes file with a size of %d returned no error", size)
+		}
+	}
+}
+
+func TestDistributionTags(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "test", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	h := newIndex(immutable)
+	r.writeGenIndexes(h)
+	for _, tag := range []int{tagDistTag, tagDistURL, tagPlatform, tagModularityLabel, tagCookie, tagOptFlags} {
+		if _, ok := h.entries[tag]; ok {
+			t.Errorf("tag %d should not be written when empty", tag)
+		}
+	}
+	if got, want := h.getString(tagSourceRPM), "test-.src.rpm"; got != want {
+		t.Errorf("SOURCERPM = %q, want %q", got, want)
+	}
+
+	r, err = NewRPM(RPMMetaData{
+		Name:     "test",
+		Summary:  "summary",
+		DistTag:  "fc32",
+		DistURL:  "https://example.com/test-1.0-1.fc32.src.rpm",
+		Platform: "x86_64-redhat-linux-gnu",
+
+		ModularityLabel: "nodejs:12:8020020200707094456:a7025d6e",
+
+		Cookie:    "builder 1600000000",
+		OptFlags:  "-O2 -g",
+		SourceRPM: "other-1.0-1.fc32.src.rpm",
+	})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	h = newIndex(immutable)
+	r.writeGenIndexes(h)
+	for tag, want := range map[int]string{
+		tagDistTag:  "fc32",
+		tagDistURL:  "https://example.com/test-1.0-1.fc32.src.rpm",
+		tagPlatform: "x86_64-redhat-linux-gnu",
+
+		tagModularityLabel: "nodejs:12:8020020200707094456:a7025d6e",
+
+		tagCookie:    "builder 1600000000",
+		tagOptFlags:  "-O2 -g",
+		tagSourceRPM: "other-1.0-1.fc32.src.rpm",
+	} {
+		if got := h.getString(tag); got != want {
+			t.Errorf("tag %d = %q, want %q", tag, got, want)
+		}
+	}
+}
+
+func TestPrefixes(t *testing.T) {
+	testCases := []struct {
+		name        string
+		prefixes    []string
+		files       []string
+		errExpected bool
+	}{{
+		name:     "none",
+		files:    []string{"/usr/bin/foo"},
+		prefixes: nil,
+	}, {
+		name:     "single",
+		prefixes: []string{"/opt/foo"},
+		files:    []string{"/opt/foo", "/opt/foo/bin/foo"},
+	}, {
+		name:     "several",
+		prefixes: []string{"/opt/foo", "/etc/foo"},
+		files:    []string{"/opt/foo/bin/foo", "/etc/foo/foo.conf"},
+	}, {
+		name:        "outside",
+		prefixes:    []string{"/opt/foo"},
+		files:       []string{"/opt/foo/bin/foo", "/opt/foobar"},
+		errExpected: true,
+	}, {
+		name:        "relative",
+		prefixes:    []string{"opt/foo"},
+		errExpected: true,
+	}, {
+		name:        "trailing slash",
+		prefixes:    []string{"/opt/foo/"},
+		errExpected: true,
+	}, {
+		name:        "root",
+		prefixes:    []string{"/"},
+		errExpected: true,
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewRPM(RPMMetaData{Name: "test", Summary: "summary", Prefixes: tc.prefixes})
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			for _, f := range tc.files {
+				r.AddFile(RPMFile{Name: f, Body: []byte("foo")})
+			}
+			_, _, err = r.buildHeaders()
+			if tc.errExpected {
+				if err == nil {
+					t.Errorf("buildHeaders should have returned an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("buildHeaders returned error %v", err)
+			}
+			h := newIndex(immutable)
+			r.writeGenIndexes(h)
+			if d := cmp.Diff(tc.prefixes, h.getStrings(tagPrefixes)); d != "" {
+				t.Errorf("unexpected prefixes (-want, +got): %s", d)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import "strings"
+
+// rpmlibFeatures are the features of rpm a package can depend on, with the
+// version of rpm which introduced them, and whether the package uses them.
+// https://github.com/rpm-software-management/rpm/blob/master/lib/rpmds.c
+var rpmlibFeatures = []struct {
+	name, version string
+	used          func(r *RPM) bool
+}{
+	{"CompressedFileNames", "3.0.4-1", func(r *RPM) bool { return len(r.files) > 0 }},
+	{"FileDigests", "4.6.0-1", func(r *RPM) bool { return len(r.files) > 0 && r.fileDigest.algo != hashAlgoMD5 }},
+	{"FileCaps", "4.6.1-1", func(r *RPM) bool { return r.hasFileCaps }},
+	{"PartialHardlinkSets", "4.0.4-1", func(r *RPM) bool { return len(r.hardlinks) > 0 }},
+	{"LargeFiles", "4.12.0-1", func(r *RPM) bool { return r.largeFiles() }},
+	{"PayloadIsLzma", "4.4.6-1", func(r *RPM) bool { return r.payloadCompressor == "lzma" }},
+	{"PayloadIsXz", "5.2-1", func(r *RPM) bool { return r.payloadCompressor == "xz" }},
+	{"PayloadIsZstd", "5.4.18-1", func(r *RPM) bool { return r.payloadCompressor == "zstd" }},
+	{"ScriptletExpansion", "4.9.0-1", func(r *RPM) bool {
+		return r.scriptletsUse(func(s scriptlet) bool { return s.flags&ScriptletExpand != 0 })
+	}},
+	{"ScriptletInterpreterArgs", "4.0.3-1", func(r *RPM) bool {
+		return r.scriptletsUse(func(s scriptlet) bool { return len(s.interpreter()) > 1 })
+	}},
+	{"BuiltinLuaScripts", "4.2.2-1", func(r *RPM) bool {
+		return r.scriptletsUse(func(s scriptlet) bool { return s.interpreter()[0] == LuaInterpreter })
+	}},
+	{"FileTriggers", "4.13.0-1", func(r *RPM) bool { return len(r.fileTriggers) > 0 }},
+	{"RichDependencies", "4.12.0-1", func(r *RPM) bool {
+		for _, rels := range []Relations{r.Requires, r.Conflicts, r.Recommends, r.Suggests, r.Supplements, r.Enhances} {
+			for _, rel := range rels {
+				if rel.IsRich() {
+					return true
+				}
+			}
+		}
+		return false
+	}},
+	{"TildeInVersions", "4.10.0-1", func(r *RPM) bool { return r.versionsContain("~") }},
+	{"CaretInVersions", "4.15.0-1", func(r *RPM) bool { return r.versionsContain("^") }},
+}
+
+// scriptletsUse reports whether f is true for one of the scriptlets or
+// triggers.
+func (r *RPM) scriptletsUse(f func(scriptlet) bool) bool {
+	for _, s := range r.scriptlets {
+		if s.body != "" && f(s) {
+			return true
+		}
+	}
+	for _, t := range r.triggers {
+		if f(scriptlet{body: t.Script, flags: t.Flags, prog: []string{t.Interpreter}}) {
+			return true
+		}
+	}
+	for _, t := range r.fileTriggers {
+		if f(scriptlet{body: t.Script, flags: t.Flags, prog: []string{t.Interpreter}}) {
+			return true
+		}
+	}
+	return false
+}
+
+// versionsContain reports whether the version and release of the package, or
+// the version of a relation, contain s. The versions of rich dependencies and
+// of the packages of triggers count too.
+func (r *RPM) versionsContain(s string) bool {
+	if strings.Contains(r.Version, s) || strings.Contains(r.Release, s) {
+		return true
+	}
+	rels := []Relations{r.Provides, r.Obsoletes, r.Suggests, r.Recommends, r.Supplements, r.Enhances, r.Requires, r.Conflicts, r.OrderWithRequires}
+	for _, t := range r.triggers {
+		rels = append(rels, t.Packages)
+	}
+	for _, rs := range rels {
+		for _, rel := range rs {
+			if strings.Contains(rel.Version, s) || rel.IsRich() && strings.Contains(rel.Name, s) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// addRPMLibRequirements requires the rpmlib() features the package uses, like
+// rpmbuild, so that rpm versions without them refuse to install the package
+// instead of installing it wrong.
+func (r *RPM) addRPMLibRequirements() {
+	for _, f := range rpmlibFeatures {
+		if f.used(r) {
+			r.Requires.addGenerated("rpmlib("+f.name+")", f.version, SenseRPMLib|SenseLess|SenseEqual)
+		}
+	}
+}
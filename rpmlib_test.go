@@ -0,0 +1,116 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRPMLibRequirements(t *testing.T) {
+	rich, err := NewRelation("(foo or bar)")
+	if err != nil {
+		t.Fatalf("NewRelation returned error %v", err)
+	}
+	file := RPMFile{Name: "/usr/share/foo", Body: []byte("foo")}
+	testCases := []struct {
+		name   string
+		md     RPMMetaData
+		files  []RPMFile
+		expand bool
+		want   []string
+	}{{
+		name: "meta package",
+	}, {
+		name:  "files",
+		files: []RPMFile{file},
+		want:  []string{"rpmlib(CompressedFileNames)<=3.0.4-1", "rpmlib(FileDigests)<=4.6.0-1"},
+	}, {
+		name:  "md5 digests",
+		md:    RPMMetaData{FileDigest: "md5"},
+		files: []RPMFile{file},
+		want:  []string{"rpmlib(CompressedFileNames)<=3.0.4-1"},
+	}, {
+		name: "xz",
+		md:   RPMMetaData{Compressor: "xz"},
+		want: []string{"rpmlib(PayloadIsXz)<=5.2-1"},
+	}, {
+		name: "zstd",
+		md:   RPMMetaData{Compressor: "zstd"},
+		want: []string{"rpmlib(PayloadIsZstd)<=5.4.18-1"},
+	}, {
+		name: "lzma",
+		md:   RPMMetaData{Compressor: "lzma"},
+		want: []string{"rpmlib(PayloadIsLzma)<=4.4.6-1"},
+	}, {
+		name: "rich",
+		md:   RPMMetaData{Requires: Relations{rich}},
+		want: []string{"rpmlib(RichDependencies)<=4.12.0-1"},
+	}, {
+		name:   "expansion",
+		expand: true,
+		want:   []string{"rpmlib(ScriptletExpansion)<=4.9.0-1"},
+	}, {
+		name: "tilde and caret",
+		md:   RPMMetaData{Version: "1.0~rc1", Release: "1^git"},
+		want: []string{"rpmlib(TildeInVersions)<=4.10.0-1", "rpmlib(CaretInVersions)<=4.15.0-1"},
+	}, {
+		name: "tilde in a dependency",
+		md:   RPMMetaData{Requires: Relations{{Name: "foo", Version: "2.0~rc1", Sense: SenseGreater | SenseEqual}}},
+		want: []string{"rpmlib(TildeInVersions)<=4.10.0-1"},
+	}, {
+		name: "caret in a rich dependency",
+		md:   RPMMetaData{Conflicts: Relations{{Name: "(foo >= 2.0^git1 with foo < 3)"}}},
+		want: []string{"rpmlib(RichDependencies)<=4.12.0-1", "rpmlib(CaretInVersions)<=4.15.0-1"},
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			md := tc.md
+			md.Name, md.Summary = "test", "summary"
+			if md.Version == "" {
+				md.Version = "1.0"
+			}
+			r, err := NewRPM(md)
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			for _, f := range tc.files {
+				r.AddFile(f)
+			}
+			if tc.expand {
+				r.AddPostin("echo %{_bindir}")
+				r.SetScriptletFlags(PostinScriptlet, ScriptletExpand)
+			}
+			if err := r.Write(ioutil.Discard); err != nil {
+				t.Fatalf("Write returned error %v", err)
+			}
+			var got []string
+			for _, rel := range r.Requires {
+				if rel.Sense&SenseRPMLib != 0 {
+					if rel.Sense != SenseRPMLib|SenseLess|SenseEqual {
+						t.Errorf("%s has flags %d", rel.Name, rel.Sense)
+					}
+					got = append(got, rel.String())
+				}
+			}
+			if d := cmp.Diff(tc.want, got); d != "" {
+				t.Errorf("unexpected rpmlib requirements (-want, +got): %s", d)
+			}
+		})
+	}
+}
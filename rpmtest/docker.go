@@ -0,0 +1,50 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build docker
+// +build docker
+
+package rpmtest
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// DockerRunner is a Runner that runs commands with the docker cli, in a new
+// container of Image. The files are mounted read-only in the working directory.
+type DockerRunner struct {
+	// Image is an image with rpm, for example "fedora:32".
+	Image string
+}
+
+// Run implements Runner.
+func (d DockerRunner) Run(files map[string][]byte, cmd ...string) ([]byte, error) {
+	dir, err := ioutil.TempDir("", "rpmtest")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create a temporary directory")
+	}
+	defer os.RemoveAll(dir)
+	for name, body := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), body, 0644); err != nil {
+			return nil, errors.Wrapf(err, "failed to write %s", name)
+		}
+	}
+	args := append([]string{"run", "--rm", "-v", dir + ":/rpmtest:ro", "-w", "/rpmtest", d.Image}, cmd...)
+	return exec.Command("docker", args...).CombinedOutput()
+}
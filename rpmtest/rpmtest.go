@@ -0,0 +1,46 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rpmtest checks that rpm files can be installed, for integration tests
+// of packages built with rpmpack.
+// The commands run through a Runner, so this package does not depend on any
+// container runtime. A docker based Runner is available with the "docker"
+// build tag.
+package rpmtest
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Runner runs a command in a fresh environment with rpm installed, usually a
+// container. files are made available in the working directory of the
+// command, keyed by file name. Run returns the combined output of the command.
+type Runner interface {
+	Run(files map[string][]byte, cmd ...string) ([]byte, error)
+}
+
+// packageFile is the name of the rpm file in the working directory of the runner.
+const packageFile = "package.rpm"
+
+// CheckInstall runs `rpm -i --test` on the rpm file through runner, and returns
+// the output of rpm. The returned error is not nil when the package cannot be
+// installed, for example because of missing dependencies, or when rpm cannot
+// read it.
+func CheckInstall(runner Runner, rpm []byte) (string, error) {
+	out, err := runner.Run(map[string][]byte{packageFile: rpm}, "rpm", "-i", "--test", packageFile)
+	if err != nil {
+		return string(out), errors.Wrapf(err, "rpm -i --test failed: %s", out)
+	}
+	return string(out), nil
+}
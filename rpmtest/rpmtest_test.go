@@ -0,0 +1,67 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmtest
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/rpmpack"
+)
+
+type fakeRunner struct {
+	out   string
+	err   error
+	files map[string][]byte
+	cmd   []string
+}
+
+func (f *fakeRunner) Run(files map[string][]byte, cmd ...string) ([]byte, error) {
+	f.files = files
+	f.cmd = cmd
+	return []byte(f.out), f.err
+}
+
+func TestCheckInstall(t *testing.T) {
+	r := rpmpack.MinimalRPM("installable", "1.0")
+	b := &bytes.Buffer{}
+	if err := r.Write(b); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	runner := &fakeRunner{}
+	if _, err := CheckInstall(runner, b.Bytes()); err != nil {
+		t.Fatalf("CheckInstall returned error %v", err)
+	}
+	if d := cmp.Diff([]string{"rpm", "-i", "--test", "package.rpm"}, runner.cmd); d != "" {
+		t.Errorf("command mismatch (-want +got):\n%s", d)
+	}
+	if !bytes.Equal(runner.files["package.rpm"], b.Bytes()) {
+		t.Error("the rpm file was not passed to the runner")
+	}
+}
+
+func TestCheckInstallFailure(t *testing.T) {
+	const out = "error: Failed dependencies:\n\tfoo is needed by installable-1.0-1.noarch\n"
+	runner := &fakeRunner{out: out, err: errors.New("exit status 1")}
+	got, err := CheckInstall(runner, []byte("rpm"))
+	if err == nil {
+		t.Fatal("CheckInstall should return an error when rpm fails")
+	}
+	if got != out {
+		t.Errorf("CheckInstall() = %q, want %q", got, out)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+// ScriptletType identifies one of the scriptlets rpm runs during a transaction.
+type ScriptletType int
+
+const (
+	// PreinScriptlet runs before the package is installed (%pre).
+	PreinScriptlet ScriptletType = iota
+	// PostinScriptlet runs after the package is installed (%post).
+	PostinScriptlet
+	// PreunScriptlet runs before the package is removed (%preun).
+	PreunScriptlet
+	// PostunScriptlet runs after the package is removed (%postun).
+	PostunScriptlet
+	// PretransScriptlet runs once before the transaction (%pretrans). It
+	// runs before any package is installed, so it is usually in Lua, see
+	// LuaInterpreter.
+	PretransScriptlet
+	// PosttransScriptlet runs once after the transaction (%posttrans).
+	PosttransScriptlet
+)
+
+// ScriptletFlags are the RPMSCRIPT_FLAG_* bits stored in the *FLAGS tag of a scriptlet.
+type ScriptletFlags uint32
+
+// https://github.com/rpm-software-management/rpm/blob/master/lib/rpmscript.h
+const (
+	// ScriptletExpand makes rpm expand macros in the scriptlet body at install
+	// time, like %{_prefix}, with the macro configuration of the target system.
+	ScriptletExpand ScriptletFlags = 1 << 0
+	// ScriptletQFormat makes rpm render the scriptlet body as a query format
+	// at install time, so tags of the package header like %{VERSION} or
+	// %{NAME} are replaced with their values. Unlike ScriptletExpand, only
+	// header tags are expanded, not macros. `rpm -q --scripts` shows the
+	// rendered body.
+	ScriptletQFormat ScriptletFlags = 1 << 1
+	// ScriptletCritical makes a failing scriptlet fatal. rpm always treats %pre and
+	// %preun as critical: if they exit non-zero, the package is not installed
+	// (or removed). Failures of %post and %postun are only reported as warnings,
+	// unless they are marked critical as well, in which case rpm reports the
+	// transaction element as failed.
+	// Note that this is unrelated to running the script body with "sh -e", which
+	// only decides which exit code the scriptlet returns.
+	ScriptletCritical ScriptletFlags = 1 << 2
+)
+
+// LuaInterpreter is the interpreter of scriptlets in the Lua interpreter
+// built into rpm, which needs no shell on the target system.
+const LuaInterpreter = "<lua>"
+
+// defaultInterpreter runs the scriptlets without an interpreter set.
+var defaultInterpreter = []string{"/bin/sh"}
+
+type scriptlet struct {
+	body  string
+	flags ScriptletFlags
+	// prog is the interpreter and its arguments, defaultInterpreter if empty.
+	prog []string
+}
+
+func (s scriptlet) interpreter() []string {
+	if len(s.prog) == 0 {
+		return defaultInterpreter
+	}
+	return s.prog
+}
+
+// sameInterpreter reports whether both scriptlets run with the same interpreter.
+func (s scriptlet) sameInterpreter(o scriptlet) bool {
+	a, b := s.interpreter(), o.interpreter()
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// scriptletTags holds the script, interpreter and flags tags of every scriptlet type.
+var scriptletTags = []struct {
+	t                   ScriptletType
+	script, prog, flags int
+}{
+	{PreinScriptlet, tagPrein, tagPreinProg, tagPreinFlags},
+	{PostinScriptlet, tagPostin, tagPostinProg, tagPostinFlags},
+	{PreunScriptlet, tagPreun, tagPreunProg, tagPreunFlags},
+	{PostunScriptlet, tagPostun, tagPostunProg, tagPostunFlags},
+	{PretransScriptlet, tagPretrans, tagPretransProg, tagPretransFlags},
+	{PosttransScriptlet, tagPosttrans, tagPosttransProg, tagPosttransFlags},
+}
+
+// SetScriptletFlags sets the rpm flags of a scriptlet, see ScriptletFlags.
+func (r *RPM) SetScriptletFlags(t ScriptletType, f ScriptletFlags) {
+	s := r.scriptlets[t]
+	s.flags = f
+	r.scriptlets[t] = s
+}
+
+// SetScriptletInterpreter sets the program running a scriptlet, with its
+// arguments, like "/usr/bin/python3" or "/bin/bash", "-e". It is /bin/sh if
+// not set. Use LuaInterpreter for scriptlets in Lua.
+func (r *RPM) SetScriptletInterpreter(t ScriptletType, prog ...string) {
+	s := r.scriptlets[t]
+	s.prog = append([]string(nil), prog...)
+	r.scriptlets[t] = s
+}
+
+func (r *RPM) addScriptlet(t ScriptletType, body string) {
+	s := r.scriptlets[t]
+	s.body = body
+	r.scriptlets[t] = s
+}
+
+func (r *RPM) writeScriptletIndexes(h *index) {
+	for _, st := range scriptletTags {
+		s := r.scriptlets[st.t]
+		if s.body == "" {
+			continue
+		}
+		h.Add(st.script, EntryString(s.body))
+		// A program with arguments is stored as an array, which needs
+		// rpmlib(ScriptletInterpreterArgs), see rpmlibFeatures.
+		if prog := s.interpreter(); len(prog) == 1 {
+			h.Add(st.prog, EntryString(prog[0]))
+		} else {
+			h.Add(st.prog, EntryStringSlice(prog))
+		}
+		if s.flags != 0 {
+			h.Add(st.flags, EntryUint32([]uint32{uint32(s.flags)}))
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestScriptletFlags(t *testing.T) {
+	testCases := []struct {
+		name      string
+		flags     ScriptletFlags
+		wantFlags string
+	}{{
+		name: "non fatal",
+	}, {
+		name:      "critical",
+		flags:     ScriptletCritical,
+		wantFlags: "00000004",
+	}, {
+		name:      "expand",
+		flags:     ScriptletExpand,
+		wantFlags: "00000001",
+	}, {
+		name:      "qformat",
+		flags:     ScriptletQFormat,
+		wantFlags: "00000002",
+	}, {
+		name:      "critical qformat",
+		flags:     ScriptletCritical | ScriptletQFormat,
+		wantFlags: "00000006",
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewRPM(RPMMetaData{Name: "test", Summary: "summary"})
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			r.AddPostin("systemctl daemon-reload")
+			r.SetScriptletFlags(PostinScriptlet, tc.flags)
+			h := newIndex(immutable)
+			r.writeGenIndexes(h)
+			if _, ok := h.entries[tagPostin]; !ok {
+				t.Errorf("postin scriptlet missing from header")
+			}
+			e, ok := h.entries[tagPostinFlags]
+			if want := tc.wantFlags != ""; ok != want {
+				t.Fatalf("postin flags present = %t, want %t", ok, want)
+			}
+			if !ok {
+				return
+			}
+			if got := fmt.Sprintf("%x", e.data); got != tc.wantFlags {
+				t.Errorf("postin flags = %s, want %s", got, tc.wantFlags)
+			}
+		})
+	}
+}
+
+func TestScriptletFlagsWithoutBody(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "test", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.SetScriptletFlags(PreunScriptlet, ScriptletCritical)
+	h := newIndex(immutable)
+	r.writeGenIndexes(h)
+	for _, tag := range []int{tagPreun, tagPreunProg, tagPreunFlags} {
+		if _, ok := h.entries[tag]; ok {
+			t.Errorf("tag %d should not be written without a scriptlet body", tag)
+		}
+	}
+}
+
+func TestScriptletInterpreter(t *testing.T) {
+	testCases := []struct {
+		name     string
+		prog     []string
+		wantProg IndexEntry
+		wantLib  string
+	}{{
+		name:     "default",
+		wantProg: EntryString("/bin/sh"),
+	}, {
+		name:     "program",
+		prog:     []string{"/usr/bin/python3"},
+		wantProg: EntryString("/usr/bin/python3"),
+	}, {
+		name:     "arguments",
+		prog:     []string{"/bin/bash", "-e"},
+		wantProg: EntryStringSlice([]string{"/bin/bash", "-e"}),
+		wantLib:  "rpmlib(ScriptletInterpreterArgs)",
+	}, {
+		name:     "lua",
+		prog:     []string{LuaInterpreter},
+		wantProg: EntryString("<lua>"),
+		wantLib:  "rpmlib(BuiltinLuaScripts)",
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewRPM(RPMMetaData{Name: "test", Summary: "summary"})
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			r.AddPrein("echo pre")
+			r.SetScriptletInterpreter(PreinScriptlet, tc.prog...)
+			h := newIndex(immutable)
+			r.writeGenIndexes(h)
+			if d := cmp.Diff(tc.wantProg, h.entries[tagPreinProg], cmp.AllowUnexported(IndexEntry{})); d != "" {
+				t.Errorf("unexpected preinprog (-want, +got): %s", d)
+			}
+			r.addRPMLibRequirements()
+			var got string
+			for _, rel := range r.Requires {
+				if strings.HasPrefix(rel.Name, "rpmlib(") {
+					got = rel.Name
+				}
+			}
+			if got != tc.wantLib {
+				t.Errorf("rpmlib requirement = %q, want %q", got, tc.wantLib)
+			}
+		})
+	}
+}
+
+func TestTransScriptlets(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "test", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddPretrans("print('pretrans')")
+	r.SetScriptletInterpreter(PretransScriptlet, LuaInterpreter)
+	r.AddPosttrans("ldconfig")
+	r.SetScriptletFlags(PosttransScriptlet, ScriptletCritical)
+	h := newIndex(immutable)
+	r.writeGenIndexes(h)
+	want := map[int]IndexEntry{
+		tagPretrans:       EntryString("print('pretrans')"),
+		tagPretransProg:   EntryString("<lua>"),
+		tagPosttrans:      EntryString("ldconfig"),
+		tagPosttransProg:  EntryString("/bin/sh"),
+		tagPosttransFlags: EntryUint32([]uint32{uint32(ScriptletCritical)}),
+	}
+	for tag, e := range want {
+		if d := cmp.Diff(e, h.entries[tag], cmp.AllowUnexported(IndexEntry{})); d != "" {
+			t.Errorf("unexpected tag %d (-want, +got): %s", tag, d)
+		}
+	}
+	if _, ok := h.entries[tagPretransFlags]; ok {
+		t.Errorf("pretrans flags should not be written without flags")
+	}
+}
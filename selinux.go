@@ -0,0 +1,56 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// checkSELinuxContext checks that context is a security context of the form
+// user:role:type, optionally followed by an MLS range like "s0" or
+// "s0-s0:c0.c1023".
+func checkSELinuxContext(context string) error {
+	parts := strings.SplitN(context, ":", 4)
+	if len(parts) < 3 || strings.ContainsAny(context, " \t\n") {
+		return errors.Errorf("invalid SELinux context %q, want user:role:type[:range]", context)
+	}
+	for _, p := range parts {
+		if p == "" {
+			return errors.Errorf("invalid SELinux context %q, want user:role:type[:range]", context)
+		}
+	}
+	return nil
+}
+
+// writeFileContext records the SELinux context of a file, FILECONTEXTS is
+// only written when a file has one.
+func (r *RPM) writeFileContext(f RPMFile) error {
+	if f.SELinuxContext != "" {
+		if err := checkSELinuxContext(f.SELinuxContext); err != nil {
+			return errors.Wrapf(err, "file %s", f.Name)
+		}
+		r.hasFileContexts = true
+	}
+	r.filecontexts = append(r.filecontexts, f.SELinuxContext)
+	return nil
+}
+
+func (r *RPM) writeFileContextIndexes(h *index) {
+	if r.hasFileContexts {
+		h.Add(tagFileContexts, EntryStringSlice(r.filecontexts))
+	}
+}
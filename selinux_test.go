@@ -0,0 +1,80 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCheckSELinuxContext(t *testing.T) {
+	for _, tc := range []struct {
+		context string
+		wantErr bool
+	}{
+		{context: "system_u:object_r:httpd_exec_t:s0"},
+		{context: "system_u:object_r:httpd_exec_t"},
+		{context: "system_u:object_r:httpd_sys_content_t:s0-s0:c0.c1023"},
+		{context: "httpd_exec_t", wantErr: true},
+		{context: "system_u:object_r", wantErr: true},
+		{context: "system_u::httpd_exec_t:s0", wantErr: true},
+		{context: "system_u:object_r:httpd_exec_t:", wantErr: true},
+		{context: "system_u:object_r:httpd exec_t", wantErr: true},
+	} {
+		if err := checkSELinuxContext(tc.context); (err != nil) != tc.wantErr {
+			t.Errorf("checkSELinuxContext(%q) returned error %v, want error: %v", tc.context, err, tc.wantErr)
+		}
+	}
+}
+
+func TestFileContexts(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "selinux", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/sbin/httpd", Body: []byte("httpd"), Mode: 0755, SELinuxContext: "system_u:object_r:httpd_exec_t:s0"})
+	r.AddFile(RPMFile{Name: "/usr/sbin/true", Body: []byte("true"), Mode: 0755})
+	b := buildRPM(t, r)
+	if got, want := readHeader(t, b).getStrings(tagFileContexts), []string{"system_u:object_r:httpd_exec_t:s0", ""}; !cmp.Equal(got, want) {
+		t.Errorf("FILECONTEXTS = %q, want %q", got, want)
+	}
+	info, err := ReadRPMInfo(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("ReadRPMInfo returned error %v", err)
+	}
+	if got := info.Files[0].SELinuxContext; got != "system_u:object_r:httpd_exec_t:s0" {
+		t.Errorf("ReadRPMInfo: SELinuxContext = %q, want system_u:object_r:httpd_exec_t:s0", got)
+	}
+
+	r, err = NewRPM(RPMMetaData{Name: "selinux", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/sbin/true", Body: []byte("true"), Mode: 0755})
+	if _, ok := readHeader(t, buildRPM(t, r)).entries[tagFileContexts]; ok {
+		t.Error("FILECONTEXTS is written without contexts")
+	}
+
+	r, err = NewRPM(RPMMetaData{Name: "selinux", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/sbin/httpd", Body: []byte("httpd"), SELinuxContext: "httpd_exec_t"})
+	if err := r.Write(&bytes.Buffer{}); err == nil {
+		t.Error("Write with an invalid SELinux context returned no error")
+	}
+}
@@ -3,7 +3,10 @@ package rpmpack
 import (
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
+
+	"github.com/pkg/errors"
 )
 
 type rpmSense uint32
@@ -12,22 +15,73 @@ type rpmSense uint32
 // SenseLess (2) specifies less then the specified version
 // SenseGreater (4) specifies greater then the specified version
 // SenseEqual (8) specifies equal to the specified version
+// The values match RPMSENSE_LESS, RPMSENSE_GREATER and RPMSENSE_EQUAL of rpm,
+// so ">=" is 12 and "<=" is 10.
+// https://github.com/rpm-software-management/rpm/blob/master/include/rpm/rpmds.h
 const (
 	SenseAny  rpmSense = 0
-	SenseLess          = 1 << iota
+	SenseLess rpmSense = 1 << iota
 	SenseGreater
 	SenseEqual
 )
 
+// SenseScriptPre (512) marks a requirement needed by the %pre scriptlet
+// SenseScriptPost (1024) marks a requirement needed by the %post scriptlet
+// SenseScriptPreun (2048) marks a requirement needed by the %preun scriptlet
+// SenseScriptPostun (4096) marks a requirement needed by the %postun scriptlet
+// https://github.com/rpm-software-management/rpm/blob/master/include/rpm/rpmds.h
+const (
+	SenseScriptPre rpmSense = 1 << (iota + 9)
+	SenseScriptPost
+	SenseScriptPreun
+	SenseScriptPostun
+)
+
+// SensePosttrans (32) marks a requirement needed by the %posttrans scriptlet
+// SensePretrans (128) marks a requirement needed by the %pretrans scriptlet
+// https://github.com/rpm-software-management/rpm/blob/master/include/rpm/rpmds.h
+const (
+	SensePosttrans rpmSense = 1 << 5
+	SensePretrans  rpmSense = 1 << 7
+)
+
+// SenseFindRequires (16384) marks a requirement found by a dependency generator
+// SenseFindProvides (32768) marks a provide found by a dependency generator
+// https://github.com/rpm-software-management/rpm/blob/master/include/rpm/rpmds.h
+const (
+	SenseFindRequires rpmSense = 1 << (iota + 14)
+	SenseFindProvides
+)
+
+// SenseRPMLib (16777216) marks a requirement on a feature of rpm itself, like
+// "rpmlib(PayloadIsZstd) <= 5.4.18-1"
+const SenseRPMLib rpmSense = 1 << 24
+
+// SenseConfig (268435456) marks the "config(name)" provide of a package with
+// config files
+const SenseConfig rpmSense = 1 << 28
+
+// senseCompareMask selects the version comparison bits of an rpmSense.
+const senseCompareMask = SenseLess | SenseGreater | SenseEqual
+
 var relationMatch = regexp.MustCompile(`([^=<>\s]*)\s*((?:=|>|<)*)\s*(.*)?`)
 
-// Relation is the structure of rpm sense relationships
+// Relation is the structure of rpm sense relationships.
+// Name is used verbatim, so qualified names like "glibc(x86-64)" or
+// "libc.so.6(GLIBC_2.17)(64bit)" are plain names.
 type Relation struct {
 	Name    string
 	Version string
 	Sense   rpmSense
 }
 
+// IsRich reports whether the relation is a rich (boolean) dependency like
+// "(foo or bar)". rpm tells rich dependencies apart from plain names only by the
+// leading parenthesis, so a name with an arch or soname qualifier is never rich.
+func (r *Relation) IsRich() bool {
+	return strings.HasPrefix(r.Name, "(")
+}
+
 // String return the string representation of the Relation
 func (r *Relation) String() string {
 	return fmt.Sprintf("%s%v%s", r.Name, r.Sense, r.Version)
@@ -38,7 +92,10 @@ func (r *Relation) Equal(o *Relation) bool {
 	return r.Name == o.Name && r.Version == o.Version && r.Sense == o.Sense
 }
 
-// Relations is a slice of Relation pointers
+// Relations is a slice of Relation pointers.
+// Relations are written to the header in the order they were added, which
+// mirrors how rpmbuild preserves the order of explicit dependencies in a spec
+// file. This keeps the dependency arrays stable across builds.
 type Relations []*Relation
 
 // String return the string representation of the Relations
@@ -72,7 +129,19 @@ func (r *Relations) addIfMissing(value *Relation) {
 	*r = append(*r, value)
 }
 
-// AddToIndex add the relations to the specified category on the index
+// addGenerated adds a relation found by a dependency generator, unless a
+// relation of that name was already added.
+func (r *Relations) addGenerated(name, version string, sense rpmSense) {
+	for _, relation := range *r {
+		if relation.Name == name {
+			return
+		}
+	}
+	*r = append(*r, &Relation{Name: name, Version: version, Sense: sense})
+}
+
+// AddToIndex add the relations to the specified category on the index.
+// The name, version and flags arrays keep the order of the Relations slice.
 func (r *Relations) AddToIndex(h *index, nameTag, versionTag, flagsTag int) error {
 	var (
 		num      = len(*r)
@@ -98,16 +167,63 @@ func (r *Relations) AddToIndex(h *index, nameTag, versionTag, flagsTag int) erro
 	return nil
 }
 
-// NewRelation parse a string into a Relation
+// NewRelation parse a string into a Relation, a name optionally followed by
+// an operator (<, <=, =, >= or >) and a version, like "bash >= 4.0".
+// A string starting with a parenthesis is a rich dependency like
+// "(foo or bar)" or "(foo if bar)", which is kept verbatim as the name.
 func NewRelation(related string) (*Relation, error) {
 	var (
 		err   error
 		sense rpmSense
 	)
+	if rich := strings.TrimSpace(related); strings.HasPrefix(rich, "(") {
+		if err := checkRich(rich); err != nil {
+			return nil, fmt.Errorf("invalid rich dependency %q: %v", related, err)
+		}
+		// rpm evaluates the versions inside the expression, the relation itself
+		// has no version and no comparison bits.
+		return &Relation{Name: rich}, nil
+	}
 	parts := relationMatch.FindStringSubmatch(related)
 	if sense, err = parseSense(parts[2]); err != nil {
 		return nil, err
 	}
+	// rpm only compares versions with an operator, and needs a version to
+	// compare to, like "bash >= 4.0" or "glibc = 2.28-1".
+	switch {
+	case parts[1] == "":
+		return nil, fmt.Errorf("invalid relation %q: no name", related)
+	case sense != SenseAny && parts[3] == "":
+		return nil, fmt.Errorf("invalid relation %q: operator %s without a version", related, parts[2])
+	case sense == SenseAny && parts[3] != "":
+		return nil, fmt.Errorf("invalid relation %q: version without an operator", related)
+	case strings.ContainsAny(parts[3], " \t"):
+		return nil, fmt.Errorf("invalid relation %q: the version has spaces", related)
+	}
+	// rpm compares the epoch first, as a number, so "foo >= 1:2.0" is
+	// satisfied by 1:1.0 but not by 3.0, which has epoch 0.
+	vr := parts[3]
+	if i := strings.Index(vr, ":"); i >= 0 {
+		if _, err := strconv.ParseUint(vr[:i], 10, 32); err != nil {
+			return nil, fmt.Errorf("invalid relation %q: the epoch is not a number", related)
+		}
+		vr = vr[i+1:]
+	}
+	// The version and release have the characters of Version and Release,
+	// '~' and '^' included, which sort before and after the release of the
+	// version they follow, see rpmvercmp.
+	if vr != "" {
+		v, rel := vr, ""
+		if i := strings.LastIndex(vr, "-"); i >= 0 {
+			v, rel = vr[:i], vr[i+1:]
+			if err := validateVersion("release", rel); err != nil || rel == "" {
+				return nil, fmt.Errorf("invalid relation %q: invalid release %q", related, rel)
+			}
+		}
+		if err := validateVersion("version", v); err != nil || v == "" {
+			return nil, fmt.Errorf("invalid relation %q: invalid version %q", related, v)
+		}
+	}
 
 	return &Relation{
 		Name:    parts[1],
@@ -116,6 +232,41 @@ func NewRelation(related string) (*Relation, error) {
 	}, nil
 }
 
+// checkRich checks the parentheses of a rich dependency: the expression must
+// be a single non-empty parenthesized group, possibly with nested groups.
+func checkRich(rich string) error {
+	depth := 0
+	for i, c := range rich {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if strings.TrimSpace(rich[strings.LastIndex(rich[:i], "(")+1:i]) == "" {
+				return errors.New("empty parentheses")
+			}
+			depth--
+			if depth == 0 && i != len(rich)-1 {
+				return errors.New("text after the closing parenthesis")
+			}
+		}
+	}
+	if depth != 0 {
+		return errors.New("unbalanced parentheses")
+	}
+	return nil
+}
+
+// checkNoRich returns an error if one of the relations is a rich dependency,
+// rpm does not accept them for provides and obsoletes.
+func (r *Relations) checkNoRich() error {
+	for _, rel := range *r {
+		if rel.IsRich() {
+			return fmt.Errorf("rich dependency %q is not allowed here", rel.Name)
+		}
+	}
+	return nil
+}
+
 var stringToSense = map[string]rpmSense{
 	"":   SenseAny,
 	"<":  SenseLess,
@@ -133,7 +284,7 @@ func (r rpmSense) String() string {
 	)
 
 	for ret, val = range stringToSense {
-		if r == val {
+		if r&senseCompareMask == val {
 			return ret
 		}
 	}
@@ -146,6 +297,10 @@ func parseSense(sense string) (rpmSense, error) {
 		ret rpmSense
 		ok  bool
 	)
+	// rpm also accepts "==" for equality, it is printed back as "=".
+	if sense == "==" {
+		sense = "="
+	}
 	if ret, ok = stringToSense[sense]; !ok {
 		return SenseAny, fmt.Errorf("unknown sense value: %s", sense)
 	}
@@ -1,7 +1,12 @@
 package rpmpack
 
 import (
+	"bytes"
+	"fmt"
+	"os"
 	"testing"
+
+	"github.com/google/go-cmp/cmp"
 )
 
 func TestNewRelation(t *testing.T) {
@@ -36,7 +41,11 @@ func TestNewRelation(t *testing.T) {
 			errExpected: true,
 		},
 		{
-			input:       "python == 3.5",
+			input:  "python == 3.5",
+			output: "python=3.5",
+		},
+		{
+			input:       "python === 3.5",
 			output:      "",
 			errExpected: true,
 		},
@@ -50,6 +59,80 @@ func TestNewRelation(t *testing.T) {
 			output:      "",
 			errExpected: true,
 		},
+		{
+			input:  "python < 3",
+			output: "python<3",
+		},
+		{
+			input:  "python<=3.5-1",
+			output: "python<=3.5-1",
+		},
+		{
+			input:  "python > 1:2.7",
+			output: "python>1:2.7",
+		},
+		{
+			input:  "python >= 2:3.5-1",
+			output: "python>=2:3.5-1",
+		},
+		{
+			input:       "python >= x:3.5",
+			output:      "",
+			errExpected: true,
+		},
+		{
+			input:       "python >= :3.5",
+			output:      "",
+			errExpected: true,
+		},
+		{
+			input:       "python >=",
+			output:      "",
+			errExpected: true,
+		},
+		{
+			input:       ">= 1.0",
+			output:      "",
+			errExpected: true,
+		},
+		{
+			input:       "",
+			output:      "",
+			errExpected: true,
+		},
+		{
+			input:       "python 3.5",
+			output:      "",
+			errExpected: true,
+		},
+		{
+			input:       "python >= 3.5 3.6",
+			output:      "",
+			errExpected: true,
+		},
+		{
+			input:  "python >= 3.8~rc1",
+			output: "python>=3.8~rc1",
+		},
+		{
+			input:  "python > 1:3.8^git20200101-1~beta",
+			output: "python>1:3.8^git20200101-1~beta",
+		},
+		{
+			input:       "python >= 3.8$",
+			output:      "",
+			errExpected: true,
+		},
+		{
+			input:       "python >= ~3.8",
+			output:      "",
+			errExpected: true,
+		},
+		{
+			input:       "python >= 3.8-",
+			output:      "",
+			errExpected: true,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -79,3 +162,369 @@ func TestNewRelation(t *testing.T) {
 		})
 	}
 }
+
+func TestRelationsOrder(t *testing.T) {
+	build := func() *index {
+		var requires Relations
+		for _, v := range []string{"zlib", "bash >= 4", "glibc", "awk"} {
+			if err := requires.Set(v); err != nil {
+				t.Fatalf("requires.Set(%q) returned error: %v", v, err)
+			}
+		}
+		r, err := NewRPM(RPMMetaData{Name: "test", Version: "1.0", Requires: requires, Summary: "summary"})
+		if err != nil {
+			t.Fatalf("NewRPM returned error %v", err)
+		}
+		h := newIndex(immutable)
+		if err := r.writeRelationIndexes(h); err != nil {
+			t.Fatalf("writeRelationIndexes returned error %v", err)
+		}
+		return h
+	}
+	first, second := build(), build()
+	for _, tag := range []int{tagProvides, tagProvideVersion, tagProvideFlags, tagRequires, tagRequireVersion, tagRequireFlags} {
+		if got, want := fmt.Sprintf("%x", second.entries[tag].data), fmt.Sprintf("%x", first.entries[tag].data); got != want {
+			t.Errorf("tag %d differs between builds: got %s, want %s", tag, got, want)
+		}
+	}
+	if got, want := fmt.Sprintf("%x", first.entries[tagRequires].data), fmt.Sprintf("%x", EntryStringSlice([]string{"zlib", "bash", "glibc", "awk"}).data); got != want {
+		t.Errorf("requires are not in insertion order: got %s, want %s", got, want)
+	}
+}
+
+func TestWeakDependencies(t *testing.T) {
+	rel := func(s string) Relations {
+		r, err := NewRelation(s)
+		if err != nil {
+			t.Fatalf("NewRelation(%q) returned error %v", s, err)
+		}
+		return Relations{r}
+	}
+	r, err := NewRPM(RPMMetaData{
+		Name:        "test",
+		Summary:     "summary",
+		Recommends:  rel("bash-completion"),
+		Suggests:    rel("bash-doc >= 5.0"),
+		Supplements: rel("bash"),
+		Enhances:    rel("zsh < 6"),
+
+		OrderWithRequires: rel("systemd >= 239"),
+	})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	h := newIndex(immutable)
+	if err := r.writeRelationIndexes(h); err != nil {
+		t.Fatalf("writeRelationIndexes returned error %v", err)
+	}
+	testCases := []struct {
+		names, versions, flags int
+		want                   []string
+		wantFlags              []uint32
+	}{
+		{tagRecommends, tagRecommendVersion, tagRecommendFlags, []string{"bash-completion", ""}, []uint32{uint32(SenseAny)}},
+		{tagSuggests, tagSuggestVersion, tagSuggestFlags, []string{"bash-doc", "5.0"}, []uint32{uint32(SenseGreater | SenseEqual)}},
+		{tagSupplements, tagSupplementVersion, tagSupplementFlags, []string{"bash", ""}, []uint32{uint32(SenseAny)}},
+		{tagEnhances, tagEnhanceVersion, tagEnhanceFlags, []string{"zsh", "6"}, []uint32{uint32(SenseLess)}},
+		{tagOrderName, tagOrderVersion, tagOrderFlags, []string{"systemd", "239"}, []uint32{uint32(SenseGreater | SenseEqual)}},
+	}
+	for _, tc := range testCases {
+		got := append(h.getStrings(tc.names), h.getStrings(tc.versions)...)
+		if d := cmp.Diff(tc.want, got); d != "" {
+			t.Errorf("tag %d: unexpected names and versions (-want, +got): %s", tc.names, d)
+		}
+		if d := cmp.Diff(tc.wantFlags, h.getUint32s(tc.flags)); d != "" {
+			t.Errorf("tag %d: unexpected flags (-want, +got): %s", tc.flags, d)
+		}
+	}
+}
+
+func TestScriptRequirements(t *testing.T) {
+	testCases := []struct {
+		name      string
+		add       func(*RPM, *Relation)
+		wantFlags uint32
+	}{{
+		name:      "pre",
+		add:       (*RPM).RequiresPre,
+		wantFlags: 512 | 8,
+	}, {
+		name:      "post",
+		add:       (*RPM).RequiresPost,
+		wantFlags: 1024 | 8,
+	}, {
+		name:      "preun",
+		add:       (*RPM).RequiresPreun,
+		wantFlags: 2048 | 8,
+	}, {
+		name:      "postun",
+		add:       (*RPM).RequiresPostun,
+		wantFlags: 4096 | 8,
+	}, {
+		name:      "pretrans",
+		add:       (*RPM).RequiresPretrans,
+		wantFlags: 128 | 8,
+	}, {
+		name:      "posttrans",
+		add:       (*RPM).RequiresPosttrans,
+		wantFlags: 32 | 8,
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewRPM(RPMMetaData{Name: "test", Summary: "summary"})
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			rel, err := NewRelation("systemd = 245")
+			if err != nil {
+				t.Fatalf("NewRelation returned error %v", err)
+			}
+			tc.add(r, rel)
+			if rel.Sense != SenseEqual {
+				t.Errorf("the passed relation was modified: %v", rel.Sense)
+			}
+			h := newIndex(immutable)
+			if err := r.writeRelationIndexes(h); err != nil {
+				t.Fatalf("writeRelationIndexes returned error %v", err)
+			}
+			if got, want := fmt.Sprintf("%x", h.entries[tagRequireFlags].data), fmt.Sprintf("%08x", tc.wantFlags); got != want {
+				t.Errorf("require flags = %s, want %s", got, want)
+			}
+			if got, want := r.Requires.String(), "systemd=245"; got != want {
+				t.Errorf("requires = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestRequiresScriptlet(t *testing.T) {
+	testCases := []struct {
+		name      string
+		ts        []ScriptletType
+		wantFlags rpmSense
+		wantErr   bool
+	}{{
+		name:      "post",
+		ts:        []ScriptletType{PostinScriptlet},
+		wantFlags: SenseScriptPost | SenseGreater | SenseEqual,
+	}, {
+		name:      "post and preun",
+		ts:        []ScriptletType{PostinScriptlet, PreunScriptlet},
+		wantFlags: SenseScriptPost | SenseScriptPreun | SenseGreater | SenseEqual,
+	}, {
+		name:      "pretrans",
+		ts:        []ScriptletType{PretransScriptlet},
+		wantFlags: SensePretrans | SenseGreater | SenseEqual,
+	}, {
+		name:    "none",
+		wantErr: true,
+	}, {
+		name:    "unknown",
+		ts:      []ScriptletType{PosttransScriptlet + 1},
+		wantErr: true,
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewRPM(RPMMetaData{Name: "test", Version: "1.0", Summary: "summary", NoSelfProvides: true})
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			err = r.RequiresScriptlet(&Relation{Name: "systemd", Version: "245", Sense: SenseGreater | SenseEqual}, tc.ts...)
+			if tc.wantErr {
+				if err == nil {
+					t.Error("RequiresScriptlet returned no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RequiresScriptlet returned error %v", err)
+			}
+			if len(r.Requires) != 1 || r.Requires[0].Sense != tc.wantFlags {
+				t.Errorf("requires = %v, want one with flags %d", r.Requires, tc.wantFlags)
+			}
+			b := &bytes.Buffer{}
+			if err := r.WriteSpec(b); err != nil {
+				t.Fatalf("WriteSpec returned error %v", err)
+			}
+			r2, err := ReadSpec(b, os.TempDir())
+			if err != nil {
+				t.Fatalf("ReadSpec returned error %v\n%s", err, b)
+			}
+			if len(r2.Requires) != 1 || r2.Requires[0].Sense != tc.wantFlags {
+				t.Errorf("requires read back from the spec = %v, want one with flags %d", r2.Requires, tc.wantFlags)
+			}
+		})
+	}
+}
+
+func TestQualifiedRelation(t *testing.T) {
+	testCases := []struct {
+		input    string
+		wantName string
+		wantRich bool
+	}{{
+		input:    "glibc(x86-64) >= 2.17",
+		wantName: "glibc(x86-64)",
+	}, {
+		input:    "libc.so.6(GLIBC_2.17)(64bit)",
+		wantName: "libc.so.6(GLIBC_2.17)(64bit)",
+	}, {
+		input:    "perl(File::Temp)",
+		wantName: "perl(File::Temp)",
+	}}
+	for _, tc := range testCases {
+		relation, err := NewRelation(tc.input)
+		if err != nil {
+			t.Errorf("NewRelation(%q) returned error %v", tc.input, err)
+			continue
+		}
+		if relation.Name != tc.wantName {
+			t.Errorf("NewRelation(%q).Name = %q, want %q", tc.input, relation.Name, tc.wantName)
+		}
+		if relation.IsRich() {
+			t.Errorf("NewRelation(%q).IsRich() = true, want false", tc.input)
+		}
+	}
+	rich := &Relation{Name: "(glibc(x86-64) or musl)"}
+	if !rich.IsRich() {
+		t.Errorf("%q should be a rich dependency", rich.Name)
+	}
+}
+
+func TestRichRelation(t *testing.T) {
+	testCases := []struct {
+		input       string
+		wantName    string
+		errExpected bool
+	}{
+		{input: "(pkgA or pkgB)", wantName: "(pkgA or pkgB)"},
+		{input: " (foo if bar) ", wantName: "(foo if bar)"},
+		{input: "(foo >= 1.0 with (bar or baz < 2))", wantName: "(foo >= 1.0 with (bar or baz < 2))"},
+		{input: "(foo or bar", errExpected: true},
+		{input: "(foo or bar))", errExpected: true},
+		{input: "(foo) or bar", errExpected: true},
+		{input: "(foo or ())", errExpected: true},
+	}
+	for _, tc := range testCases {
+		relation, err := NewRelation(tc.input)
+		if tc.errExpected {
+			if err == nil {
+				t.Errorf("NewRelation(%q) = %v, want error", tc.input, relation)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NewRelation(%q) returned error %v", tc.input, err)
+			continue
+		}
+		if d := cmp.Diff(&Relation{Name: tc.wantName}, relation); d != "" {
+			t.Errorf("NewRelation(%q) unexpected relation (-want, +got): %s", tc.input, d)
+		}
+		if !relation.IsRich() {
+			t.Errorf("NewRelation(%q).IsRich() = false, want true", tc.input)
+		}
+	}
+}
+
+func TestRichRelationIndexes(t *testing.T) {
+	rich, err := NewRelation("(pkgA or pkgB)")
+	if err != nil {
+		t.Fatalf("NewRelation returned error %v", err)
+	}
+	r, err := NewRPM(RPMMetaData{Name: "test", Summary: "summary", Requires: Relations{rich}, Conflicts: Relations{rich}})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	h := newIndex(immutable)
+	if err := r.writeRelationIndexes(h); err != nil {
+		t.Fatalf("writeRelationIndexes returned error %v", err)
+	}
+	if d := cmp.Diff([]string{"(pkgA or pkgB)", ""}, append(h.getStrings(tagRequires), h.getStrings(tagRequireVersion)...)); d != "" {
+		t.Errorf("unexpected requires (-want, +got): %s", d)
+	}
+	if d := cmp.Diff([]uint32{0}, h.getUint32s(tagRequireFlags)); d != "" {
+		t.Errorf("unexpected require flags (-want, +got): %s", d)
+	}
+	for _, md := range []RPMMetaData{
+		{Name: "test", Summary: "summary", Provides: Relations{rich}},
+		{Name: "test", Summary: "summary", Obsoletes: Relations{rich}},
+	} {
+		r, err := NewRPM(md)
+		if err != nil {
+			t.Fatalf("NewRPM returned error %v", err)
+		}
+		if err := r.writeRelationIndexes(newIndex(immutable)); err == nil {
+			t.Errorf("writeRelationIndexes accepted a rich provides or obsoletes")
+		}
+	}
+}
+
+func TestSenseFlags(t *testing.T) {
+	testCases := []struct {
+		op         string
+		wantFlags  uint32
+		wantString string
+	}{
+		{op: "", wantFlags: 0, wantString: ""},
+		{op: "<", wantFlags: 2, wantString: "<"},
+		{op: ">", wantFlags: 4, wantString: ">"},
+		{op: "=", wantFlags: 8, wantString: "="},
+		{op: "==", wantFlags: 8, wantString: "="},
+		{op: "<=", wantFlags: 10, wantString: "<="},
+		{op: ">=", wantFlags: 12, wantString: ">="},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.op, func(t *testing.T) {
+			input := "foo"
+			if tc.op != "" {
+				input = "foo " + tc.op + " 1.0"
+			}
+			rel, err := NewRelation(input)
+			if err != nil {
+				t.Fatalf("NewRelation(%q) returned error %v", input, err)
+			}
+			h := newIndex(immutable)
+			rels := Relations{rel}
+			if err := rels.AddToIndex(h, tagRequires, tagRequireVersion, tagRequireFlags); err != nil {
+				t.Fatalf("AddToIndex returned error %v", err)
+			}
+			if d := cmp.Diff([]uint32{tc.wantFlags}, h.getUint32s(tagRequireFlags)); d != "" {
+				t.Errorf("flags mismatch (-want +got):\n%s", d)
+			}
+			if got := rel.Sense.String(); got != tc.wantString {
+				t.Errorf("Sense.String() = %q, want %q", got, tc.wantString)
+			}
+		})
+	}
+}
+
+func TestUnversionedProvides(t *testing.T) {
+	var provides Relations
+	for _, p := range []string{"webserver", "httpd = 2.4", "httpd-mmn", "mod_ssl >= 1:2.4"} {
+		if err := provides.Set(p); err != nil {
+			t.Fatalf("Set(%q) returned error %v", p, err)
+		}
+	}
+	h := newIndex(immutable)
+	if err := provides.AddToIndex(h, tagProvides, tagProvideVersion, tagProvideFlags); err != nil {
+		t.Fatalf("AddToIndex returned error %v", err)
+	}
+	names := h.getStrings(tagProvides)
+	versions := h.getStrings(tagProvideVersion)
+	flags := h.getUint32s(tagProvideFlags)
+	if len(names) != 4 || len(versions) != 4 || len(flags) != 4 {
+		t.Fatalf("array lengths = %d, %d, %d, want 4", len(names), len(versions), len(flags))
+	}
+	if d := cmp.Diff([]string{"webserver", "httpd", "httpd-mmn", "mod_ssl"}, names); d != "" {
+		t.Errorf("names mismatch (-want +got):\n%s", d)
+	}
+	if d := cmp.Diff([]string{"", "2.4", "", "1:2.4"}, versions); d != "" {
+		t.Errorf("versions mismatch (-want +got):\n%s", d)
+	}
+	if d := cmp.Diff([]uint32{0, 8, 0, 12}, flags); d != "" {
+		t.Errorf("flags mismatch (-want +got):\n%s", d)
+	}
+}
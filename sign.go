@@ -0,0 +1,267 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// Signer creates OpenPGP signatures for rpm files.
+// Sign returns a binary (not armored) detached OpenPGP signature of data.
+// Implementations can keep the key material out of process, in an HSM, a
+// cloud KMS or a remote signing service. See NewCryptoSigner for signers that
+// only need to sign a digest.
+type Signer interface {
+	Sign(data io.Reader) ([]byte, error)
+}
+
+// SetSigner signs the rpm with s, the way rpmsign does: Write adds both a
+// header-only and a header+payload signature to the signature header, so
+// `rpm -K` checks them once the public key is imported with `rpm --import`.
+// Like rpmsign, the tags depend on the key algorithm: RSAHEADER and PGP with
+// RSA keys, DSAHEADER and GPG with the others, like ECDSA.
+// SetSigner replaces a signer set with SetPGPSigner.
+func (r *RPM) SetSigner(s Signer) {
+	r.headerSigner = func(b []byte) ([]byte, error) {
+		return s.Sign(bytes.NewReader(b))
+	}
+	r.pgpSigner = s.Sign
+}
+
+// SetHeaderSignature sets sig, a binary detached OpenPGP signature of the
+// header returned by FinalizeHeader, as the header-only (RSAHEADER or
+// DSAHEADER) signature that Write adds. It replaces the header-only
+// signature of SetSigner, and the header must be finalized first.
+func (r *RPM) SetHeaderSignature(sig []byte) error {
+	if r.header == nil {
+		return errors.New("the header is not finalized, see FinalizeHeader")
+	}
+	r.headerSigner = func([]byte) ([]byte, error) {
+		return sig, nil
+	}
+	return nil
+}
+
+// SetPGPKey signs the rpm with the private key of e, see SetSigner.
+// The signatures use SHA256. The private key must be decrypted, see
+// openpgp.Entity.PrivateKey.Decrypt.
+func (r *RPM) SetPGPKey(e *openpgp.Entity) error {
+	if e.PrivateKey == nil {
+		return errors.New("pgp key has no private key")
+	}
+	if e.PrivateKey.Encrypted {
+		return errors.New("pgp private key is encrypted")
+	}
+	r.SetSigner(entitySigner{e})
+	return nil
+}
+
+// signatureTags returns the tags of the header-only and the header+payload
+// signatures for the OpenPGP signature sig, from its key algorithm like
+// rpmsign does. Signatures of another format, which rpm cannot check anyway,
+// keep the RSA tags that SetPGPSigner always used.
+func signatureTags(sig []byte) (int, int) {
+	var algo packet.PublicKeyAlgorithm
+	p, err := packet.Read(bytes.NewReader(sig))
+	switch s := p.(type) {
+	case *packet.Signature:
+		algo = s.PubKeyAlgo
+	case *packet.SignatureV3:
+		algo = s.PubKeyAlgo
+	}
+	if err != nil || algo == 0 || algo == packet.PubKeyAlgoRSA || algo == packet.PubKeyAlgoRSASignOnly {
+		return sigRSA, sigPGP
+	}
+	return sigDSA, sigGPG
+}
+
+// headerSignature returns the header-only signature of the signature header
+// s, RSAHEADER or DSAHEADER.
+func headerSignature(s *index) (IndexEntry, bool) {
+	if e, ok := s.entries[sigRSA]; ok {
+		return e, true
+	}
+	e, ok := s.entries[sigDSA]
+	return e, ok
+}
+
+// payloadSignature returns the header+payload signature of the signature
+// header s, PGP or GPG.
+func payloadSignature(s *index) (IndexEntry, bool) {
+	if e, ok := s.entries[sigPGP]; ok {
+		return e, true
+	}
+	e, ok := s.entries[sigGPG]
+	return e, ok
+}
+
+type entitySigner struct {
+	e *openpgp.Entity
+}
+
+// signatureTime returns the creation time of new signatures. With
+// SOURCE_DATE_EPOCH, RSA signatures are reproducible too.
+func signatureTime() (time.Time, error) {
+	t, err := sourceDateEpoch()
+	if err != nil || !t.IsZero() {
+		return t, err
+	}
+	return time.Now(), nil
+}
+
+func (s entitySigner) Sign(data io.Reader) ([]byte, error) {
+	created, err := signatureTime()
+	if err != nil {
+		return nil, err
+	}
+	config := &packet.Config{
+		DefaultHash: crypto.SHA256,
+		Time:        func() time.Time { return created },
+	}
+	sig := &bytes.Buffer{}
+	if err := openpgp.DetachSign(sig, s.e, data, config); err != nil {
+		return nil, err
+	}
+	return sig.Bytes(), nil
+}
+
+// NewCryptoSigner returns a Signer creating OpenPGP signatures with key, which
+// only sees the SHA256 digest of the signed data. This fits HSMs and cloud KMS
+// whose keys implement crypto.Signer. Only RSA and ECDSA keys are supported.
+// created is the creation time of the OpenPGP key, which is part of the key
+// id: it must match the public key imported with `rpm --import`.
+func NewCryptoSigner(key crypto.Signer, created time.Time) (Signer, error) {
+	switch key.Public().(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, errors.Errorf("unsupported key type %T", key.Public())
+	}
+	return cryptoSigner{packet.NewSignerPrivateKey(created, key)}, nil
+}
+
+type cryptoSigner struct {
+	key *packet.PrivateKey
+}
+
+func (s cryptoSigner) Sign(data io.Reader) ([]byte, error) {
+	created, err := signatureTime()
+	if err != nil {
+		return nil, err
+	}
+	sig := &packet.Signature{
+		SigType:      packet.SigTypeBinary,
+		PubKeyAlgo:   s.key.PubKeyAlgo,
+		Hash:         crypto.SHA256,
+		CreationTime: created,
+		IssuerKeyId:  &s.key.KeyId,
+	}
+	h := sig.Hash.New()
+	if _, err := io.Copy(h, data); err != nil {
+		return nil, errors.Wrap(err, "failed to hash signed data")
+	}
+	if err := sig.Sign(h, s.key, nil); err != nil {
+		return nil, errors.Wrap(err, "failed to sign")
+	}
+	b := &bytes.Buffer{}
+	if err := sig.Serialize(b); err != nil {
+		return nil, errors.Wrap(err, "failed to serialize signature")
+	}
+	return b.Bytes(), nil
+}
+
+// Resign writes a copy of the rpm file r to w, signed with s like SetSigner
+// does. Existing header-only and header+payload signatures are replaced, the
+// lead, header and payload are copied unchanged. If the rpm has reserved
+// space in its signatures header, the reservation is resized to keep the
+// header and payload at the same offset.
+func Resign(r io.ReadSeeker, w io.Writer, s Signer) error {
+	lead := make([]byte, 0x60)
+	if _, err := io.ReadFull(r, lead); err != nil {
+		return errors.Wrap(err, "failed to read lead")
+	}
+	if _, err := readLead(bytes.NewReader(lead)); err != nil {
+		return err
+	}
+	sigs, err := readSignatures(r)
+	if err != nil {
+		return err
+	}
+	headerStart, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return errors.Wrap(err, "failed to find the header")
+	}
+	hb := &bytes.Buffer{}
+	if _, _, err := readIndex(io.TeeReader(r, hb)); err != nil {
+		return errors.Wrap(err, "failed to read header")
+	}
+	payloadStart, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return errors.Wrap(err, "failed to find the payload")
+	}
+
+	headerSig, err := s.Sign(bytes.NewReader(hb.Bytes()))
+	if err != nil {
+		return errors.Wrap(err, "call to header signer failed")
+	}
+	pgpSig, err := s.Sign(io.MultiReader(bytes.NewReader(hb.Bytes()), r))
+	if err != nil {
+		return errors.Wrap(err, "call to signer failed")
+	}
+	headerTag, _ := signatureTags(headerSig)
+	_, pgpTag := signatureTags(pgpSig)
+	for _, tag := range []int{sigDSA, sigRSA, sigPGP, sigGPG} {
+		delete(sigs.entries, tag)
+	}
+	sigs.Add(headerTag, EntryBytes(headerSig))
+	sigs.Add(pgpTag, EntryBytes(pgpSig))
+	sb, err := sigs.Bytes()
+	if err != nil {
+		return errors.Wrap(err, "failed to retrieve signatures header")
+	}
+	if reserved, ok := sigs.entries[sigReservedSpace]; ok {
+		// Both sizes are padded to 8 bytes, and so is the difference, which keeps
+		// the alignment of the entries following the reservation.
+		grow := len(sb) + len(signaturePadding(len(sb))) - int(headerStart-0x60)
+		if grow < len(reserved.data) {
+			sigs.Add(sigReservedSpace, EntryBytes(make([]byte, len(reserved.data)-grow)))
+		} else {
+			delete(sigs.entries, sigReservedSpace)
+		}
+		if sb, err = sigs.Bytes(); err != nil {
+			return errors.Wrap(err, "failed to retrieve signatures header")
+		}
+	}
+
+	if _, err := r.Seek(payloadStart, io.SeekStart); err != nil {
+		return errors.Wrap(err, "failed to seek to the payload")
+	}
+	cw := &countingWriter{w: w}
+	for _, b := range [][]byte{lead, sb, signaturePadding(len(sb)), hb.Bytes()} {
+		if _, err := cw.Write(b); err != nil {
+			return errors.Wrap(err, "failed to write signed rpm")
+		}
+	}
+	_, err = io.Copy(cw, r)
+	return errors.Wrap(err, "failed to write payload")
+}
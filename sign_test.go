@@ -0,0 +1,349 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func TestSetPGPKey(t *testing.T) {
+	e := newTestEntity(t, "signer")
+	r, err := NewRPM(RPMMetaData{Name: "signed", Version: "1.0", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/share/signed/file", Body: []byte("content")})
+	if err := r.SetPGPKey(e); err != nil {
+		t.Fatalf("SetPGPKey returned error %v", err)
+	}
+	b := buildRPM(t, r)
+	s, err := readSignatures(bytes.NewReader(b[0x60:]))
+	if err != nil {
+		t.Fatalf("readSignatures returned error %v", err)
+	}
+	for _, tag := range []int{sigRSA, sigPGP} {
+		if _, ok := s.entries[tag]; !ok {
+			t.Errorf("signature tag %d missing", tag)
+		}
+	}
+	keyID, err := VerifySignature(bytes.NewReader(b), openpgp.EntityList{e})
+	if err != nil {
+		t.Fatalf("VerifySignature returned error %v", err)
+	}
+	if keyID != e.PrimaryKey.KeyId {
+		t.Errorf("VerifySignature() = %x, want %x", keyID, e.PrimaryKey.KeyId)
+	}
+}
+
+func TestSetPGPKeyWithoutPrivateKey(t *testing.T) {
+	e := newTestEntity(t, "signer")
+	pub := &openpgp.Entity{PrimaryKey: e.PrimaryKey, Identities: e.Identities}
+	r, err := NewRPM(RPMMetaData{Name: "signed", Version: "1.0", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	if err := r.SetPGPKey(pub); err == nil {
+		t.Error("SetPGPKey with a public key should return an error")
+	}
+}
+
+// digestSigner is a crypto.Signer that only sees digests, like an HSM.
+type digestSigner struct {
+	crypto.Signer
+	digests [][]byte
+}
+
+func (s *digestSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	s.digests = append(s.digests, digest)
+	return s.Signer.Sign(rand, digest, opts)
+}
+
+// publicEntity returns the self-signed public OpenPGP key of key, as it would
+// be exported for `rpm --import`.
+func publicEntity(t *testing.T, key crypto.Signer, created time.Time) *openpgp.Entity {
+	t.Helper()
+	priv := packet.NewSignerPrivateKey(created, key)
+	uid := packet.NewUserId("signer", "", "signer@example.com")
+	primary := true
+	sig := &packet.Signature{
+		SigType:      packet.SigTypePositiveCert,
+		PubKeyAlgo:   priv.PubKeyAlgo,
+		Hash:         crypto.SHA256,
+		CreationTime: created,
+		IssuerKeyId:  &priv.KeyId,
+		IsPrimaryId:  &primary,
+		FlagsValid:   true,
+		FlagSign:     true,
+	}
+	if err := sig.SignUserId(uid.Id, &priv.PublicKey, priv, nil); err != nil {
+		t.Fatalf("SignUserId returned error %v", err)
+	}
+	return &openpgp.Entity{
+		PrimaryKey: &priv.PublicKey,
+		Identities: map[string]*openpgp.Identity{
+			uid.Id: {Name: uid.Id, UserId: uid, SelfSignature: sig},
+		},
+	}
+}
+
+func TestCryptoSigner(t *testing.T) {
+	created := time.Unix(1600000000, 0)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey returned error %v", err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey returned error %v", err)
+	}
+	testCases := []struct {
+		name string
+		key  crypto.Signer
+		// wantTags are the header-only and header+payload signature tags.
+		wantTags []int
+	}{{
+		name:     "ecdsa",
+		key:      ecKey,
+		wantTags: []int{sigDSA, sigGPG},
+	}, {
+		name:     "rsa",
+		key:      rsaKey,
+		wantTags: []int{sigRSA, sigPGP},
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			key := &digestSigner{Signer: tc.key}
+			s, err := NewCryptoSigner(key, created)
+			if err != nil {
+				t.Fatalf("NewCryptoSigner returned error %v", err)
+			}
+			r, err := NewRPM(RPMMetaData{Name: "signed", Version: "1.0", Summary: "summary"})
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			r.AddFile(RPMFile{Name: "/usr/share/signed/file", Body: []byte("content")})
+			r.SetSigner(s)
+			b := buildRPM(t, r)
+			if len(key.digests) != 2 {
+				t.Fatalf("key signed %d times, want 2 (header, header+payload)", len(key.digests))
+			}
+			for _, d := range key.digests {
+				if len(d) != sha256.Size {
+					t.Errorf("key signed %d bytes, want a sha256 digest", len(d))
+				}
+			}
+			e := publicEntity(t, tc.key, created)
+			keyID, err := VerifySignature(bytes.NewReader(b), openpgp.EntityList{e})
+			if err != nil {
+				t.Fatalf("VerifySignature returned error %v", err)
+			}
+			if keyID != e.PrimaryKey.KeyId {
+				t.Errorf("VerifySignature() = %x, want %x", keyID, e.PrimaryKey.KeyId)
+			}
+			if err := Verify(bytes.NewReader(b), openpgp.EntityList{e}); err != nil {
+				t.Errorf("Verify returned error %v", err)
+			}
+
+			// Resigning a package signed with an RSA key replaces its tags.
+			r, err = NewRPM(RPMMetaData{Name: "signed", Version: "1.0", Summary: "summary"})
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			r.AddFile(RPMFile{Name: "/usr/share/signed/file", Body: []byte("content")})
+			if err := r.SetPGPKey(newTestEntity(t, "rsa")); err != nil {
+				t.Fatalf("SetPGPKey returned error %v", err)
+			}
+			out := &bytes.Buffer{}
+			if err := Resign(bytes.NewReader(buildRPM(t, r)), out, s); err != nil {
+				t.Fatalf("Resign returned error %v", err)
+			}
+			if _, err := VerifySignature(bytes.NewReader(out.Bytes()), openpgp.EntityList{e}); err != nil {
+				t.Errorf("VerifySignature of the resigned rpm returned error %v", err)
+			}
+			for name, b := range map[string][]byte{"written": b, "resigned": out.Bytes()} {
+				sigs, err := readSignatures(bytes.NewReader(b[0x60:]))
+				if err != nil {
+					t.Fatalf("readSignatures returned error %v", err)
+				}
+				for _, tag := range []int{sigDSA, sigRSA, sigPGP, sigGPG} {
+					want := tag == tc.wantTags[0] || tag == tc.wantTags[1]
+					if _, ok := sigs.entries[tag]; ok != want {
+						t.Errorf("%s rpm has signature tag %d: %v, want %v", name, tag, ok, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+// unsupportedKey is a crypto.Signer with a key type openpgp does not know.
+type unsupportedKey struct{}
+
+func (unsupportedKey) Public() crypto.PublicKey { return []byte("public") }
+func (unsupportedKey) Sign(io.Reader, []byte, crypto.SignerOpts) ([]byte, error) {
+	return nil, nil
+}
+
+func TestCryptoSignerUnsupportedKey(t *testing.T) {
+	if _, err := NewCryptoSigner(unsupportedKey{}, time.Now()); err == nil {
+		t.Error("NewCryptoSigner with an unsupported key should return an error")
+	}
+}
+
+func TestResign(t *testing.T) {
+	first := newTestEntity(t, "first")
+	second := newTestEntity(t, "second")
+	r, err := NewRPM(RPMMetaData{Name: "resigned", Version: "1.0", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/share/resigned/file", Body: []byte("content")})
+	if err := r.SetPGPKey(first); err != nil {
+		t.Fatalf("SetPGPKey returned error %v", err)
+	}
+	signed := buildRPM(t, r)
+
+	out := &bytes.Buffer{}
+	if err := Resign(bytes.NewReader(signed), out, entitySigner{second}); err != nil {
+		t.Fatalf("Resign returned error %v", err)
+	}
+	resigned := out.Bytes()
+	keyID, err := VerifySignature(bytes.NewReader(resigned), openpgp.EntityList{second})
+	if err != nil {
+		t.Fatalf("VerifySignature returned error %v", err)
+	}
+	if keyID != second.PrimaryKey.KeyId {
+		t.Errorf("VerifySignature() = %x, want %x", keyID, second.PrimaryKey.KeyId)
+	}
+	if _, err := VerifySignature(bytes.NewReader(resigned), openpgp.EntityList{first}); err == nil {
+		t.Error("the signature of the first key should have been replaced")
+	}
+	if !bytes.Equal(readPayload(t, signed), readPayload(t, resigned)) {
+		t.Error("Resign changed the payload")
+	}
+	s, err := readSignatures(bytes.NewReader(resigned[0x60:]))
+	if err != nil {
+		t.Fatalf("readSignatures returned error %v", err)
+	}
+	for _, tag := range []int{sigSize, sigSHA256, sigPayloadSize} {
+		if _, ok := s.entries[tag]; !ok {
+			t.Errorf("signature tag %d was dropped", tag)
+		}
+	}
+	for _, n := range []int{0x20, len(resigned) - 1} {
+		if err := Resign(bytes.NewReader(signed), &failingWriter{n: n, short: true}, entitySigner{second}); err == nil {
+			t.Errorf("Resign with a short write after %d bytes returned no error", n)
+		}
+	}
+}
+
+func TestFinalizeHeader(t *testing.T) {
+	e := newTestEntity(t, "detached")
+	r, err := NewRPM(RPMMetaData{Name: "detached", Version: "1.0", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/share/detached/file", Body: []byte("content")})
+	if err := r.SetHeaderSignature(nil); err == nil {
+		t.Error("SetHeaderSignature before FinalizeHeader returned no error")
+	}
+	h, err := r.FinalizeHeader()
+	if err != nil {
+		t.Fatalf("FinalizeHeader returned error %v", err)
+	}
+	if sum := sha256.Sum256(h.Bytes); !bytes.Equal(sum[:], h.SHA256) {
+		t.Errorf("FinalizeHeader().SHA256 = %x, want %x", h.SHA256, sum)
+	}
+	// The signature is made without the rpm, as a signing service would.
+	sig, err := entitySigner{e}.Sign(bytes.NewReader(h.Bytes))
+	if err != nil {
+		t.Fatalf("Sign returned error %v", err)
+	}
+	if err := r.SetHeaderSignature(sig); err != nil {
+		t.Fatalf("SetHeaderSignature returned error %v", err)
+	}
+	// Files added after FinalizeHeader are not part of the rpm.
+	r.AddFile(RPMFile{Name: "/usr/share/detached/late", Body: []byte("late")})
+	b := buildRPM(t, r)
+	if _, err := VerifySignature(bytes.NewReader(b), openpgp.EntityList{e}); err != nil {
+		t.Errorf("VerifySignature returned error %v", err)
+	}
+	rd := bytes.NewReader(b[0x60:])
+	if _, err := readSignatures(rd); err != nil {
+		t.Fatalf("readSignatures returned error %v", err)
+	}
+	if got := b[len(b)-rd.Len():][:len(h.Bytes)]; !bytes.Equal(got, h.Bytes) {
+		t.Error("Write wrote a different header than FinalizeHeader returned")
+	}
+	if err := Verify(bytes.NewReader(b), nil); err != nil {
+		t.Errorf("Verify returned error %v", err)
+	}
+}
+
+func TestResignNotRPM(t *testing.T) {
+	err := Resign(bytes.NewReader(make([]byte, 0x100)), ioutil.Discard, entitySigner{newTestEntity(t, "signer")})
+	if err != ErrNotRPM {
+		t.Errorf("Resign returned error %v, want %v", err, ErrNotRPM)
+	}
+}
+
+func TestResignReservedSpace(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "reserved", Version: "1.0", Summary: "summary", ReservedSpace: 4096})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/share/reserved/file", Body: []byte("content")})
+	unsigned := buildRPM(t, r)
+	s, err := readSignatures(bytes.NewReader(unsigned[0x60:]))
+	if err != nil {
+		t.Fatalf("readSignatures returned error %v", err)
+	}
+	if got := len(s.entries[sigReservedSpace].data); got != 4096 {
+		t.Fatalf("reserved space = %d bytes, want 4096", got)
+	}
+
+	out := &bytes.Buffer{}
+	if err := Resign(bytes.NewReader(unsigned), out, entitySigner{newTestEntity(t, "signer")}); err != nil {
+		t.Fatalf("Resign returned error %v", err)
+	}
+	resigned := out.Bytes()
+	if len(resigned) != len(unsigned) {
+		t.Errorf("Resign changed the size from %d to %d", len(unsigned), len(resigned))
+	}
+	if !bytes.Equal(resigned[len(resigned)-len(readPayload(t, unsigned)):], readPayload(t, unsigned)) {
+		t.Error("Resign moved the payload")
+	}
+	s, err = readSignatures(bytes.NewReader(resigned[0x60:]))
+	if err != nil {
+		t.Fatalf("readSignatures returned error %v", err)
+	}
+	if got := len(s.entries[sigReservedSpace].data); got >= 4096 || got == 0 {
+		t.Errorf("reserved space = %d bytes, want it to shrink", got)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// SparseExtent is a region of a sparse file holding data. The rest of the
+// file is holes, which read as zeros.
+type SparseExtent struct {
+	Offset, Length int64
+}
+
+// NewSparseFile returns a regular file at destPath of size bytes, whose
+// content is read from r at the data extents only, sorted by offset. The holes
+// between them are never read, so that a sparse file like a VM image is
+// packaged without reading, or holding in memory, its apparent size.
+// SparseExtents finds the extents of a file on disk.
+//
+// The cpio payload of rpm has no holes: they are written as zeros, which
+// compress to almost nothing, and rpm installs the file fully allocated.
+func NewSparseFile(destPath string, r io.ReaderAt, size int64, data []SparseExtent) (RPMFile, error) {
+	end := int64(0)
+	for _, e := range data {
+		if e.Offset < end || e.Length <= 0 || e.Offset+e.Length > size {
+			return RPMFile{}, errors.Errorf("sparse file %s has an invalid extent at %d of length %d", destPath, e.Offset, e.Length)
+		}
+		end = e.Offset + e.Length
+	}
+	return RPMFile{
+		Name:   destPath,
+		Mode:   0100644,
+		Owner:  "root",
+		Group:  "root",
+		Reader: &sparseReader{r: r, size: size, data: data},
+		Size:   size,
+	}, nil
+}
+
+// wholeFile returns the extents of a file of size bytes without holes.
+func wholeFile(size int64) []SparseExtent {
+	if size == 0 {
+		return nil
+	}
+	return []SparseExtent{{Offset: 0, Length: size}}
+}
+
+// sparseReader reads the extents of a sparse file from r, and zeros for the
+// holes. It is an io.Seeker, so that Write reads the content again instead
+// of holding it in memory.
+type sparseReader struct {
+	r    io.ReaderAt
+	size int64
+	data []SparseExtent
+	off  int64
+}
+
+func (s *sparseReader) Read(p []byte) (int, error) {
+	if s.off >= s.size {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > s.size-s.off {
+		p = p[:s.size-s.off]
+	}
+	// The extent holding off, or else the next one.
+	i := sort.Search(len(s.data), func(i int) bool { return s.data[i].Offset+s.data[i].Length > s.off })
+	if i < len(s.data) && s.data[i].Offset <= s.off {
+		if n := s.data[i].Offset + s.data[i].Length - s.off; int64(len(p)) > n {
+			p = p[:n]
+		}
+		n, err := s.r.ReadAt(p, s.off)
+		s.off += int64(n)
+		if err == io.EOF && n == len(p) {
+			err = nil
+		}
+		return n, err
+	}
+	if i < len(s.data) && int64(len(p)) > s.data[i].Offset-s.off {
+		p = p[:s.data[i].Offset-s.off]
+	}
+	for ii := range p {
+		p[ii] = 0
+	}
+	s.off += int64(len(p))
+	return len(p), nil
+}
+
+func (s *sparseReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.off
+	case io.SeekEnd:
+		offset += s.size
+	default:
+		return 0, errors.New("sparseReader: unsupported whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("sparseReader: negative position")
+	}
+	s.off = offset
+	return offset, nil
+}
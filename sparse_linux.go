@@ -0,0 +1,65 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// The whence values of lseek for sparse files, os.File.Seek passes them on.
+const (
+	seekData = 3
+	seekHole = 4
+)
+
+// SparseExtents returns the data extents of f, found with SEEK_DATA and
+// SEEK_HOLE, for NewSparseFile. On filesystems without them, the whole file
+// is one extent. SparseExtents moves the offset of f.
+func SparseExtents(f *os.File) ([]SparseExtent, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to stat sparse file")
+	}
+	size := info.Size()
+	var extents []SparseExtent
+	for off := int64(0); off < size; {
+		start, err := f.Seek(off, seekData)
+		if isErrno(err, syscall.ENXIO) {
+			// There are only holes after off.
+			break
+		}
+		if isErrno(err, syscall.EINVAL) {
+			return wholeFile(size), nil
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to find the data of %s", f.Name())
+		}
+		end, err := f.Seek(start, seekHole)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to find the holes of %s", f.Name())
+		}
+		extents = append(extents, SparseExtent{Offset: start, Length: end - start})
+		off = end
+	}
+	return extents, nil
+}
+
+func isErrno(err error, errno syscall.Errno) bool {
+	pe, ok := err.(*os.PathError)
+	return ok && pe.Err == errno
+}
@@ -0,0 +1,34 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+// +build !linux
+
+package rpmpack
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// SparseExtents returns the data extents of f, for NewSparseFile. Holes are
+// only found on Linux, elsewhere the whole file is one extent.
+func SparseExtents(f *os.File) ([]SparseExtent, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to stat sparse file")
+	}
+	return wholeFile(info.Size()), nil
+}
@@ -0,0 +1,120 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// extentReader reads from b, failing when a read goes to a hole.
+type extentReader struct {
+	b    []byte
+	data []SparseExtent
+}
+
+func (e extentReader) ReadAt(p []byte, off int64) (int, error) {
+	for _, d := range e.data {
+		if off >= d.Offset && off+int64(len(p)) <= d.Offset+d.Length {
+			return bytes.NewReader(e.b).ReadAt(p, off)
+		}
+	}
+	return 0, errors.Errorf("read of %d bytes at %d is not in an extent", len(p), off)
+}
+
+func TestNewSparseFile(t *testing.T) {
+	content := append(append(make([]byte, 10), "data"...), make([]byte, 6)...)
+	content = append(content, "more"...)
+	data := []SparseExtent{{Offset: 10, Length: 4}, {Offset: 20, Length: 4}}
+	f, err := NewSparseFile("/var/lib/image", extentReader{content, data}, int64(len(content)), data)
+	if err != nil {
+		t.Fatalf("NewSparseFile returned error %v", err)
+	}
+	if f.Size != int64(len(content)) || f.Mode != 0100644 {
+		t.Errorf("NewSparseFile: Size = %d, Mode = %o, want %d, 100644", f.Size, f.Mode, len(content))
+	}
+	for pass := 0; pass < 2; pass++ {
+		got, err := ioutil.ReadAll(f.Reader)
+		if err != nil {
+			t.Fatalf("reading the sparse file returned error %v", err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Errorf("sparse file content = %q, want %q", got, content)
+		}
+		if _, err := f.Reader.(io.Seeker).Seek(0, io.SeekStart); err != nil {
+			t.Fatalf("Seek returned error %v", err)
+		}
+	}
+
+	r, err := NewRPM(RPMMetaData{Name: "sparse", Summary: "summary", Compressor: "none"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(f)
+	if got := readArchive(t, buildRPM(t, r))[0].Body; !bytes.Equal(got, content) {
+		t.Errorf("payload content = %q, want %q", got, content)
+	}
+
+	for _, data := range [][]SparseExtent{
+		{{Offset: 20, Length: 4}, {Offset: 10, Length: 4}},
+		{{Offset: 10, Length: 12}, {Offset: 20, Length: 4}},
+		{{Offset: 20, Length: 5}},
+		{{Offset: 10, Length: 0}},
+	} {
+		if _, err := NewSparseFile("/var/lib/image", extentReader{content, data}, int64(len(content)), data); err == nil {
+			t.Errorf("NewSparseFile(%v) returned no error", data)
+		}
+	}
+}
+
+func TestSparseExtents(t *testing.T) {
+	f, err := ioutil.TempFile("", "sparse")
+	if err != nil {
+		t.Fatalf("TempFile returned error %v", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	const size = 4 << 20
+	if err := f.Truncate(size); err != nil {
+		t.Fatalf("Truncate returned error %v", err)
+	}
+	if _, err := f.WriteAt([]byte("data"), 1<<20); err != nil {
+		t.Fatalf("WriteAt returned error %v", err)
+	}
+	data, err := SparseExtents(f)
+	if err != nil {
+		t.Fatalf("SparseExtents returned error %v", err)
+	}
+	// How much of the file is holes depends on the filesystem, but the data
+	// must be in an extent, and the file must read back the same.
+	sf, err := NewSparseFile("/image", f, size, data)
+	if err != nil {
+		t.Fatalf("NewSparseFile(%v) returned error %v", data, err)
+	}
+	got, err := ioutil.ReadAll(sf.Reader)
+	if err != nil {
+		t.Fatalf("reading the sparse file returned error %v", err)
+	}
+	want := make([]byte, size)
+	copy(want[1<<20:], "data")
+	if !bytes.Equal(got, want) {
+		t.Errorf("sparse file with extents %v does not read back the same", data)
+	}
+}
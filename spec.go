@@ -0,0 +1,888 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// scriptletSections are the spec file sections of the scriptlets, in the
+// order WriteSpec writes them.
+var scriptletSections = []struct {
+	t    ScriptletType
+	name string
+}{
+	{PretransScriptlet, "%pretrans"},
+	{PreinScriptlet, "%pre"},
+	{PostinScriptlet, "%post"},
+	{PreunScriptlet, "%preun"},
+	{PostunScriptlet, "%postun"},
+	{PosttransScriptlet, "%posttrans"},
+}
+
+var triggerSections = map[TriggerType]string{
+	TriggerPrein:  "triggerprein",
+	TriggerIn:     "triggerin",
+	TriggerUn:     "triggerun",
+	TriggerPostun: "triggerpostun",
+}
+
+// verifyDirectives are the names of the attributes in %verify(not ...).
+var verifyDirectives = []struct {
+	name string
+	f    VerifyFlags
+}{
+	{"md5", VerifyDigest},
+	{"size", VerifySize},
+	{"link", VerifyLinkTo},
+	{"user", VerifyUser},
+	{"group", VerifyGroup},
+	{"mtime", VerifyMTime},
+	{"mode", VerifyMode},
+	{"rdev", VerifyRdev},
+	{"caps", VerifyCaps},
+}
+
+// WriteSpec writes an approximate spec file of r to w: the preamble, the
+// description, the scriptlets and triggers, the %files section with the
+// attributes of the files, and the changelog. It is meant to diff packages
+// built with rpmpack against the spec files they replace. It has no %prep,
+// %build or %install section, and the parts of the package a spec file
+// cannot express, like the content of the files, are left out.
+// Dependencies generated by Write, like AutoRequires, are not included.
+func (r *RPM) WriteSpec(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	r.writeSpecPreamble(b)
+	r.writeSpecScriptlets(b)
+	if !r.sourcePackage {
+		r.writeSpecFiles(b)
+	}
+	r.writeSpecChangelog(b)
+	return errors.Wrap(b.Flush(), "failed to write spec")
+}
+
+func (r *RPM) writeSpecPreamble(w io.Writer) {
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(w, "%s: %s\n", name, value)
+		}
+	}
+	field("Name", r.Name)
+	if r.Epoch != 0 {
+		fmt.Fprintf(w, "Epoch: %d\n", r.Epoch)
+	}
+	field("Version", r.Version)
+	field("Release", r.Release)
+	field("Summary", r.Summary)
+	for _, l := range r.sortedTranslations() {
+		field(fmt.Sprintf("Summary(%s)", l), r.Translations[l].Summary)
+	}
+	field("License", r.Licence)
+	field("Group", r.Group)
+	field("URL", r.URL)
+	field("Vendor", r.Vendor)
+	field("Packager", r.Packager)
+	if r.Arch == "noarch" {
+		field("BuildArch", r.Arch)
+	}
+	field("ModularityLabel", r.ModularityLabel)
+	for _, p := range r.Prefixes {
+		field("Prefix", p)
+	}
+	for i, s := range r.sources {
+		field(fmt.Sprintf("Source%d", i), s)
+	}
+	for i, p := range r.patches {
+		field(fmt.Sprintf("Patch%d", i), p)
+	}
+	requires := "Requires"
+	if r.sourcePackage {
+		requires = "BuildRequires"
+	}
+	for _, d := range []struct {
+		name string
+		rels Relations
+	}{
+		{"Provides", r.Provides},
+		{requires, r.Requires},
+		{"Conflicts", r.Conflicts},
+		{"Obsoletes", r.Obsoletes},
+		{"Recommends", r.Recommends},
+		{"Suggests", r.Suggests},
+		{"Supplements", r.Supplements},
+		{"Enhances", r.Enhances},
+		{"OrderWithRequires", r.OrderWithRequires},
+	} {
+	rels:
+		for _, rel := range d.rels {
+			if rel.Sense&(SenseConfig|SenseRPMLib) != 0 {
+				// Generated by Write, like rpmbuild does.
+				continue
+			}
+			if d.name == "Provides" {
+				for _, self := range r.selfProvides() {
+					if rel.Equal(self) {
+						// rpmbuild adds the package itself, like NewRPM.
+						continue rels
+					}
+				}
+			}
+			name := d.name
+			if q := specQualifiers(rel.Sense); d.name == requires && q != "" {
+				name = fmt.Sprintf("%s(%s)", name, q)
+			}
+			field(name, specRelation(rel))
+		}
+	}
+	fmt.Fprintf(w, "\n%%description\n%s\n", r.Description)
+	for _, l := range r.sortedTranslations() {
+		if d := r.Translations[l].Description; d != "" {
+			fmt.Fprintf(w, "\n%%description -l %s\n%s\n", l, d)
+		}
+	}
+}
+
+// sortedTranslations returns the locales of the translations, sorted.
+func (r *RPM) sortedTranslations() []string {
+	var l []string
+	for k := range r.Translations {
+		l = append(l, k)
+	}
+	sort.Strings(l)
+	return l
+}
+
+// specRelation returns a dependency as written in a spec file, like
+// "foo >= 1.0".
+func specRelation(rel *Relation) string {
+	if rel.Sense&senseCompareMask == 0 || rel.Version == "" {
+		return rel.Name
+	}
+	return fmt.Sprintf("%s %s %s", rel.Name, rel.Sense, rel.Version)
+}
+
+// specQualifiers returns the qualifiers of a requirement for the scriptlets of
+// sense, like "post,preun", or "" if it is not scoped to scriptlets.
+func specQualifiers(sense rpmSense) string {
+	var q []string
+	for _, s := range scriptletSections {
+		if sense&scriptletSenses[s.t] != 0 {
+			q = append(q, s.name[1:])
+		}
+	}
+	return strings.Join(q, ",")
+}
+
+// specScriptletOptions returns the options of a scriptlet section for its
+// interpreter and flags, like " -p <lua>".
+func specScriptletOptions(prog []string, flags ScriptletFlags) string {
+	var o string
+	if flags&ScriptletExpand != 0 {
+		o += " -e"
+	}
+	if flags&ScriptletQFormat != 0 {
+		o += " -q"
+	}
+	if len(prog) > 0 && !(len(prog) == 1 && prog[0] == defaultInterpreter[0]) {
+		o += " -p " + strings.Join(prog, " ")
+	}
+	return o
+}
+
+func (r *RPM) writeSpecScriptlets(w io.Writer) {
+	for _, ss := range scriptletSections {
+		s := r.scriptlets[ss.t]
+		if s.body == "" {
+			continue
+		}
+		fmt.Fprintf(w, "\n%s%s\n%s\n", ss.name, specScriptletOptions(s.prog, s.flags), s.body)
+	}
+	for _, t := range r.triggers {
+		pkgs := make([]string, len(t.Packages))
+		for i, p := range t.Packages {
+			pkgs[i] = specRelation(p)
+		}
+		fmt.Fprintf(w, "\n%%%s%s -- %s\n%s\n", triggerSections[t.Type], specScriptletOptions([]string{t.Interpreter}, t.Flags), strings.Join(pkgs, ", "), t.Script)
+	}
+	for _, t := range r.fileTriggers {
+		name := "file" + triggerSections[t.Type]
+		if t.Transaction {
+			name = "trans" + name
+		}
+		fmt.Fprintf(w, "\n%%%s%s -P %d -- %s\n%s\n", name, specScriptletOptions([]string{t.Interpreter}, t.Flags), t.Priority, strings.Join(t.Prefixes, " "), t.Script)
+	}
+}
+
+func (r *RPM) writeSpecFiles(w io.Writer) {
+	io.WriteString(w, "\n%files\n")
+	var names []string
+	for n := range r.files {
+		names = append(names, n)
+	}
+	for n := range r.hardlinks {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		f, ok := r.files[n]
+		if !ok {
+			// A hard link has the attributes of its target.
+			f = r.files[r.hardlinks[n]]
+		}
+		fmt.Fprintf(w, "%s%s\n", specFileAttributes(f), n)
+	}
+}
+
+// specFileAttributes returns the directives of a file in the %files section,
+// followed by a space, like "%attr(0644,root,root) %config(noreplace) ".
+func specFileAttributes(f RPMFile) string {
+	owner, group := f.Owner, f.Group
+	if owner == "" {
+		owner = "root"
+	}
+	if group == "" {
+		group = "root"
+	}
+	ds := []string{fmt.Sprintf("%%attr(%04o,%s,%s)", f.Mode&07777, owner, group)}
+	if f.Mode&0170000 == 040000 {
+		ds = append(ds, "%dir")
+	}
+	if f.Type != GenericFile {
+		ds = append(ds, f.Type.String())
+	}
+	if f.NoVerify != 0 {
+		var not []string
+		for _, vd := range verifyDirectives {
+			if f.NoVerify&vd.f != 0 {
+				not = append(not, vd.name)
+			}
+		}
+		ds = append(ds, fmt.Sprintf("%%verify(not %s)", strings.Join(not, " ")))
+	}
+	if f.Caps != "" {
+		ds = append(ds, fmt.Sprintf("%%caps(%s)", f.Caps))
+	}
+	if f.Lang != "" {
+		ds = append(ds, fmt.Sprintf("%%lang(%s)", strings.Replace(f.Lang, "|", ",", -1)))
+	}
+	return strings.Join(ds, " ") + " "
+}
+
+func (r *RPM) writeSpecChangelog(w io.Writer) {
+	entries := r.sortedChangelog()
+	if len(entries) == 0 {
+		return
+	}
+	io.WriteString(w, "\n%changelog\n")
+	for i, e := range entries {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "* %s %s\n%s\n", e.Time.UTC().Format("Mon Jan 02 2006"), e.Name, e.Text)
+	}
+}
+
+// ReadSpec creates an rpm from a restricted subset of a spec file, to move
+// packages built by rpmbuild to rpmpack: the tags of the preamble, the
+// %description, the scriptlets, the %files section and the %changelog, as
+// WriteSpec writes them. The files listed in %files are added from buildRoot,
+// where %install left them, like AddDir adds them; globs match in buildRoot,
+// and %attr, %defattr, %dir, %exclude, %verify, %caps, %lang and the file
+// types of ParseFileType are applied. The sections building the package,
+// %prep, %build, %install, %check and %clean, and the tags only used by them,
+// like BuildRequires or Source, are skipped. Qualified requirements, like
+// Requires(post), are added with RequiresScriptlet.
+// Macros, conditionals, subpackages and triggers are not supported, and are
+// errors, like unknown tags and sections.
+func ReadSpec(spec io.Reader, buildRoot string) (*RPM, error) {
+	p := &specParser{meta: RPMMetaData{Translations: map[string]Translation{}}}
+	s := bufio.NewScanner(spec)
+	s.Buffer(nil, 1<<20)
+	for n := 1; s.Scan(); n++ {
+		if err := p.line(s.Text()); err != nil {
+			return nil, errors.Wrapf(err, "line %d", n)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read spec")
+	}
+	if err := p.endSection(); err != nil {
+		return nil, err
+	}
+	if len(p.meta.Translations) == 0 {
+		p.meta.Translations = nil
+	}
+	r, err := NewRPM(p.meta)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range p.scriptlets {
+		r.addScriptlet(s.t, s.body)
+		if s.prog != nil {
+			r.SetScriptletInterpreter(s.t, s.prog...)
+		}
+		if s.flags != 0 {
+			r.SetScriptletFlags(s.t, s.flags)
+		}
+	}
+	for _, s := range p.scriptRequires {
+		if err := r.RequiresScriptlet(s.rel, s.ts...); err != nil {
+			return nil, err
+		}
+	}
+	for _, e := range p.changelog {
+		r.AddChangelog(e)
+	}
+	for _, f := range p.files {
+		if err := r.addSpecFile(buildRoot, f, p.excludes); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// specSections are the sections ReadSpec skips, and the sections it reads
+// besides the scriptlets.
+var (
+	specSkippedSections = map[string]bool{"prep": true, "build": true, "install": true, "check": true, "clean": true}
+	specSections        = map[string]bool{"description": true, "files": true, "changelog": true}
+)
+
+// specSkippedTags are the tags of the preamble only used to build the package.
+var specSkippedTags = []string{"buildrequires", "buildconflicts", "buildroot", "source", "patch", "nosource", "nopatch"}
+
+type specParser struct {
+	meta RPMMetaData
+	// section is the current section without the %, with its options, and
+	// body its lines. The preamble is the empty section.
+	section string
+	options []string
+	body    []string
+
+	scriptlets     []specScriptlet
+	scriptRequires []specScriptRequire
+	changelog      []ChangelogEntry
+	files          []specFile
+	excludes       []string
+	defattr        specAttr
+}
+
+// specScriptRequire is a requirement of scriptlets, like Requires(post).
+type specScriptRequire struct {
+	rel *Relation
+	ts  []ScriptletType
+}
+
+type specScriptlet struct {
+	t     ScriptletType
+	body  string
+	prog  []string
+	flags ScriptletFlags
+}
+
+// specAttr is a %attr or %defattr, with "-" for the default values.
+type specAttr struct {
+	mode, owner, group string
+}
+
+// specFile is a path of the %files section, with its attributes.
+type specFile struct {
+	path     string
+	attr     specAttr
+	dir      bool
+	t        FileType
+	noVerify VerifyFlags
+	caps     string
+	lang     string
+}
+
+func (p *specParser) line(l string) error {
+	if strings.Contains(l, "%{") || strings.Contains(l, "%(") {
+		return errors.Errorf("macros are not supported: %q", l)
+	}
+	if strings.HasPrefix(l, "%") {
+		fields := strings.Fields(l)
+		name := strings.TrimPrefix(fields[0], "%")
+		_, scriptlet := specScriptletType(name)
+		if scriptlet || specSections[name] || specSkippedSections[name] {
+			if err := p.endSection(); err != nil {
+				return err
+			}
+			p.section, p.options, p.body = name, fields[1:], nil
+			return nil
+		}
+		// Only %files has directives, the preamble, skipped sections and
+		// %changelog have none.
+		if p.section != "files" && !specSkippedSections[p.section] {
+			return errors.Errorf("unsupported directive or section %q", fields[0])
+		}
+	}
+	p.body = append(p.body, l)
+	return nil
+}
+
+// specScriptletType returns the type of the scriptlet section name.
+func specScriptletType(name string) (ScriptletType, bool) {
+	for _, ss := range scriptletSections {
+		if ss.name == "%"+name {
+			return ss.t, true
+		}
+	}
+	return 0, false
+}
+
+// endSection parses the section which ends.
+func (p *specParser) endSection() error {
+	body := p.body
+	// The sections are separated by empty lines.
+	for len(body) > 0 && strings.TrimSpace(body[len(body)-1]) == "" {
+		body = body[:len(body)-1]
+	}
+	if t, ok := specScriptletType(p.section); ok {
+		return p.scriptlet(t, body)
+	}
+	switch p.section {
+	case "":
+		for _, l := range body {
+			if err := p.tag(l); err != nil {
+				return err
+			}
+		}
+	case "description":
+		return p.description(body)
+	case "files":
+		if len(p.options) > 0 {
+			return errors.New("subpackages are not supported")
+		}
+		for _, l := range body {
+			if err := p.fileLine(l); err != nil {
+				return err
+			}
+		}
+	case "changelog":
+		return p.changelogEntries(body)
+	}
+	return nil
+}
+
+func (p *specParser) tag(l string) error {
+	l = strings.TrimSpace(l)
+	if l == "" || strings.HasPrefix(l, "#") {
+		return nil
+	}
+	i := strings.Index(l, ":")
+	if i < 0 {
+		return errors.Errorf("invalid preamble line %q", l)
+	}
+	name, value := strings.ToLower(strings.TrimSpace(l[:i])), strings.TrimSpace(l[i+1:])
+	// Locales of Summary, or qualifiers of dependencies, like Requires(post).
+	var qualifier string
+	if j := strings.Index(name, "("); j >= 0 && strings.HasSuffix(name, ")") {
+		name, qualifier = name[:j], name[j+1:len(name)-1]
+	}
+	for _, skipped := range specSkippedTags {
+		if strings.HasPrefix(name, skipped) && strings.Trim(name[len(skipped):], "0123456789") == "" {
+			return nil
+		}
+	}
+	m := &p.meta
+	fields := map[string]*string{
+		"name":            &m.Name,
+		"version":         &m.Version,
+		"release":         &m.Release,
+		"license":         &m.Licence,
+		"group":           &m.Group,
+		"url":             &m.URL,
+		"vendor":          &m.Vendor,
+		"packager":        &m.Packager,
+		"buildarch":       &m.Arch,
+		"modularitylabel": &m.ModularityLabel,
+	}
+	relations := map[string]*Relations{
+		"provides":          &m.Provides,
+		"requires":          &m.Requires,
+		"conflicts":         &m.Conflicts,
+		"obsoletes":         &m.Obsoletes,
+		"recommends":        &m.Recommends,
+		"suggests":          &m.Suggests,
+		"supplements":       &m.Supplements,
+		"enhances":          &m.Enhances,
+		"orderwithrequires": &m.OrderWithRequires,
+	}
+	switch {
+	case name == "summary" && qualifier != "":
+		t := m.Translations[qualifier]
+		t.Summary = value
+		m.Translations[qualifier] = t
+	case name == "summary":
+		m.Summary = value
+	case name == "epoch":
+		e, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return errors.Errorf("invalid epoch %q", value)
+		}
+		m.Epoch = uint32(e)
+	case name == "prefix":
+		m.Prefixes = append(m.Prefixes, value)
+	case fields[name] != nil && qualifier == "":
+		*fields[name] = value
+	case name == "requires" && qualifier != "":
+		var ts []ScriptletType
+		for _, q := range strings.Split(qualifier, ",") {
+			t, ok := specScriptletType(strings.TrimSpace(q))
+			if !ok {
+				return errors.Errorf("unsupported qualifier %q of %q", q, l[:i])
+			}
+			ts = append(ts, t)
+		}
+		rels, err := specRelations(value)
+		if err != nil {
+			return errors.Wrapf(err, "invalid %s", name)
+		}
+		for _, rel := range rels {
+			r, err := NewRelation(rel)
+			if err != nil {
+				return errors.Wrapf(err, "invalid %s", name)
+			}
+			p.scriptRequires = append(p.scriptRequires, specScriptRequire{r, ts})
+		}
+	case relations[name] != nil && qualifier == "":
+		rels, err := specRelations(value)
+		if err != nil {
+			return errors.Wrapf(err, "invalid %s", name)
+		}
+		for _, rel := range rels {
+			if err := relations[name].Set(rel); err != nil {
+				return errors.Wrapf(err, "invalid %s", name)
+			}
+		}
+	default:
+		return errors.Errorf("unsupported tag %q", l[:i])
+	}
+	return nil
+}
+
+// specRelations splits the dependencies of a tag of the preamble, like
+// "foo, bar >= 1.0 baz" or "bar>=1.0". An operator without a name or a
+// version is an error.
+func specRelations(value string) ([]string, error) {
+	var rels []string
+	for _, part := range strings.Split(value, ",") {
+		tokens := specTokens(splitDirectives(part))
+		for i := 0; i < len(tokens); i++ {
+			rel := tokens[i]
+			if isSpecOperator(rel) {
+				return nil, errors.Errorf("operator %q without a name in %q", rel, value)
+			}
+			if i+1 < len(tokens) && isSpecOperator(tokens[i+1]) {
+				if i+2 == len(tokens) || isSpecOperator(tokens[i+2]) {
+					return nil, errors.Errorf("operator %q without a version in %q", tokens[i+1], value)
+				}
+				rel = strings.Join(tokens[i:i+3], " ")
+				i += 2
+			}
+			rels = append(rels, rel)
+		}
+	}
+	return rels, nil
+}
+
+// specTokens splits the fields of a dependency list at the operators, which
+// can be attached to the name or the version, like "bar>=1.0". Parentheses,
+// like rich dependencies or "perl(Foo) >= 1", are not split.
+func specTokens(fields []string) []string {
+	var tokens []string
+	for _, f := range fields {
+		depth, start, op := 0, 0, false
+		for i, c := range f {
+			switch c {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			}
+			if depth != 0 || i == start || isSpecOperator(string(c)) == op {
+				if i == start {
+					op = isSpecOperator(string(c))
+				}
+				continue
+			}
+			tokens = append(tokens, f[start:i])
+			start, op = i, !op
+		}
+		tokens = append(tokens, f[start:])
+	}
+	return tokens
+}
+
+// isSpecOperator tells whether s is made of the characters of the comparison
+// operators of dependencies.
+func isSpecOperator(s string) bool {
+	return s != "" && strings.Trim(s, "<>=") == ""
+}
+
+func (p *specParser) description(body []string) error {
+	text := strings.Join(body, "\n")
+	switch {
+	case len(p.options) == 0:
+		p.meta.Description = text
+	case len(p.options) == 2 && p.options[0] == "-l":
+		t := p.meta.Translations[p.options[1]]
+		t.Description = text
+		p.meta.Translations[p.options[1]] = t
+	default:
+		return errors.Errorf("unsupported %%description options %q", strings.Join(p.options, " "))
+	}
+	return nil
+}
+
+func (p *specParser) scriptlet(t ScriptletType, body []string) error {
+	s := specScriptlet{t: t, body: strings.Join(body, "\n")}
+	for i := 0; i < len(p.options); i++ {
+		switch o := p.options[i]; {
+		case o == "-e":
+			s.flags |= ScriptletExpand
+		case o == "-q":
+			s.flags |= ScriptletQFormat
+		case o == "-p" && i+1 < len(p.options):
+			// The interpreter takes the rest of the line.
+			s.prog = p.options[i+1:]
+			i = len(p.options)
+		default:
+			return errors.Errorf("unsupported option %q of %%%s", o, p.section)
+		}
+	}
+	if s.body == "" {
+		return errors.Errorf("%%%s has no body, scriptlets running only their interpreter are not supported", p.section)
+	}
+	p.scriptlets = append(p.scriptlets, s)
+	return nil
+}
+
+func (p *specParser) fileLine(l string) error {
+	l = strings.TrimSpace(l)
+	if l == "" || strings.HasPrefix(l, "#") {
+		return nil
+	}
+	f := specFile{attr: p.defattr}
+	var directives []string
+	exclude := false
+	for _, d := range splitDirectives(l) {
+		if !strings.HasPrefix(d, "%") {
+			if f.path != "" {
+				return errors.Errorf("several paths in %q", l)
+			}
+			f.path = d
+			continue
+		}
+		name, arg := d, ""
+		if i := strings.Index(d, "("); i >= 0 && strings.HasSuffix(d, ")") {
+			name, arg = d[:i], d[i+1:len(d)-1]
+		}
+		switch name {
+		case "%attr", "%defattr":
+			a := strings.Split(arg, ",")
+			if len(a) < 3 || len(a) > 4 {
+				return errors.Errorf("invalid %s", d)
+			}
+			attr := specAttr{strings.TrimSpace(a[0]), strings.TrimSpace(a[1]), strings.TrimSpace(a[2])}
+			if name == "%defattr" {
+				p.defattr = attr
+				return nil
+			}
+			f.attr = attr
+		case "%dir":
+			f.dir = true
+		case "%exclude":
+			exclude = true
+		case "%caps":
+			f.caps = arg
+		case "%lang":
+			langs := strings.Split(arg, ",")
+			for i, l := range langs {
+				langs[i] = strings.TrimSpace(l)
+			}
+			f.lang = strings.Join(langs, "|")
+		case "%verify":
+			fs := strings.Fields(arg)
+			if len(fs) == 0 || fs[0] != "not" {
+				return errors.Errorf("unsupported %s, only %%verify(not ...) is", d)
+			}
+			for _, n := range fs[1:] {
+				found := false
+				for _, vd := range verifyDirectives {
+					if vd.name == n {
+						f.noVerify |= vd.f
+						found = true
+					}
+				}
+				if !found {
+					return errors.Errorf("unknown attribute %q in %s", n, d)
+				}
+			}
+		default:
+			directives = append(directives, d)
+		}
+	}
+	if !path.IsAbs(f.path) {
+		return errors.Errorf("the path of %q is not absolute", l)
+	}
+	if exclude {
+		p.excludes = append(p.excludes, f.path)
+		return nil
+	}
+	t, err := ParseFileType(strings.Join(directives, " "))
+	if err != nil {
+		return err
+	}
+	f.t = t
+	p.files = append(p.files, f)
+	return nil
+}
+
+func (p *specParser) changelogEntries(body []string) error {
+	var e *ChangelogEntry
+	var text []string
+	flush := func() {
+		if e != nil {
+			for len(text) > 0 && strings.TrimSpace(text[len(text)-1]) == "" {
+				text = text[:len(text)-1]
+			}
+			e.Text = strings.Join(text, "\n")
+			p.changelog = append(p.changelog, *e)
+		}
+	}
+	for _, l := range body {
+		if !strings.HasPrefix(l, "*") {
+			if e == nil && strings.TrimSpace(l) != "" {
+				return errors.Errorf("changelog text %q before the first entry", l)
+			}
+			text = append(text, l)
+			continue
+		}
+		flush()
+		fields := strings.Fields(strings.TrimPrefix(l, "*"))
+		if len(fields) < 5 {
+			return errors.Errorf("invalid changelog entry %q", l)
+		}
+		t, err := time.Parse("Mon Jan 2 2006", strings.Join(fields[:4], " "))
+		if err != nil {
+			return errors.Errorf("invalid date of changelog entry %q", l)
+		}
+		e, text = &ChangelogEntry{Time: t, Name: strings.Join(fields[4:], " ")}, nil
+	}
+	flush()
+	return nil
+}
+
+// addSpecFile adds the file f of a %files section from buildRoot.
+func (r *RPM) addSpecFile(buildRoot string, f specFile, excludes []string) error {
+	matches := []string{filepath.Join(buildRoot, filepath.FromSlash(f.path))}
+	if strings.ContainsAny(f.path, "*?[") {
+		var err error
+		if matches, err = filepath.Glob(matches[0]); err != nil {
+			return errors.Wrapf(err, "invalid glob %q", f.path)
+		}
+		if len(matches) == 0 {
+			return errors.Errorf("no file matches %q in the build root", f.path)
+		}
+	}
+	rules := ImportRules{Type: f.t}
+	if f.attr.owner != "-" {
+		rules.Owner = f.attr.owner
+	}
+	if f.attr.group != "-" {
+		rules.Group = f.attr.group
+	}
+	if f.attr.mode != "" && f.attr.mode != "-" {
+		mode, err := strconv.ParseUint(f.attr.mode, 8, 32)
+		if err != nil {
+			return errors.Errorf("invalid mode %q of %s", f.attr.mode, f.path)
+		}
+		rules.FileMode = uint(mode)
+	}
+	// before are the files of the previous entries, when f has attributes.
+	var before map[string]bool
+	if f.noVerify != 0 || f.caps != "" || f.lang != "" {
+		before = make(map[string]bool, len(r.files))
+		for fn := range r.files {
+			before[fn] = true
+		}
+	}
+	for _, src := range matches {
+		rel, err := filepath.Rel(buildRoot, src)
+		if err != nil {
+			return err
+		}
+		name := "/" + filepath.ToSlash(rel)
+		if excluded, _ := matchAny(excludes, name); excluded {
+			continue
+		}
+		info, err := os.Lstat(src)
+		switch {
+		case os.IsNotExist(err) && f.t&GhostFile != 0:
+			mode := rules.FileMode
+			if mode == 0 {
+				mode = 0644
+			}
+			err = r.AddFile(RPMFile{Name: name, Mode: 0100000 | mode, Owner: rules.Owner, Group: rules.Group, Type: f.t})
+		case err != nil:
+			return errors.Wrapf(err, "failed to find %s in the build root", f.path)
+		case f.dir:
+			if !info.IsDir() {
+				return errors.Errorf("%s is marked %%dir, but is not a directory", f.path)
+			}
+			mode := uint(info.Mode().Perm())
+			if rules.FileMode != 0 {
+				mode = rules.FileMode
+			}
+			err = r.AddFile(RPMFile{Name: name, Mode: 040000 | mode, Owner: rules.Owner, Group: rules.Group, MTime: uint32(info.ModTime().Unix()), Type: f.t})
+		default:
+			// The excluded paths are relative to the directory added.
+			for _, e := range excludes {
+				if strings.HasPrefix(e, name+"/") {
+					rules.Exclude = append(rules.Exclude, strings.TrimPrefix(e, name+"/"))
+				}
+			}
+			err = r.AddDir(src, name, rules)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to add %s", f.path)
+		}
+		if before == nil {
+			continue
+		}
+		// Like rpmbuild, the attributes of a directory apply to the files
+		// added under it too, unless it is marked %dir.
+		for fn, file := range r.files {
+			if fn == name || (!f.dir && strings.HasPrefix(fn, name+"/") && !before[fn]) {
+				file.NoVerify, file.Caps, file.Lang = f.noVerify, f.caps, f.lang
+				r.files[fn] = file
+			}
+		}
+	}
+	return nil
+}
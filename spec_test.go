@@ -0,0 +1,380 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriteSpec(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{
+		Name:        "spec",
+		Version:     "1.0",
+		Release:     "2",
+		Epoch:       3,
+		Summary:     "summary",
+		Description: "description",
+		Licence:     "MIT",
+		Arch:        "noarch",
+		Requires:    Relations{{Name: "bash"}, {Name: "glibc", Version: "2.17", Sense: SenseGreater | SenseEqual}},
+		Provides:    Relations{{Name: "spec(tool)"}},
+	})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	for _, f := range []RPMFile{
+		{Name: "/usr/bin/spec", Body: []byte("bin"), Mode: 0755},
+		{Name: "/etc/spec.conf", Body: []byte("a=b\n"), Mode: 0640, Group: "spec", Type: ConfigFile | NoReplaceFile, NoVerify: VerifyMTime | VerifySize},
+		{Name: "/usr/share/spec", Mode: 040755},
+		{Name: "/usr/bin/ping-spec", Body: []byte("bin"), Mode: 0755, Caps: "cap_net_raw+ep"},
+		{Name: "/usr/share/locale/de/LC_MESSAGES/spec.mo", Body: []byte("mo"), Mode: 0644, Lang: "de|de_AT"},
+	} {
+		if err := r.AddFile(f); err != nil {
+			t.Fatalf("AddFile returned error %v", err)
+		}
+	}
+	r.AddPostin("echo post")
+	r.AddPretrans("print('pre')")
+	r.SetScriptletInterpreter(PretransScriptlet, LuaInterpreter)
+	if err := r.AddTrigger(Trigger{Type: TriggerIn, Packages: Relations{{Name: "other"}}, Script: "echo other"}); err != nil {
+		t.Fatalf("AddTrigger returned error %v", err)
+	}
+	if err := r.AddFileTrigger(FileTrigger{Type: TriggerIn, Prefixes: []string{"/usr/lib64"}, Script: "ldconfig"}); err != nil {
+		t.Fatalf("AddFileTrigger returned error %v", err)
+	}
+	r.AddChangelog(ChangelogEntry{Time: time.Date(2020, 1, 2, 12, 0, 0, 0, time.UTC), Name: "A <a@example.com> - 1.0-1", Text: "- first"})
+	r.AddChangelog(ChangelogEntry{Time: time.Date(2021, 3, 4, 12, 0, 0, 0, time.UTC), Name: "B <b@example.com> - 1.0-2", Text: "- second"})
+
+	b := &bytes.Buffer{}
+	if err := r.WriteSpec(b); err != nil {
+		t.Fatalf("WriteSpec returned error %v", err)
+	}
+	want := `Name: spec
+Epoch: 3
+Version: 1.0
+Release: 2
+Summary: summary
+License: MIT
+BuildArch: noarch
+Provides: spec(tool)
+Requires: bash
+Requires: glibc >= 2.17
+
+%description
+description
+
+%pretrans -p <lua>
+print('pre')
+
+%post
+echo post
+
+%triggerin -- other
+echo other
+
+%filetriggerin -P 1000000 -- /usr/lib64
+ldconfig
+
+%files
+%attr(0640,root,spec) %config(noreplace) %verify(not size mtime) /etc/spec.conf
+%attr(0755,root,root) %caps(cap_net_raw+ep) /usr/bin/ping-spec
+%attr(0755,root,root) /usr/bin/spec
+%attr(0644,root,root) %lang(de,de_AT) /usr/share/locale/de/LC_MESSAGES/spec.mo
+%attr(0755,root,root) %dir /usr/share/spec
+
+%changelog
+* Thu Mar 04 2021 B <b@example.com> - 1.0-2
+- second
+
+* Thu Jan 02 2020 A <a@example.com> - 1.0-1
+- first
+`
+	if d := cmp.Diff(want, b.String()); d != "" {
+		t.Errorf("WriteSpec mismatch (-want +got):\n%s", d)
+	}
+}
+
+const testSpec = `# A legacy spec file.
+Name: spec
+Epoch: 3
+Version: 1.0
+Release: 2
+Summary: summary
+Summary(de): Zusammenfassung
+License: MIT
+BuildArch: noarch
+Source0: spec-1.0.tar.gz
+BuildRequires: gcc
+Provides: spec(tool)
+Requires: bash, glibc >= 2.17
+Requires(post): coreutils
+OrderWithRequires: systemd
+
+%description
+description
+
+%description -l de
+Beschreibung
+
+%prep
+%setup -q
+
+%build
+make
+
+%install
+make install DESTDIR=$RPM_BUILD_ROOT
+
+%pretrans -p <lua>
+print('pre')
+
+%post
+echo post
+
+%files
+%defattr(-,root,root)
+%attr(0640,root,spec) %config(noreplace) %verify(not size mtime) /etc/spec.conf
+%attr(0755,-,-) %caps(cap_net_raw+ep) /usr/bin/ping-spec
+/usr/bin/spec
+/usr/lib/spec/*.so
+%lang(de, de_AT) /usr/share/locale/de/LC_MESSAGES/spec.mo
+%doc /usr/share/spec
+%exclude /usr/share/spec/static.la
+%ghost /var/log/spec.log
+
+%changelog
+* Thu Mar 4 2021 B <b@example.com> - 1.0-2
+- second
+
+* Thu Jan 02 2020 A <a@example.com> - 1.0-1
+- first
+`
+
+func TestReadSpec(t *testing.T) {
+	root, err := ioutil.TempDir("", "rpmpack")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir returned error %v", err)
+	}
+	defer os.RemoveAll(root)
+	for name, mode := range map[string]os.FileMode{
+		"etc/spec.conf":                           0644,
+		"usr/bin/ping-spec":                       0700,
+		"usr/bin/spec":                            0755,
+		"usr/lib/spec/libspec.so":                 0755,
+		"usr/lib/spec/libspec.a":                  0644,
+		"usr/share/locale/de/LC_MESSAGES/spec.mo": 0644,
+		"usr/share/spec/README":                   0644,
+		"usr/share/spec/static.la":                0644,
+	} {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("os.MkdirAll returned error %v", err)
+		}
+		if err := ioutil.WriteFile(p, []byte(name), mode); err != nil {
+			t.Fatalf("ioutil.WriteFile returned error %v", err)
+		}
+	}
+	r, err := ReadSpec(strings.NewReader(testSpec), root)
+	if err != nil {
+		t.Fatalf("ReadSpec returned error %v", err)
+	}
+	b := &bytes.Buffer{}
+	if err := r.WriteSpec(b); err != nil {
+		t.Fatalf("WriteSpec returned error %v", err)
+	}
+	want := `Name: spec
+Epoch: 3
+Version: 1.0
+Release: 2
+Summary: summary
+Summary(de): Zusammenfassung
+License: MIT
+BuildArch: noarch
+Provides: spec(tool)
+Requires: bash
+Requires: glibc >= 2.17
+Requires(post): coreutils
+OrderWithRequires: systemd
+
+%description
+description
+
+%description -l de
+Beschreibung
+
+%pretrans -p <lua>
+print('pre')
+
+%post
+echo post
+
+%files
+%attr(0640,root,spec) %config(noreplace) %verify(not size mtime) /etc/spec.conf
+%attr(0755,root,root) %caps(cap_net_raw+ep) /usr/bin/ping-spec
+%attr(0755,root,root) /usr/bin/spec
+%attr(0755,root,root) /usr/lib/spec/libspec.so
+%attr(0644,root,root) %lang(de,de_AT) /usr/share/locale/de/LC_MESSAGES/spec.mo
+%attr(0755,root,root) %dir /usr/share/spec
+%attr(0644,root,root) %doc /usr/share/spec/README
+%attr(0644,root,root) %ghost /var/log/spec.log
+
+%changelog
+* Thu Mar 04 2021 B <b@example.com> - 1.0-2
+- second
+
+* Thu Jan 02 2020 A <a@example.com> - 1.0-1
+- first
+`
+	if d := cmp.Diff(want, b.String()); d != "" {
+		t.Errorf("WriteSpec of ReadSpec mismatch (-want +got):\n%s", d)
+	}
+	if err := r.Write(ioutil.Discard); err != nil {
+		t.Errorf("Write returned error %v", err)
+	}
+}
+
+func TestReadSpecDirAttributes(t *testing.T) {
+	root, err := ioutil.TempDir("", "rpmpack")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir returned error %v", err)
+	}
+	defer os.RemoveAll(root)
+	for _, name := range []string{
+		"etc/spec.d/a.conf",
+		"var/cache/spec/cached",
+		"usr/share/doc/spec/README",
+		"usr/lib/spec/bin/tool",
+		"usr/share/locale/de/spec/spec.mo",
+		"usr/lib/verified/lib.so",
+	} {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("os.MkdirAll returned error %v", err)
+		}
+		if err := ioutil.WriteFile(p, []byte(name), 0644); err != nil {
+			t.Fatalf("ioutil.WriteFile returned error %v", err)
+		}
+	}
+	spec := `Name: spec
+Version: 1.0
+Summary: summary
+
+%files
+%dir %config /etc/spec.d
+%dir %ghost /var/cache/spec
+%dir %doc /usr/share/doc/spec
+%caps(cap_net_raw+ep) /usr/lib/spec
+%lang(de) /usr/share/locale/de/spec
+%verify(not mtime) /usr/lib/verified
+`
+	r, err := ReadSpec(strings.NewReader(spec), root)
+	if err != nil {
+		t.Fatalf("ReadSpec returned error %v", err)
+	}
+	for _, tc := range []struct {
+		name string
+		want RPMFile
+	}{
+		{"/etc/spec.d", RPMFile{Type: ConfigFile}},
+		{"/var/cache/spec", RPMFile{Type: GhostFile}},
+		{"/usr/share/doc/spec", RPMFile{Type: DocFile}},
+		{"/usr/lib/spec", RPMFile{Caps: "cap_net_raw+ep"}},
+		{"/usr/lib/spec/bin", RPMFile{Caps: "cap_net_raw+ep"}},
+		{"/usr/lib/spec/bin/tool", RPMFile{Caps: "cap_net_raw+ep"}},
+		{"/usr/share/locale/de/spec", RPMFile{Lang: "de"}},
+		{"/usr/share/locale/de/spec/spec.mo", RPMFile{Lang: "de"}},
+		{"/usr/lib/verified", RPMFile{NoVerify: VerifyMTime}},
+		{"/usr/lib/verified/lib.so", RPMFile{NoVerify: VerifyMTime}},
+	} {
+		f, ok := r.files[tc.name]
+		if !ok {
+			t.Errorf("%s is not in the rpm", tc.name)
+			continue
+		}
+		got := RPMFile{Type: f.Type, Caps: f.Caps, Lang: f.Lang, NoVerify: f.NoVerify}
+		if d := cmp.Diff(tc.want, got); d != "" {
+			t.Errorf("attributes of %s mismatch (-want +got):\n%s", tc.name, d)
+		}
+	}
+	// %dir only adds the directory.
+	if _, ok := r.files["/etc/spec.d/a.conf"]; ok {
+		t.Errorf("/etc/spec.d/a.conf of the %%dir is in the rpm")
+	}
+}
+
+func TestSpecRelations(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		want  []string
+	}{
+		{"foo, bar >= 1.0 baz", []string{"foo", "bar >= 1.0", "baz"}},
+		{"bar >=1.0", []string{"bar >= 1.0"}},
+		{"bar>= 1.0", []string{"bar >= 1.0"}},
+		{"bar>=1.0, baz<2", []string{"bar >= 1.0", "baz < 2"}},
+		{"perl(Foo::Bar)>=1.0", []string{"perl(Foo::Bar) >= 1.0"}},
+		{"(foo >= 1.0 or bar)", []string{"(foo >= 1.0 or bar)"}},
+	} {
+		got, err := specRelations(tc.value)
+		if err != nil {
+			t.Errorf("specRelations(%q) returned error %v", tc.value, err)
+			continue
+		}
+		if d := cmp.Diff(tc.want, got); d != "" {
+			t.Errorf("specRelations(%q) mismatch (-want +got):\n%s", tc.value, d)
+		}
+	}
+	for _, value := range []string{">= 1.0", "bar >=", "bar >= < 1.0", "bar, >=1.0"} {
+		if got, err := specRelations(value); err == nil {
+			t.Errorf("specRelations(%q) = %q, want an error", value, got)
+		}
+	}
+}
+
+func TestReadSpecErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name, spec string
+	}{
+		{"macro", "Name: spec\nVersion: %{version}\n"},
+		{"define", "%define foo bar\nName: spec\n"},
+		{"conditional", "Name: spec\n%if 0\nVersion: 1\n%endif\n"},
+		{"unknown tag", "Name: spec\nColor: blue\n"},
+		{"subpackage", "Name: spec\n%package devel\n"},
+		{"subpackage files", "Name: spec\nVersion: 1\n%files devel\n"},
+		{"trigger", "Name: spec\nVersion: 1\n%triggerin -- other\necho\n"},
+		{"requires qualifier", "Name: spec\nVersion: 1\nRequires(build): gcc\n"},
+		{"interpreter only", "Name: spec\nVersion: 1\n%post -p /sbin/ldconfig\n"},
+		{"relative path", "Name: spec\nVersion: 1\n%files\nusr/bin/spec\n"},
+		{"missing file", "Name: spec\nVersion: 1\n%files\n/usr/bin/missing\n"},
+		{"changelog date", "Name: spec\nVersion: 1\n%changelog\n* June 2020 A - 1\n- first\n"},
+		{"operator without name", "Name: spec\nVersion: 1\nRequires: >= 1.0\n"},
+		{"operator without version", "Name: spec\nVersion: 1\nRequires: bar >=\n"},
+		{"two operators", "Name: spec\nVersion: 1\nRequires: bar >= < 1.0\n"},
+		{"unknown operator", "Name: spec\nVersion: 1\nRequires: bar => 1.0\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := ReadSpec(strings.NewReader(tc.spec), os.TempDir()); err == nil {
+				t.Errorf("ReadSpec(%q) returned no error", tc.spec)
+			}
+		})
+	}
+}
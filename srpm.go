@@ -0,0 +1,124 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// NewSourceRPM creates and returns a new source rpm, a .src.rpm, holding the
+// spec file and the sources and patches the binary packages are built from.
+// The files are added with AddSpec, AddSource and AddPatch. Requires of a
+// source rpm are the build requirements of its spec file.
+// Unlike binary packages, a source rpm does not provide itself.
+func NewSourceRPM(m RPMMetaData) (*RPM, error) {
+	r, err := NewRPM(m)
+	if err != nil {
+		return nil, err
+	}
+	r.sourcePackage = true
+	r.Provides = m.Provides
+	return r, nil
+}
+
+// AddSpec adds the spec file of a source rpm.
+// A source rpm has exactly one spec file.
+func (r *RPM) AddSpec(f RPMFile) error {
+	if r.specFile != "" {
+		return errors.Errorf("source rpm already has the spec file %q", r.specFile)
+	}
+	f.Type |= SpecFile
+	if err := r.addSourceFile(f); err != nil {
+		return err
+	}
+	r.specFile = f.Name
+	return nil
+}
+
+// AddSource adds a source, usually an archive, to a source rpm.
+// Sources are numbered in the order they are added, like the Source tags of the spec file.
+func (r *RPM) AddSource(f RPMFile) error {
+	if err := r.addSourceFile(f); err != nil {
+		return err
+	}
+	r.sources = append(r.sources, f.Name)
+	return nil
+}
+
+// AddPatch adds a patch to a source rpm.
+// Patches are numbered in the order they are added, like the Patch tags of the spec file.
+func (r *RPM) AddPatch(f RPMFile) error {
+	if err := r.addSourceFile(f); err != nil {
+		return err
+	}
+	r.patches = append(r.patches, f.Name)
+	return nil
+}
+
+// addSourceFile adds a file of a source rpm. The files of a source rpm have
+// no directory, rpm installs them to %_sourcedir and %_specdir.
+func (r *RPM) addSourceFile(f RPMFile) error {
+	if !r.sourcePackage {
+		return errors.Errorf("cannot add %q: not a source rpm", f.Name)
+	}
+	if f.Name == "" || f.Name == "." || f.Name == ".." || strings.Contains(f.Name, "/") {
+		return errors.Errorf("invalid source file name %q: it must be a plain file name", f.Name)
+	}
+	if _, ok := r.files[f.Name]; ok {
+		return errors.Errorf("source rpm already has a file %q", f.Name)
+	}
+	if f.Mode == 0 {
+		f.Mode = 0100644
+	}
+	r.putFile(f)
+	return nil
+}
+
+// checkSourcePackage checks that a source rpm has a spec file.
+func (r *RPM) checkSourcePackage() error {
+	if r.sourcePackage && r.specFile == "" {
+		return errors.New("source rpm has no spec file")
+	}
+	return nil
+}
+
+// sourceRPMName returns the file name of the source rpm of a binary package.
+func (r *RPM) sourceRPMName() string {
+	if r.SourceRPM != "" {
+		return r.SourceRPM
+	}
+	return fmt.Sprintf("%s-%s.src.rpm", r.Name, r.FullVersion())
+}
+
+// writeSourceIndexes writes the tags telling source and binary packages apart.
+// A binary package names its source rpm, a source rpm lists its sources and patches.
+func (r *RPM) writeSourceIndexes(h *index) {
+	if !r.sourcePackage {
+		// rpm utilities look for the sourcerpm tag to deduce if this is not a source rpm (if it has a sourcerpm,
+		// it is NOT a source rpm).
+		h.Add(tagSourceRPM, EntryString(r.sourceRPMName()))
+		return
+	}
+	h.Add(tagSourcePackage, EntryInt32([]int32{1}))
+	if len(r.sources) > 0 {
+		h.Add(tagSource, EntryStringSlice(r.sources))
+	}
+	if len(r.patches) > 0 {
+		h.Add(tagPatch, EntryStringSlice(r.patches))
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSourceRPM(t *testing.T) {
+	r, err := NewSourceRPM(RPMMetaData{
+		Name:     "foo",
+		Summary:  "foo",
+		Version:  "1.0",
+		Release:  "1",
+		Arch:     "x86_64",
+		Requires: Relations{{Name: "golang"}},
+	})
+	if err != nil {
+		t.Fatalf("NewSourceRPM returned error %v", err)
+	}
+	if err := r.AddSpec(RPMFile{Name: "foo.spec", Body: []byte("Name: foo\n")}); err != nil {
+		t.Fatalf("AddSpec returned error %v", err)
+	}
+	if err := r.AddSource(RPMFile{Name: "foo-1.0.tar.gz", Body: []byte("source")}); err != nil {
+		t.Fatalf("AddSource returned error %v", err)
+	}
+	if err := r.AddPatch(RPMFile{Name: "fix.patch", Body: []byte("patch")}); err != nil {
+		t.Fatalf("AddPatch returned error %v", err)
+	}
+	if got, want := r.FileName(), "foo-1.0-1.src.rpm"; got != want {
+		t.Errorf("FileName() = %q, want %q", got, want)
+	}
+	b := &bytes.Buffer{}
+	if err := r.Write(b); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	if got := b.Bytes()[6:8]; !bytes.Equal(got, []byte{0x00, 0x01}) {
+		t.Errorf("lead type = %x, want 0001", got)
+	}
+	h := readHeader(t, b.Bytes())
+	if _, ok := h.entries[tagSourceRPM]; ok {
+		t.Error("source rpm has a SOURCERPM tag")
+	}
+	if got := h.getUint32s(tagSourcePackage); !cmp.Equal(got, []uint32{1}) {
+		t.Errorf("SOURCEPACKAGE = %v, want [1]", got)
+	}
+	if got, want := h.getStrings(tagSource), []string{"foo-1.0.tar.gz"}; !cmp.Equal(got, want) {
+		t.Errorf("SOURCE = %v, want %v", got, want)
+	}
+	if got, want := h.getStrings(tagPatch), []string{"fix.patch"}; !cmp.Equal(got, want) {
+		t.Errorf("PATCH = %v, want %v", got, want)
+	}
+	if got := h.getStrings(tagProvides); len(got) != 0 {
+		t.Errorf("PROVIDENAME = %v, want none", got)
+	}
+	if got, want := h.getStrings(tagDirnames), []string{""}; !cmp.Equal(got, want) {
+		t.Errorf("DIRNAMES = %q, want %q", got, want)
+	}
+
+	info, err := ReadRPMInfo(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatalf("ReadRPMInfo returned error %v", err)
+	}
+	if !info.Source {
+		t.Error("ReadRPMInfo: Source = false, want true")
+	}
+	got := map[string]FileType{}
+	for _, f := range info.Files {
+		got[f.Name] = f.Type
+	}
+	want := map[string]FileType{"foo.spec": SpecFile, "foo-1.0.tar.gz": GenericFile, "fix.patch": GenericFile}
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("files differ (-want, +got):\n%s", d)
+	}
+}
+
+func TestSourceRPMErrors(t *testing.T) {
+	md := RPMMetaData{Name: "foo", Summary: "foo", Version: "1.0"}
+	testCases := []struct {
+		name string
+		add  func(r *RPM) error
+	}{{
+		name: "directory",
+		add:  func(r *RPM) error { return r.AddSource(RPMFile{Name: "src/foo.tar.gz"}) },
+	}, {
+		name: "empty name",
+		add:  func(r *RPM) error { return r.AddPatch(RPMFile{}) },
+	}, {
+		name: "second spec",
+		add: func(r *RPM) error {
+			r.AddSpec(RPMFile{Name: "foo.spec"})
+			return r.AddSpec(RPMFile{Name: "bar.spec"})
+		},
+	}, {
+		name: "duplicate",
+		add: func(r *RPM) error {
+			r.AddSource(RPMFile{Name: "foo.tar.gz"})
+			return r.AddPatch(RPMFile{Name: "foo.tar.gz"})
+		},
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewSourceRPM(md)
+			if err != nil {
+				t.Fatalf("NewSourceRPM returned error %v", err)
+			}
+			if err := tc.add(r); err == nil {
+				t.Error("got nil error, want an error")
+			}
+		})
+	}
+
+	r, err := NewSourceRPM(md)
+	if err != nil {
+		t.Fatalf("NewSourceRPM returned error %v", err)
+	}
+	if err := r.Write(&bytes.Buffer{}); err == nil {
+		t.Error("Write of a source rpm without spec file returned nil error")
+	}
+	b, err := NewRPM(md)
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	if err := b.AddSource(RPMFile{Name: "foo.tar.gz"}); err == nil {
+		t.Error("AddSource to a binary rpm returned nil error")
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Subpackage is a package built from the files of a PackageSet, like a
+// %package section of a spec file.
+type Subpackage struct {
+	// Name is the suffix of the package name, like "devel" for foo-devel,
+	// as in "%package devel". FullName, if set, is the whole name instead,
+	// as in "%package -n bar".
+	Name, FullName string
+	// Summary is the summary of the package, which it needs like any package.
+	// Description is the one of the main package if empty, and Arch too,
+	// for example "noarch" for a -doc package.
+	Summary, Description, Arch string
+	Provides,
+	Obsoletes,
+	Suggests,
+	Recommends,
+	Supplements,
+	Enhances,
+	Requires,
+	Conflicts Relations
+	// RequireMain makes the package require the exact version of the main
+	// package, like "Requires: %{name} = %{version}-%{release}".
+	RequireMain bool
+	// Files are the files of the pool in the package, as absolute paths or
+	// path.Match patterns, like "/usr/include/*". A directory includes the
+	// files under it, like in %files.
+	Files []string
+}
+
+// PackageSet builds a main package and its subpackages in one go, like a spec
+// file with several %package sections. The packages share the metadata of
+// the main package, its version and release, and a pool of files, which
+// are split between them.
+type PackageSet struct {
+	md          RPMMetaData
+	files       []RPMFile
+	subpackages []Subpackage
+}
+
+// NewPackageSet returns a package set whose main package has the metadata md.
+func NewPackageSet(md RPMMetaData) (*PackageSet, error) {
+	if err := validateName(md.Name); err != nil {
+		return nil, err
+	}
+	return &PackageSet{md: md}, nil
+}
+
+// AddFile adds a file to the pool of the package set. It goes into the first
+// subpackage whose Files match it, or into the main package if none do.
+func (s *PackageSet) AddFile(f RPMFile) error {
+	name, err := cleanPath(f.Name)
+	if err != nil {
+		return err
+	}
+	f.Name = name
+	s.files = append(s.files, f)
+	return nil
+}
+
+// AddSubpackage adds a subpackage to the package set.
+func (s *PackageSet) AddSubpackage(p Subpackage) error {
+	name := s.subpackageName(p)
+	if p.Name == "" && p.FullName == "" {
+		return errors.New("a subpackage needs a name")
+	}
+	if name == s.md.Name {
+		return errors.Errorf("subpackage %s has the name of the main package", name)
+	}
+	for _, o := range s.subpackages {
+		if s.subpackageName(o) == name {
+			return errors.Errorf("subpackage %s is already in the package set", name)
+		}
+	}
+	for _, pattern := range p.Files {
+		if _, err := path.Match(pattern, "/"); err != nil {
+			return errors.Wrapf(err, "invalid file pattern %q of subpackage %s", pattern, name)
+		}
+	}
+	p.Files = append([]string(nil), p.Files...)
+	s.subpackages = append(s.subpackages, p)
+	return nil
+}
+
+func (s *PackageSet) subpackageName(p Subpackage) string {
+	if p.FullName != "" {
+		return p.FullName
+	}
+	return s.md.Name + "-" + p.Name
+}
+
+// matchFile reports whether the file at name is selected by one of patterns,
+// or is under a directory they select.
+func matchFile(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		for p := name; p != "/"; p = path.Dir(p) {
+			if ok, _ := path.Match(strings.TrimSuffix(pattern, "/"), p); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Build returns the main package followed by the subpackages, in the order
+// they were added. They all name the source rpm of the main package. The
+// packages can still be changed before they are written, for example to
+// add scriptlets.
+func (s *PackageSet) Build() ([]*RPM, error) {
+	main, err := NewRPM(s.md)
+	if err != nil {
+		return nil, err
+	}
+	rpms := []*RPM{main}
+	for _, p := range s.subpackages {
+		md := s.md
+		md.Name = s.subpackageName(p)
+		md.SourceRPM = main.sourceRPMName()
+		md.Summary = p.Summary
+		if p.Description != "" {
+			md.Description = p.Description
+		}
+		if p.Arch != "" {
+			md.Arch = p.Arch
+		}
+		md.Provides, md.Requires, md.Conflicts, md.Obsoletes = p.Provides, p.Requires, p.Conflicts, p.Obsoletes
+		md.Suggests, md.Recommends, md.Supplements, md.Enhances = p.Suggests, p.Recommends, p.Supplements, p.Enhances
+		if p.RequireMain {
+			md.Requires = append(Relations{{Name: s.md.Name, Version: main.evr(), Sense: SenseEqual}}, md.Requires...)
+		}
+		// The translations are the ones of the main package.
+		md.Translations = nil
+		r, err := NewRPM(md)
+		if err != nil {
+			return nil, errors.Wrapf(err, "subpackage %s", md.Name)
+		}
+		rpms = append(rpms, r)
+	}
+	files := make([]RPMFile, len(s.files))
+	copy(files, s.files)
+	sort.SliceStable(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	for _, f := range files {
+		r := main
+		for i, p := range s.subpackages {
+			if matchFile(p.Files, f.Name) {
+				r = rpms[i+1]
+				break
+			}
+		}
+		if err := r.AddFile(f); err != nil {
+			return nil, errors.Wrapf(err, "package %s", r.Name)
+		}
+	}
+	return rpms, nil
+}
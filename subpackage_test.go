@@ -0,0 +1,116 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPackageSet(t *testing.T) {
+	s, err := NewPackageSet(RPMMetaData{Name: "foo", Version: "1.0", Release: "2", Arch: "x86_64", Summary: "foo", Description: "the foo", Licence: "MIT"})
+	if err != nil {
+		t.Fatalf("NewPackageSet returned error %v", err)
+	}
+	for _, n := range []string{"/usr/bin/foo", "/usr/include/foo/foo.h", "/usr/include/foo.h", "/usr/lib64/libfoo.so", "/usr/share/doc/foo/README"} {
+		if err := s.AddFile(RPMFile{Name: n, Body: []byte(n)}); err != nil {
+			t.Fatalf("AddFile(%s) returned error %v", n, err)
+		}
+	}
+	if err := s.AddSubpackage(Subpackage{Name: "devel", Summary: "foo headers", RequireMain: true, Files: []string{"/usr/include", "/usr/lib64/*.so"}}); err != nil {
+		t.Fatalf("AddSubpackage returned error %v", err)
+	}
+	if err := s.AddSubpackage(Subpackage{FullName: "foo-docs", Summary: "foo docs", Arch: "noarch", Files: []string{"/usr/share/doc/"}}); err != nil {
+		t.Fatalf("AddSubpackage returned error %v", err)
+	}
+	if err := s.AddSubpackage(Subpackage{Name: "docs", Summary: "again"}); err == nil {
+		t.Error("AddSubpackage of a duplicate name returned no error")
+	}
+	rpms, err := s.Build()
+	if err != nil {
+		t.Fatalf("Build returned error %v", err)
+	}
+	want := []struct {
+		name, arch, description string
+		files, requires         []string
+	}{
+		{"foo", "x86_64", "the foo", []string{"/usr/bin/foo"}, nil},
+		{"foo-devel", "x86_64", "the foo", []string{"/usr/include/foo.h", "/usr/include/foo/foo.h", "/usr/lib64/libfoo.so"}, []string{"foo"}},
+		{"foo-docs", "noarch", "the foo", []string{"/usr/share/doc/foo/README"}, nil},
+	}
+	if len(rpms) != len(want) {
+		t.Fatalf("Build returned %d packages, want %d", len(rpms), len(want))
+	}
+	for i, w := range want {
+		b := &bytes.Buffer{}
+		if err := rpms[i].Write(b); err != nil {
+			t.Fatalf("Write of %s returned error %v", w.name, err)
+		}
+		h := readHeader(t, b.Bytes())
+		if got := h.getString(tagName); got != w.name {
+			t.Errorf("package %d is %s, want %s", i, got, w.name)
+		}
+		if got := h.getString(tagArch); got != w.arch {
+			t.Errorf("%s has arch %s, want %s", w.name, got, w.arch)
+		}
+		if got := h.getString(tagDescription); got != w.description {
+			t.Errorf("%s has description %q, want %q", w.name, got, w.description)
+		}
+		if got := h.getString(tagSourceRPM); got != "foo-1.0-2.src.rpm" {
+			t.Errorf("%s has source rpm %s, want foo-1.0-2.src.rpm", w.name, got)
+		}
+		info, err := ReadRPMInfo(bytes.NewReader(b.Bytes()))
+		if err != nil {
+			t.Fatalf("ReadRPMInfo returned error %v", err)
+		}
+		var files []string
+		for _, f := range info.Files {
+			files = append(files, f.Name)
+		}
+		if d := cmp.Diff(w.files, files); d != "" {
+			t.Errorf("%s files mismatch (-want +got):\n%s", w.name, d)
+		}
+		var requires []string
+		for _, n := range h.getStrings(tagRequires) {
+			if n == "foo" {
+				requires = append(requires, n)
+			}
+		}
+		if d := cmp.Diff(w.requires, requires); d != "" {
+			t.Errorf("%s requires mismatch (-want +got):\n%s", w.name, d)
+		}
+	}
+}
+
+func TestMatchFile(t *testing.T) {
+	for _, tc := range []struct {
+		patterns []string
+		name     string
+		want     bool
+	}{
+		{[]string{"/usr/include"}, "/usr/include/foo/foo.h", true},
+		{[]string{"/usr/include/"}, "/usr/include", true},
+		{[]string{"/usr/lib64/*.so"}, "/usr/lib64/libfoo.so", true},
+		{[]string{"/usr/lib64/*.so"}, "/usr/lib64/libfoo.so.1", false},
+		{[]string{"/usr/inc"}, "/usr/include/foo.h", false},
+		{nil, "/usr/bin/foo", false},
+	} {
+		if got := matchFile(tc.patterns, tc.name); got != tc.want {
+			t.Errorf("matchFile(%q, %s) = %v, want %v", tc.patterns, tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SysusersDir is where AddSysusers puts the sysusers.d files.
+const SysusersDir = "/usr/lib/sysusers.d"
+
+// AddSysusers adds the sysusers.d(5) configuration conf as
+// SysusersDir/<name>.conf, and provides the users and groups it declares the
+// way rpm 4.19 does, like "user(foo) = <encoded line>". rpm 4.19 creates them
+// on install, without useradd scriptlets.
+func (r *RPM) AddSysusers(name string, conf []byte) error {
+	rels, err := sysusersProvides(conf)
+	if err != nil {
+		return errors.Wrapf(err, "invalid sysusers configuration %q", name)
+	}
+	if err := r.AddFile(RPMFile{
+		Name:  path.Join(SysusersDir, name+".conf"),
+		Body:  conf,
+		Mode:  0100644,
+		Owner: "root",
+		Group: "root",
+	}); err != nil {
+		return err
+	}
+	for _, rel := range rels {
+		r.Provides.addIfMissing(rel)
+	}
+	return nil
+}
+
+// sysusersProvides returns the provides of the lines of a sysusers.d file.
+// As in the sysusers.prov generator of rpm, the version of a provide is the
+// line, with the fields separated by NUL, in base64.
+func sysusersProvides(conf []byte) (Relations, error) {
+	var rels Relations
+	provide := func(name string, fields []string) {
+		rel := &Relation{Name: name}
+		if fields != nil {
+			rel.Version = base64.StdEncoding.EncodeToString([]byte(strings.Join(fields, "\x00") + "\x00"))
+			rel.Sense = SenseEqual
+		}
+		rels = append(rels, rel)
+	}
+	s := bufio.NewScanner(bytes.NewReader(conf))
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		fields, err := sysusersFields(line)
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", n)
+		}
+		if len(fields) < 2 {
+			return nil, errors.Errorf("line %d: missing name", n)
+		}
+		switch fields[0] {
+		case "u":
+			// Missing fields default to "-", as with systemd-sysusers.
+			for len(fields) < 6 {
+				fields = append(fields, "-")
+			}
+			provide("user("+fields[1]+")", fields[:6])
+			// Users get a group of the same name, unless they join another one.
+			if i := strings.Index(fields[2], ":"); i < 0 || fields[2][i+1:] == fields[1] {
+				provide("group("+fields[1]+")", nil)
+			}
+		case "g":
+			for len(fields) < 3 {
+				fields = append(fields, "-")
+			}
+			provide("group("+fields[1]+")", fields[:3])
+		case "m":
+			if len(fields) < 3 {
+				return nil, errors.Errorf("line %d: missing group", n)
+			}
+			provide("groupmember("+fields[1]+"/"+fields[2]+")", fields[:3])
+		case "r":
+			// Ranges only matter on the host.
+		default:
+			return nil, errors.Errorf("line %d: unknown type %q", n, fields[0])
+		}
+	}
+	return rels, errors.Wrap(s.Err(), "failed to read configuration")
+}
+
+// sysusersFields splits a sysusers.d line into its fields, which are separated
+// by spaces, and can be quoted like the GECOS field "Foo Daemon".
+func sysusersFields(line string) ([]string, error) {
+	var (
+		fields []string
+		field  strings.Builder
+		quote  rune
+		inside bool
+	)
+	for _, c := range line {
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			field.WriteRune(c)
+		case c == '"' || c == '\'':
+			quote, inside = c, true
+		case c == ' ' || c == '\t':
+			if inside {
+				fields = append(fields, field.String())
+				field.Reset()
+				inside = false
+			}
+		default:
+			field.WriteRune(c)
+			inside = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if inside {
+		fields = append(fields, field.String())
+	}
+	return fields, nil
+}
+
+// addOwnerRequirements requires the users and groups owning the files, other
+// than root, like rpm 4.19 does, so that they exist before the files are
+// installed.
+func (r *RPM) addOwnerRequirements() {
+	fnames := []string{}
+	for fn := range r.files {
+		fnames = append(fnames, fn)
+	}
+	sort.Strings(fnames)
+	for _, fn := range fnames {
+		f := r.files[fn]
+		if f.Owner != "" && f.Owner != "root" {
+			r.Requires.addGenerated("user("+f.Owner+")", "", SenseFindRequires)
+		}
+		if f.Group != "" && f.Group != "root" {
+			r.Requires.addGenerated("group("+f.Group+")", "", SenseFindRequires)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSysusersFields(t *testing.T) {
+	testCases := []struct {
+		line        string
+		want        []string
+		errExpected bool
+	}{
+		{line: "u foo - \"Foo Daemon\" /var/lib/foo", want: []string{"u", "foo", "-", "Foo Daemon", "/var/lib/foo"}},
+		{line: "g\tbar  123", want: []string{"g", "bar", "123"}},
+		{line: "u foo - ''", want: []string{"u", "foo", "-", ""}},
+		{line: "u foo - \"Foo", errExpected: true},
+	}
+	for _, tc := range testCases {
+		got, err := sysusersFields(tc.line)
+		if tc.errExpected {
+			if err == nil {
+				t.Errorf("sysusersFields(%q) = %q, want error", tc.line, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("sysusersFields(%q) returned error %v", tc.line, err)
+			continue
+		}
+		if d := cmp.Diff(tc.want, got); d != "" {
+			t.Errorf("sysusersFields(%q) unexpected fields (-want, +got): %s", tc.line, d)
+		}
+	}
+}
+
+func TestAddSysusers(t *testing.T) {
+	enc := func(fields ...string) string {
+		return base64.StdEncoding.EncodeToString([]byte(strings.Join(fields, "\x00") + "\x00"))
+	}
+	r, err := NewRPM(RPMMetaData{Name: "test", Version: "1.0", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	conf := "# foo\nu foo - \"Foo Daemon\" /var/lib/foo\ng bar 123\nu baz 200:bar\nm foo bar\nr - 500-900\n"
+	if err := r.AddSysusers("test", []byte(conf)); err != nil {
+		t.Fatalf("AddSysusers returned error %v", err)
+	}
+	f, ok := r.files["/usr/lib/sysusers.d/test.conf"]
+	if !ok {
+		t.Fatalf("sysusers.d file was not added")
+	}
+	if string(f.Body) != conf || f.Mode != 0100644 {
+		t.Errorf("unexpected sysusers.d file %+v", f)
+	}
+	want := []string{
+		"test=1.0",
+		"user(foo)=" + enc("u", "foo", "-", "Foo Daemon", "/var/lib/foo", "-"),
+		"group(foo)",
+		"group(bar)=" + enc("g", "bar", "123"),
+		"user(baz)=" + enc("u", "baz", "200:bar", "-", "-", "-"),
+		"groupmember(foo/bar)=" + enc("m", "foo", "bar"),
+	}
+	var got []string
+	for _, p := range r.Provides {
+		got = append(got, p.String())
+	}
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("unexpected provides (-want, +got): %s", d)
+	}
+
+	for _, conf := range []string{"x foo\n", "u\n", "m foo\n", "u 'foo\n"} {
+		if err := r.AddSysusers("bad", []byte(conf)); err == nil {
+			t.Errorf("AddSysusers accepted %q", conf)
+		}
+	}
+}
+
+func TestRequireFileOwners(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "test", Version: "1.0", Summary: "summary", RequireFileOwners: true})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/var/lib/foo", Mode: 040750, Owner: "foo", Group: "foo"})
+	r.AddFile(RPMFile{Name: "/var/lib/foo/data", Body: []byte("data"), Owner: "foo", Group: "bar"})
+	r.AddFile(RPMFile{Name: "/usr/bin/foo", Body: []byte("foo"), Mode: 0755})
+	if err := r.Write(ioutil.Discard); err != nil {
+		t.Fatalf("Write returned error %v", err)
+	}
+	var got []string
+	for _, rel := range r.Requires {
+		if rel.Sense&SenseRPMLib == 0 {
+			got = append(got, rel.String())
+		}
+	}
+	if d := cmp.Diff([]string{"user(foo)", "group(foo)", "group(bar)"}, got); d != "" {
+		t.Errorf("unexpected requires (-want, +got): %s", d)
+	}
+}
@@ -19,13 +19,25 @@ package rpmpack
 const (
 	tagHeaderI18NTable = 0x64 // 100
 	// Signature tags are obiously overlapping regular header tags..
-	sigSHA256      = 0x0111 // 273
-	sigSize        = 0x03e8 // 1000
-	sigPGP         = 0x03ea // 1002
-	sigPayloadSize = 0x03ef // 1007
+	sigDSA                 = 0x010b // 267
+	sigRSA                 = 0x010c // 268
+	sigSHA1                = 0x010d // 269
+	sigSHA256              = 0x0111 // 273
+	sigLongSize            = 0x010e // 270
+	sigLongArchiveSize     = 0x010f // 271
+	sigVeritySignatures    = 0x0114 // 276
+	sigVeritySignatureAlgo = 0x0115 // 277
+	sigSize                = 0x03e8 // 1000
+	sigPGP                 = 0x03ea // 1002
+	sigGPG                 = 0x03ed // 1005
+	sigPayloadSize         = 0x03ef // 1007
+	sigReservedSpace       = 0x03f0 // 1008
 
 	// https://github.com/rpm-software-management/rpm/blob/92eadae94c48928bca90693ad63c46ceda37d81f/rpmio/rpmpgp.h#L258
+	hashAlgoMD5    = 0x0001 // 1
+	hashAlgoSHA1   = 0x0002 // 2
 	hashAlgoSHA256 = 0x0008 // 8
+	hashAlgoSHA512 = 0x000a // 10
 
 	tagName        = 0x03e8 // 1000
 	tagVersion     = 0x03e9 // 1001
@@ -40,6 +52,8 @@ const (
 	tagLicence     = 0x03f6 // 1014
 	tagPackager    = 0x03f7 // 1015
 	tagGroup       = 0x03f8 // 1016
+	tagSource      = 0x03fa // 1018
+	tagPatch       = 0x03fb // 1019
 	tagURL         = 0x03fc // 1020
 	tagOS          = 0x03fd // 1021
 	tagArch        = 0x03fe // 1022
@@ -49,6 +63,7 @@ const (
 	tagPreun  = 0x0401 // 1025
 	tagPostun = 0x0402 // 1026
 
+	tagOldFileNames      = 0x0403 // 1027
 	tagFileSizes         = 0x0404 // 1028
 	tagFileModes         = 0x0406 // 1030
 	tagFileRDevs         = 0x0409 // 1033
@@ -67,13 +82,19 @@ const (
 	tagConflictFlags     = 0x041d // 1053
 	tagConflicts         = 0x041e // 1054
 	tagConflictVersion   = 0x041f // 1055
+	tagChangelogTime     = 0x0438 // 1080
+	tagChangelogName     = 0x0439 // 1081
+	tagChangelogText     = 0x043a // 1082
 	tagPreinProg         = 0x043d // 1085
 	tagPostinProg        = 0x043e // 1086
 	tagPreunProg         = 0x043f // 1087
 	tagPostunProg        = 0x0440 // 1088
 	tagObsoletes         = 0x0442 // 1090
+	tagCookie            = 0x0446 // 1094
 	tagFileINodes        = 0x0448 // 1096
 	tagFileLangs         = 0x0449 // 1097
+	tagPrefixes          = 0x044a // 1098
+	tagSourcePackage     = 0x0452 // 1106
 	tagProvideFlags      = 0x0458 // 1112
 	tagProvideVersion    = 0x0459 // 1113
 	tagObsoleteFlags     = 0x045a // 1114
@@ -81,16 +102,76 @@ const (
 	tagDirindexes        = 0x045c // 1116
 	tagBasenames         = 0x045d // 1117
 	tagDirnames          = 0x045e // 1118
+	tagOptFlags          = 0x0462 // 1122
+	tagDistURL           = 0x0463 // 1123
 	tagPayloadFormat     = 0x0464 // 1124
 	tagPayloadCompressor = 0x0465 // 1125
 	tagPayloadFlags      = 0x0466 // 1126
+	tagPlatform          = 0x046c // 1132
+	tagFileColors        = 0x0474 // 1140
+	tagFileClass         = 0x0475 // 1141
+	tagClassDict         = 0x0476 // 1142
+	tagFileContexts      = 0x047b // 1147
+	tagPretrans          = 0x047f // 1151
+	tagPosttrans         = 0x0480 // 1152
+	tagPretransProg      = 0x0481 // 1153
+	tagPosttransProg     = 0x0482 // 1154
+	tagDistTag           = 0x0483 // 1155
+	tagLongFileSizes     = 0x1390 // 5008
+	tagLongSize          = 0x1391 // 5009
+	tagFileCaps          = 0x1392 // 5010
 	tagFileDigestAlgo    = 0x1393 // 5011
+	tagPreinFlags        = 0x139c // 5020
+	tagPostinFlags       = 0x139d // 5021
+	tagPreunFlags        = 0x139e // 5022
+	tagPostunFlags       = 0x139f // 5023
+	tagPretransFlags     = 0x13a0 // 5024
+	tagPosttransFlags    = 0x13a1 // 5025
 	tagRecommends        = 0x13b6 // 5046
 	tagRecommendVersion  = 0x13b7 // 5047
 	tagRecommendFlags    = 0x13b8 // 5048
 	tagSuggests          = 0x13b9 // 5049
 	tagSuggestVersion    = 0x13ba // 5050
 	tagSuggestFlags      = 0x13bb // 5051
+	tagSupplements       = 0x13bc // 5052
+	tagSupplementVersion = 0x13bd // 5053
+	tagSupplementFlags   = 0x13be // 5054
+	tagEnhances          = 0x13bf // 5055
+	tagEnhanceVersion    = 0x13c0 // 5056
+	tagEnhanceFlags      = 0x13c1 // 5057
+	tagOrderName         = 0x13ab // 5035
+	tagOrderVersion      = 0x13ac // 5036
+	tagOrderFlags        = 0x13ad // 5037
+	tagFileSignatures    = 0x13e2 // 5090
+	tagFileSignatureLen  = 0x13e3 // 5091
 	tagPayloadDigest     = 0x13e4 // 5092
 	tagPayloadDigestAlgo = 0x13e5 // 5093
+	tagModularityLabel   = 0x13e8 // 5096
+	tagPayloadDigestAlt  = 0x13e9 // 5097
+
+	// Triggers and file triggers, see trigger.go.
+	tagTriggerScripts     = 0x0429 // 1065
+	tagTriggerName        = 0x042a // 1066
+	tagTriggerVersion     = 0x042b // 1067
+	tagTriggerFlags       = 0x042c // 1068
+	tagTriggerIndex       = 0x042d // 1069
+	tagTriggerScriptProg  = 0x0444 // 1092
+	tagTriggerScriptFlags = 0x13a3 // 5027
+
+	tagFileTriggerScripts          = 0x13ca // 5066
+	tagFileTriggerScriptProg       = 0x13cb // 5067
+	tagFileTriggerScriptFlags      = 0x13cc // 5068
+	tagFileTriggerName             = 0x13cd // 5069
+	tagFileTriggerIndex            = 0x13ce // 5070
+	tagFileTriggerVersion          = 0x13cf // 5071
+	tagFileTriggerFlags            = 0x13d0 // 5072
+	tagTransFileTriggerScripts     = 0x13d4 // 5076
+	tagTransFileTriggerScriptProg  = 0x13d5 // 5077
+	tagTransFileTriggerScriptFlags = 0x13d6 // 5078
+	tagTransFileTriggerName        = 0x13d7 // 5079
+	tagTransFileTriggerIndex       = 0x13d8 // 5080
+	tagTransFileTriggerVersion     = 0x13d9 // 5081
+	tagTransFileTriggerFlags       = 0x13da // 5082
+	tagFileTriggerPriorities       = 0x13dc // 5084
+	tagTransFileTriggerPriorities  = 0x13dd // 5085
 )
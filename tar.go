@@ -20,6 +20,7 @@ import (
 	"io"
 	"io/ioutil"
 	"path"
+	"strconv"
 
 	"github.com/pkg/errors"
 )
@@ -31,40 +32,79 @@ func FromTar(inp io.Reader, md RPMMetaData) (*RPM, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create RPM structure")
 	}
+	if err := r.AddTar(inp); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// AddTar adds the directories, files, symlinks, devices and fifos of a tar file to the rpm,
+// with the modes, owners and modification times of the tar headers.
+// Hard links are added with AddHardlink, the file they link to has to come
+// first in the tar file.
+func (r *RPM) AddTar(inp io.Reader) error {
 	t := tar.NewReader(inp)
 	for {
 		h, err := t.Next()
 		if err == io.EOF {
-			return r, nil
+			return nil
 		} else if err != nil {
-			return nil, errors.Wrap(err, "failed to read tar file")
+			return errors.Wrap(err, "failed to read tar file")
 		}
+		name := path.Join("/", h.Name)
 		var body []byte
+		var major, minor uint32
 		switch h.Typeflag {
 		case tar.TypeDir:
 			h.Mode |= 040000
 		case tar.TypeSymlink:
 			body = []byte(h.Linkname)
 			h.Mode |= 0120000
-		case tar.TypeReg:
+		case tar.TypeReg, tar.TypeRegA:
 			b, err := ioutil.ReadAll(t)
 			if err != nil {
-				return nil, errors.Wrapf(err, "failed to read file (%q)", h.Name)
+				return errors.Wrapf(err, "failed to read file (%q)", h.Name)
 			}
 			body = b
+		case tar.TypeChar, tar.TypeBlock:
+			if h.Typeflag == tar.TypeChar {
+				h.Mode |= 020000
+			} else {
+				h.Mode |= 060000
+			}
+			major, minor = uint32(h.Devmajor), uint32(h.Devminor)
+		case tar.TypeFifo:
+			h.Mode |= 010000
+		case tar.TypeLink:
+			if err := r.AddHardlink(name, path.Join("/", h.Linkname)); err != nil {
+				return errors.Wrapf(err, "failed to add hard link %q", h.Name)
+			}
+			continue
 		default:
-			return nil, fmt.Errorf("unknown tar type: %d, (%q)", h.Typeflag, h.Name)
+			return fmt.Errorf("unknown tar type: %d, (%q)", h.Typeflag, h.Name)
 		}
 		mtime := uint32(h.ModTime.Unix())
+		// Without names, the ids are resolved by the names of SetOwnerIDs.
+		if h.Uname == "" {
+			h.Uname = strconv.Itoa(h.Uid)
+		}
+		if h.Gname == "" {
+			h.Gname = strconv.Itoa(h.Gid)
+		}
 
-		r.AddFile(
+		if err := r.AddFile(
 			RPMFile{
-				Name:  path.Join("/", h.Name),
+				Name:  name,
 				Body:  body,
 				Mode:  uint(h.Mode),
 				Owner: h.Uname,
 				Group: h.Gname,
 				MTime: mtime,
-			})
+
+				DevMajor: major,
+				DevMinor: minor,
+			}); err != nil {
+			return errors.Wrapf(err, "failed to add %q", h.Name)
+		}
 	}
 }
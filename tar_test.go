@@ -82,7 +82,7 @@ func TestFromTar(t *testing.T) {
 	for _, tc := range testCases {
 		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
-			r, err := FromTar(tc.input, RPMMetaData{})
+			r, err := FromTar(tc.input, RPMMetaData{Summary: "summary"})
 			if err != nil {
 				t.Errorf("FromTar returned err: %v", err)
 			}
@@ -101,3 +101,76 @@ func TestFromTar(t *testing.T) {
 		})
 	}
 }
+
+func TestAddTarHardLink(t *testing.T) {
+	b := &bytes.Buffer{}
+	ta := tar.NewWriter(b)
+	for _, h := range []*tar.Header{
+		{Name: "bin/tool", Mode: 0755, Size: 4, Uname: "bin", Gname: "bin"},
+		{Typeflag: tar.TypeLink, Name: "bin/alias", Linkname: "bin/tool", Mode: 0755},
+	} {
+		if err := ta.WriteHeader(h); err != nil {
+			t.Fatalf("failed to write header %s: %v", h.Name, err)
+		}
+		if h.Size != 0 {
+			ta.Write([]byte("tool"))
+		}
+	}
+	ta.Close()
+	r, err := NewRPM(RPMMetaData{Name: "tar", Version: "1.0", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	if err := r.AddTar(b); err != nil {
+		t.Fatalf("AddTar returned error %v", err)
+	}
+	if d := cmp.Diff([]byte("tool"), r.files["/bin/alias"].Body); d != "" {
+		t.Errorf("hard link content differs (want->got):\n%v", d)
+	}
+
+	b.Reset()
+	ta = tar.NewWriter(b)
+	ta.WriteHeader(&tar.Header{Typeflag: tar.TypeLink, Name: "alias", Linkname: "missing"})
+	ta.Close()
+	if err := r.AddTar(b); err == nil {
+		t.Error("AddTar with a dangling hard link returned no error")
+	}
+}
+
+func TestAddTarDevices(t *testing.T) {
+	b := &bytes.Buffer{}
+	ta := tar.NewWriter(b)
+	for _, h := range []*tar.Header{
+		{Typeflag: tar.TypeChar, Name: "dev/null", Mode: 0666, Devmajor: 1, Devminor: 3},
+		{Typeflag: tar.TypeBlock, Name: "dev/sda", Mode: 0660, Devmajor: 8, Devminor: 0},
+		{Typeflag: tar.TypeFifo, Name: "run/fifo", Mode: 0600},
+	} {
+		if err := ta.WriteHeader(h); err != nil {
+			t.Fatalf("failed to write header %s: %v", h.Name, err)
+		}
+	}
+	ta.Close()
+	r, err := NewRPM(RPMMetaData{Name: "tar", Version: "1.0", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	if err := r.AddTar(b); err != nil {
+		t.Fatalf("AddTar returned error %v", err)
+	}
+	type dev struct {
+		Mode         uint
+		Major, Minor uint32
+	}
+	got := map[string]dev{}
+	for n, f := range r.files {
+		got[n] = dev{f.Mode, f.DevMajor, f.DevMinor}
+	}
+	want := map[string]dev{
+		"/dev/null": {020666, 1, 3},
+		"/dev/sda":  {060660, 8, 0},
+		"/run/fifo": {010600, 0, 0},
+	}
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("devices differ (want->got):\n%v", d)
+	}
+}
@@ -0,0 +1,9 @@
+#include "hello.h"
+
+int answer(void) { return ANSWER; }
+
+void _start(void) {
+	for (;;) {
+		answer();
+	}
+}
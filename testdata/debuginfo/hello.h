@@ -0,0 +1 @@
+#define ANSWER 42
@@ -0,0 +1,205 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// TriggerType is when rpm runs a trigger, relative to the package it is on.
+type TriggerType rpmSense
+
+// The values are the RPMSENSE_TRIGGER* bits of rpm, stored in TRIGGERFLAGS.
+// https://github.com/rpm-software-management/rpm/blob/master/include/rpm/rpmds.h
+const (
+	// TriggerIn runs after the package is installed (%triggerin).
+	TriggerIn TriggerType = 1 << 16
+	// TriggerUn runs before the package is removed (%triggerun).
+	TriggerUn TriggerType = 1 << 17
+	// TriggerPostun runs after the package is removed (%triggerpostun).
+	TriggerPostun TriggerType = 1 << 18
+	// TriggerPrein runs before the package is installed (%triggerprein).
+	TriggerPrein TriggerType = 1 << 25
+)
+
+// Trigger is a script rpm runs when other packages are installed or removed.
+type Trigger struct {
+	Type TriggerType
+	// Packages are the packages the trigger is on, like "foo" or "foo >= 2.0".
+	// The trigger runs for each of them.
+	Packages Relations
+	Script   string
+	// Interpreter is the program running the script, /bin/sh if empty.
+	// Triggers cannot pass arguments to their interpreter.
+	Interpreter string
+	Flags       ScriptletFlags
+}
+
+// AddTrigger adds a trigger on other packages, the equivalent of
+// "%triggerin -- foo >= 2.0" in a spec file.
+func (r *RPM) AddTrigger(t Trigger) error {
+	switch t.Type {
+	case TriggerIn, TriggerUn, TriggerPostun, TriggerPrein:
+	default:
+		return errors.Errorf("invalid trigger type %d", t.Type)
+	}
+	if len(t.Packages) == 0 {
+		return errors.New("a trigger needs at least one package")
+	}
+	for _, p := range t.Packages {
+		if p.IsRich() {
+			return errors.Errorf("trigger on rich dependency %q is not allowed", p.Name)
+		}
+	}
+	if t.Interpreter == "" {
+		t.Interpreter = defaultInterpreter[0]
+	}
+	t.Packages = append(Relations(nil), t.Packages...)
+	r.triggers = append(r.triggers, t)
+	return nil
+}
+
+// DefaultFileTriggerPriority is the priority of file triggers without one.
+const DefaultFileTriggerPriority = 1000000
+
+// FileTrigger is a script rpm runs when files under some paths are installed
+// or removed, by any package, like running ldconfig for /usr/lib64.
+type FileTrigger struct {
+	// Type is TriggerIn, TriggerUn or TriggerPostun.
+	Type TriggerType
+	// Transaction makes the trigger run once per transaction
+	// (%transfiletriggerin), instead of once per package (%filetriggerin).
+	Transaction bool
+	// Prefixes are the paths the trigger is on, like "/usr/lib64".
+	Prefixes []string
+	Script   string
+	// Interpreter is the program running the script, /bin/sh if empty.
+	Interpreter string
+	Flags       ScriptletFlags
+	// Priority orders the file triggers, higher priorities run first for
+	// TriggerIn. DefaultFileTriggerPriority if 0.
+	Priority uint32
+}
+
+// AddFileTrigger adds a file trigger, the equivalent of
+// "%filetriggerin -- /usr/lib64" in a spec file.
+func (r *RPM) AddFileTrigger(t FileTrigger) error {
+	switch t.Type {
+	case TriggerIn, TriggerUn, TriggerPostun:
+	default:
+		return errors.Errorf("invalid file trigger type %d", t.Type)
+	}
+	if len(t.Prefixes) == 0 {
+		return errors.New("a file trigger needs at least one path prefix")
+	}
+	for _, p := range t.Prefixes {
+		if !strings.HasPrefix(p, "/") {
+			return errors.Errorf("file trigger prefix %q is not an absolute path", p)
+		}
+	}
+	if t.Interpreter == "" {
+		t.Interpreter = defaultInterpreter[0]
+	}
+	if t.Priority == 0 {
+		t.Priority = DefaultFileTriggerPriority
+	}
+	t.Prefixes = append([]string(nil), t.Prefixes...)
+	r.fileTriggers = append(r.fileTriggers, t)
+	return nil
+}
+
+// triggerTags are the tags of a kind of triggers.
+type triggerTags struct {
+	scripts, progs, scriptFlags, names, versions, flags, indexes, priorities int
+}
+
+var (
+	packageTriggerTags = triggerTags{
+		tagTriggerScripts, tagTriggerScriptProg, tagTriggerScriptFlags,
+		tagTriggerName, tagTriggerVersion, tagTriggerFlags, tagTriggerIndex, 0,
+	}
+	fileTriggerTags = triggerTags{
+		tagFileTriggerScripts, tagFileTriggerScriptProg, tagFileTriggerScriptFlags,
+		tagFileTriggerName, tagFileTriggerVersion, tagFileTriggerFlags, tagFileTriggerIndex, tagFileTriggerPriorities,
+	}
+	transFileTriggerTags = triggerTags{
+		tagTransFileTriggerScripts, tagTransFileTriggerScriptProg, tagTransFileTriggerScriptFlags,
+		tagTransFileTriggerName, tagTransFileTriggerVersion, tagTransFileTriggerFlags, tagTransFileTriggerIndex, tagTransFileTriggerPriorities,
+	}
+)
+
+// writeTriggerIndexes writes the triggers and the file triggers.
+func (r *RPM) writeTriggerIndexes(h *index) {
+	writeTriggers(h, packageTriggerTags, r.triggers, nil)
+	var (
+		file, trans                     []Trigger
+		filePriorities, transPriorities []uint32
+	)
+	for _, ft := range r.fileTriggers {
+		t := Trigger{Type: ft.Type, Script: ft.Script, Interpreter: ft.Interpreter, Flags: ft.Flags}
+		for _, p := range ft.Prefixes {
+			t.Packages = append(t.Packages, &Relation{Name: p})
+		}
+		if ft.Transaction {
+			trans = append(trans, t)
+			transPriorities = append(transPriorities, ft.Priority)
+		} else {
+			file = append(file, t)
+			filePriorities = append(filePriorities, ft.Priority)
+		}
+	}
+	writeTriggers(h, fileTriggerTags, file, filePriorities)
+	writeTriggers(h, transFileTriggerTags, trans, transPriorities)
+}
+
+// writeTriggers writes the scripts of the triggers, one entry per trigger,
+// and what they are on, one entry per package or prefix, with the index of the
+// script of the trigger in the index tag.
+func writeTriggers(h *index, tags triggerTags, triggers []Trigger, priorities []uint32) {
+	if len(triggers) == 0 {
+		return
+	}
+	var (
+		scripts, progs, names, versions []string
+		scriptFlags, flags, indexes     []uint32
+		hasFlags                        bool
+	)
+	for i, t := range triggers {
+		scripts = append(scripts, t.Script)
+		progs = append(progs, t.Interpreter)
+		scriptFlags = append(scriptFlags, uint32(t.Flags))
+		hasFlags = hasFlags || t.Flags != 0
+		for _, p := range t.Packages {
+			names = append(names, p.Name)
+			versions = append(versions, p.Version)
+			flags = append(flags, uint32(p.Sense&senseCompareMask)|uint32(t.Type))
+			indexes = append(indexes, uint32(i))
+		}
+	}
+	h.Add(tags.scripts, EntryStringSlice(scripts))
+	h.Add(tags.progs, EntryStringSlice(progs))
+	if hasFlags {
+		h.Add(tags.scriptFlags, EntryUint32(scriptFlags))
+	}
+	h.Add(tags.names, EntryStringSlice(names))
+	h.Add(tags.versions, EntryStringSlice(versions))
+	h.Add(tags.flags, EntryUint32(flags))
+	h.Add(tags.indexes, EntryUint32(indexes))
+	if priorities != nil {
+		h.Add(tags.priorities, EntryUint32(priorities))
+	}
+}
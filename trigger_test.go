@@ -0,0 +1,180 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTriggers(t *testing.T) {
+	rel := func(s string) *Relation {
+		r, err := NewRelation(s)
+		if err != nil {
+			t.Fatalf("NewRelation(%q) returned error %v", s, err)
+		}
+		return r
+	}
+	r, err := NewRPM(RPMMetaData{Name: "test", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	if err := r.AddTrigger(Trigger{
+		Type:     TriggerIn,
+		Packages: Relations{rel("foo >= 2.0"), rel("bar")},
+		Script:   "echo in",
+	}); err != nil {
+		t.Fatalf("AddTrigger returned error %v", err)
+	}
+	if err := r.AddTrigger(Trigger{
+		Type:        TriggerPostun,
+		Packages:    Relations{rel("foo < 2.0")},
+		Script:      "print('postun')",
+		Interpreter: LuaInterpreter,
+	}); err != nil {
+		t.Fatalf("AddTrigger returned error %v", err)
+	}
+	h := newIndex(immutable)
+	r.writeGenIndexes(h)
+	if d := cmp.Diff([]string{"echo in", "print('postun')"}, h.getStrings(tagTriggerScripts)); d != "" {
+		t.Errorf("unexpected scripts (-want, +got): %s", d)
+	}
+	if d := cmp.Diff([]string{"/bin/sh", "<lua>"}, h.getStrings(tagTriggerScriptProg)); d != "" {
+		t.Errorf("unexpected programs (-want, +got): %s", d)
+	}
+	if d := cmp.Diff([]string{"foo", "bar", "foo"}, h.getStrings(tagTriggerName)); d != "" {
+		t.Errorf("unexpected names (-want, +got): %s", d)
+	}
+	if d := cmp.Diff([]string{"2.0", "", "2.0"}, h.getStrings(tagTriggerVersion)); d != "" {
+		t.Errorf("unexpected versions (-want, +got): %s", d)
+	}
+	if d := cmp.Diff([]uint32{1<<16 | 12, 1 << 16, 1<<18 | 2}, h.getUint32s(tagTriggerFlags)); d != "" {
+		t.Errorf("unexpected flags (-want, +got): %s", d)
+	}
+	if d := cmp.Diff([]uint32{0, 0, 1}, h.getUint32s(tagTriggerIndex)); d != "" {
+		t.Errorf("unexpected indexes (-want, +got): %s", d)
+	}
+	if _, ok := h.entries[tagTriggerScriptFlags]; ok {
+		t.Errorf("trigger script flags should not be written without flags")
+	}
+}
+
+func TestTriggerScriptFlags(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "test", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	for _, f := range []ScriptletFlags{0, ScriptletExpand} {
+		if err := r.AddTrigger(Trigger{Type: TriggerUn, Packages: Relations{{Name: "foo"}}, Script: "echo %{_bindir}", Flags: f}); err != nil {
+			t.Fatalf("AddTrigger returned error %v", err)
+		}
+	}
+	h := newIndex(immutable)
+	r.writeGenIndexes(h)
+	if d := cmp.Diff([]uint32{0, uint32(ScriptletExpand)}, h.getUint32s(tagTriggerScriptFlags)); d != "" {
+		t.Errorf("unexpected script flags (-want, +got): %s", d)
+	}
+}
+
+func TestAddTriggerErrors(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "test", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	for _, tr := range []Trigger{
+		{Type: TriggerIn, Script: "echo"},
+		{Type: 1, Packages: Relations{{Name: "foo"}}, Script: "echo"},
+		{Type: TriggerIn, Packages: Relations{{Name: "(foo or bar)"}}, Script: "echo"},
+	} {
+		if err := r.AddTrigger(tr); err == nil {
+			t.Errorf("AddTrigger(%+v) should have returned an error", tr)
+		}
+	}
+	if len(r.triggers) != 0 {
+		t.Errorf("invalid triggers were added: %+v", r.triggers)
+	}
+}
+
+func TestFileTriggers(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "test", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	for _, ft := range []FileTrigger{
+		{Type: TriggerIn, Prefixes: []string{"/usr/share/foo"}, Script: "echo foo"},
+		{Type: TriggerIn, Transaction: true, Prefixes: []string{"/usr/lib64", "/usr/lib"}, Script: "ldconfig", Priority: 10},
+		{Type: TriggerPostun, Transaction: true, Prefixes: []string{"/usr/lib64"}, Script: "ldconfig"},
+	} {
+		if err := r.AddFileTrigger(ft); err != nil {
+			t.Fatalf("AddFileTrigger returned error %v", err)
+		}
+	}
+	h := newIndex(immutable)
+	r.writeGenIndexes(h)
+	want := map[int]interface{}{
+		tagFileTriggerScripts:         []string{"echo foo"},
+		tagFileTriggerScriptProg:      []string{"/bin/sh"},
+		tagFileTriggerName:            []string{"/usr/share/foo"},
+		tagFileTriggerVersion:         []string{""},
+		tagFileTriggerFlags:           []uint32{1 << 16},
+		tagFileTriggerIndex:           []uint32{0},
+		tagFileTriggerPriorities:      []uint32{DefaultFileTriggerPriority},
+		tagTransFileTriggerScripts:    []string{"ldconfig", "ldconfig"},
+		tagTransFileTriggerScriptProg: []string{"/bin/sh", "/bin/sh"},
+		tagTransFileTriggerName:       []string{"/usr/lib64", "/usr/lib", "/usr/lib64"},
+		tagTransFileTriggerVersion:    []string{"", "", ""},
+		tagTransFileTriggerFlags:      []uint32{1 << 16, 1 << 16, 1 << 18},
+		tagTransFileTriggerIndex:      []uint32{0, 0, 1},
+		tagTransFileTriggerPriorities: []uint32{10, DefaultFileTriggerPriority},
+	}
+	for tag, w := range want {
+		var got interface{}
+		switch w.(type) {
+		case []string:
+			got = h.getStrings(tag)
+		case []uint32:
+			got = h.getUint32s(tag)
+		}
+		if d := cmp.Diff(w, got); d != "" {
+			t.Errorf("unexpected tag %d (-want, +got): %s", tag, d)
+		}
+	}
+	for _, tag := range []int{tagTriggerScripts, tagFileTriggerScriptFlags, tagTransFileTriggerScriptFlags} {
+		if _, ok := h.entries[tag]; ok {
+			t.Errorf("unexpected tag %d", tag)
+		}
+	}
+	r.addRPMLibRequirements()
+	if got, want := r.Requires.String(), "rpmlib(FileTriggers)<=4.13.0-1"; got != want {
+		t.Errorf("requires = %s, want %s", got, want)
+	}
+}
+
+func TestAddFileTriggerErrors(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "test", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	for _, ft := range []FileTrigger{
+		{Type: TriggerIn, Script: "echo"},
+		{Type: TriggerPrein, Prefixes: []string{"/usr"}, Script: "echo"},
+		{Type: TriggerIn, Prefixes: []string{"usr/lib"}, Script: "echo"},
+	} {
+		if err := r.AddFileTrigger(ft); err == nil {
+			t.Errorf("AddFileTrigger(%+v) should have returned an error", ft)
+		}
+	}
+}
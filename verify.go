@@ -0,0 +1,285 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// ErrNoSignature is returned by VerifySignature for rpm files without a PGP signature.
+var ErrNoSignature = errors.New("rpm file is not signed")
+
+// VerifySignature checks the PGP signatures of an rpm file against keyring,
+// and returns the id of the key that signed it, a subkey for the signatures
+// of a signing subkey.
+// Both header-only (RSAHEADER or DSAHEADER) and header+payload (PGP or GPG)
+// signatures are checked, all of those present must be valid. The payload is
+// only read when there is a header+payload signature.
+func VerifySignature(r io.Reader, keyring openpgp.KeyRing) (uint64, error) {
+	if _, err := readLead(r); err != nil {
+		return 0, err
+	}
+	s, err := readSignatures(r)
+	if err != nil {
+		return 0, err
+	}
+	hb := &bytes.Buffer{}
+	if _, _, err := readIndex(io.TeeReader(r, hb)); err != nil {
+		return 0, errors.Wrap(err, "failed to read header")
+	}
+	var (
+		keyID  uint64
+		signed bool
+	)
+	if e, ok := headerSignature(s); ok {
+		signer, err := openpgp.CheckDetachedSignature(keyring, bytes.NewReader(hb.Bytes()), bytes.NewReader(e.data))
+		if err != nil {
+			return 0, errors.Wrap(err, "invalid header signature")
+		}
+		keyID, signed = signatureKeyID(e.data, signer), true
+	}
+	if e, ok := payloadSignature(s); ok {
+		signer, err := openpgp.CheckDetachedSignature(keyring, io.MultiReader(hb, r), bytes.NewReader(e.data))
+		if err != nil {
+			return 0, errors.Wrap(err, "invalid header and payload signature")
+		}
+		keyID, signed = signatureKeyID(e.data, signer), true
+	}
+	if !signed {
+		return 0, ErrNoSignature
+	}
+	return keyID, nil
+}
+
+// signatureKeyID returns the issuer key id of the valid signature sig, by
+// signer, which is signer's primary key when the signature does not name it.
+func signatureKeyID(sig []byte, signer *openpgp.Entity) uint64 {
+	p, err := packet.Read(bytes.NewReader(sig))
+	if err != nil {
+		return signer.PrimaryKey.KeyId
+	}
+	switch s := p.(type) {
+	case *packet.Signature:
+		if s.IssuerKeyId != nil {
+			return *s.IssuerKeyId
+		}
+	case *packet.SignatureV3:
+		return s.IssuerKeyId
+	}
+	return signer.PrimaryKey.KeyId
+}
+
+// ErrDigestMismatch is returned by Verify when a digest or size stored in an
+// rpm file does not match its content.
+var ErrDigestMismatch = errors.New("digest mismatch")
+
+// errSignatureStopped stops reading the payload in Verify when the check of
+// the header+payload signature failed.
+var errSignatureStopped = errors.New("signature check stopped")
+
+// Verify checks that an rpm file is consistent: the digest of the header and
+// the size of the header and payload in the signatures, the digests of the
+// payload, compressed and not, in the header, and the size and digest of
+// each file of the payload. The digests an rpm file does not have are not
+// checked. If keyring is set, the PGP signatures are checked against it too,
+// like VerifySignature does, otherwise they are ignored.
+func Verify(r io.Reader, keyring openpgp.KeyRing) error {
+	l, err := readLead(r)
+	if err != nil {
+		return err
+	}
+	s, err := readSignatures(r)
+	if err != nil {
+		return err
+	}
+	hb := &bytes.Buffer{}
+	h, _, err := readIndex(io.TeeReader(r, hb))
+	if err != nil {
+		return errors.Wrap(err, "failed to read header")
+	}
+	if want := s.getString(sigSHA256); want != "" {
+		if got := fmt.Sprintf("%x", sha256.Sum256(hb.Bytes())); got != want {
+			return errors.Wrapf(ErrDigestMismatch, "header SHA256 is %s, the signature has %s", got, want)
+		}
+	}
+	if want := s.getString(sigSHA1); want != "" {
+		if got := fmt.Sprintf("%x", sha1.Sum(hb.Bytes())); got != want {
+			return errors.Wrapf(ErrDigestMismatch, "header SHA1 is %s, the signature has %s", got, want)
+		}
+	}
+	if keyring != nil {
+		if _, ok := headerSignature(s); !ok {
+			if _, ok := payloadSignature(s); !ok {
+				return ErrNoSignature
+			}
+		}
+		if e, ok := headerSignature(s); ok {
+			if _, err := openpgp.CheckDetachedSignature(keyring, bytes.NewReader(hb.Bytes()), bytes.NewReader(e.data)); err != nil {
+				return errors.Wrap(err, "invalid header signature")
+			}
+		}
+	}
+
+	// The payload is read once, for its digests, the digests of the files and
+	// the header+payload signature.
+	payload := &countingWriter{w: ioutil.Discard}
+	writers := []io.Writer{payload}
+	payloadDigest, payloadDigestAlgo := h.getStrings(tagPayloadDigest), h.getUint32s(tagPayloadDigestAlgo)
+	var compressed hash.Hash
+	if len(payloadDigest) > 0 && len(payloadDigestAlgo) > 0 {
+		if compressed, err = newDigestHash(payloadDigestAlgo[0]); err != nil {
+			return err
+		}
+		writers = append(writers, compressed)
+	}
+	var (
+		sigDone chan error
+		pw      *io.PipeWriter
+	)
+	if e, ok := payloadSignature(s); ok && keyring != nil {
+		var pr *io.PipeReader
+		pr, pw = io.Pipe()
+		sigDone = make(chan error, 1)
+		go func() {
+			_, err := openpgp.CheckDetachedSignature(keyring, io.MultiReader(bytes.NewReader(hb.Bytes()), pr), bytes.NewReader(e.data))
+			// Stop reading the payload if the check failed before its end.
+			pr.CloseWithError(errSignatureStopped)
+			sigDone <- err
+		}()
+		writers = append(writers, pw)
+	}
+	var archive hash.Hash
+	if len(h.getStrings(tagPayloadDigestAlt)) > 0 && compressed != nil {
+		archive, _ = newDigestHash(payloadDigestAlgo[0])
+	}
+	tr := io.TeeReader(r, io.MultiWriter(writers...))
+	p := &Package{Lead: l, Signature: &Header{s}, Header: &Header{h}}
+	err = verifyPayload(p, tr, archive)
+	if err == nil {
+		// The end of the stream, after the end of the compressed payload.
+		if _, err = io.Copy(ioutil.Discard, tr); err != nil {
+			err = errors.Wrap(err, "failed to read payload")
+		}
+	}
+	if sigDone != nil {
+		pw.CloseWithError(err)
+		serr := <-sigDone
+		if serr != nil && (err == nil || errors.Cause(err) == errSignatureStopped) {
+			err = errors.Wrap(serr, "invalid header and payload signature")
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if compressed != nil {
+		if got := fmt.Sprintf("%x", compressed.Sum(nil)); got != payloadDigest[0] {
+			return errors.Wrapf(ErrDigestMismatch, "payload digest is %s, the header has %s", got, payloadDigest[0])
+		}
+	}
+	if archive != nil {
+		if got, want := fmt.Sprintf("%x", archive.Sum(nil)), h.getStrings(tagPayloadDigestAlt)[0]; got != want {
+			return errors.Wrapf(ErrDigestMismatch, "uncompressed payload digest is %s, the header has %s", got, want)
+		}
+	}
+	size := int64(hb.Len()) + payload.n
+	if want := s.getUint64s(sigLongSize); len(want) > 0 && int64(want[0]) != size {
+		return errors.Wrapf(ErrDigestMismatch, "header and payload have %d bytes, the signature has %d", size, want[0])
+	}
+	if want := s.getUint32s(sigSize); len(want) > 0 && int64(want[0]) != size {
+		return errors.Wrapf(ErrDigestMismatch, "header and payload have %d bytes, the signature has %d", size, want[0])
+	}
+	return nil
+}
+
+// verifyPayload checks the sizes and digests of the files of the payload,
+// read from r, and writes the uncompressed payload to archive, if set.
+func verifyPayload(p *Package, r io.Reader, archive io.Writer) error {
+	algo := uint32(hashAlgoMD5)
+	if a := p.Header.i.getUint32s(tagFileDigestAlgo); len(a) > 0 {
+		algo = a[0]
+	}
+	pr, err := p.payload(r, archive)
+	if err != nil {
+		return err
+	}
+	defer pr.Close()
+	// The content of a set of hard links is only with its last file, in
+	// header order, like rpm does.
+	noContent := map[string]bool{}
+	if inodes := p.Header.i.getUint32s(tagFileINodes); len(inodes) == len(pr.files) {
+		last := map[uint32]string{}
+		for ii, f := range pr.files {
+			if f.Mode&0170000 != 0100000 {
+				continue
+			}
+			if name, ok := last[inodes[ii]]; ok {
+				noContent[name] = true
+			}
+			last[inodes[ii]] = f.Name
+		}
+	}
+	for {
+		f, err := pr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		d, err := newDigestHash(algo)
+		if err != nil {
+			return err
+		}
+		n, err := io.Copy(d, pr)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read file %s", f.Name)
+		}
+		if f.Mode&0170000 != 0100000 || f.Digest == "" || (noContent[f.Name] && n == 0) {
+			// Not a regular file, a ghost, or a hard link without the content.
+			continue
+		}
+		if n != f.Size {
+			return errors.Wrapf(ErrDigestMismatch, "file %s has %d bytes, the header has %d", f.Name, n, f.Size)
+		}
+		if got := fmt.Sprintf("%x", d.Sum(nil)); got != f.Digest {
+			return errors.Wrapf(ErrDigestMismatch, "file %s has digest %s, the header has %s", f.Name, got, f.Digest)
+		}
+	}
+	// The end of the uncompressed payload, after the trailer.
+	if _, err := io.Copy(ioutil.Discard, pr.r); err != nil {
+		return errors.Wrap(err, "failed to read payload")
+	}
+	return nil
+}
+
+// newDigestHash returns a hash for a PGPHASHALGO value of a digest tag.
+func newDigestHash(algo uint32) (hash.Hash, error) {
+	for _, d := range fileDigests {
+		if uint32(d.algo) == algo {
+			return d.hash.New(), nil
+		}
+	}
+	return nil, errors.Errorf("unknown digest algorithm %d", algo)
+}
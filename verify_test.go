@@ -0,0 +1,313 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"crypto"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/openpgp"
+	pgperrors "golang.org/x/crypto/openpgp/errors"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func newTestEntity(t *testing.T, name string) *openpgp.Entity {
+	t.Helper()
+	e, err := openpgp.NewEntity(name, "", name+"@example.com", nil)
+	if err != nil {
+		t.Fatalf("openpgp.NewEntity returned error %v", err)
+	}
+	return e
+}
+
+func detachSign(e *openpgp.Entity, b []byte) ([]byte, error) {
+	sig := &bytes.Buffer{}
+	if err := openpgp.DetachSign(sig, e, bytes.NewReader(b), nil); err != nil {
+		return nil, err
+	}
+	return sig.Bytes(), nil
+}
+
+// signHeader adds a header-only RSAHEADER signature by e to the rpm file b.
+func signHeader(t *testing.T, b []byte, e *openpgp.Entity) []byte {
+	t.Helper()
+	rd := bytes.NewReader(b[0x60:])
+	s, err := readSignatures(rd)
+	if err != nil {
+		t.Fatalf("readSignatures returned error %v", err)
+	}
+	hb := &bytes.Buffer{}
+	if _, _, err := readIndex(io.TeeReader(rd, hb)); err != nil {
+		t.Fatalf("readIndex returned error %v", err)
+	}
+	sig, err := detachSign(e, hb.Bytes())
+	if err != nil {
+		t.Fatalf("failed to sign header: %v", err)
+	}
+	s.Add(sigRSA, EntryBytes(sig))
+	sb, err := s.Bytes()
+	if err != nil {
+		t.Fatalf("s.Bytes() returned error %v", err)
+	}
+	out := append([]byte{}, b[:0x60]...)
+	out = append(out, sb...)
+	out = append(out, signaturePadding(len(sb))...)
+	out = append(out, hb.Bytes()...)
+	return append(out, b[len(b)-rd.Len():]...)
+}
+
+func TestVerifySignature(t *testing.T) {
+	signer := newTestEntity(t, "signer")
+	other := newTestEntity(t, "other")
+	build := func(sign bool) []byte {
+		r, err := NewRPM(RPMMetaData{Name: "signed", Version: "1.0", Summary: "summary"})
+		if err != nil {
+			t.Fatalf("NewRPM returned error %v", err)
+		}
+		r.AddFile(RPMFile{Name: "/usr/share/signed/file", Body: []byte("content")})
+		if sign {
+			r.SetPGPSigner(func(b []byte) ([]byte, error) { return detachSign(signer, b) })
+		}
+		return buildRPM(t, r)
+	}
+	testCases := []struct {
+		name    string
+		rpm     []byte
+		keyring openpgp.EntityList
+		wantErr error
+	}{{
+		name:    "header and payload",
+		rpm:     build(true),
+		keyring: openpgp.EntityList{other, signer},
+	}, {
+		name:    "header only",
+		rpm:     signHeader(t, build(false), signer),
+		keyring: openpgp.EntityList{signer},
+	}, {
+		name:    "both",
+		rpm:     signHeader(t, build(true), signer),
+		keyring: openpgp.EntityList{signer},
+	}, {
+		name:    "wrong key",
+		rpm:     build(true),
+		keyring: openpgp.EntityList{other},
+		wantErr: pgperrors.ErrUnknownIssuer,
+	}, {
+		name:    "wrong header key",
+		rpm:     signHeader(t, build(false), other),
+		keyring: openpgp.EntityList{signer},
+		wantErr: pgperrors.ErrUnknownIssuer,
+	}, {
+		name:    "unsigned",
+		rpm:     build(false),
+		keyring: openpgp.EntityList{signer},
+		wantErr: ErrNoSignature,
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			keyID, err := VerifySignature(bytes.NewReader(tc.rpm), tc.keyring)
+			if errors.Cause(err) != tc.wantErr {
+				t.Fatalf("VerifySignature returned error %v, want %v", err, tc.wantErr)
+			}
+			if err == nil && keyID != signer.PrimaryKey.KeyId {
+				t.Errorf("VerifySignature() = %x, want %x", keyID, signer.PrimaryKey.KeyId)
+			}
+		})
+	}
+}
+
+func TestVerifySignatureSubkey(t *testing.T) {
+	signer := newTestEntity(t, "signer")
+	// The key of another entity, as a signing subkey of signer.
+	sub := newTestEntity(t, "sub")
+	signer.Subkeys = append(signer.Subkeys, openpgp.Subkey{
+		PublicKey:  sub.PrimaryKey,
+		PrivateKey: sub.PrivateKey,
+		Sig: &packet.Signature{
+			SigType:      packet.SigTypeSubkeyBinding,
+			CreationTime: sub.PrimaryKey.CreationTime,
+			FlagsValid:   true,
+			FlagSign:     true,
+			IssuerKeyId:  &signer.PrimaryKey.KeyId,
+		},
+	})
+	r, err := NewRPM(RPMMetaData{Name: "signed", Version: "1.0", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/share/signed/file", Body: []byte("content")})
+	// openpgp.DetachSign only signs with the primary key.
+	r.SetPGPSigner(func(b []byte) ([]byte, error) {
+		sig := &packet.Signature{
+			SigType:      packet.SigTypeBinary,
+			PubKeyAlgo:   sub.PrivateKey.PubKeyAlgo,
+			Hash:         crypto.SHA256,
+			CreationTime: time.Now(),
+			IssuerKeyId:  &sub.PrivateKey.KeyId,
+		}
+		h := sig.Hash.New()
+		h.Write(b)
+		if err := sig.Sign(h, sub.PrivateKey, nil); err != nil {
+			return nil, err
+		}
+		out := &bytes.Buffer{}
+		if err := sig.Serialize(out); err != nil {
+			return nil, err
+		}
+		return out.Bytes(), nil
+	})
+	keyID, err := VerifySignature(bytes.NewReader(buildRPM(t, r)), openpgp.EntityList{signer})
+	if err != nil {
+		t.Fatalf("VerifySignature returned error %v", err)
+	}
+	if keyID != sub.PrimaryKey.KeyId {
+		t.Errorf("VerifySignature() = %x, want the subkey %x and not the primary key %x", keyID, sub.PrimaryKey.KeyId, signer.PrimaryKey.KeyId)
+	}
+}
+
+func TestVerifySignatureTamperedPayload(t *testing.T) {
+	signer := newTestEntity(t, "signer")
+	r, err := NewRPM(RPMMetaData{Name: "signed", Version: "1.0", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	r.SetPGPSigner(func(b []byte) ([]byte, error) { return detachSign(signer, b) })
+	b := buildRPM(t, r)
+	b[len(b)-1] ^= 0xff
+	if _, err := VerifySignature(bytes.NewReader(b), openpgp.EntityList{signer}); err == nil {
+		t.Error("VerifySignature of a tampered payload should return an error")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	signer := newTestEntity(t, "signer")
+	build := func(compressor string, sign bool) []byte {
+		r, err := NewRPM(RPMMetaData{Name: "verified", Version: "1.0", Summary: "summary", Compressor: compressor})
+		if err != nil {
+			t.Fatalf("NewRPM returned error %v", err)
+		}
+		r.AddFile(RPMFile{Name: "/usr/share/verified/file", Body: []byte("content"), Mode: 0644})
+		r.AddFile(RPMFile{Name: "/usr/share/verified/dir", Mode: 040755})
+		r.AddFile(RPMFile{Name: "/usr/share/verified/link", Body: []byte("file"), Mode: 0120777})
+		if sign {
+			r.SetPGPSigner(func(b []byte) ([]byte, error) { return detachSign(signer, b) })
+		}
+		return buildRPM(t, r)
+	}
+	replace := func(b []byte, old, new string) []byte {
+		if !bytes.Contains(b, []byte(old)) {
+			t.Fatalf("rpm file does not contain %q", old)
+		}
+		return bytes.Replace(b, []byte(old), []byte(new), 1)
+	}
+	testCases := []struct {
+		name    string
+		rpm     []byte
+		keyring openpgp.EntityList
+		wantErr error
+	}{{
+		name: "gzip",
+		rpm:  build("gzip", false),
+	}, {
+		name: "xz",
+		rpm:  build("xz", false),
+	}, {
+		name: "zstd",
+		rpm:  build("zstd", false),
+	}, {
+		name: "none",
+		rpm:  build("none", false),
+	}, {
+		name:    "signed",
+		rpm:     signHeader(t, build("gzip", true), signer),
+		keyring: openpgp.EntityList{signer},
+	}, {
+		name: "signed without keyring",
+		rpm:  build("gzip", true),
+	}, {
+		name:    "unsigned with keyring",
+		rpm:     build("gzip", false),
+		keyring: openpgp.EntityList{signer},
+		wantErr: ErrNoSignature,
+	}, {
+		name: "hard links",
+		rpm: func() []byte {
+			r, err := NewRPM(RPMMetaData{Name: "verified", Version: "1.0", Summary: "summary"})
+			if err != nil {
+				t.Fatalf("NewRPM returned error %v", err)
+			}
+			r.AddFile(RPMFile{Name: "/usr/share/verified/a", Body: []byte("content"), Mode: 0644})
+			for _, name := range []string{"/usr/share/verified/b", "/usr/share/verified/c"} {
+				if err := r.AddHardlink(name, "/usr/share/verified/a"); err != nil {
+					t.Fatalf("AddHardlink returned error %v", err)
+				}
+			}
+			return buildRPM(t, r)
+		}(),
+	}, {
+		name:    "tampered header",
+		rpm:     replace(build("gzip", false), "summary", "SUMMARY"),
+		wantErr: ErrDigestMismatch,
+	}, {
+		name:    "tampered file",
+		rpm:     replace(build("none", false), "content", "CONTENT"),
+		wantErr: ErrDigestMismatch,
+	}, {
+		name:    "tampered signed file",
+		rpm:     replace(build("none", true), "content", "CONTENT"),
+		keyring: openpgp.EntityList{signer},
+		wantErr: ErrDigestMismatch,
+	}}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var keyring openpgp.KeyRing
+			if tc.keyring != nil {
+				keyring = tc.keyring
+			}
+			if err := Verify(bytes.NewReader(tc.rpm), keyring); errors.Cause(err) != tc.wantErr {
+				t.Errorf("Verify returned error %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyPayloadEmptiedFile(t *testing.T) {
+	build := func(body string) []byte {
+		r, err := NewRPM(RPMMetaData{Name: "verified", Version: "1.0", Summary: "summary", Compressor: "none"})
+		if err != nil {
+			t.Fatalf("NewRPM returned error %v", err)
+		}
+		r.AddFile(RPMFile{Name: "/usr/share/verified/file", Body: []byte(body), Mode: 0644})
+		return buildRPM(t, r)
+	}
+	p, err := ReadPackage(bytes.NewReader(build("content")))
+	if err != nil {
+		t.Fatalf("ReadPackage returned error %v", err)
+	}
+	// The payload of the same file, emptied.
+	emptied := bytes.NewReader(build(""))
+	if _, err := ReadPackage(emptied); err != nil {
+		t.Fatalf("ReadPackage returned error %v", err)
+	}
+	if err := verifyPayload(p, emptied, nil); errors.Cause(err) != ErrDigestMismatch {
+		t.Errorf("verifyPayload of an emptied file returned error %v, want %v", err, ErrDigestMismatch)
+	}
+}
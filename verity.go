@@ -0,0 +1,228 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// FS_VERITY_HASH_ALG_SHA256, the only fs-verity hash rpmpack supports.
+	verityHashSHA256 = 1
+	verityBlockSize  = 4096
+)
+
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidRSAEncryption = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidECDSAWithSHA2 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+)
+
+// SetVeritySigner signs the fs-verity digest of every regular file with key,
+// and stores the signatures in the VERITYSIGNATURES signature tag, as rpmsign
+// --signverity does. rpm 4.17+ enables fs-verity on the installed files with
+// them. cert is the certificate of key, which has to be loaded in the
+// .fs-verity kernel keyring. Only RSA and ECDSA keys are supported.
+// The fs-verity digests use SHA256 and 4096 byte blocks, without salt.
+func (r *RPM) SetVeritySigner(key crypto.Signer, cert *x509.Certificate) error {
+	switch key.Public().(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return errors.Errorf("unsupported key type %T", key.Public())
+	}
+	r.veritySigner = key
+	r.verityCert = cert
+	return nil
+}
+
+// writeVeritySignature adds the fs-verity signature of a file from the
+// hasher its content was written to, or an empty one if the file is not
+// signed, to keep the file arrays aligned.
+func (r *RPM) writeVeritySignature(v *verityHasher, regular bool) error {
+	if r.veritySigner == nil {
+		return nil
+	}
+	if !regular {
+		r.veritysignatures = append(r.veritysignatures, "")
+		return nil
+	}
+	sig, err := r.veritySign(v.Sum())
+	if err != nil {
+		return errors.Wrap(err, "failed to create fs-verity signature")
+	}
+	r.veritysignatures = append(r.veritysignatures, base64.StdEncoding.EncodeToString(sig))
+	return nil
+}
+
+func (r *RPM) writeVeritySignatureIndexes(sigHeader *index) {
+	if r.veritySigner == nil || len(r.veritysignatures) == 0 {
+		return
+	}
+	sigHeader.Add(sigVeritySignatures, EntryStringSlice(r.veritysignatures))
+	sigHeader.Add(sigVeritySignatureAlgo, EntryUint32([]uint32{verityHashSHA256}))
+}
+
+// verityHasher computes the fs-verity file digest of the content written to
+// it: the digest of the fsverity_descriptor holding the root hash of the
+// Merkle tree of the file. Only the digests of the data blocks are kept.
+type verityHasher struct {
+	block  []byte
+	level  []byte
+	length uint64
+}
+
+func (v *verityHasher) Write(p []byte) (int, error) {
+	n := len(p)
+	v.length += uint64(n)
+	for len(p) > 0 {
+		m := verityBlockSize - len(v.block)
+		if m > len(p) {
+			m = len(p)
+		}
+		v.block = append(v.block, p[:m]...)
+		p = p[m:]
+		if len(v.block) == verityBlockSize {
+			s := sha256.Sum256(v.block)
+			v.level = append(v.level, s[:]...)
+			v.block = v.block[:0]
+		}
+	}
+	return n, nil
+}
+
+// Sum returns the fs-verity digest of the content written so far.
+func (v *verityHasher) Sum() []byte {
+	level := v.level
+	if len(v.block) > 0 {
+		level = append(level[:len(level):len(level)], verityLevel(v.block)...)
+	}
+	var root [sha256.Size]byte
+	if v.length > 0 {
+		for len(level) > sha256.Size {
+			level = verityLevel(level)
+		}
+		copy(root[:], level)
+	}
+	// struct fsverity_descriptor
+	d := &bytes.Buffer{}
+	d.Write([]byte{1, verityHashSHA256, 12, 0})
+	d.Write(make([]byte, 4))
+	binary.Write(d, binary.LittleEndian, v.length)
+	d.Write(root[:])
+	d.Write(make([]byte, 64-sha256.Size+32+144))
+	s := sha256.Sum256(d.Bytes())
+	return s[:]
+}
+
+// verityDigest returns the fs-verity file digest of body.
+func verityDigest(body []byte) []byte {
+	v := &verityHasher{}
+	v.Write(body)
+	return v.Sum()
+}
+
+// verityLevel returns the concatenated digests of the zero padded blocks of b.
+func verityLevel(b []byte) []byte {
+	out := []byte{}
+	for i := 0; i < len(b); i += verityBlockSize {
+		block := make([]byte, verityBlockSize)
+		copy(block, b[i:])
+		s := sha256.Sum256(block)
+		out = append(out, s[:]...)
+	}
+	return out
+}
+
+type issuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type signerInfo struct {
+	Version            int
+	IssuerAndSerial    issuerAndSerial
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      contentInfo
+	SignerInfos      []signerInfo `asn1:"set"`
+}
+
+type pkcs7 struct {
+	ContentType asn1.ObjectIdentifier
+	Content     signedData `asn1:"explicit,tag:0"`
+}
+
+// veritySign returns the detached PKCS#7 signature of the fs-verity digest d,
+// the way libfsverity signs it: over the fsverity_formatted_digest, without
+// certificates nor signed attributes.
+func (r *RPM) veritySign(d []byte) ([]byte, error) {
+	msg := &bytes.Buffer{}
+	msg.WriteString("FSVerity")
+	binary.Write(msg, binary.LittleEndian, []uint16{verityHashSHA256, uint16(len(d))})
+	msg.Write(d)
+	h := sha256.Sum256(msg.Bytes())
+	sig, err := r.veritySigner.Sign(rand.Reader, h[:], crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	sigAlgo := pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue}
+	if _, ok := r.veritySigner.Public().(*ecdsa.PublicKey); ok {
+		sigAlgo = pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA2}
+	}
+	sha256Algo := pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue}
+	return asn1.Marshal(pkcs7{
+		ContentType: oidSignedData,
+		Content: signedData{
+			Version:          1,
+			DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256Algo},
+			ContentInfo:      contentInfo{ContentType: oidData},
+			SignerInfos: []signerInfo{{
+				Version: 1,
+				IssuerAndSerial: issuerAndSerial{
+					Issuer: asn1.RawValue{FullBytes: r.verityCert.RawIssuer},
+					Serial: r.verityCert.SerialNumber,
+				},
+				DigestAlgorithm:    sha256Algo,
+				SignatureAlgorithm: sigAlgo,
+				Signature:          sig,
+			}},
+		},
+	})
+}
@@ -0,0 +1,139 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func newVerityCert(t *testing.T, key *rsa.PrivateKey) *x509.Certificate {
+	t.Helper()
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "fs-verity test"},
+		NotBefore:    time.Unix(0, 0),
+		NotAfter:     time.Unix(0, 0).AddDate(100, 0, 0),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("x509.CreateCertificate returned error %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("x509.ParseCertificate returned error %v", err)
+	}
+	return cert
+}
+
+func TestVerityDigest(t *testing.T) {
+	block := func(b []byte) []byte {
+		p := make([]byte, verityBlockSize)
+		copy(p, b)
+		s := sha256.Sum256(p)
+		return s[:]
+	}
+	long := bytes.Repeat([]byte{'a'}, 2*verityBlockSize+1)
+	for _, tc := range []struct {
+		name string
+		body []byte
+		root []byte
+	}{
+		{"empty", nil, make([]byte, sha256.Size)},
+		{"one block", []byte("hello"), block([]byte("hello"))},
+		{"three blocks", long, block(bytes.Join([][]byte{
+			block(long[:verityBlockSize]),
+			block(long[verityBlockSize : 2*verityBlockSize]),
+			block(long[2*verityBlockSize:]),
+		}, nil))},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := make([]byte, 256)
+			copy(d, []byte{1, 1, 12, 0})
+			binary.LittleEndian.PutUint64(d[8:], uint64(len(tc.body)))
+			copy(d[16:], tc.root)
+			want := sha256.Sum256(d)
+			if got := verityDigest(tc.body); !bytes.Equal(got, want[:]) {
+				t.Errorf("verityDigest() = %x, want %x", got, want)
+			}
+		})
+	}
+}
+
+func TestVeritySignatures(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey returned error %v", err)
+	}
+	cert := newVerityCert(t, key)
+	r, err := NewRPM(RPMMetaData{Name: "verity", Version: "1.0", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	if err := r.SetVeritySigner(key, cert); err != nil {
+		t.Fatalf("SetVeritySigner returned error %v", err)
+	}
+	r.AddFile(RPMFile{Name: "/usr/bin/verity", Body: []byte("binary"), Mode: 0755})
+	r.AddFile(RPMFile{Name: "/usr/lib/verity", Mode: 040755})
+	b := buildRPM(t, r)
+	if _, err := readLead(bytes.NewReader(b[:0x60])); err != nil {
+		t.Fatalf("readLead returned error %v", err)
+	}
+	s, err := readSignatures(bytes.NewReader(b[0x60:]))
+	if err != nil {
+		t.Fatalf("readSignatures returned error %v", err)
+	}
+	if got := s.getUint32s(sigVeritySignatureAlgo); len(got) != 1 || got[0] != verityHashSHA256 {
+		t.Errorf("verity signature algo = %v, want [1]", got)
+	}
+	sigs := s.getStrings(sigVeritySignatures)
+	if len(sigs) != 2 {
+		t.Fatalf("got %d verity signatures, want 2", len(sigs))
+	}
+	if sigs[1] != "" {
+		t.Errorf("directory signature = %q, want empty", sigs[1])
+	}
+	der, err := base64.StdEncoding.DecodeString(sigs[0])
+	if err != nil {
+		t.Fatalf("verity signature %q is not base64: %v", sigs[0], err)
+	}
+	var p pkcs7
+	if _, err := asn1.Unmarshal(der, &p); err != nil {
+		t.Fatalf("verity signature is not PKCS#7: %v", err)
+	}
+	if !p.ContentType.Equal(oidSignedData) || len(p.Content.SignerInfos) != 1 {
+		t.Fatalf("unexpected PKCS#7 %+v", p)
+	}
+	si := p.Content.SignerInfos[0]
+	if si.IssuerAndSerial.Serial.Cmp(cert.SerialNumber) != 0 || !bytes.Equal(si.IssuerAndSerial.Issuer.FullBytes, cert.RawIssuer) {
+		t.Errorf("signer %+v does not match the certificate", si.IssuerAndSerial)
+	}
+	msg := append([]byte("FSVerity\x01\x00\x20\x00"), verityDigest([]byte("binary"))...)
+	h := sha256.Sum256(msg)
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, h[:], si.Signature); err != nil {
+		t.Errorf("verity signature does not verify: %v", err)
+	}
+}
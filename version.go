@@ -0,0 +1,204 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// validateName checks a Name value with the rules of rpmbuild: ASCII letters
+// and digits, and "._+-", starting with a letter, a digit or '_'.
+func validateName(n string) error {
+	return checkChars("name", n, "._+-")
+}
+
+// validateVersion checks a Version or Release value.
+// '-' separates version from release, so it cannot be part of either of them.
+// '~' (sorts before, as in 1.0~rc1) and '^' (sorts after, as in 1.0^git1) are allowed,
+// they require rpm 4.10 and 4.15 respectively.
+func validateVersion(field, v string) error {
+	return checkChars(field, v, "._+~^")
+}
+
+// checkChars checks that v only has ASCII letters and digits and the
+// characters of extra, starts with a letter, a digit or '_', and has no "..",
+// like rpmCharCheck of rpmbuild. rpmbuild also allows the characters of
+// macros, "%{}", which rpmpack does not expand.
+func checkChars(field, v, extra string) error {
+	for i, c := range v {
+		if c < 0x80 && isAlnum(byte(c)) || c == '_' {
+			continue
+		}
+		if !strings.ContainsRune(extra, c) {
+			return errors.Errorf("invalid %s %q: character %q is not allowed", field, v, c)
+		}
+		if i == 0 {
+			return errors.Errorf("invalid %s %q: it cannot start with %q", field, v, c)
+		}
+	}
+	if strings.Contains(v, "..") {
+		return errors.Errorf("invalid %s %q: \"..\" is not allowed", field, v)
+	}
+	return nil
+}
+
+// SnapshotRelease returns the release of a snapshot build following the Fedora
+// convention for pre-release snapshots, "<base>.<YYYYMMDD>git<shortcommit>",
+// for example "0.20240101git1a2b3c4". base is the release counter, usually "0"
+// so that the final release "1" sorts after all the snapshots. The date is the
+// UTC date of t, and the commit is shortened to 7 characters.
+// A dist tag like ".fc40" can be appended to the result.
+func SnapshotRelease(base string, t time.Time, commit string) (string, error) {
+	if base == "" {
+		return "", errors.New("invalid snapshot release: empty base")
+	}
+	if len(commit) < 7 {
+		return "", errors.Errorf("invalid snapshot commit %q: want at least 7 hex digits", commit)
+	}
+	for _, c := range commit {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return "", errors.Errorf("invalid snapshot commit %q: want hex digits", commit)
+		}
+	}
+	rel := fmt.Sprintf("%s.%sgit%s", base, t.UTC().Format("20060102"), strings.ToLower(commit[:7]))
+	if err := validateVersion("release", rel); err != nil {
+		return "", err
+	}
+	return rel, nil
+}
+
+// VersionCompare compares two version (or release) strings the way rpm does,
+// and returns -1 if a is older than b, 0 if they are the same version and 1
+// if a is newer. Alphabetic and numeric segments are compared in order, a
+// numeric one being newer, and the separators between them are ignored.
+// '~' sorts before everything, even the end of the string, and '^' sorts
+// after the end of the string, but before anything else.
+// It is a port of rpmvercmp from rpm's rpmio/rpmvercmp.c.
+func VersionCompare(a, b string) int {
+	if a == b {
+		return 0
+	}
+	isSep := func(c byte) bool {
+		return !isAlnum(c) && c != '~' && c != '^'
+	}
+	for len(a) > 0 || len(b) > 0 {
+		for len(a) > 0 && isSep(a[0]) {
+			a = a[1:]
+		}
+		for len(b) > 0 && isSep(b[0]) {
+			b = b[1:]
+		}
+
+		// A tilde sorts before everything else, even the end of the string.
+		if strings.HasPrefix(a, "~") || strings.HasPrefix(b, "~") {
+			if !strings.HasPrefix(a, "~") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "~") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+
+		// A caret sorts after the end of the string, but before anything else.
+		if strings.HasPrefix(a, "^") || strings.HasPrefix(b, "^") {
+			if len(a) == 0 {
+				return -1
+			}
+			if len(b) == 0 {
+				return 1
+			}
+			if !strings.HasPrefix(a, "^") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "^") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+
+		if len(a) == 0 || len(b) == 0 {
+			break
+		}
+
+		// Grab the first completely alpha or completely numeric segment of both.
+		isnum := isDigit(a[0])
+		span := isAlpha
+		if isnum {
+			span = isDigit
+		}
+		na, nb := segmentLen(a, span), segmentLen(b, span)
+		segA, segB := a[:na], b[:nb]
+		a, b = a[na:], b[nb:]
+
+		// Segments of different types: numeric segments are newer than alpha ones.
+		if nb == 0 {
+			if isnum {
+				return 1
+			}
+			return -1
+		}
+
+		if isnum {
+			segA = strings.TrimLeft(segA, "0")
+			segB = strings.TrimLeft(segB, "0")
+			// The longer number is the larger one.
+			if len(segA) != len(segB) {
+				if len(segA) > len(segB) {
+					return 1
+				}
+				return -1
+			}
+		}
+		if c := strings.Compare(segA, segB); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case len(a) == 0 && len(b) == 0:
+		return 0
+	case len(a) == 0:
+		return -1
+	default:
+		return 1
+	}
+}
+
+func segmentLen(s string, f func(byte) bool) int {
+	n := 0
+	for n < len(s) && f(s[n]) {
+		n++
+	}
+	return n
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isAlnum(c byte) bool {
+	return isDigit(c) || isAlpha(c)
+}
@@ -0,0 +1,173 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateVersion(t *testing.T) {
+	testCases := []struct {
+		version     string
+		errExpected bool
+	}{
+		{version: ""},
+		{version: "1.0"},
+		{version: "1.0~rc1"},
+		{version: "1.0^git20200101"},
+		{version: "2.fc32_1+b"},
+		{version: "1.0-1", errExpected: true},
+		{version: "1.0 rc1", errExpected: true},
+		{version: "1.0\t", errExpected: true},
+		{version: "_1.0"},
+		{version: "~1.0", errExpected: true},
+		{version: "1..0", errExpected: true},
+		{version: "1.0:1", errExpected: true},
+		{version: "1.0/1", errExpected: true},
+		{version: "1.0%{dist}", errExpected: true},
+		{version: "1.0é", errExpected: true},
+	}
+	for _, tc := range testCases {
+		err := validateVersion("version", tc.version)
+		if got := err != nil; got != tc.errExpected {
+			t.Errorf("validateVersion(%q) returned error %v, want error: %t", tc.version, err, tc.errExpected)
+		}
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		wantErr bool
+	}{
+		{name: ""},
+		{name: "rpmpack"},
+		{name: "python3-foo_bar"},
+		{name: "libstdc++"},
+		{name: "_private.pkg"},
+		{name: "-rpmpack", wantErr: true},
+		{name: ".rpmpack", wantErr: true},
+		{name: "rpm pack", wantErr: true},
+		{name: "rpm/pack", wantErr: true},
+		{name: "rpm..pack", wantErr: true},
+		{name: "rpm:pack", wantErr: true},
+	} {
+		if err := validateName(tc.name); (err != nil) != tc.wantErr {
+			t.Errorf("validateName(%q) returned error %v, want error: %t", tc.name, err, tc.wantErr)
+		}
+	}
+}
+
+func TestNewRPMVersionValidation(t *testing.T) {
+	r, err := NewRPM(RPMMetaData{Name: "test", Version: "1.0~rc1", Release: "0.1^git", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error for tilde and caret: %v", err)
+	}
+	if got, want := r.Provides.String(), "test=1.0~rc1-0.1^git"; got != want {
+		t.Errorf("self provide = %s, want %s", got, want)
+	}
+	if _, err := NewRPM(RPMMetaData{Name: "test", Version: "1.0-1", Summary: "summary"}); err == nil {
+		t.Errorf("NewRPM should reject a dash in the version")
+	}
+	if _, err := NewRPM(RPMMetaData{Name: "test", Version: "1.0", Release: "1 2", Summary: "summary"}); err == nil {
+		t.Errorf("NewRPM should reject whitespace in the release")
+	}
+	if _, err := NewRPM(RPMMetaData{Name: "my package", Version: "1.0", Summary: "summary"}); err == nil {
+		t.Errorf("NewRPM should reject whitespace in the name")
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	// Test cases from rpm's tests/rpmvercmp.at
+	testCases := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "2.0", -1},
+		{"2.0", "1.0", 1},
+		{"2.0.1", "2.0.1", 0},
+		{"2.0", "2.0.1", -1},
+		{"2.0.1a", "2.0.1", 1},
+		{"5.5p1", "5.5p2", -1},
+		{"5.5p10", "5.5p1", 1},
+		{"10xyz", "10.1xyz", -1},
+		{"xyz10", "xyz10.1", -1},
+		{"xyz.4", "8", -1},
+		{"8", "xyz.4", 1},
+		{"1.0aa", "1.0a", 1},
+		{"1.0010", "1.9", 1},
+		{"1.05", "1.5", 0},
+		{"2_0", "2.0", 0},
+		{"6.0.rc1", "6.0", 1},
+		{"10b2", "10a1", 1},
+		{"1b.fc17", "1.fc17", -1},
+		{"1.fc17", "1b.fc17", 1},
+		{"1g.fc17", "1.fc17", 1},
+		{"1.fc17", "1g.fc17", -1},
+		{"2a", "2.0", -1},
+		{"1.0", "1.0.0", -1},
+		{"1.0~rc1", "1.0~rc1", 0},
+		{"1.0~~", "1.0~", -1},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0", "1.0~rc1", 1},
+		{"1.0~rc1", "1.0~rc2", -1},
+		{"1.0~rc1~git123", "1.0~rc1", -1},
+		{"1.0^", "1.0", 1},
+		{"1.0^git1", "1.0", 1},
+		{"1.0^git1", "1.01", -1},
+		{"1.0^git1", "1.0^git2", -1},
+		{"1.0^git1", "1.0~rc1", 1},
+		{"1.0^git1~pre", "1.0^git1", -1},
+	}
+	for _, tc := range testCases {
+		if got := VersionCompare(tc.a, tc.b); got != tc.want {
+			t.Errorf("VersionCompare(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestSnapshotRelease(t *testing.T) {
+	day := time.Date(2024, 1, 1, 23, 30, 0, 0, time.FixedZone("west", -3600))
+	testCases := []struct {
+		base, commit string
+		want         string
+		wantErr      bool
+	}{
+		{base: "0", commit: "1A2B3C4D5E6F", want: "0.20240102git1a2b3c4"},
+		{base: "0.1", commit: "1a2b3c4", want: "0.1.20240102git1a2b3c4"},
+		{base: "", commit: "1a2b3c4", wantErr: true},
+		{base: "0", commit: "1a2b3c", wantErr: true},
+		{base: "0", commit: "1a2b3c4-dirty", wantErr: true},
+		{base: "0-1", commit: "1a2b3c4", wantErr: true},
+	}
+	for _, tc := range testCases {
+		got, err := SnapshotRelease(tc.base, day, tc.commit)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("SnapshotRelease(%q, %q) returned error %v, want error %t", tc.base, tc.commit, err, tc.wantErr)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("SnapshotRelease(%q, %q) = %q, want %q", tc.base, tc.commit, got, tc.want)
+		}
+	}
+	// Snapshots sort before the final release, and by date.
+	older, _ := SnapshotRelease("0", day.AddDate(0, 0, -1), "fffffff")
+	newer, _ := SnapshotRelease("0", day, "0000000")
+	if VersionCompare(older, newer) != -1 || VersionCompare(newer, "1") != -1 {
+		t.Errorf("snapshot releases %q, %q, %q do not sort in order", older, newer, "1")
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"archive/zip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/pkg/errors"
+)
+
+// AddZip adds the directories, files and symlinks of a zip archive under the
+// directory prefix, with the modes stored in the external attributes of the
+// entries. Entries without unix modes, as created on Windows, get 0755 for
+// directories and 0644 for files. The files belong to root, and are
+// decompressed by Write.
+func (r *RPM) AddZip(z *zip.Reader, prefix string) error {
+	for _, zf := range z.File {
+		zf := zf
+		mode := zf.Mode()
+		// Only zip files created on unix and macOS store unix modes.
+		creator := zf.CreatorVersion >> 8
+		unixModes := creator == 3 || creator == 19
+		f := RPMFile{
+			Name:  path.Join(prefix, "/", zf.Name),
+			Mode:  uint(mode.Perm()),
+			Owner: "root",
+			Group: "root",
+			MTime: uint32(zf.Modified.Unix()),
+		}
+		if zf.Modified.IsZero() {
+			f.MTime = uint32(zf.ModTime().Unix())
+		}
+		switch {
+		case mode.IsDir():
+			if f.Mode == 0 || !unixModes {
+				f.Mode = 0755
+			}
+			f.Mode |= 040000
+		case mode&os.ModeSymlink != 0:
+			rc, err := zf.Open()
+			if err != nil {
+				return errors.Wrapf(err, "failed to open %q", zf.Name)
+			}
+			target, err := ioutil.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return errors.Wrapf(err, "failed to read symlink %q", zf.Name)
+			}
+			f.Mode = 0120777
+			f.Body = target
+		case mode.IsRegular():
+			if !unixModes {
+				f.Mode = 0644
+			}
+			f.Mode |= 0100000
+			f.Reader = &lazyReader{open: func() (io.ReadCloser, error) { return zf.Open() }}
+			f.Size = int64(zf.UncompressedSize64)
+		default:
+			return errors.Errorf("unsupported file type %s of %q", mode&os.ModeType, zf.Name)
+		}
+		if err := r.AddFile(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
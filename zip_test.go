@@ -0,0 +1,91 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpmpack
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAddZip(t *testing.T) {
+	b := &bytes.Buffer{}
+	zw := zip.NewWriter(b)
+	for _, e := range []struct {
+		name, content string
+		mode          os.FileMode
+	}{
+		{"app/", "", os.ModeDir | 0750},
+		{"app/run", "#!/bin/sh", 0755},
+		{"app/latest", "run", os.ModeSymlink | 0777},
+		{"README.txt", "read me", 0}, // no unix mode, as zipped on windows
+	} {
+		h := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		if e.mode != 0 {
+			h.SetMode(e.mode)
+		}
+		w, err := zw.CreateHeader(h)
+		if err != nil {
+			t.Fatalf("CreateHeader returned error %v", err)
+		}
+		w.Write([]byte(e.content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Close returned error %v", err)
+	}
+	z, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Fatalf("zip.NewReader returned error %v", err)
+	}
+
+	r, err := NewRPM(RPMMetaData{Name: "zip", Version: "1.0", Summary: "summary"})
+	if err != nil {
+		t.Fatalf("NewRPM returned error %v", err)
+	}
+	if err := r.AddZip(z, "/opt"); err != nil {
+		t.Fatalf("AddZip returned error %v", err)
+	}
+	info, err := ReadRPMInfo(bytes.NewReader(buildRPM(t, r)))
+	if err != nil {
+		t.Fatalf("ReadRPMInfo returned error %v", err)
+	}
+	type file struct {
+		Name   string
+		Mode   uint
+		Size   int64
+		LinkTo string
+	}
+	got := []file{}
+	for _, f := range info.Files {
+		got = append(got, file{f.Name, f.Mode, f.Size, f.LinkTo})
+	}
+	want := []file{
+		{"/opt/README.txt", 0100644, 7, ""},
+		{"/opt/app", 040750, 4096, ""},
+		{"/opt/app/latest", 0120777, 3, "run"},
+		{"/opt/app/run", 0100755, 9, ""},
+	}
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("AddZip files mismatch (-want +got):\n%s", d)
+	}
+	if got, want := info.Files[3].Digest, fmt.Sprintf("%x", sha256.Sum256([]byte("#!/bin/sh"))); got != want {
+		t.Errorf("digest of the zipped file = %s, want %s", got, want)
+	}
+}